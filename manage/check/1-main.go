@@ -0,0 +1,65 @@
+/*
+Vérification de la cohérence des données, en ligne de commande
+(mêmes règles que la page /coherence, cf src/model/coherence.go).
+
+Voir fichier README
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package main
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"fmt"
+	"os"
+)
+
+func main() {
+	regles := []*model.RegleCoherence{}
+	for _, code := range os.Args[1:] {
+		if code == "liste" {
+			for _, regle := range model.ReglesCoherence {
+				fmt.Printf("%-20s %s\n", regle.Code, regle.Label)
+			}
+			return
+		}
+		regle := model.GetRegleCoherence(code)
+		if regle == nil {
+			fmt.Println("Règle inconnue : " + code)
+			fmt.Println("Usage : go run *.go [liste | code-regle...]")
+			os.Exit(2)
+		}
+		regles = append(regles, regle)
+	}
+
+	model.MustLoadEnv()
+	ctxt.MustLoadConfig()
+	ctxt.MustInitDB()
+	ctx := ctxt.NewContext()
+
+	resultats, err := model.VerifierCoherence(ctx.DB, regles)
+	if err != nil {
+		panic(err)
+	}
+	for _, res := range resultats {
+		if len(res.Anomalies) == 0 {
+			fmt.Printf("OK     %s\n", res.Regle.Label)
+			continue
+		}
+		fmt.Printf("ERREUR %s : %d anomalie(s)\n", res.Regle.Label, len(res.Anomalies))
+		for _, a := range res.Anomalies {
+			fmt.Println("       - " + a.Message)
+			if a.URL != "" {
+				fmt.Println("         " + a.URL)
+			}
+		}
+	}
+	nb := model.NbAnomaliesCoherence(resultats)
+	fmt.Printf("%d anomalie(s)\n", nb)
+	if nb != 0 {
+		os.Exit(1)
+	}
+}
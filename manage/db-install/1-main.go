@@ -56,15 +56,19 @@ func init() {
 	possibleInstall := []string{
 		"all",
 		"acteur",
+		"audit",
+		"blocnotes",
 		"chantier",
 		"commune",
+		"facture",
+		"affacture",
 		"fermier",
 		"parcelle",
 		"recent",
 		"stockage",
-		"type",
 		"vente",
 		"ug",
+		"utilisateur",
 	}
 	errorMsg += "Valeurs possibles pour -i :\n  "
 	strInstall := strings.Join(possibleInstall, ", ")
@@ -115,7 +119,7 @@ func main() {
 			return
 		}
 		// check que le répertoire existe
-		dirCsv := install.GetSCTLDataDir(ctx, *flagSctlDataSource)
+		dirCsv := install.GetSCTLDataDir(*flagSctlDataSource)
 		_, err := os.Stat(dirCsv)
 		if os.IsNotExist(err) {
 			fmt.Println("REPERTOIRE SCTL INEXISTANT :", dirCsv)
@@ -151,7 +155,7 @@ func handleInstall(ctx *ctxt.Context) {
 					_, err = db.Exec(fmt.Sprintf(`set search_path='%s'`, ctx.Config.Database.Schema))
 		*/
 
-		installTypes(ctx)
+		installAudit(ctx) // en premier, car les fonctions Insert*() du model écrivent dans audit
 		installCommune(ctx)
 		installActeur(ctx)
 		installFermier(ctx)
@@ -160,9 +164,11 @@ func handleInstall(ctx *ctxt.Context) {
 		installStockage(ctx)
 		installChantier(ctx)
 		installVente(ctx)
+		installFacture(ctx)
+		installAffacture(ctx)
 		installRecent(ctx)
-	} else if *flagInstall == "type" {
-		installTypes(ctx)
+		installUtilisateur(ctx)
+		installBlocnotes(ctx)
 	} else if *flagInstall == "commune" {
 		installCommune(ctx)
 	} else if *flagInstall == "acteur" {
@@ -179,22 +185,22 @@ func handleInstall(ctx *ctxt.Context) {
 		installChantier(ctx)
 	} else if *flagInstall == "vente" {
 		installVente(ctx)
+	} else if *flagInstall == "facture" {
+		installFacture(ctx)
+	} else if *flagInstall == "affacture" {
+		installAffacture(ctx)
 	} else if *flagInstall == "recent" {
 		installRecent(ctx)
+	} else if *flagInstall == "utilisateur" {
+		installUtilisateur(ctx)
+	} else if *flagInstall == "audit" {
+		installAudit(ctx)
+	} else if *flagInstall == "blocnotes" {
+		installBlocnotes(ctx)
 	} else {
 		fmt.Println(errorMsg)
 	}
 }
-func installTypes(ctx *ctxt.Context) {
-	install.CreateTable(ctx, "typessence")
-	install.CreateTable(ctx, "typexploitation")
-	install.CreateTable(ctx, "typeop")
-	install.CreateTable(ctx, "typeunite")
-	install.CreateTable(ctx, "typevalorisation")
-	install.CreateTable(ctx, "typevente")
-	install.CreateTable(ctx, "typegranulo")
-	install.CreateTable(ctx, "typestockfrais")
-}
 func installCommune(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "commune")
 	install.CreateTable(ctx, "lieudit")
@@ -207,6 +213,7 @@ func installCommune(ctx *ctxt.Context) {
 }
 func installActeur(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "acteur")
+	install.CreateTable(ctx, "acteur_role")
 	install.AddActeursInitiaux(ctx)
 	install.AddActeursFromCSV(ctx)
 }
@@ -218,6 +225,7 @@ func installParcelle(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "parcelle")
 	install.CreateTable(ctx, "parcelle_lieudit")
 	install.CreateTable(ctx, "parcelle_fermier")
+	install.CreateTable(ctx, "parcelle_geom")
 	install.FillParcelle(ctx, *flagSctlDataSource)
 	install.FillLiensParcelleFermier(ctx, *flagSctlDataSource)
 	install.FillLiensParcelleLieudit(ctx, *flagSctlDataSource)
@@ -225,6 +233,7 @@ func installParcelle(ctx *ctxt.Context) {
 func installUG(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "ug")
 	install.CreateTable(ctx, "parcelle_ug")
+	install.CreateTable(ctx, "ug_essence")
 	install.FillUG(ctx)
 	install.FillLiensParcelleUG(ctx)
 }
@@ -233,33 +242,59 @@ func installStockage(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "stockfrais")
 	install.CreateTable(ctx, "plaq")
 	install.CreateTable(ctx, "tas")
+	install.CreateTable(ctx, "mouvementstock")
+	install.CreateTable(ctx, "inventaire")
+	install.CreateTable(ctx, "inventairetas")
 	install.CreateTable(ctx, "humid")
 	install.CreateTable(ctx, "humid_acteur")
 	install.FillHangarsInitiaux(ctx)
 }
 func installChantier(ctx *ctxt.Context) {
-	// liens pour plaq, chautre
+	// liens pour plaq, chautre, chaufer
 	install.CreateTable(ctx, "chantier_ug")
+	install.CreateTable(ctx, "chantier_parcelle")
 	install.CreateTable(ctx, "chantier_fermier")
 	install.CreateTable(ctx, "chantier_lieudit")
 	// plaquettes
 	install.CreateTable(ctx, "plaqop")
 	install.CreateTable(ctx, "plaqtrans")
 	install.CreateTable(ctx, "plaqrange")
+	install.CreateTable(ctx, "plaqtransfert")
 	// autres valorisations
 	install.CreateTable(ctx, "chautre")
 	// chauffage fermier
 	install.CreateTable(ctx, "chaufer")
-	install.CreateTable(ctx, "chaufer_parcelle")
 }
 func installVente(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "venteplaq")
 	install.CreateTable(ctx, "ventelivre")
 	install.CreateTable(ctx, "ventecharge")
 }
+func installFacture(ctx *ctxt.Context) {
+	install.CreateTable(ctx, "facturenum")
+	install.CreateTable(ctx, "facture")
+	install.CreateTable(ctx, "factureligne")
+	install.CreateTable(ctx, "facturepaiement")
+}
+func installAffacture(ctx *ctxt.Context) {
+	install.CreateTable(ctx, "affacturenum")
+	install.CreateTable(ctx, "affacture")
+	install.CreateTable(ctx, "affactureitem")
+}
 func installRecent(ctx *ctxt.Context) {
 	install.CreateTable(ctx, "recent")
 }
+func installUtilisateur(ctx *ctxt.Context) {
+	install.CreateTable(ctx, "utilisateur")
+	install.CreateTable(ctx, "session")
+	install.AddAdminInitial(ctx)
+}
+func installAudit(ctx *ctxt.Context) {
+	install.CreateTable(ctx, "audit")
+}
+func installBlocnotes(ctx *ctxt.Context) {
+	install.CreateTable(ctx, "blocnotes")
+}
 
 // *********************************************************
 func handleFixture(ctx *ctxt.Context) {
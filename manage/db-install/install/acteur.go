@@ -67,6 +67,7 @@ func addActeurSCTL(ctx *ctxt.Context) {
 	if err != nil {
 		panic(err)
 	}
+	addRoleActeur(ctx, id, "DIV-PF")
 	fmt.Printf("Crée acteur SCTL, id = %d\n", id)
 }
 
@@ -118,6 +119,7 @@ func addActeurBDL(ctx *ctxt.Context) {
 	if err != nil {
 		panic(err)
 	}
+	addRoleActeur(ctx, id, "DIV-FO")
 	fmt.Printf("Crée acteur BDL, id = %d\n", id)
 }
 
@@ -142,9 +144,19 @@ func addActeurGFA(ctx *ctxt.Context) {
 	if err != nil {
 		panic(err)
 	}
+	addRoleActeur(ctx, id, "DIV-PF")
 	fmt.Printf("Crée acteur GFA, id = %d\n", id)
 }
 
+// *********************************************************
+// Rôles des acteurs initiaux, cf manage/db-migrate/2023-06-21-ajout-roles.go
+func addRoleActeur(ctx *ctxt.Context, idActeur int, codeRole string) {
+	_, err := ctx.DB.Exec("insert into acteur_role(id_acteur,code_role) values($1,$2)", idActeur, codeRole)
+	if err != nil {
+		panic(err)
+	}
+}
+
 // *********************************************************
 // Ajoute les acteurs saisis dans un fichier csv de Bastien
 // pour importer les acteurs de BDL au moment du démarrage de la base
@@ -26,9 +26,7 @@ import (
 // A la différence des autres données venant de la SCTL,
 // commune.csv est versionné (car modifié, ajout de colonne nom_court)
 //
-// Note : La base initiale ne contient pas code insee
-//
-//	Voir manage/db-migrate/2023-01-16-fix-parcelle.go
+// Code insee ajouté par manage/db-migrate/2023-01-16-fix-parcelle.go
 func FillCommune(ctx *ctxt.Context) {
 	fmt.Println("Remplit table commune à partir de commune.csv")
 	dirCsv := GetDataDir()
@@ -39,9 +37,9 @@ func FillCommune(ctx *ctxt.Context) {
 	if err != nil {
 		panic(err)
 	}
-	stmt, err := db.Prepare("insert into commune(id,nom,nomcourt) values($1, $2, $3)")
+	stmt, err := db.Prepare("insert into commune(id,nom,nomcourt,codeinsee) values($1, $2, $3, $4)")
 	for _, v := range records {
-		_, err = stmt.Exec(v["id"], v["nom"], v["nom_court"])
+		_, err = stmt.Exec(v["id"], v["nom"], v["nom_court"], v["code_insee"])
 		if err != nil {
 			panic(err)
 		}
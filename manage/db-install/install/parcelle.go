@@ -65,12 +65,13 @@ func FillParcelle(ctx *ctxt.Context, versionSCTL string) {
 			idProprio = idGFA
 		}
 		sql := fmt.Sprintf(
-			"insert into %s(id,code,id_proprietaire,surface) values(%s, '%s', '%d', %7.4f)",
+			"insert into %s(id,code,id_proprietaire,surface,id_commune) values(%s, '%s', '%d', %7.4f, %s)",
 			table,
 			v["IdParcelle"],
 			v["PARCELLE11"],
 			idProprio,
-			surface)
+			surface,
+			v["IdCommune"])
 		if _, err = db.Exec(sql); err != nil {
 			panic(err)
 		}
@@ -19,7 +19,6 @@ import (
 	"math"
 	"path"
 	"strconv"
-	"strings"
 )
 
 func FillUG(ctx *ctxt.Context) {
@@ -32,54 +31,73 @@ func FillUG(ctx *ctxt.Context) {
 	if err != nil {
 		panic(err)
 	}
-	//
-	// records2 : contient type_coupe ; plusieurs types_coupes pour un code ug - sert à dédoublonner au sein d'un code ug
-	//
-	records2 := make(map[string]map[string]string)
-	// records 3 : previsionnel_coupe et type_peuplement toujours unique pour un code ug
-	records3 := make(map[string]map[string]string)
+	// Plusieurs lignes possibles pour un code ug.
+	// surface_sig : prise dans la première ligne ; autres colonnes : prises dans la dernière ligne
+	// (même comportement que les migrations 2023-02-24-details-ug et 2023-05-19-ug-again).
+	codes := []string{}
+	ugs := make(map[string]map[string]string)
 	for _, record := range records {
 		code := record["PG"]
 		if code == "" || code == "0" {
 			continue
 		}
-		if _, ok := records2[code]; !ok {
-			records2[code] = make(map[string]string)
-		}
-		type_coupe := record["Coupe"] + " " + record["Annee_intervention"] // TODO voir si on garde info "0 0"
-		// Arrondit surface au m2 (4 chiffres après la virgule)
-		surface, _ := strconv.ParseFloat(record["Surf_SIG"], 64)
-		surface = math.Round(surface*10000) / 10000
-		surfaceStr := strconv.FormatFloat(surface, 'f', -1, 64)
-		records2[code][type_coupe] = type_coupe
-		if _, ok := records3[code]; !ok {
-			records3[code] = make(map[string]string)
-			records3[code]["previsionnel_coupe"] = record["PSG_suivant"]
-			records3[code]["type_peuplement"] = record["Essence"]
-			records3[code]["surface_sig"] = surfaceStr
+		if _, ok := ugs[code]; !ok {
+			// Arrondit surface au m2 (4 chiffres après la virgule)
+			surface, _ := strconv.ParseFloat(record["Surf_SIG"], 64)
+			surface = math.Round(surface*10000) / 10000
+			ugs[code] = map[string]string{"surface_sig": strconv.FormatFloat(surface, 'f', -1, 64)}
+			codes = append(codes, code)
 		}
+		ugs[code]["code_typo"] = record["code_typo"]
+		ugs[code]["coupe"] = valeurUG(record["Coupe"], 20)
+		ugs[code]["annee_intervention"] = valeurUG(record["Annee_intervention"], 4)
+		ugs[code]["psg_suivant"] = valeurUG(record["PSG_suivant"], 4)
+		ugs[code]["volume_stock_ou_recouvrement"] = record["Volume_stock_ou_recouvrement"]
+		ugs[code]["intensite_prelevement"] = record["Intensite_prelevement"]
+		ugs[code]["amenagement_divers"] = record["Amenagement_divers"]
 	}
 	db := ctx.DB
-	for code, record2 := range records2 {
-		// array_value() pour faire strings.Join()
-		var tmp []string
-		for _, tmp2 := range record2 {
-			tmp = append(tmp, tmp2)
-		}
-		type_coupe := strings.Join(tmp, ", ")
-		sql := fmt.Sprintf("insert into %s(code,type_coupe,previsionnel_coupe,type_peuplement,surface_sig) values('%s','%s','%s','%s',%s)",
-			table,
+	stmt, err := db.Prepare("insert into " + table + `(
+        code,
+        surface_sig,
+        code_typo,
+        coupe,
+        annee_intervention,
+        psg_suivant,
+        volume_stock_ou_recouvrement,
+        intensite_prelevement,
+        amenagement_divers
+        ) values($1,$2,$3,$4,$5,$6,$7,$8,$9)`)
+	if err != nil {
+		panic(err)
+	}
+	defer stmt.Close()
+	for _, code := range codes {
+		ug := ugs[code]
+		_, err = stmt.Exec(
 			code,
-			records3[code]["previsionnel_coupe"],
-			type_coupe,
-			records3[code]["type_peuplement"],
-			records3[code]["surface_sig"])
-		if _, err = db.Exec(sql); err != nil {
+			ug["surface_sig"],
+			ug["code_typo"],
+			ug["coupe"],
+			ug["annee_intervention"],
+			ug["psg_suivant"],
+			ug["volume_stock_ou_recouvrement"],
+			ug["intensite_prelevement"],
+			ug["amenagement_divers"])
+		if err != nil {
 			panic(err)
 		}
 	}
 }
 
+// "0" dans ug.csv signifie valeur absente ; les valeurs trop longues sont ignorées
+func valeurUG(valeur string, longueurMax int) string {
+	if valeur == "0" || len(valeur) > longueurMax {
+		return ""
+	}
+	return valeur
+}
+
 // *********************************************************
 // @pre La table parcelle existe et est remplie
 // @pre la table ug existe et est remplie
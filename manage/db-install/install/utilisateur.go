@@ -0,0 +1,49 @@
+/*
+*****************************************************************************
+
+	Initialisation des utilisateurs de l'application
+	Code servant à initialiser la base, pas utilisé en fonctionnement normal.
+
+	@copyright  BDL, Bois du Larzac
+	@license    GPL
+	@history    2026-10-18 : Creation
+
+*******************************************************************************
+*/
+package install
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+)
+
+// Crée l'utilisateur "admin", avec un mot de passe aléatoire affiché à l'écran.
+// Ce mot de passe est à changer après la première connexion (menu Accueil / Utilisateurs).
+func AddAdminInitial(ctx *ctxt.Context) {
+	buf := make([]byte, 6)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	password := hex.EncodeToString(buf)
+	hash, err := model.HashPassword(password)
+	if err != nil {
+		panic(err)
+	}
+	// Pas model.InsertUtilisateur(), qui écrit aussi dans la table audit
+	_, err = ctx.DB.Exec(
+		"insert into utilisateur(login,password,role,actif,notes) values($1,$2,$3,$4,$5)",
+		"admin",
+		hash,
+		"admin",
+		true,
+		"Créé à l'installation")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Crée utilisateur admin, mot de passe = %s\n", password)
+}
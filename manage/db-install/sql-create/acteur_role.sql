@@ -0,0 +1,9 @@
+
+-- rôles d'un acteur, codes dans src/model/role.go (ex PLA-AB, VPL-CL, DIV-FO)
+create table acteur_role (
+    id_acteur               int not null references acteur(id),
+    code_role               char(6) not null,
+    primary key(id_acteur, code_role)
+);
+create index acteur_role_acteur_idx on acteur_role(id_acteur);
+create index acteur_role_role_idx on acteur_role(code_role);
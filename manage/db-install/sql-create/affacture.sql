@@ -0,0 +1,15 @@
+-- Affactures enregistrées (cf src/model/affacture.go)
+-- Une affacture est une copie figée des activités d'un acteur sur une période, au moment de son enregistrement.
+-- dateaffacture : date reportée dans les champs *datepay des activités affacturées
+create table affacture (
+    id                      serial primary key,
+    numero                  varchar(255) not null unique,
+    id_acteur               int not null references acteur(id),
+    dateaffacture           date not null,
+    datedebut               date not null,
+    datefin                 date not null,
+    totalht                 numeric not null,
+    totalttc                numeric not null,
+    notes                   text not null default ''
+);
+create index affacture_id_acteur_idx on affacture(id_acteur);
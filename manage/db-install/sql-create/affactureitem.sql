@@ -0,0 +1,19 @@
+-- Activités contenues dans une affacture (cf src/model/affacture.go)
+-- typeactivite : AB, DB, DC, BR, TR, TR-CO, TR-OU, RG, RG-CO, RG-OU, CG, CG-CO, CG-OU, LV, LV-CO, LV-OU
+-- id_ligne : id de la ligne affacturée dans plaqop, plaqtrans, plaqrange, ventecharge ou ventelivre,
+--     selon typeactivite - pas de clé étrangère, la table dépend de typeactivite
+-- La contrainte d'unicité empêche d'affacturer deux fois la même activité
+-- lignes : détail de l'item (AffactureLigne), en JSON
+create table affactureitem (
+    id                      serial primary key,
+    id_affacture            int not null references affacture(id),
+    typeactivite            varchar(5) not null,
+    id_ligne                int not null,
+    titre                   varchar(255) not null,
+    dateitem                date not null,
+    lignes                  jsonb not null,
+    totalht                 numeric not null,
+    totalttc                numeric not null,
+    unique(typeactivite, id_ligne)
+);
+create index affactureitem_id_affacture_idx on affactureitem(id_affacture);
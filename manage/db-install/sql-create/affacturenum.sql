@@ -0,0 +1,6 @@
+-- Compteur permettant la génération automatique des numéros d'affacture (cf src/model/affacture.go)
+-- Une ligne par année
+create table affacturenum (
+    annee                   char(4) not null,
+    lastnum                 int not null
+);
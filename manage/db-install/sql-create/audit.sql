@@ -0,0 +1,20 @@
+
+-- Historique des modifications (cf src/model/audit.go)
+-- Une ligne par appel à une fonction Insert*(), Update*() ou Delete*() du model
+-- entite : nom de la table modifiée
+-- action : insert, update, delete
+-- id_utilisateur : 0 si modification faite hors de l'application web
+--     pas de clé étrangère, pour conserver l'historique si l'utilisateur est supprimé
+-- avant, apres : état de la ligne avant et après modification ; '{}' si inexistant
+create table audit (
+    id                      serial primary key,
+    entite                  varchar(20) not null,
+    id_entite               int not null,
+    action                  varchar(6) not null,
+    id_utilisateur          int not null default 0,
+    login                   varchar(255) not null default '',
+    dateaudit               timestamp not null,
+    avant                   jsonb not null default '{}',
+    apres                   jsonb not null default '{}'
+);
+create index audit_entite_idx on audit(entite, id_entite);
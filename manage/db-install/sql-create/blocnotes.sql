@@ -0,0 +1,6 @@
+
+-- bloc-notes de la page d'accueil, une seule ligne
+create table blocnotes (
+    contenu                 text not null default ''
+);
+insert into blocnotes(contenu) values('');
@@ -0,0 +1,14 @@
+
+-- lien entre chantier (plaq, chautre ou chaufer) et parcelle
+-- Pour chaque parcelle, on doit préciser s'il s'agit d'une parcelle entière ou pas.
+-- S'il ne s'agit pas d'une parcelle entière, il faut préciser la surface concernée par la coupe.
+-- L'ordre des colonnes est utilisé par model.insertLiensChantierParcelle()
+create table chantier_parcelle (
+    id_chantier             int not null,
+    id_parcelle             int not null references parcelle(id),
+    entiere                 boolean not null,
+    surface                 numeric,
+    type_chantier           varchar(7) not null -- "plaq", "chautre" ou "chaufer"
+);
+create index chantier_parcelle_chantier_idx on chantier_parcelle(type_chantier, id_chantier);
+create index chantier_parcelle_parcelle_idx on chantier_parcelle(type_chantier, id_parcelle);
@@ -3,13 +3,12 @@
 create table chaufer (
     id                      serial primary key,
     id_fermier              int not null references fermier(id),
-    id_ug                   int not null references ug(id),
+    titre                   varchar(255) not null default '',
     datechantier            date not null,
-    exploitation            typexploitation not null,
-    essence                 typessence not null,
+    exploitation            char(1) not null,
+    essence                 char(2) not null,
     volume                  numeric not null,
-    unite                   typeunite not null,
+    unite                   char(2) not null,
     notes                   text
 );
 create index chaufer_id_fermier_idx on chaufer(id_fermier);
-create index chaufer_id_ug_idx on chaufer(id_ug);
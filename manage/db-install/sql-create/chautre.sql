@@ -3,14 +3,16 @@
 create table chautre (
     id                      serial primary key,
     id_acheteur             int not null references acteur(id),
-    typevalo                typevalorisation not null,
-    typevente               typevente not null,
+    titre                   varchar(255) not null default '',
+    typevalo                char(2) not null,
+    typevente               char(3) not null,
     datecontrat             date not null,
-    exploitation            typexploitation not null,
-    essence                 typessence not null,
+    datepaiement            date not null default '0001-01-01',
+    exploitation            char(1) not null,
+    essence                 char(2) not null,
     volumecontrat           numeric not null,
     volumerealise           numeric not null,
-    unite                   typeunite not null,
+    unite                   char(2) not null,
     puht                    numeric not null,
     tva                     numeric not null,
     datefacture             date,
@@ -4,5 +4,6 @@
 create table commune (
     id                      int not null primary key,
     nom                     varchar(255) not null,
-    nomcourt                varchar(255) not null
+    nomcourt                varchar(255) not null,
+    codeinsee               char(5) not null
 );
@@ -0,0 +1,27 @@
+-- Registre des factures et avoirs émis par BDL (cf src/model/facture.go)
+-- Une facture est une copie figée des données de la vente au moment de son émission.
+-- typefacture : F (facture) ou A (avoir)
+-- id_facture_origine : pour un avoir, id de la facture annulée ; 0 pour une facture
+-- typeorigine, id_origine : ce qui est facturé - venteplaq ou chautre
+--     pas de clé étrangère, une facture émise est conservée si la vente est supprimée
+-- client : nom et adresse du client tels qu'imprimés sur la facture
+-- statut : emise, payee ou annulee
+create table facture (
+    id                      serial primary key,
+    numero                  varchar(255) not null unique,
+    typefacture             char(1) not null,
+    id_facture_origine      int not null default 0,
+    typeorigine             varchar(10) not null,
+    id_origine              int not null,
+    id_client               int not null references acteur(id),
+    client                  text not null,
+    datefacture             date not null,
+    statut                  varchar(10) not null,
+    totalht                 numeric not null,
+    totaltva                numeric not null,
+    totalttc                numeric not null,
+    notes                   text not null default '',
+    mentions                text not null default ''
+);
+create index facture_origine_idx on facture(typeorigine, id_origine);
+create index facture_id_client_idx on facture(id_client);
@@ -0,0 +1,15 @@
+-- Lignes d'une facture ou d'un avoir (cf src/model/facture.go)
+-- Montants arrondis au centime, quantités négatives pour un avoir
+create table factureligne (
+    id                      serial primary key,
+    id_facture              int not null references facture(id),
+    ordre                   int not null,
+    designation             varchar(255) not null,
+    quantite                numeric not null,
+    unite                   varchar(20) not null,
+    puht                    numeric not null,
+    tauxtva                 numeric not null,
+    montantht               numeric not null,
+    montanttva              numeric not null
+);
+create index factureligne_id_facture_idx on factureligne(id_facture);
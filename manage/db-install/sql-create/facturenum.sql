@@ -0,0 +1,6 @@
+-- Compteur permettant la génération automatique des numéros de facture (cf src/model/facture.go)
+-- Une ligne par année
+create table facturenum (
+    annee                   char(4) not null,
+    lastnum                 int not null
+);
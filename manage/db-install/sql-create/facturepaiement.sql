@@ -0,0 +1,11 @@
+-- Paiements (éventuellement partiels) d'une facture, ou remboursements d'un avoir (cf src/model/facture.go)
+-- mode : virement, cheque, especes, autre
+create table facturepaiement (
+    id                      serial primary key,
+    id_facture              int not null references facture(id),
+    datepaiement            date not null,
+    montant                 numeric not null,
+    mode                    varchar(10) not null,
+    notes                   text not null default ''
+);
+create index facturepaiement_id_facture_idx on facturepaiement(id_facture);
@@ -0,0 +1,10 @@
+-- Inventaire physique des tas d'un lieu de stockage (cf src/model/inventaire.go)
+-- L'écart entre le stock mesuré et le stock calculé de chaque tas est enregistré
+-- comme mouvement de stock d'ajustement (mouvementstock, typemvt = AJ, id_ligne = id de l'inventaire)
+create table inventaire (
+    id                      serial primary key,
+    id_stockage             int not null references stockage(id),
+    dateinventaire          date not null,
+    notes                   text not null default ''
+);
+create index inventaire_id_stockage_idx on inventaire(id_stockage);
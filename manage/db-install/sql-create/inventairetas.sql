@@ -0,0 +1,12 @@
+-- Mesure d'un tas lors d'un inventaire
+-- stockcalcule : stock du tas à la date de l'inventaire, d'après les mouvements de stock, avant ajustement
+-- stockmesure : stock constaté
+create table inventairetas (
+    id                      serial primary key,
+    id_inventaire           int not null references inventaire(id),
+    id_tas                  int not null references tas(id),
+    stockcalcule            numeric not null,
+    stockmesure             numeric not null,
+    unique(id_inventaire, id_tas)
+);
+create index inventairetas_id_tas_idx on inventairetas(id_tas);
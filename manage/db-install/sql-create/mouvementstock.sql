@@ -0,0 +1,23 @@
+-- Mouvements de stock des tas (cf src/model/mouvementstock.go)
+-- Table en ajout seul : une modification ou une suppression de transport ou de chargement
+-- ajoute un mouvement inverse, le stock d'un tas est la somme des qte de ses mouvements.
+-- typemvt : TR (transport), CG (chargement), VI (vidage), AJ (ajustement, ex inventaire),
+--     TF (transfert entre lieux de stockage)
+-- id_ligne : id du transport (plaqtrans), du chargement (ventecharge), de l'inventaire
+--     ou du transfert (plaqtransfert) selon typemvt, 0 sinon
+--     pas de clé étrangère, la table dépend de typemvt
+-- qte : en maps sèches, positive pour une entrée dans le tas, négative pour une sortie
+-- motif : pour les vidages, motif de la perte (cf model.LabelMotifPerte()), '' sinon
+create table mouvementstock (
+    id                      serial primary key,
+    id_tas                  int not null references tas(id),
+    typemvt                 char(2) not null,
+    id_ligne                int not null default 0,
+    datemvt                 date not null,
+    qte                     numeric not null,
+    motif                   char(2) not null default '',
+    notes                   text not null default '',
+    datecreation            timestamp not null default now()
+);
+create index mouvementstock_id_tas_idx on mouvementstock(id_tas);
+create index mouvementstock_typemvt_id_ligne_idx on mouvementstock(typemvt, id_ligne);
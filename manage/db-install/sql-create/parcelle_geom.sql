@@ -0,0 +1,12 @@
+-- Géométrie des parcelles cadastrales (cf src/model/carte.go)
+-- code11 : code insee de la commune + code parcelle (= c.codeinsee||p.code, comme dans qgis_chantier)
+-- Pas de clé étrangère vers parcelle : contient toutes les parcelles des communes importées,
+-- pour que la géométrie reste disponible après une mise à jour des données SCTL.
+-- idcadastre : identifiant de la parcelle dans le fichier importé (Etalab)
+-- geometrie : géométrie GeoJSON, coordonnées WGS84 (longitude, latitude)
+create table parcelle_geom (
+    code11                  char(11) primary key,
+    idcadastre              varchar(14) not null,
+    geometrie               jsonb not null,
+    dateimport              date not null
+);
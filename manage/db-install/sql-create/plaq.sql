@@ -2,12 +2,14 @@
 -- chantier plaquette, champs généraux
 create table plaq (
     id                      serial primary key,
+    titre                   varchar(255) not null default '',
     datedeb                 date not null,
     datefin                 date not null,
     surface                 numeric not null,
-    granulo                 typegranulo not null,
-    exploitation            typexploitation not null,
-    essence                 typessence not null,
+    granulo                 char(3) not null,
+    exploitation            char(1) not null,
+    essence                 char(2) not null,
     fraisrepas              numeric,
-    fraisreparation         numeric
+    fraisreparation         numeric,
+    notes                   text default ''
 );
@@ -3,11 +3,11 @@ create table plaqop (
     id                      serial primary key,
     id_chantier             int not null references plaq(id),
     id_acteur               int not null references acteur(id),
-    typop                   typeop not null,
+    typop                   char(2) not null,
     datedeb                 date not null,
     datefin                 date not null,
     qte                     numeric not null,
-    unite                   typeunite not null, -- JO, HE ou MA
+    unite                   char(2) not null, -- JO, HE ou MA
     puht                    numeric not null,
     tva                     numeric not null,
     datepay                 date,
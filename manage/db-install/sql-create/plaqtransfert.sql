@@ -0,0 +1,34 @@
+-- Transfert de plaquettes d'un tas vers un tas d'un autre lieu de stockage
+-- Les 2 tas appartiennent au même chantier plaquettes
+create table plaqtransfert (
+    id                      serial primary key,
+    id_chantier             int not null references plaq(id),
+    id_tas_origine          int not null references tas(id),
+    id_tas_destination      int not null references tas(id),
+    id_transporteur         int not null references acteur(id),
+    id_conducteur           int not null references acteur(id),
+    id_proprioutil          int not null references acteur(id),
+    datetransfert           date not null,
+    qte                     numeric not null, -- maps sèches
+    typecout                char(1) not null, -- G (global) ou D (détail)
+    -- coût global
+    glprix                  numeric,
+    gltva                   numeric,
+    gldatepay               date,
+    -- concerne le conducteur
+    conheure                numeric,
+    coprixh                 numeric,
+    cotva                   numeric,
+    codatepay               date,
+    -- concerne l'outil
+    ouprix                  numeric,
+    outva                   numeric,
+    oudatepay               date,
+    notes                   text
+);
+create index plaqtransfert_id_chantier_idx on plaqtransfert(id_chantier);
+create index plaqtransfert_id_tas_origine_idx on plaqtransfert(id_tas_origine);
+create index plaqtransfert_id_tas_destination_idx on plaqtransfert(id_tas_destination);
+create index plaqtransfert_id_transporteur_idx on plaqtransfert(id_transporteur);
+create index plaqtransfert_id_conducteur_idx on plaqtransfert(id_conducteur);
+create index plaqtransfert_id_proprioutil_idx on plaqtransfert(id_proprioutil);
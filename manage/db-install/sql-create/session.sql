@@ -0,0 +1,9 @@
+
+-- Sessions des utilisateurs connectés
+-- token : identifiant aléatoire stocké dans le cookie du navigateur
+create table session (
+    token                   char(64) primary key,
+    id_utilisateur          int not null references utilisateur(id),
+    dateexpire              timestamp not null
+);
+create index session_id_utilisateur_idx on session(id_utilisateur);
@@ -2,7 +2,7 @@
 create table stockfrais (
     id                      serial primary key,
     id_stockage             int not null references stockage(id),
-    typefrais               typestockfrais not null,
+    typefrais               char(2) not null,
     montant                 numeric not null,
     datedeb                 date not null,
     datefin                 date not null,
@@ -1,10 +1,10 @@
 
 -- tas dans un hangar à plaquette
+-- le stock n'est pas stocké ici, il est calculé à partir de la table mouvementstock
 create table tas (
     id                      serial primary key,
     id_stockage             int not null references stockage(id),
     id_chantier             int not null references plaq(id),
-    stock                   numeric,
     datevidage              date,
     actif                   boolean not null default true
 );
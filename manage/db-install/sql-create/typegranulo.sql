@@ -1,6 +0,0 @@
-
--- granulométrie (taille plaquettes)
-create type typegranulo as enum(
-    'P16',
-    'P45'
-);
@@ -1,8 +0,0 @@
-
--- essences = espèces d'arbres
-create type typessence as enum(
-    'CT', -- châtaigner
-    'CN', -- chêne
-    'GV', -- genévrier
-    'PS'  -- pin sylvestre 
-);
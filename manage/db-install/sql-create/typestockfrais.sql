@@ -1,8 +0,0 @@
-
--- types de frais pour les lieux de stockage
-create type typestockfrais as enum(
-    'LO', -- loyer
-    'AS', -- assurance
-    'EL'  -- électricité
-);
-                                                                                                                  
\ No newline at end of file
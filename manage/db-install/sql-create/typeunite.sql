@@ -1,15 +0,0 @@
-
--- unités utilisées dans le programme
-create type typeunite as enum(
-	'HE', -- heures
-	'JO', -- jours
-	'M3', -- mètres cubes
-	'MA', -- maps
-	'ST', -- stères
-	'TO'  -- tonnes
-	/* 
-	Ajout migration 2022-02-07
-	'NP'  -- nombre de piquets
-	*/
-);
-                                                                                                                  
\ No newline at end of file
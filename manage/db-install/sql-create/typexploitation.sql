@@ -1,9 +0,0 @@
-
--- exploitation, de 1 à 5
-create type typexploitation as enum(
-    '1',
-    '2',
-    '3',
-    '4',
-    '5'
-);
@@ -1,11 +1,16 @@
 
 create table ug (
-    id                      serial primary key,
-    code                    varchar(10) not null, -- len max observée = 8
-    type_coupe              varchar(50) not null, -- len max observée = 15 pour un seul type
-    previsionnel_coupe      varchar(50) not null, -- len max observée = 13
-    type_peuplement         varchar(50) not null,  -- len max observée = 26
-    surface_sig             decimal not null
+    id                              serial primary key,
+    code                            varchar(10) not null, -- len max observée = 8
+    surface_sig                     decimal not null,
+    code_typo                       char(1),
+    coupe                           varchar(20),
+    annee_intervention              varchar(4),
+    psg_suivant                     varchar(4),
+    volume_stock_ou_recouvrement    varchar(255),
+    intensite_prelevement           varchar(255),
+    amenagement_divers              varchar(255)
 );
 
 create index ug_code_idx on ug(code);
+create index ug_code_typo_idx on ug(code_typo);
@@ -0,0 +1,10 @@
+
+-- essences présentes dans une UG
+-- epars : essence présente de manière éparse
+create table ug_essence (
+    id_ug                   int not null,
+    code_essence            char(2) not null,
+    epars                   boolean not null default false
+);
+create index ug_essence_ug_idx on ug_essence(id_ug);
+create index ug_essence_essence_idx on ug_essence(code_essence);
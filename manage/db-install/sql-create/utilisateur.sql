@@ -0,0 +1,12 @@
+
+-- Personnes pouvant se connecter à l'application
+-- role : lecteur, editeur, admin (cf model.UtilisateurRoleMap)
+-- password : hash du mot de passe (cf model.HashPassword())
+create table utilisateur (
+    id                      serial primary key,
+    login                   varchar(255) not null unique,
+    password                varchar(255) not null,
+    role                    varchar(10) not null,
+    actif                   boolean not null default true,
+    notes                   text not null default ''
+);
@@ -7,6 +7,7 @@ create table venteplaq (
     puht                    numeric not null,
     tva                     numeric not null,
     datevente               date not null,
+    datepaiement            date not null default '0001-01-01',
     -- facture
     numfacture              varchar(255),
     datefacture             date,
@@ -14,6 +15,8 @@ create table venteplaq (
     facturelivraisonpuht    numeric,
     facturelivraisontva     numeric not null,
     facturenotes            boolean not null default false,
+    facturelivraisonunite   text default '',
+    facturelivraisonnbkm    numeric not null default 0,
     notes                   text
 );
 create index venteplaq_id_client_idx on venteplaq(id_client);
@@ -17,7 +17,10 @@ package main
 import (
 	"bdl.local/bdl/ctxt"
 	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/migration"
 	"bdl.local/bdl/model"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
@@ -31,17 +34,8 @@ var possibleMigrations []string
 // *********************************************************
 func main() {
 	possibleMigrations = computeMigrations()
-	msgPossibles := "Migrations possibles : \n    " + strings.Join(possibleMigrations, "\n    ")
-	if len(os.Args) != 2 {
-		fmt.Println("Cette commande a besoin d'un argument, la migration à exécuter")
-		fmt.Println(msgPossibles)
-		return
-	}
-	migration := os.Args[1]
-	if !tiglib.InArray(migration, possibleMigrations) {
-		fmt.Println("MIGRATION INEXISTANTE : " + migration)
-		fmt.Println("Modifier 1.main.go pour la rajouter dans le switch : ")
-		fmt.Println(msgPossibles)
+	if len(os.Args) != 2 && !(len(os.Args) == 3 && os.Args[1] == "applique") {
+		usage()
 		return
 	}
 
@@ -50,7 +44,34 @@ func main() {
 	ctxt.MustInitDB()
 	ctx := ctxt.NewContext()
 
-	switch migration {
+	switch os.Args[1] {
+	case "status":
+		status(ctx)
+		return
+	case "up":
+		up(ctx)
+		return
+	case "mot-de-passe-admin":
+		motDePasseAdmin(ctx)
+		return
+	case "applique":
+		err := migration.Applique(ctx.DB, os.Args[2])
+		if err != nil {
+			fmt.Println("ERREUR : ", err)
+			return
+		}
+		fmt.Println("Migration effectuée : " + os.Args[2])
+		return
+	}
+
+	// Migrations antérieures au registre (package migration)
+	nom := os.Args[1]
+	if !tiglib.InArray(nom, possibleMigrations) {
+		fmt.Println("MIGRATION INEXISTANTE : " + nom)
+		usage()
+		return
+	}
+	switch nom {
 	case "Migrate_2021_03_01_exemple":
 		Migrate_2021_03_01_exemple(ctx)
 	case "Migrate_2021_11_10_note_plaq":
@@ -92,11 +113,85 @@ func main() {
 	case "Migrate_2023_07_21_bloc_notes":
 		Migrate_2023_07_21_bloc_notes(ctx)
 	default:
-		fmt.Println("Migration inconnue : " + migration)
+		fmt.Println("Migration inconnue : " + nom)
 		fmt.Println("Modifier 1.main.go pour la rajouter dans le switch")
 	}
 }
 
+// *********************************************************
+func usage() {
+	fmt.Println("Usage :")
+	fmt.Println("    go run *.go status             : état des migrations du registre (src/migration)")
+	fmt.Println("    go run *.go up                 : applique les migrations du registre en attente")
+	fmt.Println("    go run *.go applique <version> : applique une seule migration du registre")
+	fmt.Println("    go run *.go mot-de-passe-admin : génère et affiche un nouveau mot de passe pour l'utilisateur admin")
+	fmt.Println("    go run *.go <Migrate_...>      : exécute une migration antérieure au registre")
+	fmt.Println("Migrations antérieures au registre : \n    " + strings.Join(possibleMigrations, "\n    "))
+}
+
+// Affiche l'état des migrations du registre
+func status(ctx *ctxt.Context) {
+	etats, err := migration.Status(ctx.DB)
+	if err != nil {
+		panic(err)
+	}
+	for _, etat := range etats {
+		if etat.Appliquee {
+			fmt.Printf("%-40s appliquée le %s\n", etat.Migration.Version, etat.DateApplication.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Printf("%-40s EN ATTENTE - %s\n", etat.Migration.Version, etat.Migration.Description)
+		}
+	}
+}
+
+// Applique les migrations du registre en attente
+func up(ctx *ctxt.Context) {
+	versions, err := migration.Up(ctx.DB)
+	for _, version := range versions {
+		fmt.Println("Migration effectuée : " + version)
+	}
+	if err != nil {
+		fmt.Println("ERREUR : ", err)
+		return
+	}
+	if len(versions) == 0 {
+		fmt.Println("Aucune migration en attente")
+	}
+}
+
+// Génère un nouveau mot de passe pour l'utilisateur admin et l'affiche (une seule fois, pas dans les logs).
+// Nécessaire après la migration 2026-10-18-01-utilisateurs, qui crée admin sans mot de passe utilisable.
+func motDePasseAdmin(ctx *ctxt.Context) {
+	buf := make([]byte, 6)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	password := hex.EncodeToString(buf)
+	hash, err := model.HashPassword(password)
+	if err != nil {
+		panic(err)
+	}
+	// Pas model.UpdateUtilisateur(), qui écrit aussi dans la table audit
+	res, err := ctx.DB.Exec("update utilisateur set password=$1 where login=$2", hash, "admin")
+	if err != nil {
+		panic(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	if n == 0 {
+		fmt.Println("ERREUR : utilisateur admin inexistant (lancer d'abord les migrations)")
+		return
+	}
+	_, err = ctx.DB.Exec("delete from session where id_utilisateur=(select id from utilisateur where login=$1)", "admin")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Utilisateur admin, mot de passe = %s (à changer après la première connexion)\n", password)
+}
+
 // *********************************************************
 // Renvoie la liste des migrations possibles
 // = liste des fonctions du répertoire courant commençant par Migrate_
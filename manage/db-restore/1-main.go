@@ -0,0 +1,277 @@
+/*
+Restauration d'une sauvegarde de la base (cf src/model/sauvegarde.go).
+
+Le dump est d'abord restauré dans un schéma temporaire (<schéma>_restauration),
+puis le nombre de lignes de chaque table est comparé à celui du manifeste de la sauvegarde.
+Le schéma courant n'est remplacé que si les comptes sont corrects, avec l'option -remplacer
+et après confirmation.
+
+# Voir fichier README
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package main
+
+import (
+	"archive/zip"
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func main() {
+	remplacer := flag.Bool("remplacer", false, "remplace le schéma courant par le schéma restauré si les comptes sont corrects")
+	flag.Usage = func() {
+		fmt.Println("Usage : go run *.go [-remplacer] bdl-AAAA-MM-JJ-HHMMSS.pgdump.zip")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return
+	}
+
+	model.MustLoadEnv()
+	ctxt.MustLoadConfig()
+	ctxt.MustInitDB()
+	ctx := ctxt.NewContext()
+
+	zipPath, err := trouverSauvegarde(flag.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("Sauvegarde : " + zipPath)
+	//
+	// 1 - manifeste et somme de contrôle
+	//
+	schema := model.SERVER_ENV.DATABASE_SCHEMA
+	manifeste, err := model.LireManifeste(zipPath + ".json")
+	if err != nil {
+		panic(err)
+	}
+	if manifeste == nil {
+		fmt.Println("ATTENTION : pas de manifeste, la somme de contrôle et les comptes ne peuvent pas être vérifiés")
+	} else {
+		checksum, err := model.ChecksumFichier(zipPath)
+		if err != nil {
+			panic(err)
+		}
+		if checksum != manifeste.SHA256 {
+			fmt.Println("ERREUR : la somme de contrôle ne correspond pas au manifeste, fichier modifié ou corrompu")
+			return
+		}
+		fmt.Println("Somme de contrôle OK")
+		schema = manifeste.Schema
+	}
+	//
+	// 2 - restauration dans le schéma temporaire
+	//
+	scratch := schema + "_restauration"
+	dumpPath, err := dezipper(zipPath)
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(dumpPath)
+	err = restaurer(ctx.DB, dumpPath, schema, scratch)
+	if err != nil {
+		fmt.Println("ERREUR pendant la restauration : ", err)
+		return
+	}
+	fmt.Println("Dump restauré dans le schéma " + scratch)
+	//
+	// 3 - comptes
+	//
+	restaures, err := model.CompterLignes(ctx.DB, scratch)
+	if err != nil {
+		panic(err)
+	}
+	courants, err := model.CompterLignes(ctx.DB, schema)
+	if err != nil {
+		panic(err)
+	}
+	ok := afficherComptes(manifeste, restaures, courants)
+	if !ok {
+		fmt.Println("ERREUR : les comptes ne correspondent pas au manifeste, le schéma " + schema + " n'est pas remplacé")
+		fmt.Println("Le schéma " + scratch + " peut être examiné, puis supprimé")
+		return
+	}
+	if !*remplacer {
+		fmt.Println("Comptes OK. Pour remplacer le schéma " + schema + ", relancer avec l'option -remplacer")
+		fmt.Println("Le schéma " + scratch + " peut être examiné, puis supprimé")
+		return
+	}
+	//
+	// 4 - remplacement
+	//
+	fmt.Print("Remplacer le schéma " + schema + " par " + scratch + " ? (oui / non) ")
+	reponse, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(reponse) != "oui" {
+		fmt.Println("Abandon, le schéma " + scratch + " est conservé")
+		return
+	}
+	ancien := schema + "_avant_restauration_" + time.Now().Format("20060102150405")
+	err = remplacerSchema(ctx.DB, schema, scratch, ancien)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Schéma " + schema + " remplacé ; l'ancien schéma est conservé sous le nom " + ancien)
+}
+
+// Cherche le fichier tel quel, puis dans RESTORE_DIR et BACKUP_DIR
+func trouverSauvegarde(nom string) (string, error) {
+	candidats := []string{nom}
+	for _, dir := range []string{model.SERVER_ENV.RESTORE_DIR, model.SERVER_ENV.BACKUP_DIR} {
+		if dir != "" {
+			candidats = append(candidats, filepath.Join(dir, nom))
+		}
+	}
+	for _, candidat := range candidats {
+		if _, err := os.Stat(candidat); err == nil {
+			return candidat, nil
+		}
+	}
+	return "", fmt.Errorf("Fichier inexistant : %s (cherché dans le répertoire courant, RESTORE_DIR et BACKUP_DIR)", nom)
+}
+
+// Extrait le dump du zip dans un fichier temporaire
+func dezipper(zipPath string) (string, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if len(r.File) != 1 {
+		return "", fmt.Errorf("Le zip doit contenir un seul fichier : %s", zipPath)
+	}
+	in, err := r.File[0].Open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp("", "bdl-restauration-*.pgdump")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// Restaure le dump dans le schéma scratch, sans toucher au schéma courant.
+// Le dump crée le schéma sous son nom d'origine ; psql l'exécute dans une seule transaction
+// qui renomme d'abord le schéma courant, puis renomme le schéma restauré en scratch
+// et redonne au schéma courant son nom. Vu des autres connexions, seul le schéma scratch apparaît.
+func restaurer(db *sqlx.DB, dumpPath, schema, scratch string) error {
+	_, err := db.Exec("drop schema if exists " + ident(scratch) + " cascade")
+	if err != nil {
+		return err
+	}
+	var existe bool
+	err = db.Get(&existe, "select exists(select 1 from information_schema.schemata where schema_name=$1)", schema)
+	if err != nil {
+		return err
+	}
+	tmp := schema + "_restauration_tmp"
+	debut, fin := "", "alter schema "+ident(schema)+" rename to "+ident(scratch)+";\n"
+	if existe {
+		debut = "alter schema " + ident(schema) + " rename to " + ident(tmp) + ";\n"
+		fin += "alter schema " + ident(tmp) + " rename to " + ident(schema) + ";\n"
+	}
+	dump, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+	cmdPsql := model.SERVER_ENV.CMD_PSQL
+	if cmdPsql == "" {
+		cmdPsql = "psql"
+	}
+	cmd := exec.Command(cmdPsql, model.SERVER_ENV.DATABASE_URL, "--quiet", "--single-transaction", "-v", "ON_ERROR_STOP=1", "-f", "-")
+	cmd.Stdin = io.MultiReader(strings.NewReader(debut), dump, strings.NewReader("\n"+fin))
+	cmd.Stdout = io.Discard
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Affiche les comptes par table
+// @return  true si les comptes restaurés correspondent au manifeste (ou s'il n'y a pas de manifeste)
+func afficherComptes(manifeste *model.ManifesteSauvegarde, restaures, courants map[string]int) bool {
+	tables := map[string]bool{}
+	for table := range restaures {
+		tables[table] = true
+	}
+	if manifeste != nil {
+		for table := range manifeste.NbLignes {
+			tables[table] = true
+		}
+	}
+	noms := []string{}
+	for table := range tables {
+		noms = append(noms, table)
+	}
+	sort.Strings(noms)
+	ok := true
+	fmt.Printf("%-30s %12s %12s %12s\n", "Table", "Manifeste", "Restauré", "Actuel")
+	for _, table := range noms {
+		attendu := "-"
+		marque := ""
+		if manifeste != nil {
+			n, existe := manifeste.NbLignes[table]
+			attendu = fmt.Sprint(n)
+			_, restauree := restaures[table]
+			if !existe || !restauree || n != restaures[table] {
+				ok = false
+				marque = "  <= ERREUR"
+			}
+		}
+		fmt.Printf("%-30s %12s %12d %12d%s\n", table, attendu, restaures[table], courants[table], marque)
+	}
+	return ok
+}
+
+// Remplace le schéma courant par le schéma restauré, dans une transaction
+func remplacerSchema(db *sqlx.DB, schema, scratch, ancien string) error {
+	var existe bool
+	err := db.Get(&existe, "select exists(select 1 from information_schema.schemata where schema_name=$1)", schema)
+	if err != nil {
+		return err
+	}
+	queries := []string{"alter schema " + ident(scratch) + " rename to " + ident(schema)}
+	if existe {
+		queries = append([]string{"alter schema " + ident(schema) + " rename to " + ident(ancien)}, queries...)
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Identifiant SQL entre guillemets
+func ident(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,76 @@
+/*
+Export comptable (FEC ou journal CSV) des ventes et des achats d'une période,
+en ligne de commande (même calcul que la page /compta/export).
+
+Voir fichier README
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package main
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	if len(os.Args) != 3 && len(os.Args) != 4 {
+		fmt.Println("Usage : go run *.go AAAA-MM-JJ AAAA-MM-JJ [fec|csv]")
+		return
+	}
+	dateDebut, err := time.Parse("2006-01-02", os.Args[1])
+	if err != nil {
+		fmt.Println("Date de début invalide : " + os.Args[1])
+		return
+	}
+	dateFin, err := time.Parse("2006-01-02", os.Args[2])
+	if err != nil {
+		fmt.Println("Date de fin invalide : " + os.Args[2])
+		return
+	}
+	format := "fec"
+	if len(os.Args) == 4 {
+		format = os.Args[3]
+	}
+	if format != "fec" && format != "csv" {
+		fmt.Println("Format invalide : " + format + " (fec ou csv)")
+		return
+	}
+
+	model.MustLoadEnv()
+	ctxt.MustLoadConfig()
+	ctxt.MustInitDB()
+	ctx := ctxt.NewContext()
+
+	export, err := model.ComputeExportCompta(ctx.DB, ctx.Config, dateDebut, dateFin)
+	if err != nil {
+		panic(err)
+	}
+	filename := export.NomFichierFEC(ctx.Config)
+	if format == "csv" {
+		filename = export.NomFichierCSV()
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if format == "csv" {
+		err = export.WriteCSV(f, ctx.Config)
+	} else {
+		err = export.WriteFEC(f)
+	}
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d lignes écrites dans %s\n", len(export.Lignes), filename)
+	fmt.Printf("Total débit : %.2f - Total crédit : %.2f\n", export.TotalDebit, export.TotalCredit)
+	for _, anomalie := range export.Anomalies {
+		fmt.Println("ANOMALIE : " + anomalie)
+	}
+}
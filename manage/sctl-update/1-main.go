@@ -1,109 +1,160 @@
 /*
 *****************************************************************************
 
-	Mise à jour des données SCTL (uniquement les fermiers)
+	Mise à jour des données SCTL : communes, lieux-dits, parcelles, fermiers et leurs liens.
+	Même traitement que la page "Import données SCTL" de l'application (cf src/model/sctl-import.go).
 	Exemple d'utilisation : voir README
 
 	@copyright  BDL, Bois du Larzac
 	@license    GPL
 	@history    2023-01-11 05:04:02+01:00, Thierry Graff : Creation
+	@history    2026-10-18 : Utilise l'import de src/model (diff puis application)
 
 *******************************************************************************
 */
 package main
 
 import (
-	"bdl.dbinstall/bdl/install"
 	"bdl.local/bdl/ctxt"
-	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/model"
+	"bufio"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Cette commande a besoin d'un seul argument - voir fichier README")
+	appliquer := flag.Bool("appliquer", false, "applique les différences après confirmation")
+	flag.Usage = func() {
+		fmt.Println("Usage : go run 1-main.go [-appliquer] <AAAA-MM-JJ | fichier.mdb>")
+		fmt.Println("Voir fichier README")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
 		return
 	}
 	var err error
-	versionSCTL := os.Args[1]
-	dirname := ".." + string(os.PathSeparator) + "sctl-data" + string(os.PathSeparator) + "csv-" + versionSCTL
-	_, err = os.Stat(dirname)
-	if os.IsNotExist(err) {
-		fmt.Printf("Directory %s/ does not exist - voir fichier README.\n", dirname)
-		return
+	dirname := ""
+	if strings.HasSuffix(strings.ToLower(flag.Arg(0)), ".mdb") {
+		dirname, err = os.MkdirTemp("", "bdl-sctl-")
+		if err != nil {
+			panic(err)
+		}
+		defer os.RemoveAll(dirname)
+		err = model.ExporteMdbSCTL(flag.Arg(0), dirname)
+		if err != nil {
+			fmt.Println("ERREUR export du fichier .mdb : ", err)
+			return
+		}
+	} else {
+		dirname = filepath.Join("..", "sctl-data", "csv-"+flag.Arg(0))
+		if _, err = os.Stat(dirname); os.IsNotExist(err) {
+			fmt.Printf("Le répertoire %s/ n'existe pas - voir fichier README.\n", dirname)
+			return
+		}
 	}
 
 	model.MustLoadEnv()
+	ctxt.MustLoadConfig()
 	ctxt.MustInitDB()
 	ctx := ctxt.NewContext()
 
-	report := ""
-	report += updateFermiers(ctx, dirname)
-
-	install.FillLiensParcelleFermier(ctx, versionSCTL)
-
-	fmt.Println(report)
-}
-
-func updateFermiers(ctx *ctxt.Context, dirname string) (report string) {
-	filename := dirname + string(os.PathSeparator) + "Exploita.csv"
-	records, err := tiglib.CsvMap(filename, ';')
+	donnees, err := model.LitDonneesSCTL(ctx.DB, dirname)
+	if err != nil {
+		panic(err)
+	}
+	diff, err := model.ComputeDiffSCTL(ctx.DB, donnees)
+	if err != nil {
+		panic(err)
+	}
+	afficherDiff(diff)
+	if diff.EstVide() {
+		fmt.Println("Aucune différence avec la base BDL")
+		return
+	}
+	if !*appliquer {
+		fmt.Println("Pour appliquer ces différences, relancer avec l'option -appliquer")
+		return
+	}
+	fmt.Print("Appliquer ces différences ? (oui / non) ")
+	reponse, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(reponse) != "oui" {
+		fmt.Println("Abandon")
+		return
+	}
+	err = model.WithTx(ctx.DB, nil, func(tx model.DBOrTx) error {
+		return model.AppliqueDiffSCTL(tx, donnees, diff)
+	})
 	if err != nil {
-		return "Erreur de lecture de Exploita.csv avec tiglib.CsvMap()"
+		panic(err)
 	}
+	fmt.Println("Différences appliquées")
+}
 
-	nUpdate, nInsert := 0, 0
-	for _, record := range records {
-		idExploitant, err := strconv.Atoi(record["IdExploitant"])
-		if idExploitant == 1 {
-			continue // "PERSONNE"
+func afficherDiff(d *model.DiffSCTL) {
+	fmt.Printf("Non importés : %d exploitants non agricoles, %d parcelles exploitées uniquement par des non agricoles\n",
+		d.NbNonAgricoles, d.NbParcellesNonAgricoles)
+	if d.NbLignesIgnorees != 0 {
+		fmt.Printf("%d lignes csv mal formées ignorées\n", d.NbLignesIgnorees)
+	}
+	fmt.Println("\n=== Parcelles ===")
+	for _, p := range d.ParcellesNouvelles {
+		fmt.Printf("NOUVELLE  %d %s (%s)\n", p.Id, p.Code, p.Commune.NomCourt)
+	}
+	afficherModifs(d.ParcellesModifiees)
+	for _, p := range d.ParcellesDisparues {
+		action := "supprimée"
+		if p.Conservee() {
+			action = fmt.Sprintf("conservée, liée à %d chantier(s)", p.NbChantiers)
 		}
-		if err != nil {
-			return "Erreur appel strconv.Atoi(%s) pour IdExploitant " + record["IdExploitant"]
+		fmt.Printf("DISPARUE  %d %s (%s) - %s\n", p.Parcelle.Id, p.Parcelle.Code, p.Parcelle.Commune.NomCourt, action)
+	}
+	fmt.Println("\n=== Fermiers ===")
+	for _, f := range d.FermiersNouveaux {
+		fmt.Printf("NOUVEAU   %d %s\n", f.Id, f.String())
+	}
+	afficherModifs(d.FermiersModifies)
+	for _, f := range d.FermiersDisparus {
+		fmt.Printf("DISPARU   %d %s - conservé\n", f.Id, f.String())
+	}
+	for _, fp := range d.FermiersParcelles {
+		fmt.Printf("PARCELLES %s : %d ajoutée(s), %d retirée(s)\n", fp.Fermier.String(), len(fp.Ajoutees), len(fp.Retirees))
+	}
+	fmt.Println("\n=== Communes et lieux-dits ===")
+	for _, c := range d.CommunesNouvelles {
+		fmt.Printf("NOUVELLE  commune %d %s\n", c.Id, c.Nom)
+	}
+	afficherModifs(d.CommunesModifiees)
+	for _, c := range d.CommunesDisparues {
+		fmt.Printf("DISPARUE  commune %d %s - conservée\n", c.Id, c.Nom)
+	}
+	for _, ld := range d.LieuditsNouveaux {
+		fmt.Printf("NOUVEAU   lieu-dit %d %s\n", ld.Id, ld.Nom)
+	}
+	afficherModifs(d.LieuditsModifies)
+	for _, ld := range d.LieuditsDisparus {
+		fmt.Printf("DISPARU   lieu-dit %d %s - conservé\n", ld.Id, ld.Nom)
+	}
+	fmt.Println("\n=== Liens ===")
+	for _, nb := range d.NbLiens() {
+		fmt.Printf("%-20s %5d ajoutés %5d supprimés\n", nb.Table, nb.Ajoutes, nb.Supprimes)
+	}
+	if !d.AvecUG {
+		fmt.Println("Pas de fichier ug.csv : les liens parcelles - UGs ne sont pas modifiés")
+	}
+	if len(d.UGsInconnues) != 0 {
+		fmt.Println("UGs de ug.csv absentes de la base (liens ignorés) : " + strings.Join(d.UGsInconnues, ", "))
+	}
+	fmt.Println()
+}
 
-		}
-		if record["Agricole"] == "0" {
-			//fmt.Printf("%d,",idExploitant)
-			// select * from chantier_fermier where id_fermier in(28,37,42,43,46,48,52,53,54,58,59,63,64,66,69,70,128,129,130,73,74,77,79,85,86,90,91,92,96,97,100,102,103,105,110,113,115,116,117,119,120,121,122,134);
-			//select * from parcelle_fermier where id_fermier in(28,37,42,43,46,48,52,53,54,58,59,63,64,66,69,70,128,129,130,73,74,77,79,85,86,90,91,92,96,97,100,102,103,105,110,113,115,116,117,119,120,121,122,134);
-			continue // Ne garder que les agricoles
-		}
-		cp := record["CPExp"]
-		if len(cp) > 5 {
-			cp = cp[:5] // fix une typo dans la base SCTL
-		}
-		csvFermier := model.Fermier{
-			Id:      idExploitant,
-			Nom:     record["NOMEXP"],
-			Prenom:  record["Prenom"],
-			Adresse: record["AdresseExp"],
-			Cp:      cp,
-			Ville:   record["VilleExp"],
-			Tel:     record["Telephone"],
-			Email:   record["Mail"],
-		}
-		dbFermier, err := model.GetFermier(ctx.DB, idExploitant)
-		if dbFermier.Id == 0 {
-			err = model.InsertFermier(ctx.DB, &csvFermier)
-			if err != nil {
-				panic(err)
-			}
-			nInsert++
-			report += "INSERTED " + record["IdExploitant"] + " " + record["NOMEXP"] + " " + record["Prenom"] + "\n"
-		} else {
-			err = model.UpdateFermier(ctx.DB, &csvFermier)
-			if err != nil {
-				panic(err)
-			}
-			nUpdate++
-			report += "Updated " + record["IdExploitant"] + " - " + record["NOMEXP"] + " " + record["Prenom"] + "\n"
+func afficherModifs(modifs []*model.ModifSCTL) {
+	for _, m := range modifs {
+		for _, c := range m.Champs {
+			fmt.Printf("MODIFIÉ   %d %s - %s : %q => %q\n", m.Id, m.Label, c.Nom, c.Avant, c.Apres)
 		}
 	}
-	report += "Inserted " + strconv.Itoa(nInsert) + "\n"
-	report += "Updated  " + strconv.Itoa(nUpdate) + "\n"
-	report += "Total    " + strconv.Itoa(nInsert+nUpdate) + "\n"
-	return report
 }
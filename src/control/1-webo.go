@@ -88,6 +88,18 @@ func WeboExploitation() []webo.OptionString {
 	}
 }
 
+// Renvoie la liste des motifs de perte possibles au vidage d'un tas
+// dans un format utilisable par webo
+func WeboMotifPerte() []webo.OptionString {
+	res := []webo.OptionString{
+		webo.OptionString{OptionValue: "CHOOSE_MOTIF", OptionLabel: "--- Choisir ---"},
+	}
+	for _, motif := range model.MotifsPerte {
+		res = append(res, webo.OptionString{OptionValue: motif, OptionLabel: model.LabelMotifPerte(motif)})
+	}
+	return res
+}
+
 // Renvoie la liste des valorisations possibles
 // dans un format utilisable par webo
 // Utilisé uniquement dans le contrôleur de Chautre
@@ -7,15 +7,11 @@ Contrôle l'affichage de la page d'accueil et des pages générales (menu accuei
 package control
 
 import (
-	"archive/zip"
 	"bdl.local/bdl/ctxt"
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
 	"github.com/gorilla/mux"
-	"io/ioutil"
 	"net/http"
-	"os"
-	"os/exec"
 	"time"
 )
 
@@ -54,71 +50,19 @@ func ShowDoc(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// Sauvegarde manuelle de la base, cf model.CreerSauvegarde()
 func BackupDB(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
-	var err error
-	dirname := model.SERVER_ENV.BACKUP_DIR
-	filename := "bdl-" + time.Now().Format("2006-01-02-150405") + ".pgdump"
-	filepath := dirname + string(os.PathSeparator) + filename
-	//
-	// 1 - pg_dump
-	//
-	// PGPASSWORD='my_password' pg_dump --file my_dump_file -h _my_host -n my_schema -p my_port -U my_user my_database
-	//	dbURL := ctxt.AjusteDbURL(model.SERVER_ENV.DATABASE_URL, model.SERVER_ENV.DATABASE_SCHEMA)
-	cmd := exec.Command(
-		model.SERVER_ENV.CMD_PGDUMP,
-		//		dbURL,
-		model.SERVER_ENV.DATABASE_URL,
-		"--file="+filepath,
-		"--schema="+model.SERVER_ENV.DATABASE_SCHEMA,
-	)
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err != nil {
-		if model.SERVER_ENV.RUN_MODE == "prod" {
-			return werr.Wrapf(err, "Paramètres BDD invalides")
-		}
-		return werr.Wrapf(err, "Paramètres BDD invalides:\n%v", cmd.Args)
-	}
-	//
-	// 2 - zip
-	//
-	zipfilepath := filepath + ".zip"
-	zipfilename := filename + ".zip"
-	zipfile, err := os.Create(zipfilepath)
-	if err != nil {
-		return werr.Wrap(err)
-	}
-	zipwriter := zip.NewWriter(zipfile)
-	defer zipwriter.Close()
-	f, err := zipwriter.Create(filename)
+	s, err := model.CreerSauvegarde(ctx.DB)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	b, err := ioutil.ReadFile(filepath)
-	if err != nil {
-		return werr.Wrap(err)
-	}
-	_, err = f.Write(b)
-	if err != nil {
-		return werr.Wrap(err)
-	}
-	//
-	// 3 - clean
-	//
-	err = os.Remove(filepath)
-	if err != nil {
-		return werr.Wrap(err)
-	}
-	//
-	// 4 - affiche
-	//
 	ctx.TemplateName = "db-backup.html"
 	ctx.Page = &ctxt.Page{
 		Header: ctxt.Header{
 			Title: "Sauvegarde des données",
 		},
 		Menu:    "accueil",
-		Details: zipfilename,
+		Details: s.Fichier,
 	}
 	return nil
 }
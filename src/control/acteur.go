@@ -25,8 +25,9 @@ type detailsActeurForm struct {
 }
 
 type detailsActeurShow struct {
-	Acteur    *model.Acteur
-	Activites []*model.ActeurActivite
+	Acteur     *model.Acteur
+	Activites  []*model.ActeurActivite
+	Affactures []*model.Affacture
 }
 
 // *********************************************************
@@ -75,6 +76,10 @@ func ShowActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return werr.Wrap(err)
 	}
+	affactures, err := model.GetAffacturesOfActeur(ctx.DB, id)
+	if err != nil {
+		return werr.Wrap(err)
+	}
 	//
 	ctx.TemplateName = "acteur-show.html"
 	ctx.Page = &ctxt.Page{
@@ -91,8 +96,9 @@ func ShowActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 			},
 		},
 		Details: detailsActeurShow{
-			Acteur:    acteur,
-			Activites: activites,
+			Acteur:     acteur,
+			Activites:  activites,
+			Affactures: affactures,
 		},
 	}
 	return nil
@@ -111,7 +117,11 @@ func NewActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 			return werr.Wrap(err)
 		}
 		acteur.Deletable = true // nouvellement créé, pas SCTL, pas d'activité => effaçable
-		id, err := model.InsertActeur(ctx.DB, acteur)
+		var id int
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+			id, err = model.InsertActeur(tx, acteur)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -161,7 +171,9 @@ func UpdateActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 		}
 		// Actif et Deletable sont gérés lors d'un import SCTL
 		// ou lors de l'effacement d'activités le concernant
-		err = model.UpdateActeur(ctx.DB, acteur)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateActeur(tx, acteur)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -208,7 +220,9 @@ func DeleteActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteActeur(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteActeur(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
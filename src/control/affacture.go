@@ -1,6 +1,9 @@
 /*
+Affactures : calcul et affichage (PDF), enregistrement, liste des montants restant à affacturer.
+
 @copyright  BDL, Bois du Larzac.
 @licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Enregistrement des affactures
 */
 package control
 
@@ -17,8 +20,25 @@ import (
 )
 
 type detailsAffactureForm struct {
-	Acteur    *model.Acteur
-	UrlAction string
+	Acteur     *model.Acteur
+	UrlAction  string
+	Aujourdhui time.Time
+}
+
+type detailsAffactureList struct {
+	Affactures []*model.Affacture
+	Annee      string
+	Annees     []string
+}
+
+type detailsAffactureShow struct {
+	Affacture *model.Affacture
+}
+
+type detailsAffactureEnAttente struct {
+	EnAttente []*model.AffactureEnAttente
+	TotalHT   float64
+	TotalTTC  float64
 }
 
 // Affiche formulaire pour une "facture à l'envers"
@@ -42,116 +62,245 @@ func FormAffacture(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 			JSFiles: []string{"/static/js/toogle.js"},
 		},
 		Details: detailsAffactureForm{
-			Acteur:    acteur,
-			UrlAction: "/affacture/show",
+			Acteur:     acteur,
+			UrlAction:  "/affacture/show",
+			Aujourdhui: time.Now(),
 		},
 	}
 	return nil
 }
 
 // *********************************************************
+// Affiche le PDF d'une affacture calculée à partir du formulaire, sans l'enregistrer
 func ShowAffacture(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
-	var err error
-	//
-	// 1 - parse form
-	//
-	if err = r.ParseForm(); err != nil {
+	aff, err := affactureFromForm(r)
+	if err != nil {
 		return werr.Wrap(err)
 	}
-	var aff = model.Affacture{}
-	aff.IdActeur, err = strconv.Atoi(r.PostFormValue("id-acteur"))
+	aff.Acteur, err = model.GetActeur(ctx.DB, aff.IdActeur)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	aff.DateDebut, err = time.Parse("2006-01-02", r.PostFormValue("date-debut"))
+	err = aff.ComputeItems(ctx.DB)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	aff.DateFin, err = time.Parse("2006-01-02", r.PostFormValue("date-fin"))
+	return pdfAffacture(w, ctx.Config, aff)
+}
+
+// Enregistre une affacture calculée à partir du formulaire
+func NewAffacture(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	aff, err := affactureFromForm(r)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	if r.PostFormValue("AB") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "AB")
+	aff.DateAffacture, err = time.Parse("2006-01-02", r.PostFormValue("date-affacture"))
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("DB") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "DB")
+	aff.Notes = r.PostFormValue("notes")
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+		err = aff.ComputeItems(tx)
+		if err != nil {
+			return err
+		}
+		id, err = model.InsertAffacture(tx, aff)
+		return err
+	})
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("DC") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "DC")
+	ctx.Redirect = "/affacture/" + strconv.Itoa(id)
+	return nil
+}
+
+// Récupère les champs du formulaire affacture
+func affactureFromForm(r *http.Request) (aff *model.Affacture, err error) {
+	if err = r.ParseForm(); err != nil {
+		return aff, werr.Wrap(err)
 	}
-	if r.PostFormValue("BR") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "BR")
+	aff = &model.Affacture{}
+	aff.IdActeur, err = strconv.Atoi(r.PostFormValue("id-acteur"))
+	if err != nil {
+		return aff, werr.Wrap(err)
 	}
-	if r.PostFormValue("TR") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "TR")
+	aff.DateDebut, err = time.Parse("2006-01-02", r.PostFormValue("date-debut"))
+	if err != nil {
+		return aff, werr.Wrap(err)
 	}
-	if r.PostFormValue("TR-CO") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "TR-CO")
+	aff.DateFin, err = time.Parse("2006-01-02", r.PostFormValue("date-fin"))
+	if err != nil {
+		return aff, werr.Wrap(err)
 	}
-	if r.PostFormValue("TR-OU") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "TR-OU")
+	for _, typeActivite := range model.AffactureTypesActivites {
+		if r.PostFormValue(typeActivite) == "on" {
+			aff.TypesActivites = append(aff.TypesActivites, typeActivite)
+		}
 	}
-	if r.PostFormValue("RG") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "RG")
+	return aff, nil
+}
+
+// *********************************************************
+func ListAffactures(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	annee := vars["annee"]
+	if annee == "" {
+		// annee non spécifiée, on prend l'année courante
+		annee = strconv.Itoa(time.Now().Year())
 	}
-	if r.PostFormValue("RG-CO") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "RG-CO")
+	affactures, err := model.GetAffacturesOfYear(ctx.DB, annee)
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("RG-OU") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "RG-OU")
+	annees, err := model.GetAffactureDifferentYears(ctx.DB, annee)
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("CG") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "CG")
+	ctx.TemplateName = "affacture-list.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Affactures " + annee,
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "acteurs",
+		Footer: ctxt.Footer{
+			JSFiles: []string{
+				"/static/lib/table-sort/table-sort.js",
+			},
+		},
+		Details: detailsAffactureList{
+			Affactures: affactures,
+			Annee:      annee,
+			Annees:     annees,
+		},
 	}
-	if r.PostFormValue("CG-CO") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "CG-CO")
+	return nil
+}
+
+func ShowAffactureEnregistree(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("CG-OU") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "CG-OU")
+	aff, err := model.GetAffactureFull(ctx.DB, id)
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("LV") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "LV")
+	ctx.TemplateName = "affacture-show.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: aff.String() + " - " + aff.Acteur.String(),
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "acteurs",
+		Details: detailsAffactureShow{
+			Affacture: aff,
+		},
 	}
-	if r.PostFormValue("LV-CO") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "LV-CO")
+	return nil
+}
+
+func ShowAffacturePDF(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if r.PostFormValue("LV-OU") == "on" {
-		aff.TypesActivites = append(aff.TypesActivites, "LV-OU")
+	aff, err := model.GetAffactureFull(ctx.DB, id)
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	//
-	// 2- récup info dans model
-	//
-	acteur, err := model.GetActeur(ctx.DB, aff.IdActeur)
+	return pdfAffacture(w, ctx.Config, aff)
+}
+
+func DeleteAffacture(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = aff.ComputeItems(ctx.DB)
+	aff, err := model.GetAffacture(ctx.DB, id)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	//
-	// 3 - génère PDF
-	//
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteAffacture(tx, id)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/affacture/liste/" + strconv.Itoa(aff.DateAffacture.Year())
+	return nil
+}
+
+// Montants restant à affacturer, par acteur
+func ListAffacturesEnAttente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	enAttente, err := model.ComputeAffacturesEnAttente(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	details := detailsAffactureEnAttente{EnAttente: enAttente}
+	for _, elt := range enAttente {
+		details.TotalHT += elt.TotalHT
+		details.TotalTTC += elt.TotalTTC
+	}
+	ctx.TemplateName = "affacture-en-attente.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Montants restant à affacturer",
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "acteurs",
+		Footer: ctxt.Footer{
+			JSFiles: []string{
+				"/static/lib/table-sort/table-sort.js",
+			},
+		},
+		Details: details,
+	}
+	return nil
+}
+
+// *********************************************************
+// Génère le PDF d'une affacture, calculée ou enregistrée.
+// aff.Acteur doit être renseigné.
+func pdfAffacture(w http.ResponseWriter, conf *model.Config, aff *model.Affacture) error {
 	var str string
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	tr := pdf.UnicodeTranslatorFromDescriptor("") // "" defaults to "cp1252"
 	pdf.AddPage()
-	MetaDataPDF(pdf, tr, ctx.Config, "Affacture")
+	MetaDataPDF(pdf, tr, conf, "Affacture")
 	// Emetteur de la facture
-	str = StringActeurFacture(acteur)
+	str = StringActeurFacture(aff.Acteur)
 	pdf.SetXY(10, 10)
 	pdf.SetFont("Arial", "", 12)
 	pdf.MultiCell(100, 7, tr(str), "", "L", false)
 	// Destinataire de l'affacture (BDL)
-	str = tiglib.DateFrText(time.Now())
+	date := aff.DateAffacture
+	if date.IsZero() {
+		date = time.Now()
+	}
+	str = tiglib.DateFrText(date)
 	pdf.SetXY(145, 15)
 	pdf.Cell(50, 50, "Le "+tr(str))
 	str = "FACTURE"
 	pdf.SetXY(145, 25)
 	pdf.SetFont("Arial", "B", 18)
 	pdf.Cell(50, 70, str)
-	str = ctx.Config.Affacture.Adresse
+	if aff.Numero != "" {
+		pdf.SetXY(145, 57)
+		pdf.SetFont("Arial", "", 10)
+		pdf.Cell(50, 7, tr("N° "+aff.Numero))
+	}
+	str = conf.Affacture.Adresse
 	pdf.SetXY(145, 68)
 	pdf.SetFont("Arial", "", 10)
 	pdf.MultiCell(100, 7, tr(str), "", "L", false)
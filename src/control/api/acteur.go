@@ -0,0 +1,129 @@
+/*
+API - Acteurs
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strings"
+)
+
+func ListActeurs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	acteurs, err := model.GetSortedActeurs(ctx.DB, "nom")
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(acteurs))
+}
+
+func GetActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireActeur(ctx, w, http.StatusOK, id)
+}
+
+func NewActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	a := &model.Acteur{Actif: true}
+	err := lireJSON(r, a)
+	if err != nil {
+		return err
+	}
+	err = validerActeur(a)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		id, err = model.InsertActeur(tx, a)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireActeur(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	a, err := model.GetActeurFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	err = lireJSON(r, a)
+	if err != nil {
+		return err
+	}
+	a.Id = id
+	err = validerActeur(a)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateActeur(tx, a)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireActeur(ctx, w, http.StatusOK, id)
+}
+
+// Un acteur ayant participé à des activités ne peut pas être supprimé,
+// seulement marqué comme inactif (PUT avec Actif = false)
+func DeleteActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	a, err := model.GetActeur(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	deletable, err := a.IsDeletable(ctx.DB)
+	if err != nil {
+		return err
+	}
+	if !deletable || id == model.ID_SCTL || id == model.ID_BDL || id == model.ID_GFA {
+		return &Erreur{Status: http.StatusConflict, Message: "Cet acteur ne peut pas être supprimé"}
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteActeur(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func ecrireActeur(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	a, err := model.GetActeurFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	a.Deletable, err = a.IsDeletable(ctx.DB)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, status, objet(a))
+}
+
+func validerActeur(a *model.Acteur) error {
+	v := validation{}
+	a.Nom = strings.TrimSpace(a.Nom)
+	v.obligatoire("Nom", a.Nom)
+	for _, code := range a.CodesRole {
+		v.code("CodesRole", code, model.RoleMap)
+	}
+	return v.erreur()
+}
@@ -0,0 +1,324 @@
+/*
+API JSON versionnée (/api/v1), permettant de lire et modifier les données
+sans passer par les pages html.
+
+Authentification : même session que l'application web,
+  - soit par le cookie de session (appel depuis le navigateur),
+  - soit par l'en-tête "Authorization: Bearer <jeton>", le jeton étant obtenu par POST /api/v1/login.
+
+Format des données :
+  - Les noms des champs sont ceux des structs du model (ex : "DateDebut", "IdClient").
+  - Les dates sont au format AAAA-MM-JJ ; "" pour une date non renseignée.
+  - Les objets renvoyés ne contiennent que les champs simples des structs du model,
+    et les entités liées explicitement ajoutées par chaque handler (ex : les livraisons d'une vente).
+
+Création (POST) : les champs non fournis gardent leur valeur par défaut.
+Modification (PUT) : les champs non fournis gardent leur valeur actuelle.
+Les marques d'affacturage (*DatePay) et l'identité des factures (NumFacture, DateFacture)
+ne sont pas modifiables par l'API (erreur "Champ non modifiable", cf champsNonModifiables).
+
+Erreurs : renvoyées en JSON, ex :
+
+	{"erreur": "Données invalides", "champs": {"DateDebut": "Date obligatoire"}}
+
+avec le status http 400 (données invalides), 401 (non connecté), 403 (droits insuffisants),
+404 (ressource inexistante), 409 (suppression impossible) ou 500 (erreur interne).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Erreur renvoyée par un handler de l'API, transmise au client en JSON par EcrireErreur()
+type Erreur struct {
+	Status  int               `json:"-"`
+	Message string            `json:"erreur"`
+	Champs  map[string]string `json:"champs,omitempty"` // champ => message, pour les erreurs de validation
+}
+
+func (e *Erreur) Error() string {
+	return e.Message
+}
+
+// ************************** Réponses *******************************
+
+// Ecrit v en JSON dans la réponse
+func ecrireJSON(w http.ResponseWriter, status int, v interface{}) error {
+	res, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(res)
+	return nil
+}
+
+// Ecrit une erreur en JSON dans la réponse.
+// Une erreur qui n'est pas une *Erreur est une erreur interne (500),
+// sauf si elle provient d'une ligne inexistante en base (404).
+// Utilisé par Hapi() et Auth() (run-bdl.go)
+func EcrireErreur(w http.ResponseWriter, err error) {
+	var e *Erreur
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, sql.ErrNoRows):
+		e = &Erreur{Status: http.StatusNotFound, Message: "Ressource inexistante"}
+	default:
+		ctxt.LogError(err)
+		e = &Erreur{Status: http.StatusInternalServerError, Message: "Erreur interne"}
+	}
+	_ = ecrireJSON(w, e.Status, e)
+}
+
+// ************************** Paramètres *******************************
+
+// Renvoie un id contenu dans l'url de la requête
+func idFromVars(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		return 0, &Erreur{Status: http.StatusBadRequest, Message: "Identifiant invalide : " + mux.Vars(r)[name]}
+	}
+	return id, nil
+}
+
+// Renvoie le paramètre ?annee= de la requête, ou l'année courante
+func anneeFromQuery(r *http.Request) (string, error) {
+	annee := r.URL.Query().Get("annee")
+	if annee == "" {
+		return strconv.Itoa(time.Now().Year()), nil
+	}
+	if _, err := strconv.Atoi(annee); err != nil || len(annee) != 4 {
+		return "", &Erreur{Status: http.StatusBadRequest, Message: "Année invalide : " + annee}
+	}
+	return annee, nil
+}
+
+// ************************** Conversion struct <=> JSON *******************************
+
+// Champs simples des structs du model, lus et écrits par l'API.
+// Les autres champs (pointeurs, slices de pointeurs) ne sont pas exposés,
+// car ils peuvent contenir des cycles (ex : Tas.Chantier.Tas).
+func champSimple(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Int || t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// Renvoie les champs simples d'un struct du model (passé par pointeur)
+func objet(v interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	val := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < val.NumField(); i++ {
+		f := val.Type().Field(i)
+		if !f.IsExported() || !champSimple(f.Type) {
+			continue
+		}
+		switch x := val.Field(i).Interface().(type) {
+		case time.Time:
+			res[f.Name] = date2string(x)
+		case []int:
+			if x == nil {
+				x = []int{}
+			}
+			res[f.Name] = x
+		case []string:
+			if x == nil {
+				x = []string{}
+			}
+			res[f.Name] = x
+		default:
+			res[f.Name] = x
+		}
+	}
+	return res
+}
+
+// Applique objet() à chaque élément d'une slice de structs du model
+func objets(v interface{}) []map[string]interface{} {
+	res := []map[string]interface{}{}
+	val := reflect.ValueOf(v)
+	for i := 0; i < val.Len(); i++ {
+		res = append(res, objet(val.Index(i).Interface()))
+	}
+	return res
+}
+
+func date2string(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// Champs simples non modifiables par l'API, par struct du model :
+//   - marques d'affacturage (*DatePay), posées par l'enregistrement des affactures ;
+//   - identité des factures (NumFacture, DateFacture), gérée par le registre des factures.
+var champsNonModifiables = map[reflect.Type][]string{
+	reflect.TypeOf(model.PlaqOp{}):        {"DatePay"},
+	reflect.TypeOf(model.PlaqTrans{}):     {"GlDatePay", "CoDatePay", "CaDatePay", "TbDatePay"},
+	reflect.TypeOf(model.PlaqRange{}):     {"GlDatePay", "CoDatePay", "OuDatePay"},
+	reflect.TypeOf(model.PlaqTransfert{}): {"GlDatePay", "CoDatePay", "OuDatePay"},
+	reflect.TypeOf(model.VenteCharge{}):   {"GlDatePay", "MoDatePay", "OuDatePay"},
+	reflect.TypeOf(model.VenteLivre{}):    {"GlDatePay", "MoDatePay", "OuDatePay"},
+	reflect.TypeOf(model.VentePlaq{}):     {"NumFacture", "DateFacture"},
+	reflect.TypeOf(model.Chautre{}):       {"NumFacture", "DateFacture"},
+}
+
+// Remplit les champs de dest à partir du JSON contenu dans le corps de la requête.
+// dest = struct du model (seuls les champs simples sont modifiables, sauf champsNonModifiables)
+// extras = structs (passés par pointeur) contenant des champs supplémentaires propres à l'API
+// (ex : ids des UGs d'un chantier) ; tous leurs champs doivent être exportés.
+// Les champs absents du JSON ne sont pas modifiés.
+func lireJSON(r *http.Request, dest interface{}, extras ...interface{}) error {
+	data := map[string]json.RawMessage{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		return &Erreur{Status: http.StatusBadRequest, Message: "JSON invalide : " + err.Error()}
+	}
+	champs := map[string]reflect.Value{}
+	val := reflect.ValueOf(dest).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		f := val.Type().Field(i)
+		if f.IsExported() && champSimple(f.Type) {
+			champs[f.Name] = val.Field(i)
+		}
+	}
+	for _, e := range extras {
+		val = reflect.ValueOf(e).Elem()
+		for i := 0; i < val.NumField(); i++ {
+			champs[val.Type().Field(i).Name] = val.Field(i)
+		}
+	}
+	nonModifiables := map[string]bool{}
+	for _, nom := range champsNonModifiables[reflect.TypeOf(dest).Elem()] {
+		nonModifiables[nom] = true
+	}
+	v := validation{}
+	for k, raw := range data {
+		if nonModifiables[k] {
+			v[k] = "Champ non modifiable"
+			continue
+		}
+		champ, ok := champs[k]
+		if !ok {
+			v[k] = "Champ inconnu"
+			continue
+		}
+		if champ.Type() == reflect.TypeOf(time.Time{}) {
+			var str string
+			var t time.Time
+			err = json.Unmarshal(raw, &str)
+			if err == nil && str != "" {
+				t, err = time.Parse("2006-01-02", str)
+			}
+			if err != nil {
+				v[k] = "Date invalide (format attendu : AAAA-MM-JJ)"
+				continue
+			}
+			champ.Set(reflect.ValueOf(t))
+			continue
+		}
+		ptr := reflect.New(champ.Type())
+		if err = json.Unmarshal(raw, ptr.Interface()); err != nil {
+			v[k] = "Valeur invalide"
+			continue
+		}
+		champ.Set(ptr.Elem())
+	}
+	return v.erreur()
+}
+
+// ************************** Validation *******************************
+
+// Erreurs de validation : champ => message
+type validation map[string]string
+
+// Renvoie nil si pas d'erreur de validation
+func (v validation) erreur() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &Erreur{Status: http.StatusBadRequest, Message: "Données invalides", Champs: v}
+}
+
+func (v validation) obligatoire(champ, valeur string) {
+	if valeur == "" {
+		v[champ] = "Champ obligatoire"
+	}
+}
+
+func (v validation) date(champ string, t time.Time) {
+	if t.IsZero() {
+		v[champ] = "Date obligatoire"
+	}
+}
+
+func (v validation) positif(champ string, x float64) {
+	if x < 0 {
+		v[champ] = "Doit être positif ou nul"
+	}
+}
+
+func (v validation) strictementPositif(champ string, x float64) {
+	if x <= 0 {
+		v[champ] = "Doit être strictement positif"
+	}
+}
+
+// Vérifie qu'une valeur fait partie des codes d'une map du model (ex : model.EssenceMap)
+func (v validation) code(champ, valeur string, codes map[string]string) {
+	if _, ok := codes[valeur]; !ok {
+		v[champ] = "Valeur inconnue : " + valeur
+	}
+}
+
+// Vérifie qu'une valeur fait partie d'une liste de valeurs autorisées
+func (v validation) parmi(champ, valeur string, valeurs ...string) {
+	for _, autorisee := range valeurs {
+		if valeur == autorisee {
+			return
+		}
+	}
+	v[champ] = "Valeur inconnue : " + valeur
+}
+
+// Vérifie que des ids correspondent à des lignes existantes d'une table.
+// Un id égal à 0 est accepté si facultatif = true.
+func (v validation) existe(db model.DBOrTx, champ, table string, facultatif bool, ids ...int) error {
+	for _, id := range ids {
+		if id == 0 && facultatif {
+			continue
+		}
+		ok, err := model.ExisteId(db, table, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			v[champ] = "Identifiant inexistant : " + strconv.Itoa(id)
+			return nil
+		}
+	}
+	return nil
+}
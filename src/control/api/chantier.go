@@ -0,0 +1,78 @@
+/*
+Code commun aux chantiers plaquettes, autres valorisations et chauffage fermier :
+liens avec UGs, lieux-dits, fermiers et parcelles.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/model"
+)
+
+// Champs supplémentaires d'un chantier, lus et renvoyés par l'API,
+// correspondant aux paramètres idsUG, idsLieudit, idsFermier des fonctions Insert / Update du model
+type liensChantier struct {
+	IdsUG          []int
+	IdsLieudit     []int
+	IdsFermier     []int
+	LiensParcelles []*model.ChantierParcelle
+}
+
+func newLiensChantier(ugs []*model.UG, lieudits []*model.Lieudit, fermiers []*model.Fermier, liensParcelles []*model.ChantierParcelle) *liensChantier {
+	res := &liensChantier{
+		IdsUG:          []int{},
+		IdsLieudit:     []int{},
+		IdsFermier:     []int{},
+		LiensParcelles: liensParcelles,
+	}
+	for _, ug := range ugs {
+		res.IdsUG = append(res.IdsUG, ug.Id)
+	}
+	for _, ld := range lieudits {
+		res.IdsLieudit = append(res.IdsLieudit, ld.Id)
+	}
+	for _, f := range fermiers {
+		res.IdsFermier = append(res.IdsFermier, f.Id)
+	}
+	if res.LiensParcelles == nil {
+		res.LiensParcelles = []*model.ChantierParcelle{}
+	}
+	return res
+}
+
+// Ajoute les liens à un objet renvoyé par l'API
+func (l *liensChantier) ajouter(res map[string]interface{}) {
+	res["IdsUG"] = l.IdsUG
+	res["IdsLieudit"] = l.IdsLieudit
+	res["IdsFermier"] = l.IdsFermier
+	res["LiensParcelles"] = objets(l.LiensParcelles)
+}
+
+// Vérifie les liens d'un chantier
+// Au moins une UG est obligatoire, comme dans les formulaires de l'application
+func (l *liensChantier) valider(db model.DBOrTx, v validation) (err error) {
+	if len(l.IdsUG) == 0 {
+		v["IdsUG"] = "Au moins une UG est obligatoire"
+	}
+	if err = v.existe(db, "IdsUG", "ug", false, l.IdsUG...); err != nil {
+		return err
+	}
+	if err = v.existe(db, "IdsLieudit", "lieudit", false, l.IdsLieudit...); err != nil {
+		return err
+	}
+	if err = v.existe(db, "IdsFermier", "fermier", false, l.IdsFermier...); err != nil {
+		return err
+	}
+	for _, lien := range l.LiensParcelles {
+		if err = v.existe(db, "LiensParcelles", "parcelle", false, lien.IdParcelle); err != nil {
+			return err
+		}
+		if !lien.Entiere && lien.Surface <= 0 {
+			v["LiensParcelles"] = "Surface obligatoire pour une parcelle non entière"
+		}
+	}
+	return nil
+}
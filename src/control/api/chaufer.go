@@ -0,0 +1,151 @@
+/*
+API - Chantiers chauffage fermier
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+)
+
+// Liens d'un chantier chauffage fermier (pas de liens lieux-dits ni fermiers, cf model.InsertChaufer())
+type liensChaufer struct {
+	IdsUG          []int
+	LiensParcelles []*model.ChantierParcelle
+}
+
+func ListChaufers(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	annee, err := anneeFromQuery(r)
+	if err != nil {
+		return err
+	}
+	chantiers, err := model.GetChaufersOfYear(ctx.DB, annee)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(chantiers))
+}
+
+func GetChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireChaufer(ctx, w, http.StatusOK, id)
+}
+
+func NewChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	ch := &model.Chaufer{}
+	liens := &liensChaufer{IdsUG: []int{}, LiensParcelles: []*model.ChantierParcelle{}}
+	err := lireJSON(r, ch, liens)
+	if err != nil {
+		return err
+	}
+	err = validerChaufer(ctx.DB, ch, liens)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.LiensParcelles = liens.LiensParcelles
+		id, err = model.InsertChaufer(tx, ch, liens.IdsUG)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireChaufer(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	ch, err := model.GetChauferFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	liens := newLiensChaufer(ch)
+	err = lireJSON(r, ch, liens)
+	if err != nil {
+		return err
+	}
+	ch.Id = id
+	err = validerChaufer(ctx.DB, ch, liens)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.LiensParcelles = liens.LiensParcelles
+		return model.UpdateChaufer(tx, ch, liens.IdsUG)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireChaufer(ctx, w, http.StatusOK, id)
+}
+
+func DeleteChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetChaufer(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteChaufer(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func ecrireChaufer(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	ch, err := model.GetChauferFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	liens := newLiensChaufer(ch)
+	res := objet(ch)
+	res["IdsUG"] = liens.IdsUG
+	res["LiensParcelles"] = objets(liens.LiensParcelles)
+	return ecrireJSON(w, status, res)
+}
+
+func newLiensChaufer(ch *model.Chaufer) *liensChaufer {
+	res := &liensChaufer{IdsUG: []int{}, LiensParcelles: ch.LiensParcelles}
+	for _, ug := range ch.UGs {
+		res.IdsUG = append(res.IdsUG, ug.Id)
+	}
+	if res.LiensParcelles == nil {
+		res.LiensParcelles = []*model.ChantierParcelle{}
+	}
+	return res
+}
+
+func validerChaufer(db model.DBOrTx, ch *model.Chaufer, liens *liensChaufer) error {
+	v := validation{}
+	v.date("DateChantier", ch.DateChantier)
+	v.parmi("Exploitation", ch.Exploitation, "1", "2", "3", "4", "5")
+	v.code("Essence", ch.Essence, model.EssenceMap)
+	v.strictementPositif("Volume", ch.Volume)
+	v.parmi("Unite", ch.Unite, "MA", "ST")
+	if err := v.existe(db, "IdFermier", "fermier", false, ch.IdFermier); err != nil {
+		return err
+	}
+	// même vérification que pour les autres chantiers, sans lieux-dits ni fermiers
+	tmp := &liensChantier{IdsUG: liens.IdsUG, LiensParcelles: liens.LiensParcelles}
+	if err := tmp.valider(db, v); err != nil {
+		return err
+	}
+	return v.erreur()
+}
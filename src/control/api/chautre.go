@@ -0,0 +1,143 @@
+/*
+API - Chantiers autres valorisations
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strconv"
+)
+
+func ListChautres(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	annee, err := anneeFromQuery(r)
+	if err != nil {
+		return err
+	}
+	chantiers, err := model.GetChautresOfYear(ctx.DB, annee)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(chantiers))
+}
+
+func GetChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireChautre(ctx, w, http.StatusOK, id)
+}
+
+// Un nouveau numéro de facture est attribué, comme dans le formulaire de l'application
+// (NumFacture n'est pas modifiable par l'API, cf champsNonModifiables)
+func NewChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	ch := &model.Chautre{}
+	liens := newLiensChantier(nil, nil, nil, nil)
+	err := lireJSON(r, ch, liens)
+	if err != nil {
+		return err
+	}
+	err = validerChautre(ctx.DB, ch, liens)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.NumFacture, err = model.NouveauNumeroFacture(tx, strconv.Itoa(ch.DateContrat.Year()))
+		if err != nil {
+			return err
+		}
+		ch.LiensParcelles = liens.LiensParcelles
+		id, err = model.InsertChautre(tx, ch, liens.IdsUG, liens.IdsLieudit, liens.IdsFermier)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireChautre(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	ch, err := model.GetChautreFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	liens := newLiensChantier(ch.UGs, ch.Lieudits, ch.Fermiers, ch.LiensParcelles)
+	err = lireJSON(r, ch, liens)
+	if err != nil {
+		return err
+	}
+	ch.Id = id
+	err = validerChautre(ctx.DB, ch, liens)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.LiensParcelles = liens.LiensParcelles
+		return model.UpdateChautre(tx, ch, liens.IdsUG, liens.IdsLieudit, liens.IdsFermier)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireChautre(ctx, w, http.StatusOK, id)
+}
+
+func DeleteChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetChautre(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteChautre(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func ecrireChautre(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	ch, err := model.GetChautreFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	res := objet(ch)
+	newLiensChantier(ch.UGs, ch.Lieudits, ch.Fermiers, ch.LiensParcelles).ajouter(res)
+	return ecrireJSON(w, status, res)
+}
+
+// L'unité est calculée à partir de la valorisation, comme dans le formulaire de l'application
+func validerChautre(db model.DBOrTx, ch *model.Chautre, liens *liensChantier) error {
+	v := validation{}
+	v.code("TypeVente", ch.TypeVente, model.ChautreTypeVenteMap)
+	v.parmi("TypeValo", ch.TypeValo, model.AllValoCodes()...)
+	ch.Unite = model.CodeValo2CodeUnite(ch.TypeValo)
+	v.date("DateContrat", ch.DateContrat)
+	v.positif("VolumeContrat", ch.VolumeContrat)
+	v.strictementPositif("VolumeRealise", ch.VolumeRealise)
+	v.parmi("Exploitation", ch.Exploitation, "1", "2", "3", "4", "5")
+	v.code("Essence", ch.Essence, model.EssenceMap)
+	v.positif("PUHT", ch.PUHT)
+	v.positif("TVA", ch.TVA)
+	if err := v.existe(db, "IdAcheteur", "acteur", false, ch.IdAcheteur); err != nil {
+		return err
+	}
+	if err := liens.valider(db, v); err != nil {
+		return err
+	}
+	return v.erreur()
+}
@@ -0,0 +1,145 @@
+/*
+API - Mesures d'humidité
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+)
+
+func ListHumids(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	annee, err := anneeFromQuery(r)
+	if err != nil {
+		return err
+	}
+	mesures, err := model.GetHumidsOfYear(ctx.DB, annee)
+	if err != nil {
+		return err
+	}
+	res := []map[string]interface{}{}
+	for _, h := range mesures {
+		res = append(res, objetHumid(h))
+	}
+	return ecrireJSON(w, http.StatusOK, res)
+}
+
+func GetHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireHumid(ctx, w, http.StatusOK, id)
+}
+
+func NewHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	h := &model.Humid{}
+	err := lireJSON(r, h)
+	if err != nil {
+		return err
+	}
+	err = validerHumid(ctx.DB, h)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		id, err = model.InsertHumid(tx, h)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireHumid(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	h, err := model.GetHumidFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	h.IdsMesureurs = idsMesureurs(h)
+	err = lireJSON(r, h)
+	if err != nil {
+		return err
+	}
+	h.Id = id
+	err = validerHumid(ctx.DB, h)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateHumid(tx, h)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireHumid(ctx, w, http.StatusOK, id)
+}
+
+func DeleteHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetHumidFull(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteHumid(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func ecrireHumid(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	h, err := model.GetHumidFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, status, objetHumid(h))
+}
+
+// IdsMesureurs n'est pas rempli par model.GetHumidFull()
+func objetHumid(h *model.Humid) map[string]interface{} {
+	h.IdsMesureurs = idsMesureurs(h)
+	return objet(h)
+}
+
+func idsMesureurs(h *model.Humid) []int {
+	res := []int{}
+	for _, a := range h.Mesureurs {
+		res = append(res, a.Id)
+	}
+	return res
+}
+
+func validerHumid(db model.DBOrTx, h *model.Humid) error {
+	v := validation{}
+	v.date("DateMesure", h.DateMesure)
+	if h.Valeur < 0 || h.Valeur > 100 {
+		v["Valeur"] = "Doit être un pourcentage, entre 0 et 100"
+	}
+	if len(h.IdsMesureurs) == 0 {
+		v["IdsMesureurs"] = "Au moins un mesureur est obligatoire"
+	}
+	if err := v.existe(db, "IdsMesureurs", "acteur", false, h.IdsMesureurs...); err != nil {
+		return err
+	}
+	if err := v.existe(db, "IdTas", "tas", false, h.IdTas); err != nil {
+		return err
+	}
+	return v.erreur()
+}
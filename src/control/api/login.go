@@ -0,0 +1,60 @@
+/*
+API - Connexion
+
+POST /api/v1/login avec {"Login": "...", "Password": "..."} renvoie un jeton de session,
+à transmettre dans l'en-tête "Authorization: Bearer <jeton>" des requêtes suivantes.
+Le jeton expire au bout de la durée de session (duree-session dans config.yml).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strings"
+)
+
+func Login(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	data := &struct {
+		Login    string
+		Password string
+	}{}
+	err := lireJSON(r, &struct{}{}, data)
+	if err != nil {
+		return err
+	}
+	u, err := model.AuthentifierUtilisateur(ctx.DB, strings.TrimSpace(data.Login), data.Password)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return &Erreur{Status: http.StatusUnauthorized, Message: "Identifiant ou mot de passe incorrect"}
+	}
+	s, err := model.InsertSession(ctx.DB, ctx.Config, u.Id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, map[string]interface{}{
+		"Token":      s.Token,
+		"DateExpire": s.DateExpire,
+		"Login":      u.Login,
+		"Role":       u.Role,
+	})
+}
+
+// Supprime la session correspondant au jeton transmis dans l'en-tête Authorization
+func Logout(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	err := model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteSession(tx, token)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,347 @@
+/*
+API - Activités liées à un chantier plaquettes :
+opérations simples (abattage...), transports vers le lieu de stockage, rangements.
+
+Les modifications du stock des tas sont faites par le model (InsertPlaqTrans() etc.).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+)
+
+// ************************** Opérations simples *******************************
+
+func GetPlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	op, err := model.GetPlaqOp(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(op))
+}
+
+func NewPlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	idChantier, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaq(ctx.DB, idChantier); err != nil {
+		return err
+	}
+	op := &model.PlaqOp{}
+	if err = lireJSON(r, op); err != nil {
+		return err
+	}
+	op.IdChantier = idChantier
+	if err = validerPlaqOp(ctx.DB, op); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		op.Id, err = model.InsertPlaqOp(tx, op)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusCreated, objet(op))
+}
+
+func UpdatePlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	op, err := model.GetPlaqOp(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	idChantier := op.IdChantier
+	if err = lireJSON(r, op); err != nil {
+		return err
+	}
+	op.Id, op.IdChantier = id, idChantier
+	if err = validerPlaqOp(ctx.DB, op); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdatePlaqOp(tx, op)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(op))
+}
+
+func DeletePlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaqOp(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqOp(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func validerPlaqOp(db model.DBOrTx, op *model.PlaqOp) error {
+	v := validation{}
+	v.parmi("TypOp", op.TypOp, "AB", "BR", "DB", "DC")
+	v.date("DateDebut", op.DateDebut)
+	v.date("DateFin", op.DateFin)
+	v.strictementPositif("Qte", op.Qte)
+	v.parmi("Unite", op.Unite, "JO", "HE", "MA", "ST")
+	v.positif("PUHT", op.PUHT)
+	v.positif("TVA", op.TVA)
+	if err := v.existe(db, "IdActeur", "acteur", false, op.IdActeur); err != nil {
+		return err
+	}
+	return v.erreur()
+}
+
+// ************************** Transports *******************************
+
+func GetPlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	pt, err := model.GetPlaqTrans(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(pt))
+}
+
+func NewPlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	idChantier, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaq(ctx.DB, idChantier); err != nil {
+		return err
+	}
+	pt := &model.PlaqTrans{}
+	if err = lireJSON(r, pt); err != nil {
+		return err
+	}
+	pt.IdChantier = idChantier
+	if err = validerPlaqTrans(ctx.DB, pt); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		pt.Id, err = model.InsertPlaqTrans(tx, pt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusCreated, objet(pt))
+}
+
+func UpdatePlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	pt, err := model.GetPlaqTrans(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	idChantier := pt.IdChantier
+	if err = lireJSON(r, pt); err != nil {
+		return err
+	}
+	pt.Id, pt.IdChantier = id, idChantier
+	if err = validerPlaqTrans(ctx.DB, pt); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdatePlaqTrans(tx, pt)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(pt))
+}
+
+func DeletePlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaqTrans(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqTrans(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// TypeCout : G (global), C (camion) ou T (tracteur), cf model.PlaqTrans
+func validerPlaqTrans(db model.DBOrTx, pt *model.PlaqTrans) error {
+	v := validation{}
+	v.date("DateTrans", pt.DateTrans)
+	v.strictementPositif("Qte", pt.Qte)
+	v.positif("PourcentPerte", pt.PourcentPerte)
+	v.parmi("TypeCout", pt.TypeCout, "G", "C", "T")
+	if err := validerTasChantier(db, v, pt.IdTas, pt.IdChantier); err != nil {
+		return err
+	}
+	if err := validerIntervenants(db, v, pt.TypeCout == "G", "IdTransporteur", pt.IdTransporteur, pt.IdConducteur, pt.IdProprioutil); err != nil {
+		return err
+	}
+	return v.erreur()
+}
+
+// ************************** Rangements *******************************
+
+func GetPlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	pr, err := model.GetPlaqRange(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(pr))
+}
+
+func NewPlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	idChantier, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaq(ctx.DB, idChantier); err != nil {
+		return err
+	}
+	pr := &model.PlaqRange{}
+	if err = lireJSON(r, pr); err != nil {
+		return err
+	}
+	pr.IdChantier = idChantier
+	if err = validerPlaqRange(ctx.DB, pr); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		pr.Id, err = model.InsertPlaqRange(tx, pr)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusCreated, objet(pr))
+}
+
+func UpdatePlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	pr, err := model.GetPlaqRange(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	idChantier := pr.IdChantier
+	if err = lireJSON(r, pr); err != nil {
+		return err
+	}
+	pr.Id, pr.IdChantier = id, idChantier
+	if err = validerPlaqRange(ctx.DB, pr); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdatePlaqRange(tx, pr)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(pr))
+}
+
+func DeletePlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaqRange(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqRange(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// TypeCout : G (global) ou D (détail), cf model.PlaqRange
+func validerPlaqRange(db model.DBOrTx, pr *model.PlaqRange) error {
+	v := validation{}
+	v.date("DateRange", pr.DateRange)
+	v.parmi("TypeCout", pr.TypeCout, "G", "D")
+	if err := validerTasChantier(db, v, pr.IdTas, pr.IdChantier); err != nil {
+		return err
+	}
+	if err := validerIntervenants(db, v, pr.TypeCout == "G", "IdRangeur", pr.IdRangeur, pr.IdConducteur, pr.IdProprioutil); err != nil {
+		return err
+	}
+	return v.erreur()
+}
+
+// ************************** Auxiliaires *******************************
+
+// Vérifie que le tas existe et appartient au chantier
+func validerTasChantier(db model.DBOrTx, v validation, idTas, idChantier int) error {
+	if err := v.existe(db, "IdTas", "tas", false, idTas); err != nil {
+		return err
+	}
+	if _, ok := v["IdTas"]; ok {
+		return nil
+	}
+	tas, err := model.GetTas(db, idTas)
+	if err != nil {
+		return err
+	}
+	if tas.IdChantier != idChantier {
+		v["IdTas"] = "Le tas n'appartient pas au chantier"
+	}
+	return nil
+}
+
+// Vérifie les acteurs d'une activité ayant un coût global ou détaillé (transport, rangement, livraison, chargement) :
+// coût global => l'acteur global (transporteur, rangeur...) est obligatoire,
+// sinon le conducteur et le propriétaire de l'outil sont obligatoires.
+func validerIntervenants(db model.DBOrTx, v validation, global bool, champGlobal string, idGlobal, idConducteur, idProprioutil int) error {
+	if global {
+		return v.existe(db, champGlobal, "acteur", false, idGlobal)
+	}
+	if err := v.existe(db, "IdConducteur", "acteur", false, idConducteur); err != nil {
+		return err
+	}
+	return v.existe(db, "IdProprioutil", "acteur", false, idProprioutil)
+}
@@ -0,0 +1,161 @@
+/*
+API - Chantiers plaquettes
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+)
+
+// Lieux de stockage d'un chantier plaquettes.
+// Un tas est créé (ou supprimé) pour chaque lieu de stockage ajouté (ou retiré), cf model.UpdatePlaq()
+type plaqStockages struct {
+	IdsStockage []int
+}
+
+func ListPlaqs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	annee, err := anneeFromQuery(r)
+	if err != nil {
+		return err
+	}
+	chantiers, err := model.GetPlaqsOfYear(ctx.DB, annee)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(chantiers))
+}
+
+func GetPlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrirePlaq(ctx, w, http.StatusOK, id)
+}
+
+func NewPlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	ch := &model.Plaq{}
+	liens := newLiensChantier(nil, nil, nil, nil)
+	stockages := &plaqStockages{IdsStockage: []int{}}
+	err := lireJSON(r, ch, liens, stockages)
+	if err != nil {
+		return err
+	}
+	err = validerPlaq(ctx.DB, ch, liens, stockages)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.LiensParcelles = liens.LiensParcelles
+		id, err = model.InsertPlaq(tx, ch, stockages.IdsStockage, liens.IdsUG, liens.IdsLieudit, liens.IdsFermier)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrirePlaq(ctx, w, http.StatusCreated, id)
+}
+
+func UpdatePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	ch, err := model.GetPlaqFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	liens := newLiensChantier(ch.UGs, ch.Lieudits, ch.Fermiers, ch.LiensParcelles)
+	stockages := &plaqStockages{IdsStockage: idsStockagePlaq(ch)}
+	err = lireJSON(r, ch, liens, stockages)
+	if err != nil {
+		return err
+	}
+	ch.Id = id
+	err = validerPlaq(ctx.DB, ch, liens, stockages)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		ch.LiensParcelles = liens.LiensParcelles
+		return model.UpdatePlaq(tx, ch, stockages.IdsStockage, liens.IdsUG, liens.IdsLieudit, liens.IdsFermier)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrirePlaq(ctx, w, http.StatusOK, id)
+}
+
+func DeletePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetPlaq(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaq(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Renvoie un chantier plaquettes avec ses liens, ses tas et ses activités
+func ecrirePlaq(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	ch, err := model.GetPlaqFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	res := objet(ch)
+	newLiensChantier(ch.UGs, ch.Lieudits, ch.Fermiers, ch.LiensParcelles).ajouter(res)
+	res["IdsStockage"] = idsStockagePlaq(ch)
+	res["Tas"] = objets(ch.Tas)
+	res["Operations"] = objets(ch.Operations)
+	res["Transports"] = objets(ch.Transports)
+	res["Rangements"] = objets(ch.Rangements)
+	return ecrireJSON(w, status, res)
+}
+
+func idsStockagePlaq(ch *model.Plaq) []int {
+	res := []int{}
+	for _, tas := range ch.Tas {
+		res = append(res, tas.IdStockage)
+	}
+	return res
+}
+
+func validerPlaq(db model.DBOrTx, ch *model.Plaq, liens *liensChantier, stockages *plaqStockages) error {
+	v := validation{}
+	v.date("DateDebut", ch.DateDebut)
+	v.date("DateFin", ch.DateFin)
+	if ch.DateFin.Before(ch.DateDebut) {
+		v["DateFin"] = "Doit être postérieure à DateDebut"
+	}
+	v.positif("Surface", ch.Surface)
+	v.parmi("Granulo", ch.Granulo, "P16", "P45")
+	v.parmi("Exploitation", ch.Exploitation, "1", "2", "3", "4", "5")
+	v.code("Essence", ch.Essence, model.EssenceMap)
+	v.positif("FraisRepas", ch.FraisRepas)
+	v.positif("FraisReparation", ch.FraisReparation)
+	if len(stockages.IdsStockage) == 0 {
+		v["IdsStockage"] = "Au moins un lieu de stockage est obligatoire"
+	}
+	if err := v.existe(db, "IdsStockage", "stockage", false, stockages.IdsStockage...); err != nil {
+		return err
+	}
+	if err := liens.valider(db, v); err != nil {
+		return err
+	}
+	return v.erreur()
+}
@@ -0,0 +1,234 @@
+/*
+API - Lieux de stockage et tas
+
+Les tas ne sont pas créés directement :
+un tas est créé pour chaque lieu de stockage d'un chantier plaquettes (cf IdsStockage dans plaq.go).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ************************** Stockages *******************************
+
+// Renvoie les lieux de stockage actifs, ou les lieux de stockage archivés si ?archives=true
+func ListStockages(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	stockages, err := model.GetStockagesFull(ctx.DB, r.URL.Query().Get("archives") != "true")
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(stockages))
+}
+
+func GetStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireStockage(ctx, w, http.StatusOK, id)
+}
+
+func NewStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	s := &model.Stockage{}
+	err := lireJSON(r, s)
+	if err != nil {
+		return err
+	}
+	err = validerStockage(s)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		id, err = model.InsertStockage(tx, s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireStockage(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	s, err := model.GetStockage(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	err = lireJSON(r, s)
+	if err != nil {
+		return err
+	}
+	s.Id = id
+	err = validerStockage(s)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateStockage(tx, s)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireStockage(ctx, w, http.StatusOK, id)
+}
+
+// Un lieu de stockage ayant déjà été utilisé ne peut pas être supprimé, seulement archivé (PUT avec Archived = true)
+func DeleteStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	s, err := model.GetStockage(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	err = s.ComputeDeletableAndArchivable(ctx.DB)
+	if err != nil {
+		return err
+	}
+	if !s.Deletable {
+		return &Erreur{Status: http.StatusConflict, Message: "Ce lieu de stockage a été utilisé, il ne peut pas être supprimé"}
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteStockage(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Renvoie un lieu de stockage avec ses frais et ses tas actifs
+func ecrireStockage(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	s, err := model.GetStockageFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	res := objet(s)
+	res["Frais"] = objets(s.Frais)
+	res["TasActifs"] = objets(s.TasActifs)
+	return ecrireJSON(w, status, res)
+}
+
+func validerStockage(s *model.Stockage) error {
+	v := validation{}
+	s.Nom = strings.TrimSpace(s.Nom)
+	v.obligatoire("Nom", s.Nom)
+	return v.erreur()
+}
+
+// ************************** Tas *******************************
+
+// Renvoie les tas actifs (non vides)
+func ListTas(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	tas, err := model.GetAllTasActifsFull(ctx.DB)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(tas))
+}
+
+// Renvoie un tas avec ses mesures d'humidité et l'évolution de son stock
+func GetTas(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	tas, err := model.GetTasFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	err = tas.ComputeMesuresHumidite(ctx.DB)
+	if err != nil {
+		return err
+	}
+	err = tas.ComputeEvolutionStock(ctx.DB)
+	if err != nil {
+		return err
+	}
+	res := objet(tas)
+	res["MesuresHumidite"] = objets(tas.MesuresHumidite)
+	res["EvolutionStock"] = objets(tas.EvolutionStock)
+	return ecrireJSON(w, http.StatusOK, res)
+}
+
+// Signale un tas comme vide, à la date DateVidage, avec le motif de la perte du stock restant
+// (JSON : {"DateVidage": "AAAA-MM-JJ", "MotifPerte": "PO"}, cf model.MotifsPerte)
+func ViderTas(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	tas, err := model.GetTas(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	vidage := &struct {
+		DateVidage time.Time
+		MotifPerte string
+	}{}
+	err = lireJSON(r, &struct{}{}, vidage)
+	if err != nil {
+		return err
+	}
+	v := validation{}
+	v.date("DateVidage", vidage.DateVidage)
+	v.parmi("MotifPerte", vidage.MotifPerte, model.MotifsPerte...)
+	if !tas.Actif {
+		v["Actif"] = "Le tas est déjà vide"
+	}
+	if err = v.erreur(); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DesactiverTas(tx, id, vidage.DateVidage, vidage.MotifPerte)
+	})
+	if err != nil {
+		return err
+	}
+	tas, err = model.GetTasFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(tas))
+}
+
+// Rouvre un tas signalé vide par erreur ; le stock d'avant le vidage est restauré
+func RouvrirTas(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	tas, err := model.GetTas(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	if tas.Actif {
+		return (validation{"Actif": "Le tas n'est pas vide"}).erreur()
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.RouvrirTas(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	tas, err = model.GetTasFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(tas))
+}
@@ -0,0 +1,361 @@
+/*
+API - Ventes plaquettes, avec leurs livraisons et chargements
+
+Les modifications du stock des tas sont faites par le model (InsertVenteCharge() etc.).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package api
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strconv"
+)
+
+// ************************** Ventes *******************************
+
+func ListVentePlaqs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	annee, err := anneeFromQuery(r)
+	if err != nil {
+		return err
+	}
+	ventes, err := model.GetVentePlaqsOfYear(ctx.DB, annee)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objets(ventes))
+}
+
+func GetVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireVentePlaq(ctx, w, http.StatusOK, id)
+}
+
+// Un nouveau numéro de facture est attribué, comme dans le formulaire de l'application
+// (NumFacture n'est pas modifiable par l'API, cf champsNonModifiables)
+func NewVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vp := &model.VentePlaq{}
+	err := lireJSON(r, vp)
+	if err != nil {
+		return err
+	}
+	err = validerVentePlaq(ctx.DB, vp)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		vp.NumFacture, err = model.NouveauNumeroFacture(tx, strconv.Itoa(vp.DateVente.Year()))
+		if err != nil {
+			return err
+		}
+		id, err = model.InsertVentePlaq(tx, vp)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireVentePlaq(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	vp, err := model.GetVentePlaq(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	err = lireJSON(r, vp)
+	if err != nil {
+		return err
+	}
+	vp.Id = id
+	err = validerVentePlaq(ctx.DB, vp)
+	if err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateVentePlaq(tx, vp)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireVentePlaq(ctx, w, http.StatusOK, id)
+}
+
+func DeleteVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetVentePlaq(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVentePlaq(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Renvoie une vente avec ses livraisons, chaque livraison contenant ses chargements
+func ecrireVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	vp, err := model.GetVentePlaqFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	res := objet(vp)
+	livraisons := []map[string]interface{}{}
+	for _, vl := range vp.Livraisons {
+		livraison := objet(vl)
+		livraison["Chargements"] = objets(vl.Chargements)
+		livraisons = append(livraisons, livraison)
+	}
+	res["Livraisons"] = livraisons
+	idsChantier := []int{}
+	for _, ch := range vp.Chantiers {
+		idsChantier = append(idsChantier, ch.Id)
+	}
+	res["IdsChantier"] = idsChantier
+	return ecrireJSON(w, status, res)
+}
+
+// FactureLivraisonUnite : "map" ou "km", cf model.VentePlaq
+func validerVentePlaq(db model.DBOrTx, vp *model.VentePlaq) error {
+	v := validation{}
+	v.date("DateVente", vp.DateVente)
+	v.positif("PUHT", vp.PUHT)
+	v.positif("TVA", vp.TVA)
+	if vp.FactureLivraison {
+		v.positif("FactureLivraisonPUHT", vp.FactureLivraisonPUHT)
+		v.positif("FactureLivraisonTVA", vp.FactureLivraisonTVA)
+		v.parmi("FactureLivraisonUnite", vp.FactureLivraisonUnite, "map", "km")
+		if vp.FactureLivraisonUnite == "km" {
+			v.strictementPositif("FactureLivraisonNbKm", vp.FactureLivraisonNbKm)
+		}
+	}
+	if err := v.existe(db, "IdClient", "acteur", false, vp.IdClient); err != nil {
+		return err
+	}
+	if err := v.existe(db, "IdFournisseur", "acteur", false, vp.IdFournisseur); err != nil {
+		return err
+	}
+	return v.erreur()
+}
+
+// ************************** Livraisons *******************************
+
+func GetVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	return ecrireVenteLivre(ctx, w, http.StatusOK, id)
+}
+
+func NewVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	idVente, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetVentePlaq(ctx.DB, idVente); err != nil {
+		return err
+	}
+	vl := &model.VenteLivre{}
+	if err = lireJSON(r, vl); err != nil {
+		return err
+	}
+	vl.IdVente = idVente
+	if err = validerVenteLivre(ctx.DB, vl); err != nil {
+		return err
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		id, err = model.InsertVenteLivre(tx, vl)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireVenteLivre(ctx, w, http.StatusCreated, id)
+}
+
+func UpdateVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	vl, err := model.GetVenteLivre(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	idVente := vl.IdVente
+	if err = lireJSON(r, vl); err != nil {
+		return err
+	}
+	vl.Id, vl.IdVente = id, idVente
+	if err = validerVenteLivre(ctx.DB, vl); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateVenteLivre(tx, vl)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireVenteLivre(ctx, w, http.StatusOK, id)
+}
+
+func DeleteVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetVenteLivre(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVenteLivre(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func ecrireVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, status int, id int) error {
+	vl, err := model.GetVenteLivreFull(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	res := objet(vl)
+	res["Chargements"] = objets(vl.Chargements)
+	return ecrireJSON(w, status, res)
+}
+
+// TypeCout : G (global) ou D (détail), cf model.VenteLivre
+func validerVenteLivre(db model.DBOrTx, vl *model.VenteLivre) error {
+	v := validation{}
+	v.date("DateLivre", vl.DateLivre)
+	v.parmi("TypeCout", vl.TypeCout, "G", "D")
+	if err := validerIntervenants(db, v, vl.TypeCout == "G", "IdLivreur", vl.IdLivreur, vl.IdConducteur, vl.IdProprioutil); err != nil {
+		return err
+	}
+	return v.erreur()
+}
+
+// ************************** Chargements *******************************
+
+func GetVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	vc, err := model.GetVenteCharge(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(vc))
+}
+
+func NewVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	idLivraison, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	vl, err := model.GetVenteLivre(ctx.DB, idLivraison)
+	if err != nil {
+		return err
+	}
+	vc := &model.VenteCharge{}
+	if err = lireJSON(r, vc); err != nil {
+		return err
+	}
+	vc.IdLivraison, vc.IdVente = idLivraison, vl.IdVente
+	if err = validerVenteCharge(ctx.DB, vc); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		vc.Id, err = model.InsertVenteCharge(tx, vc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusCreated, objet(vc))
+}
+
+func UpdateVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	vc, err := model.GetVenteCharge(ctx.DB, id)
+	if err != nil {
+		return err
+	}
+	if err = vc.ComputeIdVente(ctx.DB); err != nil {
+		return err
+	}
+	idLivraison, idVente := vc.IdLivraison, vc.IdVente
+	if err = lireJSON(r, vc); err != nil {
+		return err
+	}
+	vc.Id, vc.IdLivraison, vc.IdVente = id, idLivraison, idVente
+	if err = validerVenteCharge(ctx.DB, vc); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.UpdateVenteCharge(tx, vc)
+	})
+	if err != nil {
+		return err
+	}
+	return ecrireJSON(w, http.StatusOK, objet(vc))
+}
+
+func DeleteVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := idFromVars(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err = model.GetVenteCharge(ctx.DB, id); err != nil {
+		return err
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVenteCharge(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// TypeCout : G (global) ou D (détail), cf model.VenteCharge
+func validerVenteCharge(db model.DBOrTx, vc *model.VenteCharge) error {
+	v := validation{}
+	v.date("DateCharge", vc.DateCharge)
+	v.strictementPositif("Qte", vc.Qte)
+	v.parmi("TypeCout", vc.TypeCout, "G", "D")
+	if err := v.existe(db, "IdTas", "tas", false, vc.IdTas); err != nil {
+		return err
+	}
+	if err := validerIntervenants(db, v, vc.TypeCout == "G", "IdChargeur", vc.IdChargeur, vc.IdConducteur, vc.IdProprioutil); err != nil {
+		return err
+	}
+	return v.erreur()
+}
@@ -0,0 +1,76 @@
+/*
+Affichage de l'historique des modifications (cf model/audit.go)
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type detailsHistorique struct {
+	Entite    string
+	IdEntite  int
+	UrlRetour string
+	Audits    []*model.Audit
+}
+
+func ShowHistoriquePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "plaq", "/chantier/plaquette/", "production")
+}
+
+func ShowHistoriqueChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "chautre", "/chantier/autre/", "production")
+}
+
+func ShowHistoriqueChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "chaufer", "/chantier/chauffage-fermier/", "production")
+}
+
+func ShowHistoriqueVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "venteplaq", "/vente/", "ventes")
+}
+
+func ShowHistoriqueActeur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "acteur", "/acteur/", "acteurs")
+}
+
+func ShowHistoriqueStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	return showHistorique(ctx, r, "stockage", "/stockage/liste#stockage-", "accueil")
+}
+
+// Auxiliaire des fonctions ShowHistorique*()
+// urlEntite : url de la page de l'entité, sans l'id
+func showHistorique(ctx *ctxt.Context, r *http.Request, entite, urlEntite, menu string) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	audits, err := model.GetAuditsEntite(ctx.DB, entite, id)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Historique " + model.AuditEntiteMap[entite] + " " + strconv.Itoa(id),
+		},
+		Menu: menu,
+		Details: detailsHistorique{
+			Entite:    entite,
+			IdEntite:  id,
+			UrlRetour: urlEntite + strconv.Itoa(id),
+			Audits:    audits,
+		},
+	}
+	ctx.TemplateName = "historique.html"
+	return nil
+}
@@ -0,0 +1,280 @@
+/*
+Bilans par saison au format PDF (activités et ventes),
+à partir des mêmes résultats que les onglets "Bilan / saison" des pages de recherche.
+
+Une page par saison, avec les filtres de la recherche ;
+volumes et prix HT par valorisation, répartis par propriétaire.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"github.com/jung-kurt/gofpdf"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Une saison dans un bilan PDF
+type saisonBilanPDF struct {
+	Datedeb time.Time
+	Datefin time.Time
+	Lignes  []*ligneBilanPDF
+}
+
+type ligneBilanPDF struct {
+	Valo     string
+	Proprio  string
+	Volume   float64
+	Unite    string
+	PrixHT   float64
+	AvecPrix bool
+	Total    bool // ligne de total, affichée en gras
+}
+
+// Bilan PDF des activités ; reçoit les mêmes champs que le formulaire de recherche d'activités.
+// Le champ "saison" (date de début de saison, AAAA-MM-JJ) permet de n'imprimer qu'une saison.
+func PDFBilanActivites(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchActiviteResults(ctx, r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	recaps, err := model.ComputeRecapFiltresListe(ctx.DB, computeFiltresActivite(r))
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	proprios := idsTriesParLabel(details.LabelProprios)
+	saisons := []*saisonBilanPDF{}
+	for _, bilan := range details.BilansActivitesParSaison {
+		if r.PostFormValue("saison") != "" && r.PostFormValue("saison") != tiglib.DateIso(bilan.Datedeb) {
+			continue
+		}
+		saison := &saisonBilanPDF{Datedeb: bilan.Datedeb, Datefin: bilan.Datefin}
+		if details.HasPlaquettes {
+			for _, id := range proprios {
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{
+					Valo:    "Plaquettes vendues (bois sec)",
+					Proprio: details.LabelProprios[id],
+					Volume:  bilan.TotalVentePlaquettesParProprio[id],
+					Unite:   model.UniteMap["MA"],
+				})
+			}
+			for _, id := range proprios {
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{
+					Valo:    "Plaquettes coupées (bois vert)",
+					Proprio: details.LabelProprios[id],
+					Volume:  bilan.TotalActivitesPlaquettesParProprio[id].Volume,
+					Unite:   model.UniteMap["MA"],
+				})
+			}
+		}
+		totaux := map[int]float64{}
+		for _, valo := range valosTries(bilan.TotalActivitesParValoEtProprio) {
+			for _, id := range proprios {
+				total := bilan.TotalActivitesParValoEtProprio[valo][id]
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{
+					Valo:     model.ValoMap[valo],
+					Proprio:  details.LabelProprios[id],
+					Volume:   total.Volume,
+					Unite:    model.UniteMap[model.CodeValo2CodeUnite(valo)],
+					PrixHT:   total.PrixHT,
+					AvecPrix: valo != "CF", // chauffage fermier : pas de prix
+				})
+				totaux[id] += total.PrixHT
+			}
+		}
+		for _, id := range proprios {
+			saison.Lignes = append(saison.Lignes, &ligneBilanPDF{Valo: "TOTAL", Proprio: details.LabelProprios[id], PrixHT: totaux[id], AvecPrix: true, Total: true})
+		}
+		saisons = append(saisons, saison)
+	}
+	return pdfBilans(w, ctx.Config, "Bilan des activités", recaps, saisons)
+}
+
+// Bilan PDF des ventes ; reçoit les mêmes champs que le formulaire de recherche de ventes.
+// Le champ "saison" (date de début de saison, AAAA-MM-JJ) permet de n'imprimer qu'une saison.
+func PDFBilanVentes(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchVenteResults(ctx, r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	recaps, err := model.ComputeRecapFiltresListe(ctx.DB, computeFiltresVente(r))
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	labelProprios := map[int]string{0: "Parcelle inconnue"}
+	saisons := []*saisonBilanPDF{}
+	for _, bilan := range details.BilansVentesParSaison {
+		if r.PostFormValue("saison") != "" && r.PostFormValue("saison") != tiglib.DateIso(bilan.Datedeb) {
+			continue
+		}
+		saison := &saisonBilanPDF{Datedeb: bilan.Datedeb, Datefin: bilan.Datefin}
+		totaux := map[int]float64{}
+		total := 0.0
+		totauxValo := append([]*model.TotalVentesParValo{}, bilan.TotalVentesParValo...)
+		sort.Slice(totauxValo, func(i, j int) bool {
+			return model.ValoMap[totauxValo[i].TypeValo] < model.ValoMap[totauxValo[j].TypeValo]
+		})
+		for _, totalValo := range totauxValo {
+			for id := range totalValo.ParProprio {
+				if _, ok := labelProprios[id]; !ok {
+					proprio, err := model.GetActeur(ctx.DB, id)
+					if err != nil {
+						return werr.Wrap(err)
+					}
+					labelProprios[id] = proprio.String()
+				}
+			}
+			unite := model.UniteMap[totalValo.Unite]
+			for _, id := range idsTriesParLabel(labelProprios) {
+				parProprio, ok := totalValo.ParProprio[id]
+				if !ok {
+					continue
+				}
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{
+					Valo:     model.ValoMap[totalValo.TypeValo],
+					Proprio:  labelProprios[id],
+					Volume:   parProprio.Volume,
+					Unite:    unite,
+					PrixHT:   parProprio.PrixHT,
+					AvecPrix: true,
+				})
+				totaux[id] += parProprio.PrixHT
+			}
+			if len(totalValo.ParProprio) > 1 {
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{
+					Valo:     model.ValoMap[totalValo.TypeValo],
+					Proprio:  "Tous",
+					Volume:   totalValo.Volume,
+					Unite:    unite,
+					PrixHT:   totalValo.PrixHT,
+					AvecPrix: true,
+					Total:    true,
+				})
+			}
+			total += totalValo.PrixHT
+		}
+		for _, id := range idsTriesParLabel(labelProprios) {
+			if _, ok := totaux[id]; ok {
+				saison.Lignes = append(saison.Lignes, &ligneBilanPDF{Valo: "TOTAL", Proprio: labelProprios[id], PrixHT: totaux[id], AvecPrix: true, Total: true})
+			}
+		}
+		saison.Lignes = append(saison.Lignes, &ligneBilanPDF{Valo: "TOTAL", Proprio: "Tous", PrixHT: total, AvecPrix: true, Total: true})
+		saisons = append(saisons, saison)
+	}
+	return pdfBilans(w, ctx.Config, "Bilan des ventes", recaps, saisons)
+}
+
+// Ecrit le PDF : une page par saison
+func pdfBilans(w http.ResponseWriter, conf *model.Config, titre string, recaps []*model.RecapFiltre, saisons []*saisonBilanPDF) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // "" defaults to "cp1252"
+	MetaDataPDF(pdf, tr, conf, titre)
+	pdf.SetAutoPageBreak(true, 20) // laisse la place du footer
+	pdf.SetFooterFunc(func() {
+		FooterFacture(pdf, tr, conf)
+	})
+	colW := []float64{65, 50, 40, 35} // valorisation, propriétaire, volume, prix HT
+	colH := 7.0
+	entetes := []string{"Valorisation", "Propriétaire", "Volume", "Prix HT"}
+	if len(saisons) == 0 {
+		saisons = append(saisons, &saisonBilanPDF{})
+	}
+	for _, saison := range saisons {
+		pdf.AddPage()
+		HeaderFacture(pdf, tr, conf, "BILAN")
+		pdf.SetXY(10, 55)
+		pdf.SetFont("Arial", "B", 14)
+		str := titre
+		if !saison.Datedeb.IsZero() {
+			str += " - saison " + tiglib.DateFr(saison.Datedeb) + " - " + tiglib.DateFr(saison.Datefin)
+		}
+		pdf.Cell(190, 8, tr(str))
+		pdf.Ln(10)
+		// filtres
+		pdf.SetFont("Arial", "", 10)
+		if len(recaps) == 0 {
+			pdf.Cell(190, 6, tr("Aucun filtre"))
+			pdf.Ln(6)
+		}
+		for _, recap := range recaps {
+			pdf.MultiCell(190, 6, tr(recap.String()), "", "L", false)
+		}
+		pdf.Ln(4)
+		if len(saison.Lignes) == 0 {
+			pdf.SetFont("Arial", "B", 12)
+			pdf.Cell(190, 8, tr("Aucune donnée ne correspond aux critères demandés"))
+			continue
+		}
+		// tableau
+		pdf.SetFont("Arial", "B", 10)
+		for i, entete := range entetes {
+			pdf.CellFormat(colW[i], colH, tr(entete), "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+		for _, ligne := range saison.Lignes {
+			style := ""
+			if ligne.Total {
+				style = "B"
+			}
+			pdf.SetFont("Arial", style, 10)
+			pdf.CellFormat(colW[0], colH, tr(ligne.Valo), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(colW[1], colH, tr(ligne.Proprio), "1", 0, "L", false, 0, "")
+			volume := ""
+			if ligne.Unite != "" {
+				volume = formatNbPDF(ligne.Volume) + " " + ligne.Unite
+			}
+			pdf.CellFormat(colW[2], colH, tr(volume), "1", 0, "R", false, 0, "")
+			prix := ""
+			if ligne.AvecPrix {
+				prix = formatNbPDF(ligne.PrixHT) + " €"
+			}
+			pdf.CellFormat(colW[3], colH, tr(prix), "1", 0, "R", false, 0, "")
+			pdf.Ln(-1)
+		}
+	}
+	return pdf.Output(w)
+}
+
+// ************************** Auxiliaires *******************************
+
+// Nombre avec 2 décimales, au format français : 1 234,56
+func formatNbPDF(x float64) string {
+	str := strconv.FormatFloat(tiglib.Round(x, 2), 'f', 2, 64)
+	signe := ""
+	if strings.HasPrefix(str, "-") {
+		signe, str = "-", str[1:]
+	}
+	entier, decimales := str[:len(str)-3], str[len(str)-2:]
+	for i := len(entier) - 3; i > 0; i -= 3 {
+		entier = entier[:i] + " " + entier[i:]
+	}
+	return signe + entier + "," + decimales
+}
+
+func idsTriesParLabel(labels map[int]string) []int {
+	res := []int{}
+	for id := range labels {
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return labels[res[i]] < labels[res[j]] })
+	return res
+}
+
+func valosTries(totaux map[string]map[int]model.VolumePrixHT) []string {
+	res := []string{}
+	for valo := range totaux {
+		res = append(res, valo)
+	}
+	sort.Slice(res, func(i, j int) bool { return model.ValoMap[res[i]] < model.ValoMap[res[j]] })
+	return res
+}
@@ -0,0 +1,166 @@
+/*
+Carte des parcelles et export cartographique, cf model/carte.go
+
+La carte reçoit en POST le formulaire de recherche d'activités,
+et met en évidence les parcelles des chantiers trouvés.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"path/filepath"
+)
+
+type detailsCarte struct {
+	Recherche           bool // true si la carte affiche le résultat d'une recherche d'activités
+	RecapFiltres        string
+	NbActivites         int
+	ChantiersParcelles  map[int][]*model.ChantierCarte // key = id parcelle
+	NbParcellesAvecGeom int
+	NbParcellesSansGeom int
+	Couches             []string
+}
+
+type detailsImportCadastre struct {
+	Erreur   string
+	Imports  map[string]*model.ImportCadastre // key = nom du fichier importé
+	Fichiers []string                         // noms des fichiers importés, dans l'ordre d'envoi
+}
+
+// Affiche la carte des parcelles ; en POST, met en évidence les parcelles des activités recherchées
+func ShowCarte(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err error) {
+	details := detailsCarte{
+		ChantiersParcelles: map[int][]*model.ChantierCarte{},
+		Couches:            model.CouchesCarte,
+	}
+	details.NbParcellesAvecGeom, details.NbParcellesSansGeom, err = model.CompteParcellesGeom(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if r.Method == "POST" {
+		if err = r.ParseForm(); err != nil {
+			return werr.Wrap(err)
+		}
+		filtres := computeFiltresActivite(r)
+		activites, err := model.ComputeActivitesFromFiltres(ctx.DB, filtres)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		details.RecapFiltres, err = model.ComputeRecapFiltres(ctx.DB, filtres)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		details.ChantiersParcelles, err = model.ComputeChantiersCarte(ctx.DB, activites)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		details.Recherche = true
+		details.NbActivites = len(activites)
+	}
+	ctx.TemplateName = "carte.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Carte des activités",
+		},
+		Footer: ctxt.Footer{
+			JSFiles: []string{
+				"/static/js/carteGeoJSON.js",
+			},
+		},
+		Menu:    "accueil",
+		Details: details,
+	}
+	return nil
+}
+
+// Formulaire de recherche d'activités à afficher sur la carte
+func SearchCarte(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchActiviteForm(ctx, "/carte")
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "search-activite-form.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Carte des activités",
+			CSSFiles: []string{
+				"/static/css/form.css",
+			},
+		},
+		Menu:    "accueil",
+		Details: details,
+	}
+	return nil
+}
+
+// Export GeoJSON d'une couche (parcelles, ugs ou chantiers)
+func ExportCoucheCarte(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	nom := mux.Vars(r)["couche"]
+	couche, err := model.GetCoucheGeoJSON(ctx.DB, nom)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	w.Header().Set("Content-Type", "application/geo+json")
+	if r.URL.Query().Get("telecharger") != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="bdl-`+nom+`.geojson"`)
+	}
+	return json.NewEncoder(w).Encode(couche)
+}
+
+// Import de fichiers cadastre (GeoJSON Etalab, un fichier par commune)
+func ImportCadastre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details := detailsImportCadastre{
+		Imports:  map[string]*model.ImportCadastre{},
+		Fichiers: []string{},
+	}
+	ctx.TemplateName = "carte-import.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Import du cadastre",
+		},
+		Menu:    "accueil",
+		Details: &details,
+	}
+	if r.Method != "POST" {
+		return nil
+	}
+	err := r.ParseMultipartForm(256 << 20)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	fichiers := r.MultipartForm.File["fichiers"]
+	if len(fichiers) == 0 {
+		details.Erreur = "Aucun fichier envoyé"
+		return nil
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		for _, fh := range fichiers {
+			f, err := fh.Open()
+			if err != nil {
+				return err
+			}
+			imp, err := model.ImporterCadastre(tx, f)
+			f.Close()
+			if err != nil {
+				return werr.Wrapf(err, "Erreur import fichier "+fh.Filename)
+			}
+			nom := filepath.Base(fh.Filename)
+			details.Imports[nom] = imp
+			details.Fichiers = append(details.Fichiers, nom)
+		}
+		return nil
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return nil
+}
@@ -132,7 +132,10 @@ func NewChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		chantier.Id, err = model.InsertChaufer(ctx.DB, chantier, idsUG)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+			chantier.Id, err = model.InsertChaufer(tx, chantier, idsUG)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -190,7 +193,9 @@ func UpdateChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		err = model.UpdateChaufer(ctx.DB, chantier, idsUG)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateChaufer(tx, chantier, idsUG)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -246,7 +251,9 @@ func DeleteChaufer(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteChaufer(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteChaufer(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -11,7 +11,6 @@ import (
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
 	"github.com/gorilla/mux"
-	"github.com/jung-kurt/gofpdf"
 	"html/template"
 	"net/http"
 	"strconv"
@@ -39,6 +38,7 @@ type detailsChautreList struct {
 
 type detailsChautreShow struct {
 	Chantier *model.Chautre
+	Facture  *model.Facture // facture du registre, nil si pas encore émise
 }
 
 func ListChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
@@ -99,6 +99,10 @@ func ShowChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) erro
             return werr.Wrap(err)
         }
 	}
+	facture, err := model.GetFactureActive(ctx.DB, "chautre", idChantier)
+	if err != nil {
+		return werr.Wrap(err)
+	}
 	ctx.TemplateName = "chautre-show.html"
 	ctx.Page = &ctxt.Page{
 		Header: ctxt.Header{
@@ -113,6 +117,7 @@ func ShowChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) erro
 		Footer: ctxt.Footer{},
 		Details: detailsChautreShow{
 			Chantier: chantier,
+			Facture:  facture,
 		},
 	}
 	url := r.URL.String()
@@ -135,7 +140,10 @@ func NewChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 			return werr.Wrap(err)
 		}
 		//
-		chantier.Id, err = model.InsertChautre(ctx.DB, chantier, idsUGs, idsLieudits, idsFermiers)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+			chantier.Id, err = model.InsertChautre(tx, chantier, idsUGs, idsLieudits, idsFermiers)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -202,7 +210,9 @@ func UpdateChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 			return werr.Wrap(err)
 		}
 		//
-		err = model.UpdateChautre(ctx.DB, chantier, idsUGs, idsLieudits, idsFermiers)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateChautre(tx, chantier, idsUGs, idsLieudits, idsFermiers)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -271,7 +281,9 @@ func DeleteChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteChautre(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteChautre(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -386,147 +398,17 @@ func ShowFactureChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Reques
 		return werr.Wrap(err)
 	}
 	//
-	ch, err := model.GetChautreFull(ctx.DB, id)
+	f, err := model.GetFactureActive(ctx.DB, "chautre", id)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	//
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	InitializeFacture(pdf)
-	tr := pdf.UnicodeTranslatorFromDescriptor("")
-	pdf.AddPage()
-	//
-	MetaDataPDF(pdf, tr, ctx.Config, "Facture bois sur pied")
-	HeaderFacture(pdf, tr, ctx.Config)
-	FooterFacture(pdf, tr, ctx.Config)
-	//
-	var str string
-	//
-	// Acheteur
-	//
-	pdf.SetXY(60, 70)
-	pdf.SetFont("Arial", "", 12)
-	pdf.MultiCell(100, 7, tr(StringActeurFacture(ch.Acheteur)), "1", "C", false)
-	//
-	// Date  + n° facture
-	//
-	var x0, x, y, wi, he float64
-	//
-	x0 = 10
-	x = x0
-	y = 110
-	wi = 50
-	he = 6
-	//
-	pdf.SetFont("Arial", "B", 10)
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, "Date", "1", "C", false)
-	//
-	x += wi
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, tr("Facture n°"), "TRB", "C", false)
-	//
-	pdf.SetFont("Arial", "", 10)
-	x = 10
-	y += he
-	//
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, tiglib.DateFr(ch.DateFacture), "LRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, ch.NumFacture, "RB", "C", false)
-	//
-	// Tableau principal
-	//
-	var w1, w2, w3, w4, w5 = 70.0, 20.0, 20.0, 30.0, 30.0
-	x = x0
-	y = 140
-	pdf.SetXY(x, y)
-	wi = w1
-	pdf.MultiCell(wi, he, tr("Désignation"), "1", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w2
-	pdf.MultiCell(wi, he, tr("Quantité"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w3
-	pdf.MultiCell(wi, he, tr("Unité"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w4
-	pdf.MultiCell(wi, he, tr("P.U. € H.T"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w5
-	pdf.MultiCell(wi, he, tr("Montant € H.T"), "TRB", "C", false)
-	//
-	x = x0
-	y += he
-	pdf.SetXY(x, y)
-	wi = w1
-	str = "Vente " + tr(model.ValoMap[ch.TypeValo]) + " - " + tr(model.EssenceMap[ch.Essence])
-	pdf.MultiCell(wi, he, str, "LRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w2
-	pdf.MultiCell(wi, he, strconv.FormatFloat(ch.VolumeRealise, 'f', 2, 64), "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w3
-	pdf.MultiCell(wi, he, tr(model.UniteMap[ch.Unite]), "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w4
-	pdf.MultiCell(wi, he, strconv.FormatFloat(ch.PUHT, 'f', 2, 64), "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w5
-	prixHT := ch.VolumeRealise * ch.PUHT
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixHT, 'f', 2, 64), "RB", "C", false)
-	//
-	pdf.SetFont("Arial", "B", 10)
-	x = x0 + w1
-	y += he
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4 + w5
-	// @todo arriver à dire euro : € \u20AC
-	pdf.MultiCell(wi, he, tr("Montant total € HT"), "RBL", "C", false)
-	//
-	pdf.SetFont("Arial", "", 10)
-	x = x0 + w1
-	y += he
-	pdf.SetXY(x, y)
-	wi = w2 + w3
-	pdf.MultiCell(wi, he, "Montant TVA", "RBL", "C", false)
-	x += wi
-	wi = w4
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, strconv.FormatFloat(ch.TVA, 'f', 2, 64)+" %", "RB", "C", false)
-	x += wi
-	wi = w5
-	pdf.SetXY(x, y)
-	prixTVA := prixHT * ch.TVA / 100
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixTVA, 'f', 2, 64), "RB", "C", false)
-	//
-	pdf.SetFont("Arial", "B", 10)
-	x = x0 + w1
-	y += 2 * he
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4 + w5
-	pdf.MultiCell(wi, he, "Montant total TTC", "1", "C", false)
-	pdf.SetFont("Arial", "", 10)
-	x = x0 + w1
-	y += he
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4
-	pdf.MultiCell(wi, he, tr("Net à payer en euros"), "RBL", "C", false)
-	pdf.SetFont("Arial", "B", 10)
-	x += wi
-	wi = w5
-	pdf.SetXY(x, y)
-	prixTTC := prixHT + prixTVA
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixTTC, 'f', 2, 64), "RB", "C", false)
-	//
-	return pdf.Output(w)
+	if f == nil {
+		// facture pas encore émise : aperçu à partir des données actuelles du chantier
+		ch, err := model.GetChautreFull(ctx.DB, id)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		f = model.NewFactureChautre(ch)
+	}
+	return pdfFacture(w, ctx.Config, f)
 }
@@ -0,0 +1,52 @@
+/*
+Vérification de la cohérence des données, cf model/coherence.go
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"net/http"
+)
+
+type detailsCoherence struct {
+	Resultats   []*model.ResultatCoherence
+	NbAnomalies int
+	Regle       string // code de la règle vérifiée, vide si toutes les règles
+}
+
+// Exécute les règles de cohérence et affiche les anomalies.
+// Paramètre optionnel regle : code de la règle à vérifier.
+func ShowCoherence(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details := detailsCoherence{
+		Regle: r.URL.Query().Get("regle"),
+	}
+	regles := []*model.RegleCoherence{}
+	if details.Regle != "" {
+		regle := model.GetRegleCoherence(details.Regle)
+		if regle == nil {
+			return werr.New("Règle de cohérence inconnue : " + details.Regle)
+		}
+		regles = append(regles, regle)
+	}
+	var err error
+	details.Resultats, err = model.VerifierCoherence(ctx.DB, regles)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	details.NbAnomalies = model.NbAnomaliesCoherence(details.Resultats)
+	ctx.TemplateName = "coherence.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Cohérence des données",
+		},
+		Menu:    "accueil",
+		Details: details,
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Export comptable (FEC ou journal CSV) des ventes et des achats d'une période.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type detailsComptaExport struct {
+	Export     *model.ExportCompta
+	Format     string
+	UrlFichier string
+}
+
+// Affiche le formulaire de choix de la période et l'aperçu des écritures.
+// La période est passée dans l'url (date-debut, date-fin) ; par défaut, l'année en cours.
+func ShowExportCompta(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	dateDebut, dateFin, format, err := exportComptaFromQuery(r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	export, err := model.ComputeExportCompta(ctx.DB, ctx.Config, dateDebut, dateFin)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	query := url.Values{}
+	query.Set("date-debut", tiglib.DateIso(dateDebut))
+	query.Set("date-fin", tiglib.DateIso(dateFin))
+	query.Set("format", format)
+	ctx.TemplateName = "compta-export.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Export comptable",
+			CSSFiles: []string{
+				"/static/css/form.css"},
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "ventes",
+		Details: detailsComptaExport{
+			Export:     export,
+			Format:     format,
+			UrlFichier: "/compta/export/fichier?" + query.Encode(),
+		},
+	}
+	return nil
+}
+
+// Renvoie le fichier FEC ou CSV en téléchargement
+func ExportComptaFichier(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	dateDebut, dateFin, format, err := exportComptaFromQuery(r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	export, err := model.ComputeExportCompta(ctx.DB, ctx.Config, dateDebut, dateFin)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+export.NomFichierCSV()+`"`)
+		return export.WriteCSV(w, ctx.Config)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.NomFichierFEC(ctx.Config)+`"`)
+	return export.WriteFEC(w)
+}
+
+// Récupère la période et le format (fec ou csv) passés dans l'url
+func exportComptaFromQuery(r *http.Request) (dateDebut, dateFin time.Time, format string, err error) {
+	now := time.Now()
+	dateDebut = time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	dateFin = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	query := r.URL.Query()
+	if query.Get("date-debut") != "" {
+		dateDebut, err = time.Parse("2006-01-02", query.Get("date-debut"))
+		if err != nil {
+			return dateDebut, dateFin, format, werr.Wrap(err)
+		}
+	}
+	if query.Get("date-fin") != "" {
+		dateFin, err = time.Parse("2006-01-02", query.Get("date-fin"))
+		if err != nil {
+			return dateDebut, dateFin, format, werr.Wrap(err)
+		}
+	}
+	if dateFin.Before(dateDebut) {
+		return dateDebut, dateFin, format, errors.New("La date de fin doit être postérieure à la date de début")
+	}
+	format = query.Get("format")
+	if format != "csv" {
+		format = "fec"
+	}
+	return dateDebut, dateFin, format, nil
+}
@@ -0,0 +1,199 @@
+/*
+Export CSV / XLSX des pages de recherche et des listes annuelles.
+
+Les tableaux sont construits à partir des mêmes résultats que les pages HTML.
+CSV : un seul tableau (celui demandé) ; XLSX : tous les tableaux de la page, une feuille par tableau.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/generic/tableur"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/model"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Ecrit les tableaux en téléchargement.
+// @param format    "csv" ou "xlsx"
+// @param nom       nom du fichier, sans extension
+// @param tableau   pour le format csv, titre du tableau à écrire ; si vide, le premier tableau
+func ecrireTableaux(w http.ResponseWriter, format, nom, tableau string, tableaux ...*tableur.Tableau) error {
+	switch format {
+	case "xlsx":
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+nom+`.xlsx"`)
+		return tableur.WriteXLSX(w, tableaux...)
+	case "csv":
+		t := tableaux[0]
+		for _, candidat := range tableaux {
+			if candidat.Titre == tableau {
+				t = candidat
+			}
+		}
+		if t != tableaux[0] {
+			nom += "-" + nomFichierTableau(t.Titre)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+nom+`.csv"`)
+		return t.WriteCSV(w)
+	}
+	return errors.New("Format d'export inconnu : " + format)
+}
+
+// "Bilan / saison" => "bilan-saison"
+func nomFichierTableau(titre string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(titre), func(r rune) bool {
+		return r == ' ' || r == '/'
+	}), "-")
+}
+
+// ************************** Activités *******************************
+
+func tableauActivites(activites []*model.Activite) *tableur.Tableau {
+	t := tableur.New("Liste", "Date", "Type", "Titre", "Valorisation", "Essence", "Volume", "Unité", "PU HT", "Prix HT")
+	for _, a := range activites {
+		t.AddLigne(a.DateActivite, model.GetActivitesMap()[a.TypeActivite], a.Titre, model.ValoMap[a.TypeValo], model.EssenceMap[a.CodeEssence],
+			tiglib.Round(a.Volume, 2), model.UniteMap[a.Unite], tiglib.Round(a.PUHT, 2), tiglib.Round(a.PrixHT, 2))
+	}
+	return t
+}
+
+func tableauActivitesParUG(activitesParUG []*model.ActivitesParUG) *tableur.Tableau {
+	t := tableur.New("Liste par UG", "UG", "Date", "Titre", "Valorisation", "Essence", "Volume", "Unité")
+	for _, apu := range activitesParUG {
+		for _, a := range apu.Activites {
+			t.AddLigne(apu.UG.Code, a.DateActivite, a.Titre, model.ValoMap[a.TypeValo], model.EssenceMap[a.CodeEssence],
+				tiglib.Round(a.Volume, 2), model.UniteMap[a.Unite])
+		}
+	}
+	return t
+}
+
+// Une ligne par saison, valorisation et propriétaire, comme dans search-activite-show-bilan-saison.html
+func tableauBilansActivites(bilans []*model.BilanActivitesParSaison, labelProprios map[int]string, hasPlaquettes bool) *tableur.Tableau {
+	t := tableur.New("Bilan / saison", "Début saison", "Fin saison", "Valorisation", "Propriétaire", "Volume", "Unité", "Prix HT")
+	idsProprios := idsTriesParLabel(labelProprios)
+	for _, bilan := range bilans {
+		if hasPlaquettes {
+			for _, id := range idsProprios {
+				t.AddLigne(bilan.Datedeb, bilan.Datefin, "Plaquettes vendues (bois sec)", labelProprios[id],
+					tiglib.Round(bilan.TotalVentePlaquettesParProprio[id], 2), model.UniteMap["MA"], nil)
+			}
+			for _, id := range idsProprios {
+				t.AddLigne(bilan.Datedeb, bilan.Datefin, "Plaquettes coupées (bois vert)", labelProprios[id],
+					tiglib.Round(bilan.TotalActivitesPlaquettesParProprio[id].Volume, 2), model.UniteMap["MA"], nil)
+			}
+		}
+		for _, valo := range valosTries(bilan.TotalActivitesParValoEtProprio) {
+			for _, id := range idsProprios {
+				total := bilan.TotalActivitesParValoEtProprio[valo][id]
+				var prix interface{} = tiglib.Round(total.PrixHT, 2)
+				if valo == "CF" {
+					prix = nil // chauffage fermier : pas de prix
+				}
+				t.AddLigne(bilan.Datedeb, bilan.Datefin, model.ValoMap[valo], labelProprios[id],
+					tiglib.Round(total.Volume, 2), model.UniteMap[model.CodeValo2CodeUnite(valo)], prix)
+			}
+		}
+	}
+	return t
+}
+
+// ************************** Ventes *******************************
+
+func tableauVentes(ventes []*model.Vente) *tableur.Tableau {
+	t := tableur.New("Liste", "Date", "Titre", "Valorisation", "Essence", "Volume", "Unité", "PU HT", "Prix HT", "TVA", "N° facture", "Date facture")
+	for _, v := range ventes {
+		t.AddLigne(v.DateVente, v.Titre, model.ValoMap[v.TypeValo], model.EssenceMap[v.CodeEssence], tiglib.Round(v.Volume, 2),
+			model.UniteMap[v.Unite], tiglib.Round(v.PUHT, 2), tiglib.Round(v.PrixHT, 2), v.TVA, v.NumFacture, v.DateFacture)
+	}
+	return t
+}
+
+func tableauBilansVentes(bilans []*model.BilanVentesParSaison) *tableur.Tableau {
+	t := tableur.New("Bilan / saison", "Début saison", "Fin saison", "Valorisation", "Volume", "Unité", "Revenus HT")
+	for _, bilan := range bilans {
+		for _, total := range bilan.TotalVentesParValo {
+			t.AddLigne(bilan.Datedeb, bilan.Datefin, model.ValoMap[total.TypeValo], tiglib.Round(total.Volume, 2),
+				model.UniteMap[total.Unite], tiglib.Round(total.PrixHT, 2))
+		}
+	}
+	return t
+}
+
+// ************************** Sylviculture *******************************
+
+func tableauUGs(ugs []*model.UG) *tableur.Tableau {
+	t := tableur.New("Liste", "Code", "Essences", "Typo", "Coupe", "Année intervention", "Activités", "Fermiers")
+	for _, ug := range ugs {
+		essences, activites, fermiers := []string{}, []string{}, []string{}
+		for _, code := range ug.CodesEssence {
+			essences = append(essences, model.EssenceMap[code])
+		}
+		for _, a := range ug.Activites {
+			activites = append(activites, a.String())
+		}
+		for _, f := range ug.Fermiers {
+			fermiers = append(fermiers, f.String())
+		}
+		t.AddLigne(ug.Code, strings.Join(essences, ", "), ug.CodeTypo+" "+model.TypoMap[ug.CodeTypo], ug.Coupe, ug.AnneeIntervention,
+			strings.Join(activites, "\n"), strings.Join(fermiers, "\n"))
+	}
+	return t
+}
+
+// ************************** Listes annuelles *******************************
+
+func tableauPlaqs(chantiers []*model.Plaq) *tableur.Tableau {
+	t := tableur.New("Chantiers plaquettes", "Chantier", "Date début", "Date fin", "UGs", "Lieux-dits", "Fermiers",
+		"Essence", "Exploitation", "Granulométrie", "Surface (ha)", "Volume (maps)")
+	for _, ch := range chantiers {
+		ugs, lieudits, fermiers := []string{}, []string{}, []string{}
+		for _, ug := range ch.UGs {
+			ugs = append(ugs, ug.String())
+		}
+		for _, ld := range ch.Lieudits {
+			lieudits = append(lieudits, ld.Nom)
+		}
+		for _, f := range ch.Fermiers {
+			fermiers = append(fermiers, f.String())
+		}
+		t.AddLigne(ch.String(), ch.DateDebut, ch.DateFin, strings.Join(ugs, ", "), strings.Join(lieudits, ", "), strings.Join(fermiers, ", "),
+			model.EssenceMap[ch.Essence], model.LabelExploitation(ch.Exploitation), model.LabelGranulo(ch.Granulo),
+			tiglib.Round(ch.Surface, 2), tiglib.Round(ch.Volume, 2))
+	}
+	return t
+}
+
+// Prix calculés comme dans venteplaq-list.html
+func tableauVentePlaqs(ventes []*model.VentePlaq) *tableur.Tableau {
+	t := tableur.New("Ventes plaquettes", "Date vente", "Client", "Qté (maps)", "PU HT", "Prix plaquettes HT", "TVA plaquettes",
+		"Prix livraison HT", "TVA livraison", "Prix total TTC", "Livraison", "N° facture", "Date facture", "Date paiement")
+	for _, vp := range ventes {
+		prixPlaquettesHT := vp.PUHT * vp.Qte
+		prixLivraisonHT := vp.CoutLivraisonHT()
+		prixTTC := prixPlaquettesHT*(1+vp.TVA/100) + prixLivraisonHT*(1+vp.FactureLivraisonTVA/100)
+		t.AddLigne(vp.DateVente, vp.Client.String(), tiglib.Round(vp.Qte, 2), tiglib.Round(vp.PUHT, 2), tiglib.Round(prixPlaquettesHT, 2), vp.TVA,
+			tiglib.Round(prixLivraisonHT, 2), vp.FactureLivraisonTVA, tiglib.Round(prixTTC, 2), vp.FactureLivraisonUnite,
+			vp.NumFacture, vp.DateFacture, vp.DatePaiement)
+	}
+	return t
+}
+
+func tableauHumids(humids []*model.Humid) *tableur.Tableau {
+	t := tableur.New("Mesures d'humidité", "Date", "Valeur (%)", "Tas", "Mesureurs", "Notes")
+	for _, h := range humids {
+		mesureurs := []string{}
+		for _, m := range h.Mesureurs {
+			mesureurs = append(mesureurs, m.String())
+		}
+		t.AddLigne(h.DateMesure, h.Valeur, h.Tas.Nom, strings.Join(mesureurs, ", "), h.Notes)
+	}
+	return t
+}
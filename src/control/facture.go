@@ -9,8 +9,16 @@ Fonctions communes à plusieurs factures
 package control
 
 import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
 	"github.com/jung-kurt/gofpdf"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Initialisations communes à toutes les factures émises par BDL
@@ -27,7 +35,8 @@ func MetaDataPDF(pdf *gofpdf.Fpdf, tr func(string) string, conf *model.Config, t
 }
 
 // Header commun à toutes les factures
-func HeaderFacture(pdf *gofpdf.Fpdf, tr func(string) string, conf *model.Config) {
+// @param titre "FACTURE" ou "AVOIR"
+func HeaderFacture(pdf *gofpdf.Fpdf, tr func(string) string, conf *model.Config, titre string) {
 	//
 	var opt gofpdf.ImageOptions
 	opt.ImageType = "jpg"
@@ -35,7 +44,7 @@ func HeaderFacture(pdf *gofpdf.Fpdf, tr func(string) string, conf *model.Config)
 	//
 	pdf.SetXY(150, 20)
 	pdf.SetFont("Arial", "B", 24)
-	pdf.Cell(100, 15, "FACTURE")
+	pdf.Cell(100, 15, titre)
 	//
 	pdf.SetXY(10, 30)
 	pdf.SetFont("Arial", "", 10)
@@ -62,19 +71,427 @@ func FooterFacture(pdf *gofpdf.Fpdf, tr func(string) string, conf *model.Config)
 
 // Renvoie une string permettant d'afficher un acteur avec son adresse dans une facture
 func StringActeurFacture(acteur *model.Acteur) string {
-	str := acteur.String()
-	if acteur.Adresse1 != "" {
-		str += "\n" + acteur.Adresse1
+	return acteur.StringFacture()
+}
+
+// ************************** PDF *******************************
+
+// Génère le PDF d'une facture ou d'un avoir, à partir des données figées de la facture
+func pdfFacture(w http.ResponseWriter, conf *model.Config, f *model.Facture) error {
+	titre := "FACTURE"
+	if f.TypeFacture == "A" {
+		titre = "AVOIR"
+	}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	InitializeFacture(pdf)
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // "" defaults to "cp1252"
+	pdf.AddPage()
+	//
+	MetaDataPDF(pdf, tr, conf, f.String())
+	HeaderFacture(pdf, tr, conf, titre)
+	FooterFacture(pdf, tr, conf)
+	if f.Id == 0 {
+		// facture pas encore émise (aperçu construit à partir de la vente ou du chantier)
+		pdf.SetXY(150, 35)
+		pdf.SetFont("Arial", "B", 12)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.Cell(50, 8, tr("Aperçu – non émise"))
+		pdf.SetTextColor(0, 0, 0)
+	}
+	//
+	// Client
+	//
+	pdf.SetXY(60, 70)
+	pdf.SetFont("Arial", "", 12)
+	pdf.MultiCell(100, 7, tr(f.Client), "1", "C", false)
+	//
+	// Date  + n° facture
+	//
+	var x0, x, y, wi, he float64
+	//
+	x0 = 10
+	x = x0
+	y = 110
+	wi = 50
+	he = 6
+	//
+	pdf.SetFont("Arial", "B", 10)
+	pdf.SetXY(x, y)
+	pdf.MultiCell(wi, he, "Date de facturation", "1", "C", false)
+	//
+	x += wi
+	pdf.SetXY(x, y)
+	if f.TypeFacture == "A" {
+		pdf.MultiCell(wi, he, tr("Avoir n°"), "TRB", "C", false)
+	} else {
+		pdf.MultiCell(wi, he, tr("Facture n°"), "TRB", "C", false)
+	}
+	//
+	pdf.SetFont("Arial", "", 10)
+	x = 10
+	y += he
+	//
+	pdf.SetXY(x, y)
+	pdf.MultiCell(wi, he, tiglib.DateFr(f.DateFacture), "LRB", "C", false)
+	x += wi
+	pdf.SetXY(x, y)
+	pdf.MultiCell(wi, he, tr(f.Numero), "RB", "C", false)
+	//
+	// Tableau principal
+	//
+	var w1, w2, w3, w4, w5 = 70.0, 20.0, 20.0, 30.0, 30.0
+	//
+	// ligne entête des colonnes
+	//
+	x = x0
+	y = 140
+	pdf.SetFont("Arial", "B", 10)
+	for i, entete := range []string{"Désignation", "Quantité", "Unité", "P.U. € H.T", "Montant € H.T"} {
+		wi = []float64{w1, w2, w3, w4, w5}[i]
+		pdf.SetXY(x, y)
+		if i == 0 {
+			pdf.MultiCell(wi, he, tr(entete), "1", "C", false)
+		} else {
+			pdf.MultiCell(wi, he, tr(entete), "TRB", "C", false)
+		}
+		x += wi
+	}
+	//
+	// lignes de la facture
+	//
+	for _, ligne := range f.Lignes {
+		pdf.SetFont("Arial", "B", 10)
+		x = x0
+		y += he
+		pdf.SetXY(x, y)
+		wi = w1
+		pdf.MultiCell(wi, he, tr(ligne.Designation), "LRB", "L", false)
+		pdf.SetFont("Arial", "", 10)
+		x += wi
+		pdf.SetXY(x, y)
+		wi = w2
+		pdf.MultiCell(wi, he, strconv.FormatFloat(ligne.Quantite, 'f', 2, 64), "RB", "C", false)
+		x += wi
+		pdf.SetXY(x, y)
+		wi = w3
+		pdf.MultiCell(wi, he, tr(ligne.Unite), "RB", "C", false)
+		x += wi
+		pdf.SetXY(x, y)
+		wi = w4
+		pdf.MultiCell(wi, he, strconv.FormatFloat(ligne.PUHT, 'f', 2, 64), "RB", "C", false)
+		x += wi
+		pdf.SetXY(x, y)
+		wi = w5
+		pdf.MultiCell(wi, he, strconv.FormatFloat(ligne.MontantHT, 'f', 2, 64), "RB", "C", false)
+	}
+	//
+	// ligne avec les notes
+	//
+	if f.Notes != "" {
+		pdf.SetFont("Arial", "", 10)
+		x = x0
+		y += he
+		pdf.SetXY(x, y)
+		wi = w1 + w2 + w3 + w4 + w5
+		lines := tiglib.LimitLength(tr(f.Notes), 108) // 108 mesuré empiriquement
+		pdf.MultiCell(wi, he, strings.Join(lines, "\n"), "LRB", "L", false)
+		y += he * float64(len(lines))
+	} else {
+		y += he
+	}
+	//
+	// ligne montant total HT
+	//
+	pdf.SetFont("Arial", "B", 10)
+	x = x0 + w1
+	pdf.SetXY(x, y)
+	wi = w2 + w3 + w4
+	pdf.MultiCell(wi, he, tr("Montant total € HT"), "RBL", "C", false)
+	pdf.SetFont("Arial", "", 10)
+	x = x0 + w1 + w2 + w3 + w4
+	wi = w5
+	pdf.SetXY(x, y)
+	pdf.MultiCell(wi, he, strconv.FormatFloat(f.TotalHT, 'f', 2, 64), "RBL", "C", false)
+	//
+	// une ligne TVA par taux
+	//
+	for _, tva := range f.TVAs() {
+		pdf.SetFont("Arial", "", 10)
+		x = x0 + w1
+		y += he
+		pdf.SetXY(x, y)
+		wi = w2 + w3
+		pdf.MultiCell(wi, he, "Montant TVA", "RBL", "L", false)
+		x += wi
+		wi = w4
+		pdf.SetXY(x, y)
+		pdf.MultiCell(wi, he, strconv.FormatFloat(tva.Taux, 'f', 2, 64)+" %", "RB", "C", false)
+		x += wi
+		wi = w5
+		pdf.SetXY(x, y)
+		pdf.MultiCell(wi, he, strconv.FormatFloat(tva.Montant, 'f', 2, 64), "RB", "C", false)
+	}
+	//
+	// 2 lignes pour montant total TTC
+	//
+	pdf.SetFont("Arial", "B", 10)
+	x = x0 + w1
+	y += 2 * he
+	pdf.SetXY(x, y)
+	wi = w2 + w3 + w4 + w5
+	pdf.MultiCell(wi, he, "Montant total TTC", "1", "C", false)
+	pdf.SetFont("Arial", "", 10)
+	x = x0 + w1
+	y += he
+	pdf.SetXY(x, y)
+	wi = w2 + w3 + w4
+	if f.TypeFacture == "A" {
+		pdf.MultiCell(wi, he, tr("Montant de l'avoir en euros"), "RBL", "C", false)
+	} else {
+		pdf.MultiCell(wi, he, tr("Net à payer en euros"), "RBL", "C", false)
+	}
+	pdf.SetFont("Arial", "B", 10)
+	x += wi
+	wi = w5
+	pdf.SetXY(x, y)
+	pdf.MultiCell(wi, he, strconv.FormatFloat(f.TotalTTC, 'f', 2, 64), "RB", "C", false)
+	//
+	// Mentions (livreurs, facture annulée par un avoir...)
+	//
+	if f.Mentions != "" {
+		pdf.SetFont("Arial", "", 10)
+		x = x0
+		y += 2 * he
+		for _, line := range strings.Split(f.Mentions, "\n") {
+			pdf.SetXY(x, y)
+			pdf.Write(he, tr(line))
+			y += he
+		}
+	}
+	//
+	return pdf.Output(w)
+}
+
+// ************************** Registre *******************************
+
+type detailsFactureList struct {
+	Factures []*model.Facture
+	Annee    string   // année courante
+	Annees   []string // toutes les années avec facture
+}
+
+type detailsFactureShow struct {
+	Facture       *model.Facture
+	UrlOrigine    string // page de la vente ou du chantier facturé
+	Aujourdhui    time.Time
+	ModesPaiement map[string]string
+}
+
+func ListFactures(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	annee := vars["annee"]
+	if annee == "" {
+		// annee non spécifiée, on prend l'année courante
+		annee = strconv.Itoa(time.Now().Year())
+	}
+	factures, err := model.GetFacturesOfYear(ctx.DB, annee)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	annees, err := model.GetFactureDifferentYears(ctx.DB, annee)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "facture-list.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Registre des factures " + annee,
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "ventes",
+		Footer: ctxt.Footer{
+			JSFiles: []string{
+				"/static/lib/table-sort/table-sort.js",
+			},
+		},
+		Details: detailsFactureList{
+			Factures: factures,
+			Annee:    annee,
+			Annees:   annees,
+		},
+	}
+	return nil
+}
+
+func ShowFacture(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	f, err := model.GetFactureFull(ctx.DB, id)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	urlOrigine := "/vente/" + strconv.Itoa(f.IdOrigine)
+	if f.TypeOrigine == "chautre" {
+		urlOrigine = "/chantier/autre/" + strconv.Itoa(f.IdOrigine)
+	}
+	ctx.TemplateName = "facture-show.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: f.String(),
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "ventes",
+		Details: detailsFactureShow{
+			Facture:       f,
+			UrlOrigine:    urlOrigine,
+			Aujourdhui:    time.Now(),
+			ModesPaiement: model.FacturePaiementModeMap,
+		},
+	}
+	return nil
+}
+
+func ShowFacturePDF(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	f, err := model.GetFactureFull(ctx.DB, id)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return pdfFacture(w, ctx.Config, f)
+}
+
+// Enregistre dans le registre la facture d'une vente de plaquettes
+func EmettreFactureVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idVente, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+		id, err = model.EmettreFactureVentePlaq(tx, idVente)
+		return err
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/facture/" + strconv.Itoa(id)
+	return nil
+}
+
+// Enregistre dans le registre la facture d'un chantier autres valorisations
+func EmettreFactureChautre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idChantier, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+		id, err = model.EmettreFactureChautre(tx, idChantier)
+		return err
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/facture/" + strconv.Itoa(id)
+	return nil
+}
+
+// Process form avoir, affiché dans la page d'une facture
+func NewAvoir(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idFacture, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if err = r.ParseForm(); err != nil {
+		return werr.Wrap(err)
+	}
+	date, err := time.Parse("2006-01-02", r.PostFormValue("dateavoir"))
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	var id int
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+		id, err = model.EmettreAvoir(tx, idFacture, date)
+		return err
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/facture/" + strconv.Itoa(id)
+	return nil
+}
+
+// Process form paiement, affiché dans la page d'une facture
+func NewFacturePaiement(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idFacture, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if err = r.ParseForm(); err != nil {
+		return werr.Wrap(err)
+	}
+	p := &model.FacturePaiement{
+		IdFacture: idFacture,
+		Mode:      r.PostFormValue("mode"),
+		Notes:     r.PostFormValue("notes"),
+	}
+	p.DatePaiement, err = time.Parse("2006-01-02", r.PostFormValue("datepaiement"))
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	p.Montant, err = strconv.ParseFloat(r.PostFormValue("montant"), 64)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+		_, err = model.InsertFacturePaiement(tx, p)
+		return err
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/facture/" + strconv.Itoa(idFacture)
+	return nil
+}
+
+func DeleteFacturePaiement(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idFacture, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if acteur.Adresse2 != "" {
-		str += "\n" + acteur.Adresse2
+	idPaiement, err := strconv.Atoi(vars["id-paiement"])
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	if acteur.Cp != "" && acteur.Ville != "" {
-		str += "\n" + acteur.Cp + " " + acteur.Ville
-	} else if acteur.Cp != "" {
-		str += "\n" + acteur.Cp
-	} else if acteur.Ville != "" {
-		str += "\n" + acteur.Ville
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		paiement, err := model.GetFacturePaiement(tx, idPaiement)
+		if err != nil {
+			return err
+		}
+		if paiement.IdFacture != idFacture {
+			return werr.New("Le paiement " + strconv.Itoa(idPaiement) + " n'appartient pas à la facture " + strconv.Itoa(idFacture))
+		}
+		return model.DeleteFacturePaiement(tx, idPaiement)
+	})
+	if err != nil {
+		return werr.Wrap(err)
 	}
-	return str
+	ctx.Redirect = "/facture/" + strconv.Itoa(idFacture)
+	return nil
 }
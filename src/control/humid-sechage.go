@@ -0,0 +1,142 @@
+/*
+Suivi du séchage des tas : courbes d'humidité, estimation de la date de séchage,
+et tas actifs sans mesure récente.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type detailsHumidSechage struct {
+	Cible           float64
+	JoursSansMesure int
+	TasSansMesure   []*model.TasSansMesure
+	Courbes         []*model.CourbeSechage
+	Graphiques      map[int]*courbeSechageSVG // clé = id tas
+}
+
+// Graphique SVG d'une courbe de séchage ; même principe que courbeStock
+type courbeSechageSVG struct {
+	Largeur int
+	Hauteur int
+	Mesures string // points de la polyline des mesures
+	Points  []repereCourbe2D
+	Estimee string // points de la courbe estimée
+	YCible  float64
+	Jours   []repereCourbe
+	Valeurs []repereCourbe
+}
+
+type repereCourbe2D struct {
+	X, Y  float64
+	Label string
+}
+
+const (
+	sechageLargeur = 600
+	sechageHauteur = 150
+	sechageMarge   = 40 // à gauche, pour les labels des valeurs
+)
+
+func ShowSechage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	courbes, err := model.ComputeCourbesSechageTasActifs(ctx.DB, ctx.Config)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	joursSansMesure := model.HumiditeJoursSansMesure(ctx.Config)
+	tasSansMesure, err := model.ComputeTasSansMesure(ctx.DB, joursSansMesure)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	details := detailsHumidSechage{
+		Cible:           model.HumiditeCible(ctx.Config),
+		JoursSansMesure: joursSansMesure,
+		TasSansMesure:   tasSansMesure,
+		Courbes:         courbes,
+		Graphiques:      map[int]*courbeSechageSVG{},
+	}
+	for _, c := range courbes {
+		details.Graphiques[c.Tas.Id] = computeCourbeSechageSVG(c)
+	}
+	ctx.TemplateName = "humid-sechage.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Séchage des tas",
+		},
+		Menu:    "production",
+		Details: details,
+	}
+	return nil
+}
+
+// Axe x : jours depuis la date de référence, jusqu'à la dernière mesure
+// ou jusqu'à la date estimée de séchage (limitée à un an après la dernière mesure).
+func computeCourbeSechageSVG(c *model.CourbeSechage) *courbeSechageSVG {
+	g := &courbeSechageSVG{Largeur: sechageLargeur + sechageMarge, Hauteur: sechageHauteur + 30} // + 30 : labels des jours
+	derniers := c.Points[len(c.Points)-1].Jours
+	joursMax := derniers
+	if !c.DateCible.IsZero() && c.JoursCible > joursMax {
+		joursMax = c.JoursCible
+		if joursMax > derniers+365 {
+			joursMax = derniers + 365
+		}
+	}
+	if joursMax < 1 {
+		joursMax = 1
+	}
+	valeurMax := c.Cible
+	for _, p := range c.Points {
+		if p.Valeur > valeurMax {
+			valeurMax = p.Valeur
+		}
+	}
+	valeurMax *= 1.1
+	x := func(jours float64) float64 {
+		return sechageMarge + tiglib.Round(jours*sechageLargeur/float64(joursMax), 1)
+	}
+	y := func(valeur float64) float64 {
+		return tiglib.Round(sechageHauteur-valeur*sechageHauteur/valeurMax, 1)
+	}
+	points := []string{}
+	for _, p := range c.Points {
+		points = append(points, formatPoint(x(float64(p.Jours)), y(p.Valeur)))
+		g.Points = append(g.Points, repereCourbe2D{
+			X:     x(float64(p.Jours)),
+			Y:     y(p.Valeur),
+			Label: tiglib.DateFr(p.Date) + " : " + strconv.FormatFloat(p.Valeur, 'f', -1, 64) + " %",
+		})
+	}
+	g.Mesures = strings.Join(points, " ")
+	if c.B != 0 {
+		estimee := []string{}
+		pas := float64(joursMax) / 50
+		for j := 0.0; j <= float64(joursMax)+pas/2; j += pas {
+			v := c.ValeurEstimee(j)
+			if v > valeurMax {
+				continue
+			}
+			estimee = append(estimee, formatPoint(x(j), y(v)))
+		}
+		g.Estimee = strings.Join(estimee, " ")
+	}
+	g.YCible = y(c.Cible)
+	for k := 0; k <= 4; k++ {
+		jours := joursMax * k / 4
+		g.Jours = append(g.Jours, repereCourbe{Pos: x(float64(jours)), Label: strconv.Itoa(jours) + " j"})
+	}
+	for _, valeur := range []float64{0, valeurMax / 2, valeurMax} {
+		g.Valeurs = append(g.Valeurs, repereCourbe{Pos: y(valeur), Label: strconv.Itoa(int(valeur+0.5)) + " %"})
+	}
+	return g
+}
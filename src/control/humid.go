@@ -63,6 +63,16 @@ func ListHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// Export CSV ou XLSX de la liste des mesures d'humidité d'une année
+func ExportHumids(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	humids, err := model.GetHumidsOfYear(ctx.DB, vars["annee"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, vars["format"], "humidite-"+vars["annee"], "", tableauHumids(humids))
+}
+
 // Process ou affiche formulaire new mesure d'humidité
 func NewHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	switch r.Method {
@@ -74,7 +84,10 @@ func NewHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertHumid(ctx.DB, humid)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertHumid(tx, humid)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -139,7 +152,9 @@ func UpdateHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) erro
 			return werr.Wrap(err)
 		}
 		humid.Id = idMesure
-		err = model.UpdateHumid(ctx.DB, humid)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateHumid(tx, humid)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -205,7 +220,9 @@ func DeleteHumid(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteHumid(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteHumid(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -0,0 +1,163 @@
+/*
+Inventaires physiques des tas d'un lieu de stockage.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type detailsInventaireList struct {
+	Ecarts      []*model.EcartsInventaireSaison
+	Inventaires []*model.Inventaire
+}
+
+type detailsInventaireForm struct {
+	Stockage  *model.Stockage
+	Date      time.Time
+	UrlAction string
+}
+
+// Affiche les écarts d'inventaire par hangar et par saison, et la liste des inventaires
+func ListInventaires(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	ecarts, err := model.ComputeEcartsInventaires(ctx.DB, ctx.Config.DebutSaison)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	inventaires, err := model.GetInventairesFull(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "inventaire-list.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Inventaires des hangars",
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "accueil",
+		Details: detailsInventaireList{
+			Ecarts:      ecarts,
+			Inventaires: inventaires,
+		},
+	}
+	return nil
+}
+
+// Process ou affiche formulaire new inventaire d'un lieu de stockage
+func NewInventaire(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idStockage, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	switch r.Method {
+	case "POST":
+		//
+		// Process form
+		//
+		inv, err := inventaireForm2var(r, idStockage)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertInventaire(tx, inv)
+			return err
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Redirect = "/stockage/inventaires"
+		return nil
+	default:
+		//
+		// Affiche form
+		//
+		stockage, err := model.GetStockage(ctx.DB, idStockage)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = stockage.ComputeTasActifs(ctx.DB)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.TemplateName = "inventaire-form.html"
+		ctx.Page = &ctxt.Page{
+			Header: ctxt.Header{
+				Title: "Inventaire " + stockage.Nom,
+				CSSFiles: []string{
+					"/static/css/form.css"},
+				JSFiles: []string{
+					"/static/js/round.js",
+					"/static/js/formatNb.js"},
+			},
+			Menu: "accueil",
+			Details: detailsInventaireForm{
+				Stockage:  stockage,
+				Date:      time.Now(),
+				UrlAction: "/stockage/" + vars["id"] + "/inventaire/new",
+			},
+		}
+		return nil
+	}
+}
+
+func DeleteInventaire(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteInventaire(tx, id)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/stockage/inventaires"
+	return nil
+}
+
+// Fabrique un Inventaire à partir des valeurs d'un formulaire.
+// Les tas dont le stock mesuré n'est pas renseigné ne font pas partie de l'inventaire.
+func inventaireForm2var(r *http.Request, idStockage int) (*model.Inventaire, error) {
+	inv := &model.Inventaire{IdStockage: idStockage}
+	var err error
+	if err = r.ParseForm(); err != nil {
+		return inv, werr.Wrap(err)
+	}
+	inv.DateInventaire, err = time.Parse("2006-01-02", r.PostFormValue("date-inventaire"))
+	if err != nil {
+		return inv, werr.Wrap(err)
+	}
+	inv.Notes = r.PostFormValue("notes")
+	for key, values := range r.PostForm {
+		if !strings.HasPrefix(key, "stock-mesure-") || strings.TrimSpace(values[0]) == "" {
+			continue
+		}
+		idTas, err := strconv.Atoi(strings.TrimPrefix(key, "stock-mesure-"))
+		if err != nil {
+			return inv, werr.Wrap(err)
+		}
+		stock, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil {
+			return inv, werr.Wrap(err)
+		}
+		inv.Lignes = append(inv.Lignes, &model.InventaireTas{IdTas: idTas, StockMesure: stock})
+	}
+	sort.Slice(inv.Lignes, func(i, j int) bool { return inv.Lignes[i].IdTas < inv.Lignes[j].IdTas })
+	return inv, nil
+}
@@ -76,6 +76,16 @@ func ListPlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// Export CSV ou XLSX de la liste des chantiers plaquettes d'une année
+func ExportPlaqs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	chantiers, err := model.GetPlaqsOfYear(ctx.DB, vars["annee"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, vars["format"], "chantiers-plaquettes-"+vars["annee"], "", tableauPlaqs(chantiers))
+}
+
 // Affichage d'un chantier plaquettes
 func ShowPlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
@@ -162,7 +172,11 @@ func NewPlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 		//
-		id, err := model.InsertPlaq(ctx.DB, chantier, idsStockages, idsUGs, idsLieudits, idsFermiers)
+		var id int
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+			id, err = model.InsertPlaq(tx, chantier, idsStockages, idsUGs, idsLieudits, idsFermiers)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -247,7 +261,9 @@ func UpdatePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 			}
 		}
 		//
-		err = model.UpdatePlaq(ctx.DB, chantier, idsStockages, idsUGs, idsLieudits, idsFermiers)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdatePlaq(tx, chantier, idsStockages, idsUGs, idsLieudits, idsFermiers)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -319,7 +335,9 @@ func DeletePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 		return werr.Wrap(err)
 	}
 	chantier, err := model.GetPlaq(ctx.DB, id) // on retient l'année pour le redirect
-	err = model.DeletePlaq(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaq(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
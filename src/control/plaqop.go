@@ -38,7 +38,10 @@ func NewPlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertPlaqOp(ctx.DB, op)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqOp(tx, op)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -109,7 +112,9 @@ func UpdatePlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		err = model.UpdatePlaqOp(ctx.DB, op)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdatePlaqOp(tx, op)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -175,7 +180,9 @@ func DeletePlaqOp(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeletePlaqOp(ctx.DB, idOp)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqOp(tx, idOp)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
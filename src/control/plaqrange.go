@@ -38,7 +38,10 @@ func NewPlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertPlaqRange(ctx.DB, pr)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqRange(tx, pr)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -114,7 +117,9 @@ func UpdatePlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		err = model.UpdatePlaqRange(ctx.DB, pr)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdatePlaqRange(tx, pr)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -168,7 +173,9 @@ func DeletePlaqRange(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeletePlaqRange(ctx.DB, idPr)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqRange(tx, idPr)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -40,7 +40,10 @@ func NewPlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 			return werr.Wrap(err)
 		}
 		pt.PourcentPerte = ctx.Config.PourcentagePerte
-		_, err = model.InsertPlaqTrans(ctx.DB, pt) // gère la modif du stock du tas
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqTrans(tx, pt) // gère la modif du stock du tas
+			return err
+		})
 		if err != nil {
 			//return werr.Wrap(err)
 			return werr.Wrapf(err, "Erreur appel model.InsertPlaqTrans()")
@@ -121,7 +124,9 @@ func UpdatePlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 			return werr.Wrap(err)
 		}
 		pt.PourcentPerte = ctx.Config.PourcentagePerte
-		err = model.UpdatePlaqTrans(ctx.DB, pt) // gère la modif du stock du tas
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdatePlaqTrans(tx, pt) // gère la modif du stock du tas
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -201,7 +206,9 @@ func DeletePlaqTrans(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeletePlaqTrans(ctx.DB, idPt) // gère la modif du stock du tas
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqTrans(tx, idPt) // gère la modif du stock du tas
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -0,0 +1,370 @@
+/*
+Transferts de plaquettes d'un lieu de stockage vers un autre.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/webo"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type detailsPlaqTransfertForm struct {
+	GlTVAOptions        template.HTML
+	CoTVAOptions        template.HTML
+	OuTVAOptions        template.HTML
+	DestinationsOptions []optionDestinationTransfert
+	Transfert           *model.PlaqTransfert
+	ListeActeurs        map[int]string
+	UrlAction           string
+}
+
+// Destination possible d'un transfert :
+// tas actif du chantier, ou nouveau tas dans un lieu de stockage où le chantier n'a pas de tas
+type optionDestinationTransfert struct {
+	Value string // "tas-<id tas>" ou "stockage-<id stockage>"
+	Label string
+}
+
+// Process ou affiche form new
+func NewPlaqTransfert(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		//
+		// Process form
+		//
+		pt, err := plaqTransfertForm2var(r)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqTransfert(tx, pt)
+			return err
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Redirect = "/chantier/plaquette/" + strconv.Itoa(pt.IdChantier) + "/chantiers"
+		return nil
+	default:
+		//
+		// Affiche form
+		//
+		vars := mux.Vars(r)
+		idChantierStr := vars["id-chantier"]
+		idChantier, err := strconv.Atoi(idChantierStr)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		pt := &model.PlaqTransfert{}
+		pt.Transporteur = &model.Acteur{}
+		pt.Conducteur = &model.Acteur{}
+		pt.Proprioutil = &model.Acteur{}
+		pt.IdChantier = idChantier
+		pt.Chantier, err = model.GetPlaq(ctx.DB, idChantier)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = pt.Chantier.ComputeTas(ctx.DB)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = pt.Chantier.ComputeLieudits(ctx.DB) // Pour le nom du chantier
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		destinations, err := destinationsTransfert(ctx, pt.Chantier)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		listeActeurs, err := model.GetListeActeurs(ctx.DB)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.TemplateName = "plaqtransfert-form.html"
+		ctx.Page = &ctxt.Page{
+			Header: ctxt.Header{
+				Title: "Nouveau transfert entre lieux de stockage",
+				CSSFiles: []string{
+					"/static/css/form.css"},
+			},
+			Menu: "production",
+			Footer: ctxt.Footer{
+				JSFiles: []string{},
+			},
+			Details: detailsPlaqTransfertForm{
+				Transfert:           pt,
+				GlTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_GL", "gl-"), "CHOOSE_TVA_GL"),
+				CoTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_CO", "co-"), "CHOOSE_TVA_CO"),
+				OuTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_OU", "ou-"), "CHOOSE_TVA_OU"),
+				DestinationsOptions: destinations,
+				ListeActeurs:        listeActeurs,
+				UrlAction:           "/chantier/plaquette/" + idChantierStr + "/transfert/new",
+			},
+		}
+		return nil
+	}
+}
+
+// Process ou affiche form update
+func UpdatePlaqTransfert(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		//
+		// Process form
+		//
+		pt, err := plaqTransfertForm2var(r)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		pt.Id, err = strconv.Atoi(r.PostFormValue("id-pt"))
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdatePlaqTransfert(tx, pt)
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Redirect = "/chantier/plaquette/" + strconv.Itoa(pt.IdChantier) + "/chantiers"
+		return nil
+	default:
+		//
+		// Affiche form
+		//
+		vars := mux.Vars(r)
+		idPt, err := strconv.Atoi(vars["id-pt"])
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		pt, err := model.GetPlaqTransfertFull(ctx.DB, idPt)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		destinations, err := destinationsTransfert(ctx, pt.Chantier)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		listeActeurs, err := model.GetListeActeurs(ctx.DB)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.TemplateName = "plaqtransfert-form.html"
+		ctx.Page = &ctxt.Page{
+			Header: ctxt.Header{
+				Title: "Modifier un transfert entre lieux de stockage",
+				CSSFiles: []string{
+					"/static/css/form.css"},
+			},
+			Menu: "production",
+			Footer: ctxt.Footer{
+				JSFiles: []string{},
+			},
+			Details: detailsPlaqTransfertForm{
+				Transfert:           pt,
+				GlTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_GL", "gl-"), strconv.FormatFloat(pt.GlTVA, 'f', 1, 64)),
+				CoTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_CO", "co-"), strconv.FormatFloat(pt.CoTVA, 'f', 1, 64)),
+				OuTVAOptions:        webo.FmtOptions(WeboTVAExt(ctx, "CHOOSE_TVA_OU", "ou-"), strconv.FormatFloat(pt.OuTVA, 'f', 1, 64)),
+				DestinationsOptions: destinations,
+				ListeActeurs:        listeActeurs,
+				UrlAction:           "/chantier/plaquette/" + vars["id-chantier"] + "/transfert/update/" + vars["id-pt"],
+			},
+		}
+		return nil
+	}
+}
+
+func DeletePlaqTransfert(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	idPt, err := strconv.Atoi(vars["id-pt"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeletePlaqTransfert(tx, idPt)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/chantier/plaquette/" + vars["id-chantier"] + "/chantiers"
+	return nil
+}
+
+// Calcule les destinations possibles d'un transfert pour un chantier :
+// ses tas actifs, puis un nouveau tas dans chaque lieu de stockage actif où il n'a pas de tas.
+// ch.Tas doit avoir été calculé.
+func destinationsTransfert(ctx *ctxt.Context, ch *model.Plaq) (res []optionDestinationTransfert, err error) {
+	stockagesAvecTas := map[int]bool{}
+	for _, tas := range ch.Tas {
+		stockagesAvecTas[tas.IdStockage] = true
+		if !tas.Actif {
+			continue
+		}
+		res = append(res, optionDestinationTransfert{
+			Value: "tas-" + strconv.Itoa(tas.Id),
+			Label: tas.Nom,
+		})
+	}
+	stockages, err := model.GetStockages(ctx.DB, true)
+	if err != nil {
+		return res, werr.Wrap(err)
+	}
+	for _, stockage := range stockages {
+		if stockagesAvecTas[stockage.Id] {
+			continue
+		}
+		res = append(res, optionDestinationTransfert{
+			Value: "stockage-" + strconv.Itoa(stockage.Id),
+			Label: "Nouveau tas : " + stockage.Nom,
+		})
+	}
+	return res, nil
+}
+
+// Fabrique un PlaqTransfert à partir des valeurs d'un formulaire.
+// Auxiliaire de NewPlaqTransfert() et UpdatePlaqTransfert()
+// Ne gère pas le champ Id
+func plaqTransfertForm2var(r *http.Request) (*model.PlaqTransfert, error) {
+	pt := &model.PlaqTransfert{}
+	var err error
+	if err = r.ParseForm(); err != nil {
+		return pt, werr.Wrap(err)
+	}
+	pt.IdChantier, err = strconv.Atoi(r.PostFormValue("id-chantier"))
+	if err != nil {
+		return pt, werr.Wrap(err)
+	}
+	pt.IdTasOrigine, err = strconv.Atoi(strings.TrimPrefix(r.PostFormValue("tas-origine"), "tas-"))
+	if err != nil {
+		return pt, werr.Wrap(err)
+	}
+	// destination : tas existant ou nouveau tas dans un lieu de stockage
+	destination := r.PostFormValue("destination")
+	if strings.HasPrefix(destination, "stockage-") {
+		pt.IdStockageDestination, err = strconv.Atoi(strings.TrimPrefix(destination, "stockage-"))
+	} else {
+		pt.IdTasDestination, err = strconv.Atoi(strings.TrimPrefix(destination, "tas-"))
+	}
+	if err != nil {
+		return pt, werr.Wrap(err)
+	}
+	pt.DateTransfert, err = time.Parse("2006-01-02", r.PostFormValue("datetransfert"))
+	if err != nil {
+		return pt, werr.Wrap(err)
+	}
+	pt.Qte, err = strconv.ParseFloat(r.PostFormValue("qte"), 32)
+	if err != nil {
+		return pt, werr.Wrap(err)
+	}
+	pt.Qte = tiglib.Round(pt.Qte, 2)
+	//
+	if r.PostFormValue("type-cout") == "cout-global" {
+		pt.TypeCout = "G"
+	} else {
+		pt.TypeCout = "D"
+	}
+	//
+	if pt.TypeCout == "G" {
+		//
+		// coût global
+		//
+		pt.IdTransporteur, err = strconv.Atoi(r.PostFormValue("id-transporteur"))
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		//
+		pt.GlPrix, err = strconv.ParseFloat(r.PostFormValue("glprix"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.GlPrix = tiglib.Round(pt.GlPrix, 2)
+		//
+		pt.GlTVA, err = strconv.ParseFloat(r.PostFormValue("gltva"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.GlTVA = tiglib.Round(pt.GlTVA, 2)
+		//
+		if r.PostFormValue("gldatepay") != "" {
+			pt.GlDatePay, err = time.Parse("2006-01-02", r.PostFormValue("gldatepay"))
+			if err != nil {
+				return pt, werr.Wrap(err)
+			}
+		}
+	} else {
+		//
+		// conducteur
+		//
+		pt.IdConducteur, err = strconv.Atoi(r.PostFormValue("id-conducteur"))
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		//
+		pt.CoNheure, err = strconv.ParseFloat(r.PostFormValue("conheure"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.CoNheure = tiglib.Round(pt.CoNheure, 2)
+		//
+		pt.CoPrixH, err = strconv.ParseFloat(r.PostFormValue("coprixh"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.CoPrixH = tiglib.Round(pt.CoPrixH, 2)
+		//
+		pt.CoTVA, err = strconv.ParseFloat(r.PostFormValue("cotva"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		//
+		if r.PostFormValue("codatepay") != "" {
+			pt.CoDatePay, err = time.Parse("2006-01-02", r.PostFormValue("codatepay"))
+			if err != nil {
+				return pt, werr.Wrap(err)
+			}
+		}
+		//
+		// outil
+		//
+		pt.IdProprioutil, err = strconv.Atoi(r.PostFormValue("id-proprioutil"))
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		//
+		pt.OuPrix, err = strconv.ParseFloat(r.PostFormValue("ouprix"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.OuPrix = tiglib.Round(pt.OuPrix, 2)
+		//
+		pt.OuTVA, err = strconv.ParseFloat(r.PostFormValue("outva"), 32)
+		if err != nil {
+			return pt, werr.Wrap(err)
+		}
+		pt.OuTVA = tiglib.Round(pt.OuTVA, 2)
+		//
+		if r.PostFormValue("oudatepay") != "" {
+			pt.OuDatePay, err = time.Parse("2006-01-02", r.PostFormValue("oudatepay"))
+			if err != nil {
+				return pt, werr.Wrap(err)
+			}
+		}
+	}
+	//
+	pt.Notes = r.PostFormValue("notes")
+	//
+	return pt, nil
+}
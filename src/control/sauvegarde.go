@@ -0,0 +1,46 @@
+/*
+Liste des sauvegardes de la base, cf model/sauvegarde.go
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"net/http"
+	"time"
+)
+
+type detailsSauvegardeList struct {
+	Sauvegardes []*model.Sauvegarde
+	Prochaine   time.Time // nulle si pas de sauvegarde automatique
+	Config      *model.Config
+}
+
+func ListSauvegardes(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	sauvegardes, err := model.GetSauvegardes(ctx.Config)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	prochaine, err := model.ProchaineSauvegarde(ctx.Config, time.Now())
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "sauvegarde-list.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Sauvegardes de la base",
+		},
+		Menu: "accueil",
+		Details: detailsSauvegardeList{
+			Sauvegardes: sauvegardes,
+			Prochaine:   prochaine,
+			Config:      ctx.Config,
+		},
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+/*
+Import des données SCTL, cf model/sctl-import.go et model/sctl-diff.go
+
+Etapes :
+- formulaire : envoi des exports csv ou du fichier .mdb, ou lecture du .mdb indiqué dans config.yml (paths / logiciel-foncier) ;
+- affichage des différences avec la base BDL, pour validation ;
+- application des différences.
+Entre l'affichage et l'application, les fichiers sont conservés dans un répertoire temporaire.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type detailsImportSCTL struct {
+	Erreur     string
+	FichierMdb string // fichier indiqué dans config.yml, vide s'il n'existe pas
+	TablesSCTL []string
+	FichierUG  string
+	Import     string // nom du répertoire temporaire
+	Checksum   string
+	Diff       *model.DiffSCTL
+	Applique   bool
+}
+
+var reRepertoireImportSCTL = regexp.MustCompile(`^bdl-sctl-\d+$`)
+
+// Affiche le formulaire ; en POST, lit les fichiers et affiche les différences
+func FormImportSCTL(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details := detailsImportSCTL{
+		TablesSCTL: model.TablesSCTL,
+		FichierUG:  model.FICHIER_UG_SCTL,
+	}
+	if mdb := ctx.Config.Paths.LogicielFoncier; mdb != "" {
+		if _, err := os.Stat(mdb); err == nil {
+			details.FichierMdb = mdb
+		}
+	}
+	ctx.TemplateName = "sctl-import-form.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Import des données SCTL",
+		},
+		Menu:    "acteurs",
+		Details: &details,
+	}
+	if r.Method != "POST" {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "bdl-sctl-")
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	details.Erreur, err = recupereFichiersSCTL(r, dir, details.FichierMdb)
+	if err != nil {
+		os.RemoveAll(dir)
+		return werr.Wrap(err)
+	}
+	if details.Erreur != "" {
+		os.RemoveAll(dir)
+		return nil
+	}
+	for _, table := range model.TablesSCTL {
+		if _, err = os.Stat(filepath.Join(dir, table+".csv")); err != nil {
+			os.RemoveAll(dir)
+			details.Erreur = "Fichier manquant : " + table + ".csv"
+			return nil
+		}
+	}
+	details.Import = filepath.Base(dir)
+	details.Diff, details.Checksum, err = computeDiffSCTL(ctx, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "sctl-import-diff.html"
+	return nil
+}
+
+// Applique les différences validées par l'utilisateur
+func ApplyImportSCTL(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		ctx.Redirect = "/sctl/import"
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return werr.Wrap(err)
+	}
+	details := detailsImportSCTL{
+		Import: r.PostFormValue("import"),
+	}
+	ctx.TemplateName = "sctl-import-diff.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Import des données SCTL",
+		},
+		Menu:    "acteurs",
+		Details: &details,
+	}
+	if !reRepertoireImportSCTL.MatchString(details.Import) {
+		return werr.New("Import SCTL incorrect : " + details.Import)
+	}
+	dir := filepath.Join(os.TempDir(), details.Import)
+	if _, err := os.Stat(dir); err != nil {
+		details.Erreur = "Import expiré ou déjà appliqué, recommencer l'import"
+		return nil
+	}
+	var donnees *model.DonneesSCTL
+	var err error
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		// recalcul dans la transaction, pour appliquer exactement le diff validé
+		donnees, err = model.LitDonneesSCTL(tx, dir)
+		if err != nil {
+			return err
+		}
+		details.Diff, err = model.ComputeDiffSCTL(tx, donnees)
+		if err != nil {
+			return err
+		}
+		details.Checksum, err = details.Diff.Checksum()
+		if err != nil {
+			return err
+		}
+		if details.Checksum != r.PostFormValue("checksum") {
+			details.Erreur = "La base a été modifiée depuis l'affichage des différences ; vérifier les différences ci-dessous puis valider à nouveau"
+			return nil
+		}
+		return model.AppliqueDiffSCTL(tx, donnees, details.Diff)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if details.Erreur == "" {
+		details.Applique = true
+		os.RemoveAll(dir)
+	}
+	return nil
+}
+
+// Copie dans dir les fichiers envoyés, ou exporte le fichier .mdb.
+// @return  message d'erreur à afficher à l'utilisateur, vide si ok
+func recupereFichiersSCTL(r *http.Request, dir, fichierMdb string) (string, error) {
+	err := r.ParseMultipartForm(64 << 20)
+	if err != nil {
+		return "", err
+	}
+	if r.PostFormValue("source") == "config" {
+		if fichierMdb == "" {
+			return "Fichier .mdb absent de config.yml (paths / logiciel-foncier)", nil
+		}
+		err = model.ExporteMdbSCTL(fichierMdb, dir)
+		if err != nil {
+			return "Erreur export du fichier .mdb : " + err.Error(), nil
+		}
+		return "", nil
+	}
+	fichiers := r.MultipartForm.File["fichiers"]
+	if len(fichiers) == 0 {
+		return "Aucun fichier envoyé", nil
+	}
+	autorises := []string{model.FICHIER_UG_SCTL}
+	for _, table := range model.TablesSCTL {
+		autorises = append(autorises, table+".csv")
+	}
+	for _, fh := range fichiers {
+		nom := filepath.Base(fh.Filename)
+		estMdb := strings.HasSuffix(strings.ToLower(nom), ".mdb")
+		if !estMdb && !tiglib.InArray(nom, autorises) {
+			return "Fichier non reconnu : " + nom + " (fichiers possibles : .mdb ou " + strings.Join(autorises, ", ") + ")", nil
+		}
+		if estMdb {
+			nom = "sctl.mdb"
+		}
+		err = copieFichierEnvoye(fh, filepath.Join(dir, nom))
+		if err != nil {
+			return "", err
+		}
+		if estMdb {
+			err = model.ExporteMdbSCTL(filepath.Join(dir, nom), dir)
+			if err != nil {
+				return "Erreur export du fichier .mdb : " + err.Error(), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func copieFichierEnvoye(fh *multipart.FileHeader, dest string) error {
+	in, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func computeDiffSCTL(ctx *ctxt.Context, dir string) (diff *model.DiffSCTL, checksum string, err error) {
+	donnees, err := model.LitDonneesSCTL(ctx.DB, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	diff, err = model.ComputeDiffSCTL(ctx.DB, donnees)
+	if err != nil {
+		return nil, "", err
+	}
+	checksum, err = diff.Checksum()
+	return diff, checksum, err
+}
@@ -8,11 +8,13 @@ package control
 
 import (
 	"bdl.local/bdl/ctxt"
-	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
 	"golang.org/x/exp/slices"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -27,6 +29,8 @@ type detailsActiviteSearchForm struct {
 	UGs          []*model.UG      // pour choix-ug - liens-ugs - toujours vide, utile que pour compatibilité avec liens-ugs.html
 	AllCommunes  []*model.Commune // pour choix-parcelle
 	UrlAction    string
+	// false pour la carte, qui n'a qu'un type de résultat
+	AvecTypeResultat bool
 }
 
 type detailsActiviteSearchResults struct {
@@ -38,6 +42,7 @@ type detailsActiviteSearchResults struct {
 	ActivitesParUG           []*model.ActivitesParUG
 	LabelProprios            map[int]string
 	Tab                      string
+	FormValues               url.Values // pour l'export, qui refait la recherche
 }
 
 // Affiche / process le formulaire de recherche
@@ -47,57 +52,11 @@ func SearchActivite(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (
 		//
 		// Process form et affiche page de résultats
 		//
-		if err = r.ParseForm(); err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		filtres := map[string][]string{}
-		filtres["fermier"] = computeFiltreFermier(r)
-		filtres["essence"] = computeFiltreEssence(r)
-		filtres["valo"] = computeFiltreValo(r)
-		filtres["proprio"] = computeFiltreProprio(r)
-		filtres["periode"] = computeFiltrePeriode(r)
-		filtres["ug"] = computeFiltreUG(r)
-		filtres["parcelle"] = computeFiltreParcelle(r)
-		//
-		activites, err := model.ComputeActivitesFromFiltres(ctx.DB, filtres)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres) // pour l'affichage
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		hasPlaquettes := false
-		if len(filtres["valo"]) == 0 {
-		    hasPlaquettes = true
-		} else {
-            if tiglib.InArray("PQ", filtres["valo"]) {
-                hasPlaquettes = true
-            }
-		}
-		//
-		bilansActivitesParSaison, err := model.ComputeBilansActivitesParSaison(ctx.DB, ctx.Config.DebutSaison, activites)
+		details, err := computeSearchActiviteResults(ctx, r)
 		if err != nil {
 			return werr.Wrap(err)
 		}
 		//
-		labelProprios, err := model.LabelActeurs(ctx.DB, "DIV-PF") // "DIV-PF" = "divers - propriétaire foncier"
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		// on ne garde dans labelProprios que les propriétaires choisis,
-		// utilisé dans la template pour n'afficher que ces propriétaires.
-		if len(filtres["proprio"]) != 0 {
-			for idProprio, _ := range labelProprios {
-				if !slices.Contains(filtres["proprio"], strconv.Itoa(idProprio)) {
-					delete(labelProprios, idProprio)
-				}
-			}
-		}
-		//
 		ctx.TemplateName = "search-activite-show.html"
 		ctx.Page = &ctxt.Page{
 			Header: ctxt.Header{
@@ -114,43 +73,19 @@ func SearchActivite(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (
 					"/static/lib/table-sort/table-sort.js",
 				},
 			},
-			Menu: "accueil",
-			Details: detailsActiviteSearchResults{
-				Activites:                activites,
-				RecapFiltres:             recapFiltres,
-				ActiviteMap:              model.GetActivitesMap(),
-				BilansActivitesParSaison: bilansActivitesParSaison,
-				HasPlaquettes:            hasPlaquettes,
-				ActivitesParUG:           model.ComputeActivitesParUG(activites),
-				LabelProprios:            labelProprios,
-				Tab:                      r.PostFormValue("type-resultat"),
-			},
+			Menu:    "accueil",
+			Details: details,
 		}
 		return nil
 	default:
 		//
 		// Affiche form
 		//
-		periods, _, err := model.ComputeLimitesSaisons(ctx.DB, ctx.Config.DebutSaison)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		propriosMap, err := model.GetProprietaires(ctx.DB)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		fermiers, err := model.GetSortedFermiers(ctx.DB, "nom")
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		allUGs, err := model.GetUGsSortedByCode(ctx.DB)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		allCommunes, err := model.GetSortedCommunes(ctx.DB, "nom")
+		details, err := computeSearchActiviteForm(ctx, "/activite/recherche")
 		if err != nil {
 			return werr.Wrap(err)
 		}
+		details.AvecTypeResultat = true
 		//
 		ctx.TemplateName = "search-activite-form.html"
 		ctx.Page = &ctxt.Page{
@@ -160,19 +95,132 @@ func SearchActivite(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (
 					"/static/css/form.css",
 				},
 			},
-			Menu: "accueil",
-			Details: detailsActiviteSearchForm{
-				Periods:      periods,
-				EssenceCodes: model.EssenceCodes,
-				ValoCodes:    model.AllValoCodesAvecChauferEtPlaq(),
-				PropriosMap:  propriosMap,
-				Fermiers:     fermiers,
-				AllUGs:       allUGs,
-				UGs:          []*model.UG{},
-				AllCommunes:  allCommunes,
-				UrlAction:    "/activite/recherche",
-			},
+			Menu:    "accueil",
+			Details: details,
 		}
 		return nil
 	}
 }
+
+// Calcule les données du formulaire de recherche d'activités.
+// Utilisé pour la recherche d'activités et pour la carte.
+func computeSearchActiviteForm(ctx *ctxt.Context, urlAction string) (details *detailsActiviteSearchForm, err error) {
+	periods, _, err := model.ComputeLimitesSaisons(ctx.DB, ctx.Config.DebutSaison)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	propriosMap, err := model.GetProprietaires(ctx.DB)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	fermiers, err := model.GetSortedFermiers(ctx.DB, "nom")
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	allUGs, err := model.GetUGsSortedByCode(ctx.DB)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	allCommunes, err := model.GetSortedCommunes(ctx.DB, "nom")
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	details = &detailsActiviteSearchForm{
+		Periods:      periods,
+		EssenceCodes: model.EssenceCodes,
+		ValoCodes:    model.AllValoCodesAvecChauferEtPlaq(),
+		PropriosMap:  propriosMap,
+		Fermiers:     fermiers,
+		AllUGs:       allUGs,
+		UGs:          []*model.UG{},
+		AllCommunes:  allCommunes,
+		UrlAction:    urlAction,
+	}
+	return details, nil
+}
+
+// Calcule les résultats de la recherche à partir du formulaire.
+// Utilisé pour la page de résultats et pour l'export.
+func computeSearchActiviteResults(ctx *ctxt.Context, r *http.Request) (details *detailsActiviteSearchResults, err error) {
+	if err = r.ParseForm(); err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	filtres := computeFiltresActivite(r)
+	//
+	activites, err := model.ComputeActivitesFromFiltres(ctx.DB, filtres)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres) // pour l'affichage
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	hasPlaquettes := false
+	if len(filtres["valo"]) == 0 {
+		hasPlaquettes = true
+	} else {
+		if tiglib.InArray("PQ", filtres["valo"]) {
+			hasPlaquettes = true
+		}
+	}
+	//
+	bilansActivitesParSaison, err := model.ComputeBilansActivitesParSaison(ctx.DB, ctx.Config.DebutSaison, activites)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	labelProprios, err := model.LabelActeurs(ctx.DB, "DIV-PF") // "DIV-PF" = "divers - propriétaire foncier"
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	// on ne garde dans labelProprios que les propriétaires choisis,
+	// utilisé dans la template pour n'afficher que ces propriétaires.
+	if len(filtres["proprio"]) != 0 {
+		for idProprio, _ := range labelProprios {
+			if !slices.Contains(filtres["proprio"], strconv.Itoa(idProprio)) {
+				delete(labelProprios, idProprio)
+			}
+		}
+	}
+	//
+	details = &detailsActiviteSearchResults{
+		Activites:                activites,
+		RecapFiltres:             recapFiltres,
+		ActiviteMap:              model.GetActivitesMap(),
+		BilansActivitesParSaison: bilansActivitesParSaison,
+		HasPlaquettes:            hasPlaquettes,
+		ActivitesParUG:           model.ComputeActivitesParUG(activites),
+		LabelProprios:            labelProprios,
+		Tab:                      r.PostFormValue("type-resultat"),
+		FormValues:               r.PostForm,
+	}
+	return details, nil
+}
+
+// Filtres du formulaire de recherche d'activités ; r.ParseForm() doit avoir été appelé
+func computeFiltresActivite(r *http.Request) map[string][]string {
+	filtres := map[string][]string{}
+	filtres["fermier"] = computeFiltreFermier(r)
+	filtres["essence"] = computeFiltreEssence(r)
+	filtres["valo"] = computeFiltreValo(r)
+	filtres["proprio"] = computeFiltreProprio(r)
+	filtres["periode"] = computeFiltrePeriode(r)
+	filtres["ug"] = computeFiltreUG(r)
+	filtres["parcelle"] = computeFiltreParcelle(r)
+	return filtres
+}
+
+// Export CSV ou XLSX des résultats de la recherche ; reçoit les mêmes champs que le formulaire de recherche.
+func ExportSearchActivite(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchActiviteResults(ctx, r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, mux.Vars(r)["format"], "activites", r.PostFormValue("tableau"),
+		tableauActivites(details.Activites),
+		tableauActivitesParUG(details.ActivitesParUG),
+		tableauBilansActivites(details.BilansActivitesParSaison, details.LabelProprios, details.HasPlaquettes))
+}
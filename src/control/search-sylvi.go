@@ -12,6 +12,7 @@ import (
 	"bdl.local/bdl/model"
 	"github.com/gorilla/mux"
 	"net/http"
+	"net/url"
 )
 
 type detailsSylviForm struct {
@@ -25,7 +26,8 @@ type detailsSylviResults struct {
 	UGs          []*model.UG
 	RecapFiltres string
 	////// supprimer si finalement pas de tab
-	Tab string
+	Tab        string
+	FormValues url.Values // pour l'export, qui refait la recherche
 }
 
 // Affiche / process le formulaire de recherche
@@ -35,26 +37,7 @@ func SearchSylvi(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 		//
 		// Process form et affiche page de résultats
 		//
-		if err = r.ParseForm(); err != nil {
-			return werr.Wrap(err)
-		}
-		////// supprimer si finalement pas de tab
-		vars := mux.Vars(r)
-		tab := vars["tab"]
-		if tab == "" {
-			tab = "liste"
-		}
-		//
-		filtres := map[string][]string{}
-		filtres["fermier"] = computeFiltreFermier(r)
-		filtres["essence"] = computeFiltreEssence(r)
-		filtres["commune"] = computeFiltreCommune(r)
-		ugs, err := model.ComputeUGsFromFiltres(ctx.DB, filtres)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres)
+		details, err := computeSearchSylviResults(ctx, r)
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -71,13 +54,8 @@ func SearchSylvi(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 					"/static/lib/tabstrip/tabstrip.js",
 					"/static/lib/table-sort/table-sort.js"},
 			},
-			Menu: "production",
-			Details: detailsSylviResults{
-				UGs:          ugs,
-				RecapFiltres: recapFiltres,
-				////// supprimer si finalement pas de tab
-				Tab: tab,
-			},
+			Menu:    "production",
+			Details: details,
 		}
 		return nil
 	default:
@@ -121,3 +99,47 @@ func SearchSylvi(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 		return nil
 	}
 }
+
+// Calcule les résultats de la recherche à partir du formulaire.
+// Utilisé pour la page de résultats et pour l'export.
+func computeSearchSylviResults(ctx *ctxt.Context, r *http.Request) (details *detailsSylviResults, err error) {
+	if err = r.ParseForm(); err != nil {
+		return details, werr.Wrap(err)
+	}
+	////// supprimer si finalement pas de tab
+	vars := mux.Vars(r)
+	tab := vars["tab"]
+	if tab == "" {
+		tab = "liste"
+	}
+	//
+	filtres := map[string][]string{}
+	filtres["fermier"] = computeFiltreFermier(r)
+	filtres["essence"] = computeFiltreEssence(r)
+	filtres["commune"] = computeFiltreCommune(r)
+	ugs, err := model.ComputeUGsFromFiltres(ctx.DB, filtres)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	details = &detailsSylviResults{
+		UGs:          ugs,
+		RecapFiltres: recapFiltres,
+		Tab:          tab,
+		FormValues:   r.PostForm,
+	}
+	return details, nil
+}
+
+// Export CSV ou XLSX des résultats de la recherche ; reçoit les mêmes champs que le formulaire de recherche.
+func ExportSearchSylvi(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchSylviResults(ctx, r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, mux.Vars(r)["format"], "sylviculture", r.PostFormValue("tableau"), tableauUGs(details.UGs))
+}
@@ -10,7 +10,9 @@ import (
 	"bdl.local/bdl/ctxt"
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -30,6 +32,7 @@ type detailsVenteSearchResults struct {
 	DateFin               time.Time
 	BilansVentesParSaison []*model.BilanVentesParSaison
 	Tab                   string
+	FormValues            url.Values // pour l'export, qui refait la recherche
 }
 
 func SearchVente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err error) {
@@ -38,26 +41,7 @@ func SearchVente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 		//
 		// Process form et affiche page de résultats
 		//
-		if err = r.ParseForm(); err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		filtres := map[string][]string{}
-		filtres["periode"] = computeFiltrePeriode(r)
-		filtres["valo"] = computeFiltreValo(r)
-		filtres["client"] = computeFiltreClient(r)
-		filtres["proprio"] = computeFiltreProprio(r)
-		ventes, err := model.ComputeVentesFromFiltres(ctx.DB, filtres)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		bilansVentesParSaison, err := model.ComputeBilansVentesParSaison(ctx.DB, ctx.Config.DebutSaison, ventes)
+		details, err := computeSearchVenteResults(ctx, r)
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -80,13 +64,8 @@ func SearchVente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 					"/static/lib/table-sort/table-sort.js",
 				},
 			},
-			Menu: "accueil",
-			Details: detailsVenteSearchResults{
-				RecapFiltres:          recapFiltres,
-				Ventes:                ventes,
-				BilansVentesParSaison: bilansVentesParSaison,
-				Tab:                   r.PostFormValue("type-resultat"),
-			},
+			Menu:    "accueil",
+			Details: details,
 		}
 		return nil
 	default:
@@ -127,3 +106,57 @@ func SearchVente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) (err
 		return nil
 	}
 }
+
+// Calcule les résultats de la recherche à partir du formulaire.
+// Utilisé pour la page de résultats et pour l'export.
+func computeSearchVenteResults(ctx *ctxt.Context, r *http.Request) (details *detailsVenteSearchResults, err error) {
+	if err = r.ParseForm(); err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	filtres := computeFiltresVente(r)
+	ventes, err := model.ComputeVentesFromFiltres(ctx.DB, filtres)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	recapFiltres, err := model.ComputeRecapFiltres(ctx.DB, filtres)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	bilansVentesParSaison, err := model.ComputeBilansVentesParSaison(ctx.DB, ctx.Config.DebutSaison, ventes)
+	if err != nil {
+		return details, werr.Wrap(err)
+	}
+	//
+	details = &detailsVenteSearchResults{
+		RecapFiltres:          recapFiltres,
+		Ventes:                ventes,
+		BilansVentesParSaison: bilansVentesParSaison,
+		Tab:                   r.PostFormValue("type-resultat"),
+		FormValues:            r.PostForm,
+	}
+	return details, nil
+}
+
+// Filtres du formulaire de recherche de ventes ; r.ParseForm() doit avoir été appelé
+func computeFiltresVente(r *http.Request) map[string][]string {
+	filtres := map[string][]string{}
+	filtres["periode"] = computeFiltrePeriode(r)
+	filtres["valo"] = computeFiltreValo(r)
+	filtres["client"] = computeFiltreClient(r)
+	filtres["proprio"] = computeFiltreProprio(r)
+	return filtres
+}
+
+// Export CSV ou XLSX des résultats de la recherche ; reçoit les mêmes champs que le formulaire de recherche.
+func ExportSearchVente(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details, err := computeSearchVenteResults(ctx, r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, mux.Vars(r)["format"], "ventes", r.PostFormValue("tableau"),
+		tableauVentes(details.Ventes),
+		tableauBilansVentes(details.BilansVentesParSaison))
+}
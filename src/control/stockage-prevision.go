@@ -0,0 +1,146 @@
+/*
+Tableau de bord des hangars : évolution du stock et prévision de vidage.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type detailsPrevisionsStockages struct {
+	NbSaisons    int
+	ChoixSaisons []int
+	Previsions   []*model.PrevisionStockage
+	Courbes      map[int]*courbeStock // clé = id stockage
+	StockTotal   float64
+}
+
+// Graphique SVG de l'évolution du stock d'un hangar.
+// Coordonnées en pixels, calculées ici pour que le template n'ait qu'à les afficher.
+type courbeStock struct {
+	Largeur     int
+	Hauteur     int
+	Historique  string // points de la polyline du stock passé
+	Projection  string // points de la droite de projection, depuis aujourd'hui jusqu'à la date de vidage
+	XAujourdhui float64
+	Annees      []repereCourbe
+	Stocks      []repereCourbe
+}
+
+type repereCourbe struct {
+	Pos   float64
+	Label string
+}
+
+const (
+	courbeLargeur = 800
+	courbeHauteur = 200
+	courbeMarge   = 50 // à gauche, pour les labels des stocks
+)
+
+// Affiche l'évolution du stock de chaque hangar actif et la date prévue de vidage.
+// Paramètre optionnel dans l'url : saisons = nb de saisons utilisées pour le rythme des chargements (3 par défaut).
+func ShowPrevisionsStockages(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	nbSaisons := 3
+	if str := r.URL.Query().Get("saisons"); str != "" {
+		n, err := strconv.Atoi(str)
+		if err != nil || n < 1 {
+			return werr.New("Paramètre saisons incorrect : " + str)
+		}
+		nbSaisons = n
+	}
+	previsions, err := model.ComputePrevisionsStockages(ctx.DB, ctx.Config.DebutSaison, nbSaisons)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	details := detailsPrevisionsStockages{
+		NbSaisons:    nbSaisons,
+		ChoixSaisons: []int{1, 2, 3, 4, 5},
+		Previsions:   previsions,
+		Courbes:      map[int]*courbeStock{},
+	}
+	for _, p := range previsions {
+		details.Courbes[p.Stockage.Id] = computeCourbeStock(p)
+		details.StockTotal += p.StockActuel()
+	}
+	ctx.TemplateName = "stockage-previsions.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Prévisions stock plaquettes",
+			CSSFiles: []string{
+				"/static/css/form.css"},
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu:    "production",
+		Details: details,
+	}
+	return nil
+}
+
+// Calcule le graphique : de la première date de stock jusqu'à la date prévue de vidage
+// (limitée à un an après aujourd'hui).
+func computeCourbeStock(p *model.PrevisionStockage) *courbeStock {
+	c := &courbeStock{Largeur: courbeLargeur + courbeMarge, Hauteur: courbeHauteur + 30} // + 30 : labels des années
+	aujourdhui := p.DateDebut.AddDate(0, 0, len(p.Stocks)-1)
+	fin := aujourdhui
+	if !p.DateVide.IsZero() {
+		fin = p.DateVide
+		if limite := aujourdhui.AddDate(1, 0, 0); fin.After(limite) {
+			fin = limite
+		}
+	}
+	nbJoursTotal := fin.Sub(p.DateDebut).Hours()/24 + 1
+	stockMax := 0.0
+	for _, stock := range p.Stocks {
+		if stock > stockMax {
+			stockMax = stock
+		}
+	}
+	if stockMax == 0 {
+		stockMax = 1
+	}
+	x := func(d time.Time) float64 {
+		return courbeMarge + tiglib.Round(d.Sub(p.DateDebut).Hours()/24*courbeLargeur/nbJoursTotal, 1)
+	}
+	y := func(stock float64) float64 {
+		return tiglib.Round(courbeHauteur-stock*courbeHauteur/stockMax, 1)
+	}
+	points := make([]string, 0, len(p.Stocks))
+	for k, stock := range p.Stocks {
+		points = append(points, formatPoint(x(p.DateDebut.AddDate(0, 0, k)), y(stock)))
+	}
+	c.Historique = strings.Join(points, " ")
+	c.XAujourdhui = x(aujourdhui)
+	if fin.After(aujourdhui) {
+		stockFin := p.StockActuel() - p.RythmeCharge*(fin.Sub(aujourdhui).Hours()/24)
+		if stockFin < 0 {
+			stockFin = 0
+		}
+		c.Projection = formatPoint(x(aujourdhui), y(p.StockActuel())) + " " + formatPoint(x(fin), y(stockFin))
+	}
+	for annee := p.DateDebut.Year() + 1; annee <= fin.Year(); annee++ {
+		d := time.Date(annee, time.January, 1, 0, 0, 0, 0, time.UTC)
+		c.Annees = append(c.Annees, repereCourbe{Pos: x(d), Label: strconv.Itoa(annee)})
+	}
+	for _, stock := range []float64{0, stockMax / 2, stockMax} {
+		c.Stocks = append(c.Stocks, repereCourbe{Pos: y(stock), Label: strconv.Itoa(int(stock + 0.5))})
+	}
+	return c
+}
+
+func formatPoint(x, y float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64) + "," + strconv.FormatFloat(y, 'f', -1, 64)
+}
@@ -0,0 +1,201 @@
+/*
+Valorisation du stock de plaquettes à une date (bilan comptable) : page html, PDF et CSV.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/tableur"
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"github.com/gorilla/mux"
+	"github.com/jung-kurt/gofpdf"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type detailsValorisationStock struct {
+	Valorisation *model.ValorisationStock
+	UrlPDF       string
+	UrlCSV       string
+}
+
+// Affiche le formulaire de choix de la date et de la méthode, et la valorisation du stock.
+// La date et la méthode sont passées dans l'url (date, methode) ;
+// par défaut, la dernière clôture passée (30/09 ou 31/12) et la valorisation par tas.
+func ShowValorisationStock(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	date, methode, err := valorisationStockFromQuery(r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	valo, err := model.ComputeValorisationStock(ctx.DB, ctx.Config, date, methode)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	query := url.Values{}
+	query.Set("date", tiglib.DateIso(date))
+	query.Set("methode", methode)
+	ctx.TemplateName = "stockage-valorisation.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Valorisation du stock",
+			CSSFiles: []string{
+				"/static/css/form.css"},
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "accueil",
+		Details: detailsValorisationStock{
+			Valorisation: valo,
+			UrlPDF:       "/stockage/valorisation/pdf?" + query.Encode(),
+			UrlCSV:       "/stockage/valorisation/csv?" + query.Encode(),
+		},
+	}
+	return nil
+}
+
+// Renvoie la valorisation du stock en PDF ou en CSV
+func ExportValorisationStock(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	date, methode, err := valorisationStockFromQuery(r)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	valo, err := model.ComputeValorisationStock(ctx.DB, ctx.Config, date, methode)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	nom := "valorisation-stock-" + tiglib.DateIso(date)
+	if mux.Vars(r)["format"] == "csv" {
+		return ecrireTableaux(w, "csv", nom, "", tableauValorisationStock(valo))
+	}
+	return pdfValorisationStock(w, ctx.Config, valo)
+}
+
+// Récupère la date et la méthode de valorisation passées dans l'url
+func valorisationStockFromQuery(r *http.Request) (date time.Time, methode string, err error) {
+	date = derniereClotureStock(time.Now())
+	query := r.URL.Query()
+	if query.Get("date") != "" {
+		date, err = time.Parse("2006-01-02", query.Get("date"))
+		if err != nil {
+			return date, methode, werr.Wrap(err)
+		}
+	}
+	methode = query.Get("methode")
+	if methode != model.VALO_STOCK_FIFO {
+		methode = model.VALO_STOCK_TAS
+	}
+	return date, methode, nil
+}
+
+// Renvoie le dernier 30/09 ou 31/12 antérieur à now
+func derniereClotureStock(now time.Time) time.Time {
+	annee := now.Year()
+	if now.Month() >= time.October {
+		return time.Date(annee, time.September, 30, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(annee-1, time.December, 31, 0, 0, 0, 0, time.UTC)
+}
+
+// Libellé d'une ligne de valorisation : nom du tas, ou du chantier avec la méthode FIFO
+func libelleLigneValorisation(l *model.LigneValorisationStock) string {
+	if l.Tas != nil {
+		return l.Tas.Nom
+	}
+	return l.Chantier.String()
+}
+
+func labelMethodeValorisation(methode string) string {
+	if methode == model.VALO_STOCK_FIFO {
+		return "FIFO (premier entré, premier sorti)"
+	}
+	return "coût du chantier de chaque tas"
+}
+
+// ************************** CSV *******************************
+
+// Une ligne par tas (ou par chantier avec FIFO), puis une ligne de total par lieu de stockage
+func tableauValorisationStock(valo *model.ValorisationStock) *tableur.Tableau {
+	t := tableur.New("Valorisation stock", "Date", "Hangar", "Tas / chantier", "Quantité (maps)", "Coût par map HT", "Valeur HT")
+	for _, vs := range valo.Stockages {
+		for _, l := range vs.Lignes {
+			t.AddLigne(valo.Date, vs.Stockage.Nom, libelleLigneValorisation(l),
+				tiglib.Round(l.Qte, 2), tiglib.Round(l.CoutParMap, 2), tiglib.Round(l.Valeur(), 2))
+		}
+		t.AddLigne(valo.Date, vs.Stockage.Nom, "TOTAL", tiglib.Round(vs.Qte(), 2), "", tiglib.Round(vs.Valeur(), 2))
+	}
+	t.AddLigne(valo.Date, "TOTAL", "", tiglib.Round(valo.Qte(), 2), "", tiglib.Round(valo.Valeur(), 2))
+	return t
+}
+
+// ************************** PDF *******************************
+
+func pdfValorisationStock(w http.ResponseWriter, conf *model.Config, valo *model.ValorisationStock) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // "" defaults to "cp1252"
+	titre := "Valorisation du stock au " + tiglib.DateFr(valo.Date)
+	MetaDataPDF(pdf, tr, conf, titre)
+	pdf.SetAutoPageBreak(true, 20) // laisse la place du footer
+	pdf.SetFooterFunc(func() {
+		FooterFacture(pdf, tr, conf)
+	})
+	colW := []float64{100, 30, 30, 30} // tas ou chantier, quantité, coût par map, valeur
+	colH := 7.0
+	pdf.AddPage()
+	HeaderFacture(pdf, tr, conf, "STOCK")
+	pdf.SetXY(10, 55)
+	pdf.SetFont("Arial", "B", 14)
+	pdf.Cell(190, 8, tr(titre))
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "", 10)
+	pdf.MultiCell(190, 6, tr("Méthode : "+labelMethodeValorisation(valo.Methode)+".\n"+
+		"Coût par map : coût de revient du chantier à la date (exploitation, transport, rangement, transferts, "+
+		"stockage jusqu'à la date), hors chargement et livraison (frais de vente)."), "", "L", false)
+	pdf.Ln(4)
+	if len(valo.Stockages) == 0 {
+		pdf.SetFont("Arial", "B", 12)
+		pdf.Cell(190, 8, tr("Aucun stock à cette date"))
+		return pdf.Output(w)
+	}
+	entetes := []string{"Tas", "Quantité", "Coût / map HT", "Valeur HT"}
+	if valo.Methode == model.VALO_STOCK_FIFO {
+		entetes[0] = "Chantier"
+	}
+	for _, vs := range valo.Stockages {
+		pdf.SetFont("Arial", "B", 12)
+		pdf.Cell(190, 8, tr(vs.Stockage.Nom))
+		pdf.Ln(-1)
+		pdf.SetFont("Arial", "B", 10)
+		for i, entete := range entetes {
+			pdf.CellFormat(colW[i], colH, tr(entete), "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Arial", "", 10)
+		for _, l := range vs.Lignes {
+			pdf.CellFormat(colW[0], colH, tr(libelleLigneValorisation(l)), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(colW[1], colH, tr(formatNbPDF(l.Qte)+" maps"), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(colW[2], colH, tr(formatNbPDF(l.CoutParMap)+" €"), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(colW[3], colH, tr(formatNbPDF(l.Valeur())+" €"), "1", 0, "R", false, 0, "")
+			pdf.Ln(-1)
+		}
+		pdf.SetFont("Arial", "B", 10)
+		pdf.CellFormat(colW[0], colH, tr("Total "+vs.Stockage.Nom), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(colW[1], colH, tr(formatNbPDF(vs.Qte())+" maps"), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(colW[2], colH, "", "1", 0, "R", false, 0, "")
+		pdf.CellFormat(colW[3], colH, tr(formatNbPDF(vs.Valeur())+" €"), "1", 0, "R", false, 0, "")
+		pdf.Ln(10)
+	}
+	pdf.SetFont("Arial", "B", 12)
+	pdf.CellFormat(colW[0], colH, tr("TOTAL"), "1", 0, "L", false, 0, "")
+	pdf.CellFormat(colW[1], colH, tr(formatNbPDF(valo.Qte())+" maps"), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(colW[2], colH, "", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(colW[3], colH, tr(formatNbPDF(valo.Valeur())+" €"), "1", 0, "R", false, 0, "")
+	return pdf.Output(w)
+}
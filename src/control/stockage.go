@@ -6,9 +6,11 @@ package control
 
 import (
 	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/webo"
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
 	"github.com/gorilla/mux"
+	"html/template"
 	"net/http"
 	"strconv"
 )
@@ -19,8 +21,9 @@ type detailsStockageForm struct {
 }
 
 type detailsStockageList struct {
-	Actifs   []*model.Stockage
-	Archives []*model.Stockage
+	Actifs            []*model.Stockage
+	Archives          []*model.Stockage
+	MotifPerteOptions template.HTML
 }
 
 func ListStockages(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
@@ -56,8 +59,9 @@ func ListStockages(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 		},
 		Menu: "accueil",
 		Details: detailsStockageList{
-			Actifs:   actifs,
-			Archives: archives,
+			Actifs:            actifs,
+			Archives:          archives,
+			MotifPerteOptions: webo.FmtOptions(WeboMotifPerte(), "CHOOSE_MOTIF"),
 		},
 	}
 	ctx.TemplateName = "stockage-list.html"
@@ -75,7 +79,10 @@ func NewStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) erro
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertStockage(ctx.DB, stockage)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertStockage(tx, stockage)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -123,7 +130,9 @@ func UpdateStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) e
 			Id:  id,
 			Nom: r.PostFormValue("nom"),
 		}
-		err = model.UpdateStockage(ctx.DB, stockage)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateStockage(tx, stockage)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -177,13 +186,17 @@ func DeleteOrArchiveStockage(ctx *ctxt.Context, w http.ResponseWriter, r *http.R
 		return werr.Wrap(err)
 	}
 	if stockage.Deletable {
-		err = model.DeleteStockage(ctx.DB, id)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.DeleteStockage(tx, id)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
 	} else if stockage.Archivable {
 		stockage.Archived = true
-		err = model.UpdateStockage(ctx.DB, stockage)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateStockage(tx, stockage)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -35,7 +35,10 @@ func NewStockFrais(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertStockFrais(ctx.DB, frais)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertStockFrais(tx, frais)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -86,7 +89,9 @@ func UpdateStockFrais(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		err = model.UpdateStockFrais(ctx.DB, frais)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateStockFrais(tx, frais)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -134,7 +139,9 @@ func DeleteStockFrais(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteStockFrais(ctx.DB, idFrais)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteStockFrais(tx, idFrais)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -18,6 +18,13 @@ type detailsTasVidesShow struct {
 	Chantiers []*model.Plaq
 }
 
+type detailsPertesVidage struct {
+	Chantiers        []*model.PertesVidage
+	Stockages        []*model.PertesVidage
+	MotifsPerte      []string
+	PourcentagePerte float64
+}
+
 func ShowTasVides(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	chantiers, err := model.GetAllPlaqsVides(ctx.DB)
 	if err != nil {
@@ -50,10 +57,58 @@ func SignalerTasVide(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DesactiverTas(ctx.DB, id, date)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DesactiverTas(tx, id, date, vars["motif"])
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
 	ctx.Redirect = "/stockage/liste"
 	return nil
 }
+
+// Rouvre un tas signalé vide par erreur
+func RouvrirTas(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.RouvrirTas(tx, id)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/stockage/liste"
+	return nil
+}
+
+// Affiche les pertes constatées au vidage des tas, par chantier et par hangar
+func ShowPertesVidage(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	chantiers, err := model.ComputePertesVidageChantiers(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	stockages, err := model.ComputePertesVidageStockages(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "stockage-pertes.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Pertes au vidage des tas",
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "accueil",
+		Details: detailsPertesVidage{
+			Chantiers:        chantiers,
+			Stockages:        stockages,
+			MotifsPerte:      append(append([]string{}, model.MotifsPerte...), ""), // "" : vidages sans motif
+			PourcentagePerte: ctx.Config.PourcentagePerte,
+		},
+	}
+	return nil
+}
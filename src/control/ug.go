@@ -39,7 +39,7 @@ func ShowUG(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 		return werr.Wrapf(err, "Erreur appel GetUGFull()")
 	}
 	//
-	err = ug.ComputeRecap(ctx.DB)
+	err = ug.ComputeRecap(ctx.DB, ctx.Config)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel UG.ComputeRecap()")
 	}
@@ -54,7 +54,7 @@ func ShowUG(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 		Header: ctxt.Header{
 			Title:    "Unité de gestion " + ug.Code,
 			CSSFiles: []string{"/static/lib/tabstrip/tabstrip.css"},
-			JSFiles:  []string{"/static/js/formatNb.js"},
+			JSFiles:  []string{"/static/js/formatNb.js", "/static/js/round.js"},
 		},
 		Menu: "accueil",
 		Details: detailsUGShow{
@@ -0,0 +1,309 @@
+/*
+Connexion / déconnexion et gestion des utilisateurs de l'application.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package control
+
+import (
+	"bdl.local/bdl/ctxt"
+	"bdl.local/bdl/generic/wilk/werr"
+	"bdl.local/bdl/model"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Nom du cookie contenant le jeton de session
+const COOKIE_SESSION = "bdl-session"
+
+type detailsLogin struct {
+	Login   string
+	Url     string
+	Message string
+}
+
+type detailsUtilisateurList struct {
+	Utilisateurs []*model.Utilisateur
+}
+
+type detailsUtilisateurForm struct {
+	UrlAction   string
+	Utilisateur *model.Utilisateur
+	RoleMap     map[string]string
+}
+
+// *********************** Connexion **********************************
+
+// Process ou affiche form de connexion
+func Login(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	details := detailsLogin{
+		Url: r.URL.Query().Get("url"),
+	}
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			return werr.Wrap(err)
+		}
+		details.Login = strings.TrimSpace(r.PostFormValue("login"))
+		details.Url = r.PostFormValue("url")
+		u, err := model.AuthentifierUtilisateur(ctx.DB, details.Login, r.PostFormValue("password"))
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		if u != nil {
+			s, err := model.InsertSession(ctx.DB, ctx.Config, u.Id)
+			if err != nil {
+				return werr.Wrap(err)
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     COOKIE_SESSION,
+				Value:    s.Token,
+				Path:     "/",
+				Expires:  s.DateExpire,
+				HttpOnly: true,
+				Secure:   isHTTPS(r),
+				// Strict : le cookie n'est pas envoyé lors d'une navigation depuis un autre site,
+				// ce qui protège les routes de modification appelées en GET (delete etc.) contre le CSRF
+				SameSite: http.SameSiteStrictMode,
+			})
+			ctx.Redirect = "/"
+			// Uniquement des urls locales, pour éviter les redirections vers un site extérieur
+			if strings.HasPrefix(details.Url, "/") && !strings.HasPrefix(details.Url, "//") {
+				ctx.Redirect = details.Url
+			}
+			return nil
+		}
+		details.Message = "Identifiant ou mot de passe incorrect"
+	}
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title:    "Connexion",
+			CSSFiles: []string{"/static/css/form.css"},
+		},
+		Menu:    "accueil",
+		Details: details,
+	}
+	ctx.TemplateName = "login.html"
+	return nil
+}
+
+func Logout(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(COOKIE_SESSION)
+	if err == nil {
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.DeleteSession(tx, cookie.Value)
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     COOKIE_SESSION,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	ctx.Redirect = "/login"
+	return nil
+}
+
+// Renvoie l'utilisateur correspondant à la session de la requête
+// ou nil si pas de session valide.
+// Le jeton de session est lu dans l'en-tête "Authorization: Bearer <jeton>" (utilisé par l'API)
+// ou à défaut dans le cookie de session.
+func GetUtilisateurFromRequest(ctx *ctxt.Context, r *http.Request) (*model.Utilisateur, error) {
+	token := ""
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if cookie, err := r.Cookie(COOKIE_SESSION); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		return nil, nil
+	}
+	u, err := model.GetUtilisateurFromSession(ctx.DB, token)
+	if err != nil {
+		return nil, werr.Wrap(err)
+	}
+	return u, nil
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// *********************** Gestion des utilisateurs **********************************
+
+func ListUtilisateurs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	utilisateurs, err := model.GetUtilisateurs(ctx.DB)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Utilisateurs",
+		},
+		Menu: "accueil",
+		Details: detailsUtilisateurList{
+			Utilisateurs: utilisateurs,
+		},
+	}
+	ctx.TemplateName = "utilisateur-list.html"
+	return nil
+}
+
+// Process ou affiche form new
+func NewUtilisateur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		//
+		// Process form
+		//
+		u, err := utilisateurForm2var(r)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		if u.Password == "" {
+			return errors.New("Le mot de passe doit être renseigné")
+		}
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertUtilisateur(tx, u)
+			return err
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Redirect = "/utilisateur/liste"
+		return nil
+	default:
+		//
+		// Affiche form
+		//
+		ctx.Page = &ctxt.Page{
+			Header: ctxt.Header{
+				Title:    "Créer un utilisateur",
+				CSSFiles: []string{"/static/css/form.css"},
+			},
+			Menu: "accueil",
+			Details: detailsUtilisateurForm{
+				UrlAction:   "/utilisateur/new",
+				Utilisateur: &model.Utilisateur{Role: "lecteur", Actif: true},
+				RoleMap:     model.UtilisateurRoleMap,
+			},
+		}
+		ctx.TemplateName = "utilisateur-form.html"
+		return nil
+	}
+}
+
+// Process ou affiche form update
+func UpdateUtilisateur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		//
+		// Process form
+		//
+		u, err := utilisateurForm2var(r)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		u.Id, err = strconv.Atoi(r.PostFormValue("id"))
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		if u.Id == ctx.Utilisateur.Id && (!u.Actif || u.Role != "admin") {
+			return errors.New("Un administrateur ne peut pas se retirer lui-même les droits d'administration")
+		}
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateUtilisateur(tx, u)
+		})
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Redirect = "/utilisateur/liste"
+		return nil
+	default:
+		//
+		// Affiche form
+		//
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		u, err := model.GetUtilisateur(ctx.DB, id)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+		ctx.Page = &ctxt.Page{
+			Header: ctxt.Header{
+				Title:    "Modifier l'utilisateur " + u.Login,
+				CSSFiles: []string{"/static/css/form.css"},
+			},
+			Menu: "accueil",
+			Details: detailsUtilisateurForm{
+				UrlAction:   "/utilisateur/update/" + strconv.Itoa(u.Id),
+				Utilisateur: u,
+				RoleMap:     model.UtilisateurRoleMap,
+			},
+		}
+		ctx.TemplateName = "utilisateur-form.html"
+		return nil
+	}
+}
+
+func DeleteUtilisateur(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	if id == ctx.Utilisateur.Id {
+		return errors.New("Impossible de supprimer l'utilisateur connecté")
+	}
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteUtilisateur(tx, id)
+	})
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.Redirect = "/utilisateur/liste"
+	return nil
+}
+
+// Fabrique un Utilisateur à partir des valeurs d'un formulaire.
+// Auxiliaire de NewUtilisateur() et UpdateUtilisateur()
+// Ne gère pas le champ Id
+// Password contient le hash du mot de passe saisi, ou "" si pas de mot de passe saisi
+func utilisateurForm2var(r *http.Request) (*model.Utilisateur, error) {
+	u := &model.Utilisateur{}
+	var err error
+	if err = r.ParseForm(); err != nil {
+		return u, werr.Wrap(err)
+	}
+	u.Login = strings.TrimSpace(r.PostFormValue("login"))
+	if u.Login == "" {
+		return u, errors.New("L'identifiant doit être renseigné")
+	}
+	u.Role = r.PostFormValue("role")
+	u.Actif = r.PostFormValue("actif") == "on"
+	u.Notes = r.PostFormValue("notes")
+	password := r.PostFormValue("password")
+	if password != "" {
+		if password != r.PostFormValue("password2") {
+			return u, errors.New("Les deux mots de passe saisis sont différents")
+		}
+		u.Password, err = model.HashPassword(password)
+		if err != nil {
+			return u, werr.Wrap(err)
+		}
+	}
+	return u, nil
+}
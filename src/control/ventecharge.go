@@ -39,16 +39,10 @@ func NewVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) e
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertVenteCharge(ctx.DB, vc)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		// Mise à jour du stock du tas
-		err = vc.ComputeTas(ctx.DB)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		err = vc.Tas.ModifierStock(ctx.DB, -vc.Qte) // Retire plaquettes au tas
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertVenteCharge(tx, vc) // gère la modif du stock du tas
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -125,34 +119,9 @@ func UpdateVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		// Mise à jour du stock du tas
-		// Ajoute la qté du chargement avant update chargement
-		// puis enlève la qté après update chargement
-		// Attention, le tas avant update n'est pas forcément le même que le tas après update
-		// (cas où changement de tas lors de update chargement)
-		vcAvant, err := model.GetVenteCharge(ctx.DB, vc.Id)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		err = vcAvant.ComputeTas(ctx.DB)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		err = vcAvant.Tas.ModifierStock(ctx.DB, vcAvant.Qte) // Ajoute des plaquettes au tas
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		err = vc.ComputeTas(ctx.DB)
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		err = vc.Tas.ModifierStock(ctx.DB, -vc.Qte) // Retire des plaquettes au tas
-		if err != nil {
-			return werr.Wrap(err)
-		}
-		//
-		err = model.UpdateVenteCharge(ctx.DB, vc)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateVenteCharge(tx, vc) // gère la modif du stock du tas
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -230,7 +199,9 @@ func DeleteVenteCharge(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteVenteCharge(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVenteCharge(tx, id) // gère la modif du stock du tas
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -44,7 +44,10 @@ func NewVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		_, err = model.InsertVenteLivre(ctx.DB, vl)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			_, err := model.InsertVenteLivre(tx, vl)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -111,7 +114,9 @@ func UpdateVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return werr.Wrap(err)
 		}
-		err = model.UpdateVenteLivre(ctx.DB, vl)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateVenteLivre(tx, vl)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -171,7 +176,9 @@ func DeleteVenteLivre(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteVenteLivre(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVenteLivre(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -13,7 +13,6 @@ import (
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
 	"github.com/gorilla/mux"
-	"github.com/jung-kurt/gofpdf"
 	"html/template"
 	"net/http"
 	"strconv"
@@ -33,7 +32,13 @@ type detailsVentePlaqList struct {
 	Annees []string // toutes les années avec chantier
 }
 type detailsVentePlaqShow struct {
-	Vente *model.VentePlaq
+	Vente   *model.VentePlaq
+	Facture *model.Facture // facture du registre, nil si pas encore émise
+}
+type detailsVentePlaqTracabilite struct {
+	Tracabilite *model.TracabiliteVentes
+	Annee       string   // année courante
+	Annees      []string // toutes les années avec vente
 }
 
 func ListVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
@@ -77,6 +82,54 @@ func ListVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 	return nil
 }
 
+// Export CSV ou XLSX de la liste des ventes plaquettes d'une année
+func ExportVentePlaqs(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	ventes, err := model.GetVentePlaqsOfYear(ctx.DB, vars["annee"])
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	return ecrireTableaux(w, vars["format"], "ventes-plaquettes-"+vars["annee"], "", tableauVentePlaqs(ventes))
+}
+
+// Origine (chantiers, parcelles, propriétaires, communes) des plaquettes vendues pendant une année
+func TracabiliteVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	annee := vars["annee"]
+	if annee == "" {
+		// annee non spécifiée, on prend l'année courante
+		annee = strconv.Itoa(time.Now().Year())
+	}
+	y, _ := strconv.Atoi(annee)
+	date1 := time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	date2 := time.Date(y, time.December, 31, 0, 0, 0, 0, time.UTC)
+	tracabilite, err := model.ComputeTracabiliteVentes(ctx.DB, date1, date2)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	//
+	annees, err := model.GetVentePlaqDifferentYears(ctx.DB, annee)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	ctx.TemplateName = "venteplaq-tracabilite.html"
+	ctx.Page = &ctxt.Page{
+		Header: ctxt.Header{
+			Title: "Traçabilité ventes plaquettes " + annee,
+			JSFiles: []string{
+				"/static/js/round.js",
+				"/static/js/formatNb.js"},
+		},
+		Menu: "ventes",
+		Details: detailsVentePlaqTracabilite{
+			Tracabilite: tracabilite,
+			Annee:       annee,
+			Annees:      annees,
+		},
+	}
+	return nil
+}
+
 func ShowVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	idVente, _ := strconv.Atoi(vars["id-vente"])
@@ -84,6 +137,10 @@ func ShowVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return werr.Wrap(err)
 	}
+	facture, err := model.GetFactureActive(ctx.DB, "venteplaq", idVente)
+	if err != nil {
+		return werr.Wrap(err)
+	}
 	ctx.TemplateName = "venteplaq-show.html"
 	ctx.Page = &ctxt.Page{
 		Header: ctxt.Header{
@@ -99,7 +156,8 @@ func ShowVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) er
 			JSFiles: []string{},
 		},
 		Details: detailsVentePlaqShow{
-			Vente: vente,
+			Vente:   vente,
+			Facture: facture,
 		},
 	}
 	err = model.AddRecent(ctx.DB, ctx.Config, &model.Recent{URL: r.URL.String(), Label: vente.FullString()})
@@ -122,7 +180,11 @@ func NewVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request) err
 		}
 		vente.TVA = ctx.Config.TVABDL.VentePlaquettes
 		vente.FactureLivraisonTVA = ctx.Config.TVABDL.Livraison
-		idVente, err := model.InsertVentePlaq(ctx.DB, vente)
+		var idVente int
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) (err error) {
+			idVente, err = model.InsertVentePlaq(tx, vente)
+			return err
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -188,7 +250,9 @@ func UpdateVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 		}
 		vente.TVA = ctx.Config.TVABDL.VentePlaquettes
 		vente.FactureLivraisonTVA = ctx.Config.TVABDL.Livraison
-		err = model.UpdateVentePlaq(ctx.DB, vente)
+		err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+			return model.UpdateVentePlaq(tx, vente)
+		})
 		if err != nil {
 			return werr.Wrap(err)
 		}
@@ -253,7 +317,9 @@ func DeleteVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	err = model.DeleteVentePlaq(ctx.DB, id)
+	err = model.WithTx(ctx.DB, ctx.Utilisateur, func(tx model.DBOrTx) error {
+		return model.DeleteVentePlaq(tx, id)
+	})
 	if err != nil {
 		return werr.Wrap(err)
 	}
@@ -358,258 +424,17 @@ func ShowFactureVentePlaq(ctx *ctxt.Context, w http.ResponseWriter, r *http.Requ
 		return werr.Wrap(err)
 	}
 	//
-	vente, err := model.GetVentePlaqFull(ctx.DB, id)
+	f, err := model.GetFactureActive(ctx.DB, "venteplaq", id)
 	if err != nil {
 		return werr.Wrap(err)
 	}
-	//
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	InitializeFacture(pdf)
-	tr := pdf.UnicodeTranslatorFromDescriptor("") // "" defaults to "cp1252"
-	pdf.AddPage()
-	//
-	MetaDataPDF(pdf, tr, ctx.Config, "Facture vente plaquettes")
-	HeaderFacture(pdf, tr, ctx.Config)
-	FooterFacture(pdf, tr, ctx.Config)
-	//
-	// Client
-	//
-	pdf.SetXY(60, 70)
-	pdf.SetFont("Arial", "", 12)
-	pdf.MultiCell(100, 7, tr(StringActeurFacture(vente.Client)), "1", "C", false)
-	//
-	// Date  + n° facture
-	//
-	var x0, x, y, wi, he float64
-	//
-	x0 = 10
-	x = x0
-	y = 110
-	wi = 50
-	he = 6
-	//
-	pdf.SetFont("Arial", "B", 10)
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, "Date de facturation", "1", "C", false)
-	//
-	x += wi
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, tr("Facture n°"), "TRB", "C", false)
-	//
-	pdf.SetFont("Arial", "", 10)
-	x = 10
-	y += he
-	//
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, tiglib.DateFr(vente.DateFacture), "LRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, tr(vente.NumFacture), "RB", "C", false)
-	//
-	// Tableau principal
-	//
-	var w1, w2, w3, w4, w5 = 70.0, 20.0, 20.0, 30.0, 30.0
-	//
-	// ligne entête des colonnes
-	//
-	x = x0
-	y = 140
-	pdf.SetXY(x, y)
-	wi = w1
-	pdf.MultiCell(wi, he, tr("Désignation"), "1", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w2
-	pdf.MultiCell(wi, he, tr("Quantité"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w3
-	pdf.MultiCell(wi, he, tr("Unité"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w4
-	pdf.MultiCell(wi, he, tr("P.U. € H.T"), "TRB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w5
-	pdf.MultiCell(wi, he, tr("Montant € H.T"), "TRB", "C", false)
-	//
-	// ligne avec valeurs de la vente
-	//
-	var prixHTPlaquettes, prixHT float64
-	pdf.SetFont("Arial", "B", 10)
-	x = x0
-	y += he
-	pdf.SetXY(x, y)
-	wi = w1
-	pdf.MultiCell(wi, he, tr("Vente de plaquettes forestières"), "LRB", "L", false)
-	pdf.SetFont("Arial", "", 10)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w2
-	pdf.MultiCell(wi, he, strconv.FormatFloat(vente.Qte, 'f', 2, 64), "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w3
-	pdf.MultiCell(wi, he, "MAP", "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w4
-	pdf.MultiCell(wi, he, strconv.FormatFloat(vente.PUHT, 'f', 2, 64), "RB", "C", false)
-	x += wi
-	pdf.SetXY(x, y)
-	wi = w5
-	prixHTPlaquettes = vente.Qte * vente.PUHT
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixHTPlaquettes, 'f', 2, 64), "RB", "C", false)
-	prixHT = prixHTPlaquettes
-	//
-	// ligne avec valeurs de la livraison
-	//
-	var prixHTLivraison, qteLivraison float64
-	var unite string
-	if vente.FactureLivraison {
-		if vente.FactureLivraisonUnite == "map" {
-			unite = "MAP"
-			qteLivraison = vente.Qte
-		} else {
-			unite = "KM"
-			qteLivraison = vente.FactureLivraisonNbKm
-		}
-		pdf.SetFont("Arial", "B", 10)
-		x = x0
-		y += he
-		pdf.SetXY(x, y)
-		wi = w1
-		pdf.MultiCell(wi, he, tr("Livraison"), "LRB", "L", false)
-		pdf.SetFont("Arial", "", 10)
-		x += wi
-		pdf.SetXY(x, y)
-		wi = w2
-		pdf.MultiCell(wi, he, strconv.FormatFloat(qteLivraison, 'f', 2, 64), "RB", "C", false)
-		x += wi
-		pdf.SetXY(x, y)
-		wi = w3
-		pdf.MultiCell(wi, he, unite, "RB", "C", false)
-		x += wi
-		pdf.SetXY(x, y)
-		wi = w4
-		pdf.MultiCell(wi, he, strconv.FormatFloat(vente.FactureLivraisonPUHT, 'f', 2, 64), "RB", "C", false)
-		x += wi
-		pdf.SetXY(x, y)
-		wi = w5
-		prixHTLivraison = qteLivraison * vente.FactureLivraisonPUHT
-		pdf.MultiCell(wi, he, strconv.FormatFloat(prixHTLivraison, 'f', 2, 64), "RB", "C", false)
-		prixHT += prixHTLivraison
-	}
-	//
-	// ligne avec les notes
-	//
-	if vente.FactureNotes {
-		pdf.SetFont("Arial", "", 10)
-		x = x0
-		y += he
-		pdf.SetXY(x, y)
-		wi = w1 + w2 + w3 + w4 + w5
-		lines := tiglib.LimitLength(tr(vente.Notes), 108) // 108 mesuré empiriquement
-		pdf.MultiCell(wi, he, strings.Join(lines, "\n"), "LRB", "L", false)
-		y += he * float64(len(lines))
-	} else {
-		y += he
-	}
-	//
-	// ligne montant total HT
-	//
-	pdf.SetFont("Arial", "B", 10)
-	x = x0 + w1
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4
-	pdf.MultiCell(wi, he, tr("Montant total € HT"), "RBL", "C", false)
-	pdf.SetFont("Arial", "", 10)
-	x = x0 + w1 + w2 + w3 + w4
-	wi = w5
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixHT, 'f', 2, 64), "RBL", "C", false)
-	//
-	// ligne TVA plaquettes
-	//
-	var prixTVAPlaquettes float64
-	pdf.SetFont("Arial", "", 10)
-	x = x0 + w1
-	y += he
-	pdf.SetXY(x, y)
-	wi = w2 + w3
-	pdf.MultiCell(wi, he, "Montant TVA plaquettes", "RBL", "L", false)
-	x += wi
-	wi = w4
-	pdf.SetXY(x, y)
-	pdf.MultiCell(wi, he, strconv.FormatFloat(vente.TVA, 'f', 2, 64)+" %", "RB", "C", false)
-	x += wi
-	wi = w5
-	pdf.SetXY(x, y)
-	prixTVAPlaquettes = prixHTPlaquettes * vente.TVA / 100
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixTVAPlaquettes, 'f', 2, 64), "RB", "C", false)
-	//
-	// ligne TVA livraison
-	//
-	var prixTVALivraison float64
-	if vente.FactureLivraison {
-		pdf.SetFont("Arial", "", 10)
-		x = x0 + w1
-		y += he
-		pdf.SetXY(x, y)
-		wi = w2 + w3
-		pdf.MultiCell(wi, he, "Montant TVA livraison", "RBL", "L", false)
-		x += wi
-		wi = w4
-		pdf.SetXY(x, y)
-		pdf.MultiCell(wi, he, strconv.FormatFloat(vente.FactureLivraisonTVA, 'f', 2, 64)+" %", "RB", "C", false)
-		x += wi
-		wi = w5
-		pdf.SetXY(x, y)
-		prixTVALivraison = prixHTLivraison * vente.FactureLivraisonTVA / 100
-		pdf.MultiCell(wi, he, strconv.FormatFloat(prixTVALivraison, 'f', 2, 64), "RB", "C", false)
-	}
-	//
-	// 2 lignes pour montant total TTC
-	//
-	pdf.SetFont("Arial", "B", 10)
-	x = x0 + w1
-	y += 2 * he
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4 + w5
-	pdf.MultiCell(wi, he, "Montant total TTC", "1", "C", false)
-	pdf.SetFont("Arial", "", 10)
-	x = x0 + w1
-	y += he
-	pdf.SetXY(x, y)
-	wi = w2 + w3 + w4
-	pdf.MultiCell(wi, he, tr("Net à payer en euros"), "RBL", "C", false)
-	pdf.SetFont("Arial", "B", 10)
-	x += wi
-	wi = w5
-	pdf.SetXY(x, y)
-	prixTTC := prixHT + prixTVAPlaquettes + prixTVALivraison // PrixHT inclue déjà prixHTLivraison
-	pdf.MultiCell(wi, he, strconv.FormatFloat(prixTTC, 'f', 2, 64), "RB", "C", false)
-	//
-	// Noms du ou des livreur(s) / conducteur(s)
-	//
-	pdf.SetFont("Arial", "", 10)
-	x = x0
-	y += 2 * he
-	pdf.SetXY(x, y)
-	pdf.Write(he, tr("Livraison effectuée par"))
-	y += he
-	for _, livraison := range vente.Livraisons {
-		pdf.SetXY(x, y)
-		if livraison.TypeCout == "G" { // coût global
-			pdf.Write(he, "- "+tr(livraison.Livreur.String()))
-		} else { // coût détaillé
-			pdf.Write(he, "- "+tr(livraison.Conducteur.String()))
+	if f == nil {
+		// facture pas encore émise : aperçu à partir des données actuelles de la vente
+		vente, err := model.GetVentePlaqFull(ctx.DB, id)
+		if err != nil {
+			return werr.Wrap(err)
 		}
-        pdf.Write(he, ", le "+tr(tiglib.DateFr(livraison.DateLivre)))
-		
-		y += he
+		f = model.NewFactureVentePlaq(vente)
 	}
-	//
-	return pdf.Output(w)
+	return pdfFacture(w, ctx.Config, f)
 }
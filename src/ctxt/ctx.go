@@ -26,6 +26,8 @@ type Context struct {
 	Template     *template.Template
 	DB           *sqlx.DB
 	Config       *model.Config
+	// Utilisateur connecté - nil pour les pages accessibles sans connexion
+	Utilisateur *model.Utilisateur
 }
 
 // Pour utiliser db, appeler ctxt.MustInitDB() avant de faire NewContext()
@@ -12,6 +12,7 @@ import (
 	"log"
 	"strings"
 
+	"bdl.local/bdl/migration"
 	"bdl.local/bdl/model"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -26,10 +27,8 @@ func AjusteDbURL(url string, schema string) string {
 	if strings.HasPrefix(dbURL, "postgres") && !strings.Contains(dbURL, "search_path") {
 		if !strings.Contains(dbURL, "?") {
 			dbURL += "?"
-		} /* else {
-			dbURL += "&"
-		} */
-		dbURL += "search_path=" + schema
+		}
+		dbURL += "&search_path=" + schema
 	}
 	return dbURL
 }
@@ -51,5 +50,16 @@ func MustInitDB() {
 	if err != nil {
 		log.Fatalf("Connexion DB impossible : %v", err)
 	}
-	//TODO: ici faire upgrade versions
+}
+
+// Applique les migrations en attente (cf package migration).
+// Appeler MustInitDB() avant.
+func MustApplyMigrations() {
+	versions, err := migration.Up(db)
+	if err != nil {
+		log.Fatalf("Erreur migration de la base : %v", err)
+	}
+	for _, version := range versions {
+		log.Printf("Migration appliquée : %s", version)
+	}
 }
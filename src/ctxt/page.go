@@ -12,6 +12,8 @@
 */
 package ctxt
 
+import "bdl.local/bdl/model"
+
 /*
 *
 
@@ -27,6 +29,8 @@ type Page struct {
 	Details interface{}
 	// "dev" or "prod" - filled for all pages by handler function H
 	RunMode string
+	// Utilisateur connecté, nil si pas connecté - filled for all pages by handler function H
+	Utilisateur *model.Utilisateur
 }
 
 /*
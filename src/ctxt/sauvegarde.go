@@ -0,0 +1,55 @@
+/*
+Sauvegardes automatiques de la base, à l'heure fixée dans config.yml (sauvegarde / heure).
+Après chaque sauvegarde, la politique de rétention est appliquée.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package ctxt
+
+import (
+	"bdl.local/bdl/model"
+	"log"
+	"time"
+)
+
+// Lance la boucle des sauvegardes automatiques dans une goroutine.
+// Ne fait rien si aucune heure n'est définie dans config.yml.
+// Appeler MustLoadConfig() et MustInitDB() avant.
+func LanceSauvegardesAutomatiques() {
+	prochaine, err := model.ProchaineSauvegarde(config, time.Now())
+	if err != nil {
+		LogError(err)
+		return
+	}
+	if prochaine.IsZero() {
+		return
+	}
+	log.Printf("Prochaine sauvegarde automatique : %s", prochaine.Format("2006-01-02 15:04"))
+	go func() {
+		for {
+			time.Sleep(time.Until(prochaine))
+			sauvegardeAutomatique()
+			prochaine, _ = model.ProchaineSauvegarde(config, time.Now())
+		}
+	}()
+}
+
+// Les erreurs sont seulement loguées, pour ne pas arrêter les sauvegardes suivantes
+func sauvegardeAutomatique() {
+	s, err := model.CreerSauvegarde(db)
+	if err != nil {
+		LogError(err)
+		return
+	}
+	log.Printf("Sauvegarde automatique : %s", s.Fichier)
+	effaces, err := model.AppliquerRetention(config)
+	if err != nil {
+		LogError(err)
+		return
+	}
+	for _, fichier := range effaces {
+		log.Printf("Sauvegarde effacée (rétention) : %s", fichier)
+	}
+}
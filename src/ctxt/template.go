@@ -44,18 +44,24 @@ func MustInitTemplates() {
 		"year":       year,
 		"zero2empty": zero2empty,
 		// Pipelines related to current program
-		"labelActivite":     labelActivite,
-		"labelEssence":      labelEssence,
-		"labelExploitation": labelExploitation,
-		"labelRole":         labelRole,
-		"labelStockFrais":   labelStockFrais,
-		"labelTypeVente":    labelTypeVente,
-		"labelTypo":         labelTypo,
-		"labelTypo_long":    labelTypo_long,
-		"labelUnite":        labelUnite,
-		"labelValo":         labelValo,
-		"sortableUGCode":    sortableUGCode,
-		"valo2uniteLabel":   valo2uniteLabel,
+		"labelActivite":        labelActivite,
+		"labelAuditAction":     labelAuditAction,
+		"labelAuditEntite":     labelAuditEntite,
+		"labelEssence":         labelEssence,
+		"labelExploitation":    labelExploitation,
+		"labelFactureStatut":   labelFactureStatut,
+		"labelMotifPerte":      labelMotifPerte,
+		"labelPaiementMode":    labelPaiementMode,
+		"labelRole":            labelRole,
+		"labelStockFrais":      labelStockFrais,
+		"labelTypeVente":       labelTypeVente,
+		"labelTypo":            labelTypo,
+		"labelTypo_long":       labelTypo_long,
+		"labelUnite":           labelUnite,
+		"labelUtilisateurRole": labelUtilisateurRole,
+		"labelValo":            labelValo,
+		"sortableUGCode":       sortableUGCode,
+		"valo2uniteLabel":      valo2uniteLabel,
 	}
 	tmpl = template.
 		Must(template.
@@ -198,6 +204,11 @@ func labelExploitation(code string) template.HTML {
 	return template.HTML(model.LabelExploitation(code))
 }
 
+// Motif de perte au vidage d'un tas (pourriture etc.), à partir de son code
+func labelMotifPerte(code string) template.HTML {
+	return template.HTML(model.LabelMotifPerte(code))
+}
+
 // Nom d'un type de frais pour stockage (loyer, assurance, élec) à partir de son code
 func labelStockFrais(code string) template.HTML {
 	return template.HTML(model.StockFraisMap[code])
@@ -208,6 +219,39 @@ func labelRole(code string) template.HTML {
 	return template.HTML(model.RoleMap[code])
 }
 
+// Nom d'une entité de l'historique des modifications, à partir du nom de sa table
+func labelAuditEntite(table string) template.HTML {
+	return template.HTML(model.AuditEntiteMap[table])
+}
+
+// Nom d'une action de l'historique des modifications
+func labelAuditAction(action string) template.HTML {
+	switch action {
+	case model.AUDIT_INSERT:
+		return "Création"
+	case model.AUDIT_UPDATE:
+		return "Modification"
+	case model.AUDIT_DELETE:
+		return "Suppression"
+	}
+	return template.HTML(action)
+}
+
+// Statut d'une facture (émise, payée, annulée), à partir de son code
+func labelFactureStatut(code string) template.HTML {
+	return template.HTML(model.FactureStatutMap[code])
+}
+
+// Mode de paiement d'une facture (virement, chèque...), à partir de son code
+func labelPaiementMode(code string) template.HTML {
+	return template.HTML(model.FacturePaiementModeMap[code])
+}
+
+// Nom d'un rôle utilisateur (droits dans l'application), à partir de son code
+func labelUtilisateurRole(code string) template.HTML {
+	return template.HTML(model.UtilisateurRoleMap[code])
+}
+
 // Nom d'un type de vente (pour chautre: bois sur pied, bord de route...), à partir de son code
 func labelTypeVente(code string) template.HTML {
 	return template.HTML(model.ChautreTypeVenteMap[code])
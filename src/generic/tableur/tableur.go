@@ -0,0 +1,261 @@
+/*
+Ecriture de tableaux au format CSV (conventions françaises) ou XLSX,
+sans dépendance extérieure.
+
+Les cellules peuvent contenir des string, int, float64 ou time.Time ;
+une date nulle donne une cellule vide.
+
+CSV : séparateur ";", virgule décimale, dates JJ/MM/AAAA, précédé d'un BOM UTF-8 pour les tableurs.
+XLSX : un classeur contenant une feuille par tableau ; nombres et dates sont de vraies valeurs numériques.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package tableur
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Tableau struct {
+	Titre    string // nom de la feuille dans un classeur XLSX
+	Colonnes []string
+	Lignes   [][]interface{}
+}
+
+func New(titre string, colonnes ...string) *Tableau {
+	return &Tableau{Titre: titre, Colonnes: colonnes}
+}
+
+func (t *Tableau) AddLigne(valeurs ...interface{}) {
+	t.Lignes = append(t.Lignes, valeurs)
+}
+
+// ************************** CSV *******************************
+
+func (t *Tableau) WriteCSV(w io.Writer) error {
+	_, err := io.WriteString(w, "\ufeff")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	err = cw.Write(t.Colonnes)
+	if err != nil {
+		return err
+	}
+	for _, ligne := range t.Lignes {
+		valeurs := make([]string, len(ligne))
+		for i, v := range ligne {
+			valeurs[i] = formatCSV(v)
+		}
+		err = cw.Write(valeurs)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCSV(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		return strings.Replace(strconv.FormatFloat(x, 'f', -1, 64), ".", ",", 1)
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format("02/01/2006")
+	}
+	return fmt.Sprint(v)
+}
+
+// ************************** XLSX *******************************
+
+// Ecrit un classeur XLSX contenant une feuille par tableau
+func WriteXLSX(w io.Writer, tableaux ...*Tableau) error {
+	z := zip.NewWriter(w)
+	fichiers := [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes(len(tableaux))},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook(tableaux)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(tableaux))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, t := range tableaux {
+		fichiers = append(fichiers, [2]string{"xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml", t.xlsxSheet()})
+	}
+	for _, fichier := range fichiers {
+		f, err := z.Create(fichier[0])
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, fichier[1])
+		if err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+const xlsxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const xlsxRels = xlsxHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// Styles : 0 = défaut, 1 = en-tête (gras), 2 = date, 3 = nombre décimal
+const xlsxStyles = xlsxHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`</styleSheet>`
+
+func xlsxContentTypes(nbFeuilles int) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= nbFeuilles; i++ {
+		b.WriteString(`<Override PartName="/xl/worksheets/sheet` + strconv.Itoa(i) + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(tableaux []*Tableau) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	noms := map[string]bool{}
+	for i, t := range tableaux {
+		nom := nomFeuille(t.Titre, i+1)
+		if noms[nom] {
+			nom = nomFeuille(strconv.Itoa(i+1)+" "+t.Titre, i+1)
+		}
+		noms[nom] = true
+		b.WriteString(`<sheet name="` + escapeXML(nom) + `" sheetId="` + strconv.Itoa(i+1) + `" r:id="rId` + strconv.Itoa(i+1) + `"/>`)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(nbFeuilles int) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= nbFeuilles; i++ {
+		b.WriteString(`<Relationship Id="rId` + strconv.Itoa(i) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + strconv.Itoa(i) + `.xml"/>`)
+	}
+	// styles après les feuilles, pour que les rId des feuilles correspondent à leur numéro
+	b.WriteString(`<Relationship Id="rId` + strconv.Itoa(nbFeuilles+1) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+func (t *Tableau) xlsxSheet() string {
+	var b strings.Builder
+	b.WriteString(xlsxHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	b.WriteString(`<row r="1">`)
+	for i, colonne := range t.Colonnes {
+		b.WriteString(xlsxCellule(i, 1, colonne, 1))
+	}
+	b.WriteString(`</row>`)
+	for j, ligne := range t.Lignes {
+		r := j + 2
+		b.WriteString(`<row r="` + strconv.Itoa(r) + `">`)
+		for i, v := range ligne {
+			b.WriteString(xlsxCellule(i, r, v, 0))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// @param col  numéro de colonne, à partir de 0
+// @param row  numéro de ligne, à partir de 1
+// @param style cf xlsxStyles
+func xlsxCellule(col, row int, v interface{}, style int) string {
+	ref := nomColonne(col) + strconv.Itoa(row)
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case int:
+		return `<c r="` + ref + `"><v>` + strconv.Itoa(x) + `</v></c>`
+	case float64:
+		if x != float64(int64(x)) {
+			style = 3
+		}
+		return `<c r="` + ref + `" s="` + strconv.Itoa(style) + `"><v>` + strconv.FormatFloat(x, 'f', -1, 64) + `</v></c>`
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		// nombre de jours depuis le 30/12/1899 (origine des dates des tableurs)
+		d := time.Date(x.Year(), x.Month(), x.Day(), 0, 0, 0, 0, time.UTC)
+		jours := int(d.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		return `<c r="` + ref + `" s="2"><v>` + strconv.Itoa(jours) + `</v></c>`
+	}
+	s := fmt.Sprint(v)
+	if s == "" {
+		return ""
+	}
+	return `<c r="` + ref + `" s="` + strconv.Itoa(style) + `" t="inlineStr"><is><t xml:space="preserve">` + escapeXML(s) + `</t></is></c>`
+}
+
+// Nom de colonne de tableur : 0 => A, 25 => Z, 26 => AA...
+func nomColonne(i int) string {
+	res := ""
+	for i >= 0 {
+		res = string(rune('A'+i%26)) + res
+		i = i/26 - 1
+	}
+	return res
+}
+
+// Nom de feuille : 31 caractères maximum, sans []:*?/\
+func nomFeuille(titre string, numero int) string {
+	nom := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, titre)
+	runes := []rune(nom)
+	if len(runes) > 31 {
+		nom = string(runes[:31])
+	}
+	if strings.TrimSpace(nom) == "" {
+		nom = "Feuille " + strconv.Itoa(numero)
+	}
+	return nom
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,62 @@
+/*
+Ajoute tables utilisateur et session (authentification)
+Crée un utilisateur "admin" sans mot de passe utilisable (pour ne pas l'écrire dans les logs du serveur) ;
+son mot de passe est ensuite généré et affiché une seule fois par manage/db-migrate (commande mot-de-passe-admin).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-01-utilisateurs",
+		AncienneVersion: "2026-10-18-utilisateurs",
+		Description:     "Tables utilisateur et session, utilisateur admin",
+		Up:              migrate_2026_10_18_utilisateurs,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "utilisateur")
+		},
+	})
+}
+
+func migrate_2026_10_18_utilisateurs(tx *sqlx.Tx) error {
+	err := execQueries(tx,
+		`create table utilisateur (
+            id                      serial primary key,
+            login                   varchar(255) not null unique,
+            password                varchar(255) not null,
+            role                    varchar(10) not null,
+            actif                   boolean not null default true,
+            notes                   text not null default ''
+        )`,
+		`create table session (
+            token                   char(64) primary key,
+            id_utilisateur          int not null references utilisateur(id),
+            dateexpire              timestamp not null
+        )`,
+		`create index session_id_utilisateur_idx on session(id_utilisateur)`,
+	)
+	if err != nil {
+		return err
+	}
+	// Pas model.InsertUtilisateur(), qui écrit aussi dans la table audit
+	// Mot de passe vide : aucune connexion possible tant que le mot de passe n'a pas été défini
+	_, err = tx.Exec(
+		"insert into utilisateur(login,password,role,actif,notes) values($1,$2,$3,$4,$5)",
+		"admin",
+		"",
+		"admin",
+		true,
+		"Créé par la migration 2026-10-18-01-utilisateurs")
+	if err != nil {
+		return werr.Wrapf(err, "Erreur insert utilisateur admin")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+/*
+Ajoute table audit (historique des modifications)
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-02-audit",
+		AncienneVersion: "2026-10-18-audit",
+		Description:     "Table audit (historique des modifications)",
+		Up:              migrate_2026_10_18_audit,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "audit")
+		},
+	})
+}
+
+func migrate_2026_10_18_audit(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table audit (
+            id                      serial primary key,
+            entite                  varchar(20) not null,
+            id_entite               int not null,
+            action                  varchar(6) not null,
+            id_utilisateur          int not null default 0,
+            login                   varchar(255) not null default '',
+            dateaudit               timestamp not null,
+            avant                   jsonb not null default '{}',
+            apres                   jsonb not null default '{}'
+        )`,
+		`create index audit_entite_idx on audit(entite, id_entite)`,
+	)
+}
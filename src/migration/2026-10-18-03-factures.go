@@ -0,0 +1,72 @@
+/*
+Registre des factures : tables facture, factureligne, facturepaiement.
+L'ancienne table facture (compteur des numéros de facture) est renommée facturenum.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-03-factures",
+		AncienneVersion: "2026-10-18-factures",
+		Description:     "Registre des factures (facture, factureligne, facturepaiement)",
+		Up:              migrate_2026_10_18_factures,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "facturenum")
+		},
+	})
+}
+
+func migrate_2026_10_18_factures(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`alter table facture rename to facturenum`,
+		`create table facture (
+            id                      serial primary key,
+            numero                  varchar(255) not null unique,
+            typefacture             char(1) not null,
+            id_facture_origine      int not null default 0,
+            typeorigine             varchar(10) not null,
+            id_origine              int not null,
+            id_client               int not null references acteur(id),
+            client                  text not null,
+            datefacture             date not null,
+            statut                  varchar(10) not null,
+            totalht                 numeric not null,
+            totaltva                numeric not null,
+            totalttc                numeric not null,
+            notes                   text not null default '',
+            mentions                text not null default ''
+        )`,
+		`create index facture_origine_idx on facture(typeorigine, id_origine)`,
+		`create index facture_id_client_idx on facture(id_client)`,
+		`create table factureligne (
+            id                      serial primary key,
+            id_facture              int not null references facture(id),
+            ordre                   int not null,
+            designation             varchar(255) not null,
+            quantite                numeric not null,
+            unite                   varchar(20) not null,
+            puht                    numeric not null,
+            tauxtva                 numeric not null,
+            montantht               numeric not null,
+            montanttva              numeric not null
+        )`,
+		`create index factureligne_id_facture_idx on factureligne(id_facture)`,
+		`create table facturepaiement (
+            id                      serial primary key,
+            id_facture              int not null references facture(id),
+            datepaiement            date not null,
+            montant                 numeric not null,
+            mode                    varchar(10) not null,
+            notes                   text not null default ''
+        )`,
+		`create index facturepaiement_id_facture_idx on facturepaiement(id_facture)`,
+	)
+}
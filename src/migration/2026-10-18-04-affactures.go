@@ -0,0 +1,58 @@
+/*
+Enregistrement des affactures : tables affacturenum, affacture, affactureitem.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-04-affactures",
+		AncienneVersion: "2026-10-18-affactures",
+		Description:     "Affactures (affacturenum, affacture, affactureitem)",
+		Up:              migrate_2026_10_18_affactures,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "affacture")
+		},
+	})
+}
+
+func migrate_2026_10_18_affactures(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table affacturenum (
+            annee                   char(4) not null,
+            lastnum                 int not null
+        )`,
+		`create table affacture (
+            id                      serial primary key,
+            numero                  varchar(255) not null unique,
+            id_acteur               int not null references acteur(id),
+            dateaffacture           date not null,
+            datedebut               date not null,
+            datefin                 date not null,
+            totalht                 numeric not null,
+            totalttc                numeric not null,
+            notes                   text not null default ''
+        )`,
+		`create index affacture_id_acteur_idx on affacture(id_acteur)`,
+		`create table affactureitem (
+            id                      serial primary key,
+            id_affacture            int not null references affacture(id),
+            typeactivite            varchar(5) not null,
+            id_ligne                int not null,
+            titre                   varchar(255) not null,
+            dateitem                date not null,
+            lignes                  jsonb not null,
+            totalht                 numeric not null,
+            totalttc                numeric not null,
+            unique(typeactivite, id_ligne)
+        )`,
+		`create index affactureitem_id_affacture_idx on affactureitem(id_affacture)`,
+	)
+}
@@ -0,0 +1,35 @@
+/*
+Géométrie des parcelles, importée d'un fichier cadastre : table parcelle_geom.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-05-parcelle-geom",
+		AncienneVersion: "2026-10-18-parcelle-geom",
+		Description:     "Géométrie des parcelles (parcelle_geom)",
+		Up:              migrate_2026_10_18_parcelle_geom,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "parcelle_geom")
+		},
+	})
+}
+
+func migrate_2026_10_18_parcelle_geom(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table parcelle_geom (
+            code11                  char(11) primary key,
+            idcadastre              varchar(14) not null,
+            geometrie               jsonb not null,
+            dateimport              date not null
+        )`,
+	)
+}
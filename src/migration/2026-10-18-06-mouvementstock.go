@@ -0,0 +1,69 @@
+/*
+Journal des mouvements de stock des tas (table mouvementstock), qui remplace la colonne tas.stock.
+
+Le journal est reconstitué à partir des transports et des chargements existants ;
+les tas vides reçoivent un mouvement de vidage qui ramène leur stock à 0.
+Pour les tas actifs, un écart éventuel entre l'ancienne colonne tas.stock et les transports / chargements
+(cf règle de cohérence tas-stock) donne un mouvement d'ajustement, daté du jour de la migration :
+le stock des tas est conservé, et l'écart reste visible dans le journal.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-06-mouvementstock",
+		AncienneVersion: "2026-10-18-mouvementstock",
+		Description:     "Journal des mouvements de stock des tas (mouvementstock), suppression de tas.stock",
+		Up:              migrate_2026_10_18_mouvementstock,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "mouvementstock")
+		},
+	})
+}
+
+func migrate_2026_10_18_mouvementstock(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table mouvementstock (
+            id                      serial primary key,
+            id_tas                  int not null references tas(id),
+            typemvt                 char(2) not null,
+            id_ligne                int not null default 0,
+            datemvt                 date not null,
+            qte                     numeric not null,
+            notes                   text not null default '',
+            datecreation            timestamp not null default now()
+        )`,
+		`create index mouvementstock_id_tas_idx on mouvementstock(id_tas)`,
+		`create index mouvementstock_typemvt_id_ligne_idx on mouvementstock(typemvt, id_ligne)`,
+		// transports, en maps sèches (cf model.Vert2sec())
+		`insert into mouvementstock(id_tas, typemvt, id_ligne, datemvt, qte, notes)
+            select id_tas, 'TR', id, datetrans, qte * (100 - pourcentperte) / 100, 'Reprise'
+            from plaqtrans order by datetrans, id`,
+		// chargements
+		`insert into mouvementstock(id_tas, typemvt, id_ligne, datemvt, qte, notes)
+            select id_tas, 'CG', id, datecharge, -qte, 'Reprise'
+            from ventecharge order by datecharge, id`,
+		// écarts entre tas.stock et le journal reconstitué, pour les tas actifs
+		`insert into mouvementstock(id_tas, typemvt, id_ligne, datemvt, qte, notes)
+            select t.id, 'AJ', 0, current_date,
+                coalesce(t.stock, 0) - coalesce((select sum(qte) from mouvementstock where id_tas=t.id), 0),
+                'Reprise - écart avec tas.stock'
+            from tas t
+            where t.actif and coalesce(t.stock, 0) <> coalesce((select sum(qte) from mouvementstock where id_tas=t.id), 0)
+            order by t.id`,
+		// vidages
+		`insert into mouvementstock(id_tas, typemvt, id_ligne, datemvt, qte, notes)
+            select t.id, 'VI', 0, coalesce(t.datevidage, current_date),
+                -coalesce((select sum(qte) from mouvementstock where id_tas=t.id), 0), 'Reprise'
+            from tas t where not t.actif order by t.id`,
+		`alter table tas drop column stock`,
+	)
+}
@@ -0,0 +1,45 @@
+/*
+Inventaires physiques des tas : tables inventaire, inventairetas.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-07-inventaire",
+		AncienneVersion: "2026-10-18-inventaire",
+		Description:     "Inventaires physiques des tas (inventaire, inventairetas)",
+		Up:              migrate_2026_10_18_inventaire,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "inventaire")
+		},
+	})
+}
+
+func migrate_2026_10_18_inventaire(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table inventaire (
+            id                      serial primary key,
+            id_stockage             int not null references stockage(id),
+            dateinventaire          date not null,
+            notes                   text not null default ''
+        )`,
+		`create index inventaire_id_stockage_idx on inventaire(id_stockage)`,
+		`create table inventairetas (
+            id                      serial primary key,
+            id_inventaire           int not null references inventaire(id),
+            id_tas                  int not null references tas(id),
+            stockcalcule            numeric not null,
+            stockmesure             numeric not null,
+            unique(id_inventaire, id_tas)
+        )`,
+		`create index inventairetas_id_tas_idx on inventairetas(id_tas)`,
+	)
+}
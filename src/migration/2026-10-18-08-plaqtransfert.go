@@ -0,0 +1,58 @@
+/*
+Transferts de plaquettes entre lieux de stockage : table plaqtransfert.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-08-plaqtransfert",
+		AncienneVersion: "2026-10-18-plaqtransfert",
+		Description:     "Transferts de plaquettes entre lieux de stockage (plaqtransfert)",
+		Up:              migrate_2026_10_18_plaqtransfert,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return tableExiste(tx, "plaqtransfert")
+		},
+	})
+}
+
+func migrate_2026_10_18_plaqtransfert(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`create table plaqtransfert (
+            id                      serial primary key,
+            id_chantier             int not null references plaq(id),
+            id_tas_origine          int not null references tas(id),
+            id_tas_destination      int not null references tas(id),
+            id_transporteur         int not null references acteur(id),
+            id_conducteur           int not null references acteur(id),
+            id_proprioutil          int not null references acteur(id),
+            datetransfert           date not null,
+            qte                     numeric not null,
+            typecout                char(1) not null,
+            glprix                  numeric,
+            gltva                   numeric,
+            gldatepay               date,
+            conheure                numeric,
+            coprixh                 numeric,
+            cotva                   numeric,
+            codatepay               date,
+            ouprix                  numeric,
+            outva                   numeric,
+            oudatepay               date,
+            notes                   text
+        )`,
+		`create index plaqtransfert_id_chantier_idx on plaqtransfert(id_chantier)`,
+		`create index plaqtransfert_id_tas_origine_idx on plaqtransfert(id_tas_origine)`,
+		`create index plaqtransfert_id_tas_destination_idx on plaqtransfert(id_tas_destination)`,
+		`create index plaqtransfert_id_transporteur_idx on plaqtransfert(id_transporteur)`,
+		`create index plaqtransfert_id_conducteur_idx on plaqtransfert(id_conducteur)`,
+		`create index plaqtransfert_id_proprioutil_idx on plaqtransfert(id_proprioutil)`,
+	)
+}
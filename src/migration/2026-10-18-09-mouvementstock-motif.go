@@ -0,0 +1,30 @@
+/*
+Motif des pertes constatées lors du vidage d'un tas : colonne mouvementstock.motif.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(&Migration{
+		Version:         "2026-10-18-09-mouvementstock-motif",
+		AncienneVersion: "2026-10-18-mouvementstock-motif",
+		Description:     "Motif des pertes au vidage des tas (mouvementstock.motif)",
+		Up:              migrate_2026_10_18_mouvementstock_motif,
+		DejaFaite: func(tx *sqlx.Tx) (bool, error) {
+			return colonneExiste(tx, "mouvementstock", "motif")
+		},
+	})
+}
+
+func migrate_2026_10_18_mouvementstock_motif(tx *sqlx.Tx) error {
+	return execQueries(tx,
+		`alter table mouvementstock add column motif char(2) not null default ''`,
+	)
+}
@@ -0,0 +1,269 @@
+/*
+Migrations versionnées de la base (changements de structure).
+
+Chaque migration est enregistrée dans le registre (voir les fichiers AAAA-MM-JJ-*.go de ce package)
+et, une fois appliquée, dans la table schema_version.
+Les migrations en attente sont appliquées dans l'ordre des versions,
+chacune dans une transaction, au démarrage du serveur (cf ctxt.MustApplyMigrations())
+ou avec la commande manage/db-migrate (migrate up / status).
+
+Pour ajouter une migration :
+  - créer un fichier AAAA-MM-JJ-NN-ma-migration.go contenant une fonction init() qui appelle register() ;
+    NN est un numéro d'ordre sur 2 chiffres, qui suit la dernière migration existante ;
+  - la version est le nom du fichier sans extension, elle détermine l'ordre d'application.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package migration
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"github.com/jmoiron/sqlx"
+	"sort"
+	"time"
+)
+
+type Migration struct {
+	Version string // ex "2026-10-18-02-audit"
+	// Optionnel - version sous laquelle la migration a pu être enregistrée dans schema_version
+	// avant l'ajout du numéro d'ordre ; elle est renommée en Version (cf renommeAnciennesVersions())
+	AncienneVersion string
+	Description     string
+	Up              func(tx *sqlx.Tx) error
+	// Optionnel - pour les migrations antérieures au registre, qui ont pu être exécutées à la main :
+	// renvoie true si les changements sont déjà présents en base ;
+	// la migration est alors enregistrée dans schema_version sans être exécutée.
+	DejaFaite func(tx *sqlx.Tx) (bool, error)
+}
+
+// Etat d'une migration, pour migrate status
+type Etat struct {
+	Migration       *Migration
+	Appliquee       bool
+	DateApplication time.Time
+}
+
+var registre = []*Migration{}
+
+// Clé du verrou postgres empêchant deux processus d'appliquer des migrations en même temps
+const VERROU_MIGRATIONS = 20261018
+
+func register(m *Migration) {
+	for _, existante := range registre {
+		if existante.Version == m.Version {
+			panic("Migration enregistrée deux fois : " + m.Version)
+		}
+	}
+	registre = append(registre, m)
+	sort.Slice(registre, func(i, j int) bool { return registre[i].Version < registre[j].Version })
+}
+
+// Renvoie les migrations du registre, dans l'ordre d'application
+func Migrations() []*Migration {
+	return registre
+}
+
+// ************************** Status *******************************
+
+// Crée la table schema_version si elle n'existe pas
+func initSchemaVersion(db sqlx.Execer) error {
+	query := `create table if not exists schema_version (
+        version                 varchar(255) primary key,
+        description             text not null default '',
+        dateapplication         timestamp not null,
+        executee                boolean not null default true
+    )`
+	_, err := db.Exec(query)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
+
+// Renvoie l'état de toutes les migrations du registre
+func Status(db *sqlx.DB) (res []*Etat, err error) {
+	res = []*Etat{}
+	err = initSchemaVersion(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel initSchemaVersion()")
+	}
+	err = renommeAnciennesVersions(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel renommeAnciennesVersions()")
+	}
+	appliquees, err := versionsAppliquees(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel versionsAppliquees()")
+	}
+	for _, m := range registre {
+		date, ok := appliquees[m.Version]
+		res = append(res, &Etat{Migration: m, Appliquee: ok, DateApplication: date})
+	}
+	return res, nil
+}
+
+// Renomme dans schema_version les migrations enregistrées sous leur ancienne version (sans numéro d'ordre)
+func renommeAnciennesVersions(db sqlx.Execer) error {
+	query := "update schema_version set version=$1 where version=$2"
+	for _, m := range registre {
+		if m.AncienneVersion == "" {
+			continue
+		}
+		_, err := db.Exec(query, m.Version, m.AncienneVersion)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	return nil
+}
+
+func versionsAppliquees(db sqlx.Queryer) (res map[string]time.Time, err error) {
+	res = map[string]time.Time{}
+	type ligne struct {
+		Version         string
+		DateApplication time.Time
+	}
+	lignes := []*ligne{}
+	query := "select version,dateapplication from schema_version"
+	err = sqlx.Select(db, &lignes, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		res[l.Version] = l.DateApplication
+	}
+	return res, nil
+}
+
+// ************************** Application *******************************
+
+// Applique, dans l'ordre, toutes les migrations pas encore appliquées.
+// @return  les versions appliquées (ou enregistrées car déjà faites)
+func Up(db *sqlx.DB) (res []string, err error) {
+	res = []string{}
+	etats, err := Status(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel Status()")
+	}
+	for _, etat := range etats {
+		if etat.Appliquee {
+			continue
+		}
+		err = applique(db, etat.Migration, false)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur migration "+etat.Migration.Version)
+		}
+		res = append(res, etat.Migration.Version)
+	}
+	return res, nil
+}
+
+// Applique une seule migration ; erreur si elle a déjà été appliquée
+// ou si des migrations antérieures ne l'ont pas été.
+func Applique(db *sqlx.DB, version string) (err error) {
+	etats, err := Status(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel Status()")
+	}
+	for _, etat := range etats {
+		if etat.Migration.Version == version {
+			if etat.Appliquee {
+				return werr.New("Migration déjà appliquée : " + version)
+			}
+			return applique(db, etat.Migration, true)
+		}
+		if !etat.Appliquee {
+			return werr.New("Migration antérieure pas encore appliquée : " + etat.Migration.Version)
+		}
+	}
+	return werr.New("Migration inexistante : " + version)
+}
+
+// Exécute une migration et l'enregistre dans schema_version, dans une même transaction.
+// @param refuserSiFaite  si true, erreur si la migration a été appliquée entre-temps par un autre processus ;
+//
+//	sinon, elle est simplement ignorée.
+func applique(db *sqlx.DB, m *Migration, refuserSiFaite bool) (err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel db.Beginx()")
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.Exec("select pg_advisory_xact_lock($1)", VERROU_MIGRATIONS)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel pg_advisory_xact_lock()")
+	}
+	var n int
+	err = tx.Get(&n, "select count(*) from schema_version where version=$1", m.Version)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query schema_version")
+	}
+	if n != 0 {
+		if refuserSiFaite {
+			err = werr.New("Migration déjà appliquée : " + m.Version)
+			return err
+		}
+		return tx.Commit()
+	}
+	executee := true
+	if m.DejaFaite != nil {
+		dejaFaite, err := m.DejaFaite(tx)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel DejaFaite()")
+		}
+		executee = !dejaFaite
+	}
+	if executee {
+		err = m.Up(tx)
+		if err != nil {
+			return err
+		}
+	}
+	query := "insert into schema_version(version,description,dateapplication,executee) values($1,$2,$3,$4)"
+	_, err = tx.Exec(query, m.Version, m.Description, time.Now(), executee)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return tx.Commit()
+}
+
+// ************************** Auxiliaires *******************************
+
+// Exécute des requêtes les unes après les autres
+func execQueries(tx *sqlx.Tx, queries ...string) error {
+	for _, query := range queries {
+		_, err := tx.Exec(query)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	return nil
+}
+
+// Pour DejaFaite : teste l'existence d'une table dans le schéma courant
+func tableExiste(tx *sqlx.Tx, table string) (bool, error) {
+	var existe bool
+	query := "select exists(select 1 from information_schema.tables where table_schema=current_schema() and table_name=$1)"
+	err := tx.Get(&existe, query, table)
+	if err != nil {
+		return false, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return existe, nil
+}
+
+// Pour DejaFaite : teste l'existence d'une colonne d'une table dans le schéma courant
+func colonneExiste(tx *sqlx.Tx, table, colonne string) (bool, error) {
+	var existe bool
+	query := "select exists(select 1 from information_schema.columns where table_schema=current_schema() and table_name=$1 and column_name=$2)"
+	err := tx.Get(&existe, query, table, colonne)
+	if err != nil {
+		return false, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return existe, nil
+}
@@ -44,7 +44,45 @@ type Config struct {
 	Affacture struct {
 		Adresse string `yaml:"adresse"`
 	} `yaml:"affacture"`
+	// Export comptable, cf model/compta.go
+	Compta struct {
+		JournalVentes      string `yaml:"journal-ventes"`
+		JournalAchats      string `yaml:"journal-achats"`
+		CompteClients      string `yaml:"compte-clients"`
+		CompteFournisseurs string `yaml:"compte-fournisseurs"`
+		// Comptes de produits
+		CompteVentePlaquettes string `yaml:"compte-vente-plaquettes"`
+		CompteVenteLivraison  string `yaml:"compte-vente-livraison"`
+		CompteVenteAutres     string `yaml:"compte-vente-autres"`
+		// Comptes de charges, par code d'activité (AB, DB, DC, BR, TR, RG, CG, LV)
+		ComptesAchats map[string]string `yaml:"comptes-achats"`
+		// Comptes de TVA, par taux
+		TVACollectee  map[float64]string `yaml:"tva-collectee"`
+		TVADeductible map[float64]string `yaml:"tva-deductible"`
+		// Format du journal CSV
+		CSV struct {
+			Separateur string   `yaml:"separateur"`
+			Decimale   string   `yaml:"decimale"`
+			Colonnes   []string `yaml:"colonnes"`
+		} `yaml:"csv"`
+	} `yaml:"compta"`
+	// Suivi du séchage des tas, cf model/humid-sechage.go
+	Humidite struct {
+		Cible           float64 `yaml:"cible"`
+		JoursSansMesure int     `yaml:"jours-sans-mesure"`
+	} `yaml:"humidite"`
+	// Sauvegardes automatiques de la base, cf model/sauvegarde.go
+	Sauvegarde struct {
+		Heure     string `yaml:"heure"` // HH:MM
+		Retention struct {
+			Quotidiennes  int `yaml:"quotidiennes"`
+			Hebdomadaires int `yaml:"hebdomadaires"`
+			Mensuelles    int `yaml:"mensuelles"`
+		} `yaml:"retention"`
+	} `yaml:"sauvegarde"`
 	NbRecent int `yaml:"nb-recent"`
+	// Durée de validité d'une session utilisateur, en heures
+	DureeSession int `yaml:"duree-session"`
 }
 
 // Configuration spécifique au déploiement
@@ -62,6 +100,9 @@ type serverEnv struct {
 	RUN_MODE          string
 	BACKUP_DIR        string
 	CMD_PGDUMP        string
+	CMD_PSQL          string // utilisé par manage/db-restore
+	RESTORE_DIR       string // utilisé par manage/db-restore
+	CMD_MDBEXPORT     string // import SCTL, cf model/sctl-import.go
 }
 
 var SERVER_ENV serverEnv
@@ -96,5 +137,8 @@ func MustLoadEnv() {
 		RUN_MODE:          os.Getenv("RUN_MODE"),
 		CMD_PGDUMP:        os.Getenv("CMD_PGDUMP"),
 		BACKUP_DIR:        os.Getenv("BACKUP_DIR"),
+		CMD_PSQL:          os.Getenv("CMD_PSQL"),
+		RESTORE_DIR:       os.Getenv("RESTORE_DIR"),
+		CMD_MDBEXPORT:     os.Getenv("CMD_MDBEXPORT"),
 	}
 }
@@ -0,0 +1,78 @@
+/*
+Accès à la base de données utilisé par les fonctions du model.
+
+Les fonctions du model reçoivent un DBOrTx, qui peut être
+  - un *sqlx.DB (cas général, lectures)
+  - un *sqlx.Tx (écritures modifiant plusieurs tables, à faire dans une transaction)
+
+Les écritures sur plusieurs tables (ex: InsertPlaq(), qui crée aussi les tas et les liens)
+doivent être appelées dans WithTx() pour que tout soit annulé en cas d'erreur.
+Comme chaque écriture ajoute aussi une ligne dans la table audit (cf audit.go),
+le code de control fait toutes ses écritures dans WithTx(), qui transmet l'utilisateur
+connecté aux fonctions du model.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Méthodes communes à *sqlx.DB et *sqlx.Tx utilisées par le model
+type DBOrTx interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Transaction associée à l'utilisateur qui fait les modifications.
+// Permet à insertAudit() de savoir qui a fait la modification.
+type txUtilisateur struct {
+	*sqlx.Tx
+	utilisateur *Utilisateur
+}
+
+// Exécute fn dans une transaction.
+// Si fn renvoie une erreur (ou panique), la transaction est annulée (rollback),
+// sinon elle est validée (commit).
+// u = utilisateur faisant les modifications, enregistré dans l'historique (peut être nil).
+func WithTx(db *sqlx.DB, u *Utilisateur, fn func(tx DBOrTx) error) (err error) {
+	sqlxTx, err := db.Beginx()
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel db.Beginx()")
+	}
+	tx := &txUtilisateur{Tx: sqlxTx, utilisateur: u}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel tx.Commit()")
+	}
+	return nil
+}
+
+// Indique si une ligne d'identifiant id existe dans une table
+// table doit être un nom de table du programme, jamais une valeur saisie par un utilisateur
+func ExisteId(db DBOrTx, table string, id int) (res bool, err error) {
+	query := "select exists(select 1 from " + table + " where id=$1)"
+	err = db.Get(&res, query, id)
+	if err != nil {
+		return false, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return res, nil
+}
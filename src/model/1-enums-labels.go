@@ -35,6 +35,8 @@ func LabelActivite(code string) string {
 		return "Livraison"
 	case "CG":
 		return "Chargement"
+	case "TF":
+		return "Transfert"
 	}
 	return "??? BUG LabelActivite (" + code + ") ???"
 }
@@ -66,3 +68,24 @@ func LabelExploitation(code string) string {
 func LabelGranulo(code string) string {
 	return code // le type stocké en base correspond au label
 }
+
+// ************************** Motif de perte *******************************
+
+// Motifs de perte possibles lors du vidage d'un tas, dans l'ordre d'affichage
+var MotifsPerte = []string{"PO", "PS", "EM"}
+
+// Labels du motif de perte constatée au vidage d'un tas (MouvementStock.Motif)
+// @param code : motif tel que stocké en base
+func LabelMotifPerte(code string) string {
+	switch code {
+	case "PO":
+		return "Pourriture"
+	case "PS":
+		return "Poussière"
+	case "EM":
+		return "Erreur de mesure"
+	case "":
+		return "Non précisé" // vidages enregistrés avant l'ajout des motifs
+	}
+	return "??? BUG LabelMotifPerte (" + code + ") ???"
+}
@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/wilk/werr"
 	"fmt"
-	"github.com/jmoiron/sqlx"
 	"sort"
 	"strconv"
 	"strings"
@@ -66,7 +65,7 @@ type ActeurActivite struct {
 
 // IsDeletable indique si un acteur peut être supprimé, ou s'il doit être marqué comme inactif
 // cf règles de gestion dans cahier des charges
-func (a *Acteur) IsDeletable(db *sqlx.DB) (res bool, err error) {
+func (a *Acteur) IsDeletable(db DBOrTx) (res bool, err error) {
 	queries := []string{
 		// mis en premier car le plus fréquent
 		"select count(*) from chautre where id_acheteur=$1",
@@ -82,6 +81,10 @@ func (a *Acteur) IsDeletable(db *sqlx.DB) (res bool, err error) {
 		"select count(*) from plaqrange where id_conducteur=$1",
 		"select count(*) from plaqrange where id_proprioutil=$1",
 		//
+		"select count(*) from plaqtransfert where id_transporteur=$1",
+		"select count(*) from plaqtransfert where id_conducteur=$1",
+		"select count(*) from plaqtransfert where id_proprioutil=$1",
+		//
 		"select count(*) from ventelivre where id_livreur=$1",
 		"select count(*) from ventelivre where id_conducteur=$1",
 		"select count(*) from ventelivre where id_proprioutil=$1",
@@ -91,12 +94,15 @@ func (a *Acteur) IsDeletable(db *sqlx.DB) (res bool, err error) {
 		"select count(*) from ventecharge where id_proprioutil=$1",
 		//
 		"select count(*) from humid_acteur where id_acteur=$1",
+		//
+		"select count(*) from facture where id_client=$1",
+		"select count(*) from affacture where id_acteur=$1",
 	}
 	var count int
 	for _, query := range queries {
 		err = db.QueryRow(query, a.Id).Scan(&count)
 		if err != nil {
-			return false, werr.Wrapf(err, fmt.Sprint("Erreur query: %s\n Acteur %d: %s", query, a.Id, a.String()))
+			return false, werr.Wrapf(err, fmt.Sprintf("Erreur query: %s\n Acteur %d: %s", query, a.Id, a.String()))
 		}
 		if count != 0 {
 			return false, nil
@@ -111,8 +117,27 @@ func (a *Acteur) String() string {
 	return strings.TrimSpace(a.Prenom + " " + a.Nom)
 }
 
+// Renvoie une string permettant d'afficher un acteur avec son adresse dans une facture
+func (a *Acteur) StringFacture() string {
+	str := a.String()
+	if a.Adresse1 != "" {
+		str += "\n" + a.Adresse1
+	}
+	if a.Adresse2 != "" {
+		str += "\n" + a.Adresse2
+	}
+	if a.Cp != "" && a.Ville != "" {
+		str += "\n" + a.Cp + " " + a.Ville
+	} else if a.Cp != "" {
+		str += "\n" + a.Cp
+	} else if a.Ville != "" {
+		str += "\n" + a.Ville
+	}
+	return str
+}
+
 // Renvoie une map id acteur => nom, pour un rôle donné
-func LabelActeurs(db *sqlx.DB, role string) (res map[int]string, err error) {
+func LabelActeurs(db DBOrTx, role string) (res map[int]string, err error) {
 	res = map[int]string{}
 	acteurs, err := GetActeursByRole(db, role)
 	if err != nil {
@@ -126,7 +151,7 @@ func LabelActeurs(db *sqlx.DB, role string) (res map[int]string, err error) {
 
 // ************************** Divers *******************************
 
-func CountActeurs(db *sqlx.DB) (count int) {
+func CountActeurs(db DBOrTx) (count int) {
 	_ = db.QueryRow("select count(*) from acteur").Scan(&count)
 	return count
 }
@@ -136,7 +161,7 @@ func CountActeurs(db *sqlx.DB) (count int) {
 // Renvoie un Acteur à partir de son id.
 // Ne contient que les champs de la table acteur.
 // Les autres champs ne sont pas remplis.
-func GetActeur(db *sqlx.DB, id int) (a *Acteur, err error) {
+func GetActeur(db DBOrTx, id int) (a *Acteur, err error) {
 	a = &Acteur{}
 	query := "select * from acteur where id=$1"
 	row := db.QueryRowx(query, id)
@@ -148,7 +173,7 @@ func GetActeur(db *sqlx.DB, id int) (a *Acteur, err error) {
 }
 
 // Renvoie un acteur avec les codes de ses rôles
-func GetActeurFull(db *sqlx.DB, id int) (a *Acteur, err error) {
+func GetActeurFull(db DBOrTx, id int) (a *Acteur, err error) {
 	a, err = GetActeur(db, id)
 	if err != nil {
 		return nil, werr.Wrapf(err, "Erreur Appel GetActeur()")
@@ -162,7 +187,7 @@ func GetActeurFull(db *sqlx.DB, id int) (a *Acteur, err error) {
 // GetSortedActeurs renvoie une liste d'Acteurs triés en utilisant un champ de la table.
 // TODO En fait, toujours utilisée en triant par nom, on pourrait supprimer le param field
 // @param field    Champ de la table acteur utilisé pour le tri
-func GetSortedActeurs(db *sqlx.DB, field string) (acteurs []*Acteur, err error) {
+func GetSortedActeurs(db DBOrTx, field string) (acteurs []*Acteur, err error) {
 	acteurs = []*Acteur{}
 	query := "select * from acteur where id<>0 order by " + field
 	err = db.Select(&acteurs, query)
@@ -186,7 +211,7 @@ func GetSortedActeurs(db *sqlx.DB, field string) (acteurs []*Acteur, err error)
 // Les acteurs ne contiennent que les champs de la table.
 // Les acteurs sont triés par nom.
 // @param code_role    Code d'un rôle utilisateur
-func GetActeursByRole(db *sqlx.DB, code_role string) (acteurs []*Acteur, err error) {
+func GetActeursByRole(db DBOrTx, code_role string) (acteurs []*Acteur, err error) {
 	acteurs = []*Acteur{}
 	query := `select * from acteur where id in(select id_acteur from acteur_role where code_role=$1) order by nom`
 	err = db.Select(&acteurs, query, code_role)
@@ -199,7 +224,7 @@ func GetActeursByRole(db *sqlx.DB, code_role string) (acteurs []*Acteur, err err
 // Renvoie une liste d'Acteurs ayant comme rôle client PF ou client d'un chantier autres valorisations.
 // Les acteurs ne contiennent que les champs de la table.
 // Les acteurs sont triés par nom.
-func GetClients(db *sqlx.DB) (acteurs []*Acteur, err error) {
+func GetClients(db DBOrTx) (acteurs []*Acteur, err error) {
 	acteurs = []*Acteur{}
 	query := `select * from acteur where id in(
 	    select id_acteur from acteur_role where code_role in(
@@ -217,7 +242,7 @@ func GetClients(db *sqlx.DB) (acteurs []*Acteur, err error) {
 // ( = les fournisseurs de plaquettes ; en pratique, en 2020, 1 seul fournisseur : BDL)
 // Ne contient que les champs de la table acteur.
 // Les autres champs ne sont pas remplis.
-func GetFournisseurs(db *sqlx.DB) (acteurs []*Acteur, err error) {
+func GetFournisseurs(db DBOrTx) (acteurs []*Acteur, err error) {
 	////////////// remplacer par GetActeursByRole() //////////////
 	acteurs = []*Acteur{}
 	query := "select * from acteur where fournisseur"
@@ -232,7 +257,7 @@ func GetFournisseurs(db *sqlx.DB) (acteurs []*Acteur, err error) {
 // Ne contient que les champs de la table acteur.
 // Les autres champs ne sont pas remplis.
 // //////////// remplacer par GetSortedActeursByRole() //////////////
-func GetClientsPlaquettes(db *sqlx.DB) (acteurs []*Acteur, err error) {
+func GetClientsPlaquettes(db DBOrTx) (acteurs []*Acteur, err error) {
 	acteurs = []*Acteur{}
 	query := `select * from acteur where id in(
                 select id_client from venteplaq
@@ -245,7 +270,7 @@ func GetClientsPlaquettes(db *sqlx.DB) (acteurs []*Acteur, err error) {
 }
 
 // Utilisé pour construire html datalist
-func GetListeActeurs(db *sqlx.DB) (res map[int]string, err error) {
+func GetListeActeurs(db DBOrTx) (res map[int]string, err error) {
 	res = map[int]string{}
 	acteurs := []*Acteur{}
 	query := "select id,prenom,nom from acteur"
@@ -261,7 +286,7 @@ func GetListeActeurs(db *sqlx.DB) (res map[int]string, err error) {
 
 // Renvoie les acteurs SCTL et GFA, marqué comme propriétaires
 // //////////// remplacer par GetSortedActeursByRole() //////////////
-func GetProprietaires(db *sqlx.DB) (res map[int]string, err error) {
+func GetProprietaires(db DBOrTx) (res map[int]string, err error) {
 	res = map[int]string{}
 	acteurs := []*Acteur{}
 	query := "select id,nom from acteur where proprietaire=true"
@@ -277,7 +302,7 @@ func GetProprietaires(db *sqlx.DB) (res map[int]string, err error) {
 
 // ************************** Compute *******************************
 
-func (a *Acteur) ComputeCodesRole(db *sqlx.DB) (err error) {
+func (a *Acteur) ComputeCodesRole(db DBOrTx) (err error) {
 	if len(a.CodesRole) != 0 {
 		return nil // déjà calculé
 	}
@@ -297,7 +322,7 @@ func (a *Acteur) ComputeCodesRole(db *sqlx.DB) (err error) {
 // Ne renvoie que des infos pour afficher la liste, pas les activités réelles.
 // Distinct de model.Activite car concerne aussi les "petites" activités
 // (abattage, débardage ... transport, livraison ...)
-func (a *Acteur) GetActivitesByDate(db *sqlx.DB) (res []*ActeurActivite, err error) {
+func (a *Acteur) GetActivitesByDate(db DBOrTx) (res []*ActeurActivite, err error) {
 	res = []*ActeurActivite{}
 	var query string
 	//
@@ -497,6 +522,90 @@ func (a *Acteur) GetActivitesByDate(db *sqlx.DB) (res []*ActeurActivite, err err
 		res = append(res, new)
 	}
 	//
+	// Transfert plaquettes entre lieux de stockage - transporteur (coût global)
+	//
+	list3c := []PlaqTransfert{}
+	query = "select * from plaqtransfert where id_transporteur=$1"
+	err = db.Select(&list3c, query, a.Id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, elt := range list3c {
+		plaq, err := GetPlaq(db, elt.IdChantier)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetPlaq()")
+		}
+		err = plaq.ComputeLieudits(db) // pour le nom du chantier
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Plaq.ComputeLieudits()")
+		}
+		new := &ActeurActivite{
+			Date:        elt.DateTransfert,
+			Role:        "transporteur (transfert)",
+			URL:         "/chantier/plaquette/" + strconv.Itoa(elt.IdChantier) + "/chantiers",
+			NomActivite: plaq.FullString(),
+			Quantite:    elt.Qte,
+			Unite:       "MA",
+		}
+		res = append(res, new)
+	}
+	//
+	// Transfert plaquettes entre lieux de stockage - conducteur
+	//
+	list3d := []PlaqTransfert{}
+	query = "select * from plaqtransfert where id_conducteur=$1"
+	err = db.Select(&list3d, query, a.Id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, elt := range list3d {
+		plaq, err := GetPlaq(db, elt.IdChantier)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetPlaq()")
+		}
+		err = plaq.ComputeLieudits(db) // pour le nom du chantier
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Plaq.ComputeLieudits()")
+		}
+		new := &ActeurActivite{
+			Date:        elt.DateTransfert,
+			Role:        "conducteur (transfert)",
+			URL:         "/chantier/plaquette/" + strconv.Itoa(elt.IdChantier) + "/chantiers",
+			NomActivite: plaq.FullString(),
+			Quantite:    elt.Qte,
+			Unite:       "MA",
+		}
+		res = append(res, new)
+	}
+	//
+	// Transfert plaquettes entre lieux de stockage - propriétaire outil
+	//
+	list3e := []PlaqTransfert{}
+	query = "select * from plaqtransfert where id_proprioutil=$1"
+	err = db.Select(&list3e, query, a.Id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, elt := range list3e {
+		plaq, err := GetPlaq(db, elt.IdChantier)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetPlaq()")
+		}
+		err = plaq.ComputeLieudits(db) // pour le nom du chantier
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Plaq.ComputeLieudits()")
+		}
+		new := &ActeurActivite{
+			Date:        elt.DateTransfert,
+			Role:        "propriétaire outil (transfert)",
+			URL:         "/chantier/plaquette/" + strconv.Itoa(elt.IdChantier) + "/chantiers",
+			NomActivite: plaq.FullString(),
+			Quantite:    elt.Qte,
+			Unite:       "MA",
+		}
+		res = append(res, new)
+	}
+	//
 	// Livraison pour vente plaquette - livreur (coût global)
 	//
 	list4 := []VenteLivre{}
@@ -786,7 +895,7 @@ func (p acteurActiviteSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 // ************************** CRUD *******************************
 
-func InsertActeur(db *sqlx.DB, acteur *Acteur) (id int, err error) {
+func InsertActeur(db DBOrTx, acteur *Acteur) (id int, err error) {
 	query := `insert into acteur(
         nom,
         prenom,
@@ -830,10 +939,18 @@ func InsertActeur(db *sqlx.DB, acteur *Acteur) (id int, err error) {
 	if err != nil {
 		return id, werr.Wrapf(err, "Erreur appel insertLiensActeurRole()")
 	}
+	err = insertAudit(db, "acteur", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateActeur(db *sqlx.DB, acteur *Acteur) (err error) {
+func UpdateActeur(db DBOrTx, acteur *Acteur) (err error) {
+	avant, err := auditEtat(db, "acteur", acteur.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update acteur set(
         nom,
         prenom,
@@ -878,12 +995,20 @@ func UpdateActeur(db *sqlx.DB, acteur *Acteur) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel updateLiensActeurRole()")
 	}
+	err = insertAudit(db, "acteur", acteur.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteActeur(db *sqlx.DB, id int) (err error) {
+func DeleteActeur(db DBOrTx, id int) (err error) {
 	// peut-être ici protection pour savoir si Deletable = true
 	// (la situation actuelle fait confiance à l'UI pour ne pas proposer delete sur acteur non deletable)
+	avant, err := auditEtat(db, "acteur", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from acteur where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
@@ -893,6 +1018,10 @@ func DeleteActeur(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensActeurRole()")
 	}
+	err = insertAudit(db, "acteur", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
@@ -900,7 +1029,7 @@ func DeleteActeur(db *sqlx.DB, id int) (err error) {
 // Fonctions auxiliares de InsertActeur(), UpdateActeur() et DeleteActeur()
 //
 
-func insertLiensActeurRole(db *sqlx.DB, idActeur int, codesRoles []string) (err error) {
+func insertLiensActeurRole(db DBOrTx, idActeur int, codesRoles []string) (err error) {
 	query := "insert into acteur_role values($1,$2)"
 	for _, code := range codesRoles {
 		_, err = db.Exec(
@@ -914,7 +1043,7 @@ func insertLiensActeurRole(db *sqlx.DB, idActeur int, codesRoles []string) (err
 	return nil
 }
 
-func deleteLiensActeurRole(db *sqlx.DB, idActeur int) (err error) {
+func deleteLiensActeurRole(db DBOrTx, idActeur int) (err error) {
 	query := "delete from acteur_role where id_acteur=$1"
 	_, err = db.Exec(query, idActeur)
 	if err != nil {
@@ -923,7 +1052,7 @@ func deleteLiensActeurRole(db *sqlx.DB, idActeur int) (err error) {
 	return nil
 }
 
-func updateLiensActeurRole(db *sqlx.DB, idActeur int, codesRoles []string) (err error) {
+func updateLiensActeurRole(db DBOrTx, idActeur int, codesRoles []string) (err error) {
 	err = deleteLiensActeurRole(db, idActeur)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensActeurRole() à partir de updateLiensActeurRole()")
@@ -1,17 +1,24 @@
 /*
 Affacture = "facture à l'envers", que BDL doit payer à un acteur
-Les affacures ne sont pas stockées en base.
+
+Une affacture est d'abord calculée à partir des activités d'un acteur sur une période (ComputeItems()).
+Elle peut ensuite être enregistrée avec ses items et un numéro (InsertAffacture()) ;
+les activités affacturées sont alors marquées via leurs champs *DatePay,
+et ne peuvent plus figurer dans une autre affacture.
 
 @copyright  BDL, Bois du Larzac.
 @licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
 @history    2020-03-03 11:16:58+01:00, Thierry Graff : Creation
+@history    2026-10-18 : Enregistrement des affactures
 */
 package model
 
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,25 +27,37 @@ import (
 
 // Contient les données nécessaires pour afficher le PDF
 type Affacture struct {
+	Id     int
+	Numero string // vide tant que l'affacture n'est pas enregistrée
 	// Renseigné via le formulaire
-	IdActeur       int
+	IdActeur       int `db:"id_acteur"`
 	DateDebut      time.Time
 	DateFin        time.Time
 	TypesActivites []string
+	// Date reportée dans les champs *DatePay des activités affacturées
+	DateAffacture time.Time
+	Notes         string
 	// Calculé à partir de la BDD
 	Items    []*AffactureItem
 	TotalHT  float64
 	TotalTTC float64
+	// Pas stocké en base
+	Acteur *Acteur
 }
 
 // Les données hétérogènes du model (PlaqOp, PlaqTrans...) sont traduites dans un vocabulaire commun pour l'affichage
 // 1 AffactureItem <-> 1 activité (1 ligne ds la BDD)
 type AffactureItem struct {
-	Titre    string
-	Date     time.Time
-	Lignes   []AffactureLigne
-	TotalHT  float64
-	TotalTTC float64
+	Id           int
+	IdAffacture  int    `db:"id_affacture"`
+	TypeActivite string // AB, DB, DC, BR, TR, TR-CO, TR-OU, RG, RG-CO... cf AffactureTypesActivites
+	IdLigne      int    `db:"id_ligne"` // id de l'activité dans plaqop, plaqtrans, plaqrange, plaqtransfert, ventecharge ou ventelivre
+	Titre        string
+	Date         time.Time        `db:"dateitem"`
+	Lignes       []AffactureLigne `db:"-"`
+	LignesJSON   string           `db:"lignes"` // Lignes, telles que stockées en base
+	TotalHT      float64
+	TotalTTC     float64
 }
 
 // La plupart des AffactureItem sont constitués d'une seule AffactureLigne.
@@ -55,7 +74,117 @@ type AffactureColonne struct {
 	Valeur string
 }
 
-func (aff *Affacture) ComputeItems(db *sqlx.DB) (err error) {
+// Montants restant à affacturer pour un acteur (activités dont le champ *DatePay n'est pas renseigné)
+type AffactureEnAttente struct {
+	Acteur      *Acteur
+	NbActivites int
+	DateMin     time.Time
+	DateMax     time.Time
+	TotalHT     float64
+	TotalTTC    float64
+}
+
+// Codes des types d'activité pouvant figurer dans une affacture
+var AffactureTypesActivites = []string{
+	"AB", "DB", "DC", "BR",
+	"TR", "TR-CO", "TR-OU",
+	"RG", "RG-CO", "RG-OU",
+	"TF", "TF-CO", "TF-OU",
+	"CG", "CG-CO", "CG-OU",
+	"LV", "LV-CO", "LV-OU",
+}
+
+// Pour chaque type d'activité : table contenant l'activité et champ *datepay correspondant.
+// Pour TR-OU, le champ dépend de plaqtrans.typecout (cadatepay ou tbdatepay), cf champDatePay().
+var affactureChampsDatePay = map[string][2]string{
+	"AB":    {"plaqop", "datepay"},
+	"DB":    {"plaqop", "datepay"},
+	"DC":    {"plaqop", "datepay"},
+	"BR":    {"plaqop", "datepay"},
+	"TR":    {"plaqtrans", "gldatepay"},
+	"TR-CO": {"plaqtrans", "codatepay"},
+	"TR-OU": {"plaqtrans", "(case when typecout='C' then cadatepay else tbdatepay end)"},
+	"RG":    {"plaqrange", "gldatepay"},
+	"RG-CO": {"plaqrange", "codatepay"},
+	"RG-OU": {"plaqrange", "oudatepay"},
+	"TF":    {"plaqtransfert", "gldatepay"},
+	"TF-CO": {"plaqtransfert", "codatepay"},
+	"TF-OU": {"plaqtransfert", "oudatepay"},
+	"CG":    {"ventecharge", "gldatepay"},
+	"CG-CO": {"ventecharge", "modatepay"},
+	"CG-OU": {"ventecharge", "oudatepay"},
+	"LV":    {"ventelivre", "gldatepay"},
+	"LV-CO": {"ventelivre", "modatepay"},
+	"LV-OU": {"ventelivre", "oudatepay"},
+}
+
+// Condition SQL sélectionnant les activités pas encore affacturées (ni payées) :
+// champ *datepay vide (les dates vides sont stockées '0001-01-01')
+// et activité absente des affactures enregistrées (affactureitem) :
+// le champ *datepay reste modifiable dans les formulaires des activités,
+// il ne suffit pas à savoir si l'activité a déjà été affacturée.
+func sqlNonAffacture(typeActivite string) string {
+	table, champ := affactureChampsDatePay[typeActivite][0], affactureChampsDatePay[typeActivite][1]
+	typeItem := "'" + typeActivite + "'"
+	if table == "plaqop" {
+		typeItem = "plaqop.typop" // AB, DB, DC, BR
+	}
+	return "(" + champ + " is null or " + champ + "='0001-01-01')" +
+		" and not exists(select 1 from affactureitem ai where ai.typeactivite=" + typeItem + " and ai.id_ligne=" + table + ".id)"
+}
+
+// Renvoie la table et le champ *datepay à mettre à jour pour une activité affacturée
+func champDatePay(db DBOrTx, typeActivite string, idLigne int) (table, champ string, err error) {
+	table, champ = affactureChampsDatePay[typeActivite][0], affactureChampsDatePay[typeActivite][1]
+	if typeActivite == "TR-OU" {
+		var typeCout string
+		query := "select typecout from plaqtrans where id=$1"
+		err = db.Get(&typeCout, query, idLigne)
+		if err != nil {
+			return table, champ, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		champ = "tbdatepay"
+		if typeCout == "C" {
+			champ = "cadatepay"
+		}
+	}
+	return table, champ, nil
+}
+
+// ************************** Nom *******************************
+
+func (aff *Affacture) String() string {
+	return "Affacture " + aff.Numero
+}
+
+// ************************** Numéro *******************************
+
+// Même principe que NouveauNumeroFacture(), avec la table affacturenum
+// @param  annee   Format AAAA, ex 2026
+// @return         String du genre "AF2026012"
+func NouveauNumeroAffacture(db DBOrTx, annee string) (result string, err error) {
+	var lastnum int
+	query := "select lastnum from affacturenum where annee=$1"
+	_ = db.Get(&lastnum, query, annee) // empty => lastnum reste = 0
+	lastnum++
+	if lastnum == 1 {
+		query = "insert into affacturenum(annee,lastnum) values($1, $2)"
+		_, err = db.Exec(query, annee, lastnum)
+	} else {
+		query = "update affacturenum set lastnum = $1 where annee=$2"
+		_, err = db.Exec(query, lastnum, annee)
+	}
+	if err != nil {
+		return result, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	return fmt.Sprintf("AF%s%03d", annee, lastnum), nil
+}
+
+// ************************** Calcul *******************************
+
+// Calcule les items d'une affacture à partir des activités de l'acteur sur la période.
+// Les activités déjà affacturées (ou payées) ne sont pas prises en compte.
+func (aff *Affacture) ComputeItems(db DBOrTx) (err error) {
 	for _, typeActivite := range aff.TypesActivites {
 		switch typeActivite {
 		// Opérations simples
@@ -96,6 +225,22 @@ func (aff *Affacture) ComputeItems(db *sqlx.DB) (err error) {
 			if err != nil {
 				return werr.Wrapf(err, "Erreur appel Affacture.computeItemsRangementProprioutil()")
 			}
+		// Transfert entre lieux de stockage
+		case "TF":
+			err = aff.computeItemsTransfertGlobal(db)
+			if err != nil {
+				return werr.Wrapf(err, "Erreur appel Affacture.computeItemsTransfertGlobal()")
+			}
+		case "TF-CO":
+			err = aff.computeItemsTransfertConducteur(db)
+			if err != nil {
+				return werr.Wrapf(err, "Erreur appel Affacture.computeItemsTransfertConducteur()")
+			}
+		case "TF-OU":
+			err = aff.computeItemsTransfertProprioutil(db)
+			if err != nil {
+				return werr.Wrapf(err, "Erreur appel Affacture.computeItemsTransfertProprioutil()")
+			}
 			// Chargement
 		case "CG":
 			err = aff.computeItemsChargementGlobal(db)
@@ -148,9 +293,9 @@ func (p affactureItemSlice) Len() int           { return len(p) }
 func (p affactureItemSlice) Less(i, j int) bool { return p[i].Date.Before(p[j].Date) }
 func (p affactureItemSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-func (aff *Affacture) computeItemsOperationSimple(db *sqlx.DB, typeActivite string) (err error) {
+func (aff *Affacture) computeItemsOperationSimple(db DBOrTx, typeActivite string) (err error) {
 	list := []PlaqOp{}
-	query := "select * from plaqop where id_acteur=$1 and typop=$2 and datedeb>=$3 and datedeb<=$4"
+	query := "select * from plaqop where id_acteur=$1 and typop=$2 and datedeb>=$3 and datedeb<=$4 and " + sqlNonAffacture(typeActivite)
 	err = db.Select(&list, query, aff.IdActeur, typeActivite, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -162,8 +307,10 @@ func (aff *Affacture) computeItemsOperationSimple(db *sqlx.DB, typeActivite stri
 		montantTVA = montantHT * elt.TVA / 100
 		montantTTC = montantHT + montantTVA
 		item := AffactureItem{
-			Titre: LabelActivite(typeActivite),
-			Date:  elt.DateDebut,
+			TypeActivite: typeActivite,
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite(typeActivite),
+			Date:         elt.DateDebut,
 		}
 		ligne = AffactureLigne{
 			Titre: "M.O. " + LabelActivite(typeActivite),
@@ -204,9 +351,9 @@ func (aff *Affacture) computeItemsOperationSimple(db *sqlx.DB, typeActivite stri
 // Transport
 //
 
-func (aff *Affacture) computeItemsTransportGlobal(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsTransportGlobal(db DBOrTx) (err error) {
 	list := []PlaqTrans{}
-	query := "select * from plaqtrans where id_transporteur=$1 and datetrans>=$2 and datetrans<=$3"
+	query := "select * from plaqtrans where id_transporteur=$1 and datetrans>=$2 and datetrans<=$3 and " + sqlNonAffacture("TR")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -215,8 +362,10 @@ func (aff *Affacture) computeItemsTransportGlobal(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("TR"),
-			Date:  elt.DateTrans,
+			TypeActivite: "TR",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TR"),
+			Date:         elt.DateTrans,
 		}
 		montantHT = elt.GlPrix
 		montantTVA = montantHT * elt.GlTVA / 100
@@ -248,9 +397,9 @@ func (aff *Affacture) computeItemsTransportGlobal(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsTransportConducteur(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsTransportConducteur(db DBOrTx) (err error) {
 	list := []PlaqTrans{}
-	query := "select * from plaqtrans where id_conducteur=$1 and datetrans>=$2 and datetrans<=$3"
+	query := "select * from plaqtrans where id_conducteur=$1 and datetrans>=$2 and datetrans<=$3 and " + sqlNonAffacture("TR-CO")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -259,8 +408,10 @@ func (aff *Affacture) computeItemsTransportConducteur(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("TR"),
-			Date:  elt.DateTrans,
+			TypeActivite: "TR-CO",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TR"),
+			Date:         elt.DateTrans,
 		}
 		montantHT = elt.CoNheure * elt.CoPrixH
 		montantTVA = montantHT * elt.CoTVA / 100
@@ -300,9 +451,9 @@ func (aff *Affacture) computeItemsTransportConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsTransportProprioutil(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsTransportProprioutil(db DBOrTx) (err error) {
 	list := []PlaqTrans{}
-	query := "select * from plaqtrans where id_proprioutil=$1 and datetrans>=$2 and datetrans<=$3"
+	query := "select * from plaqtrans where id_proprioutil=$1 and datetrans>=$2 and datetrans<=$3 and " + sqlNonAffacture("TR-OU")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -311,8 +462,10 @@ func (aff *Affacture) computeItemsTransportProprioutil(db *sqlx.DB) (err error)
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("TR"),
-			Date:  elt.DateTrans,
+			TypeActivite: "TR-OU",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TR"),
+			Date:         elt.DateTrans,
 		}
 		if elt.TypeCout == "C" {
 			//
@@ -402,9 +555,9 @@ func (aff *Affacture) computeItemsTransportProprioutil(db *sqlx.DB) (err error)
 // Rangement
 //
 
-func (aff *Affacture) computeItemsRangementGlobal(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsRangementGlobal(db DBOrTx) (err error) {
 	list := []PlaqRange{}
-	query := "select * from plaqrange where id_rangeur=$1 and daterange>=$2 and daterange<=$3"
+	query := "select * from plaqrange where id_rangeur=$1 and daterange>=$2 and daterange<=$3 and " + sqlNonAffacture("RG")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -413,8 +566,10 @@ func (aff *Affacture) computeItemsRangementGlobal(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("RG"),
-			Date:  elt.DateRange,
+			TypeActivite: "RG",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("RG"),
+			Date:         elt.DateRange,
 		}
 		montantHT = elt.GlPrix
 		montantTVA = montantHT * elt.GlTVA / 100
@@ -447,9 +602,9 @@ func (aff *Affacture) computeItemsRangementGlobal(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsRangementConducteur(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsRangementConducteur(db DBOrTx) (err error) {
 	list := []PlaqRange{}
-	query := "select * from plaqrange where id_conducteur=$1 and daterange>=$2 and daterange<=$3"
+	query := "select * from plaqrange where id_conducteur=$1 and daterange>=$2 and daterange<=$3 and " + sqlNonAffacture("RG-CO")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -458,8 +613,10 @@ func (aff *Affacture) computeItemsRangementConducteur(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("RG"),
-			Date:  elt.DateRange,
+			TypeActivite: "RG-CO",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("RG"),
+			Date:         elt.DateRange,
 		}
 		montantHT = elt.CoNheure * elt.CoPrixH
 		montantTVA = montantHT * elt.CoTVA / 100
@@ -500,9 +657,9 @@ func (aff *Affacture) computeItemsRangementConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsRangementProprioutil(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsRangementProprioutil(db DBOrTx) (err error) {
 	list := []PlaqRange{}
-	query := "select * from plaqrange where id_proprioutil=$1 and daterange>=$2 and daterange<=$3"
+	query := "select * from plaqrange where id_proprioutil=$1 and daterange>=$2 and daterange<=$3 and " + sqlNonAffacture("RG-OU")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -511,8 +668,163 @@ func (aff *Affacture) computeItemsRangementProprioutil(db *sqlx.DB) (err error)
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("RG"),
-			Date:  elt.DateRange,
+			TypeActivite: "RG-OU",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("RG"),
+			Date:         elt.DateRange,
+		}
+		montantHT = elt.OuPrix
+		montantTVA = montantHT * elt.OuTVA / 100
+		montantTTC = montantHT + montantTVA
+		ligne = AffactureLigne{
+			Titre: "Outil",
+			Colonnes: []AffactureColonne{
+				{
+					Titre:  "Montant HT",
+					Valeur: strconv.FormatFloat(montantHT, 'f', 2, 64),
+				},
+				{
+					Titre:  "TVA " + strconv.FormatFloat(elt.OuTVA, 'f', -1, 64) + "%",
+					Valeur: strconv.FormatFloat(montantTVA, 'f', 2, 64),
+				},
+				{
+					Titre:  "Montant TTC",
+					Valeur: strconv.FormatFloat(montantTTC, 'f', 2, 64),
+				},
+			},
+		}
+		item.Lignes = append(item.Lignes, ligne)
+		aff.TotalHT += montantHT
+		aff.TotalTTC += montantTTC
+		item.TotalHT += montantHT
+		item.TotalTTC += montantTTC
+		//
+		aff.Items = append(aff.Items, &item)
+	}
+	return nil
+}
+
+//
+// Transfert entre lieux de stockage
+//
+
+func (aff *Affacture) computeItemsTransfertGlobal(db DBOrTx) (err error) {
+	list := []PlaqTransfert{}
+	query := "select * from plaqtransfert where id_transporteur=$1 and datetransfert>=$2 and datetransfert<=$3 and " + sqlNonAffacture("TF")
+	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	var montantHT, montantTVA, montantTTC float64
+	var ligne AffactureLigne
+	for _, elt := range list {
+		item := AffactureItem{
+			TypeActivite: "TF",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TF"),
+			Date:         elt.DateTransfert,
+		}
+		montantHT = elt.GlPrix
+		montantTVA = montantHT * elt.GlTVA / 100
+		montantTTC = montantHT + montantTVA
+		ligne = AffactureLigne{
+			Titre: "Transfert",
+			Colonnes: []AffactureColonne{
+				{
+					Titre:  "Montant HT",
+					Valeur: strconv.FormatFloat(montantHT, 'f', 2, 64),
+				},
+				{
+					Titre:  "TVA " + strconv.FormatFloat(elt.GlTVA, 'f', -1, 64) + "%",
+					Valeur: strconv.FormatFloat(montantTVA, 'f', 2, 64),
+				},
+				{
+					Titre:  "Montant TTC",
+					Valeur: strconv.FormatFloat(montantTTC, 'f', 2, 64),
+				},
+			},
+		}
+		item.Lignes = append(item.Lignes, ligne)
+		aff.TotalHT += montantHT
+		aff.TotalTTC += montantTTC
+		item.TotalHT += montantHT
+		item.TotalTTC += montantTTC
+		//
+		aff.Items = append(aff.Items, &item)
+	}
+	return nil
+}
+
+func (aff *Affacture) computeItemsTransfertConducteur(db DBOrTx) (err error) {
+	list := []PlaqTransfert{}
+	query := "select * from plaqtransfert where id_conducteur=$1 and datetransfert>=$2 and datetransfert<=$3 and " + sqlNonAffacture("TF-CO")
+	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	var montantHT, montantTVA, montantTTC float64
+	var ligne AffactureLigne
+	for _, elt := range list {
+		item := AffactureItem{
+			TypeActivite: "TF-CO",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TF"),
+			Date:         elt.DateTransfert,
+		}
+		montantHT = elt.CoNheure * elt.CoPrixH
+		montantTVA = montantHT * elt.CoTVA / 100
+		montantTTC = montantHT + montantTVA
+		ligne = AffactureLigne{
+			Titre: "Conducteur",
+			Colonnes: []AffactureColonne{
+				{
+					Titre:  "Nb heures",
+					Valeur: strconv.FormatFloat(elt.CoNheure, 'f', 2, 64),
+				},
+				{
+					Titre:  "Prix / h",
+					Valeur: strconv.FormatFloat(elt.CoPrixH, 'f', 2, 64),
+				},
+				{
+					Titre:  "Montant HT",
+					Valeur: strconv.FormatFloat(montantHT, 'f', 2, 64),
+				},
+				{
+					Titre:  "TVA " + strconv.FormatFloat(elt.CoTVA, 'f', -1, 64) + "%",
+					Valeur: strconv.FormatFloat(montantTVA, 'f', 2, 64),
+				},
+				{
+					Titre:  "Montant TTC",
+					Valeur: strconv.FormatFloat(montantTTC, 'f', 2, 64),
+				},
+			},
+		}
+		item.Lignes = append(item.Lignes, ligne)
+		aff.TotalHT += montantHT
+		aff.TotalTTC += montantTTC
+		item.TotalHT += montantHT
+		item.TotalTTC += montantTTC
+		//
+		aff.Items = append(aff.Items, &item)
+	}
+	return nil
+}
+
+func (aff *Affacture) computeItemsTransfertProprioutil(db DBOrTx) (err error) {
+	list := []PlaqTransfert{}
+	query := "select * from plaqtransfert where id_proprioutil=$1 and datetransfert>=$2 and datetransfert<=$3 and " + sqlNonAffacture("TF-OU")
+	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	var montantHT, montantTVA, montantTTC float64
+	var ligne AffactureLigne
+	for _, elt := range list {
+		item := AffactureItem{
+			TypeActivite: "TF-OU",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("TF"),
+			Date:         elt.DateTransfert,
 		}
 		montantHT = elt.OuPrix
 		montantTVA = montantHT * elt.OuTVA / 100
@@ -549,9 +861,9 @@ func (aff *Affacture) computeItemsRangementProprioutil(db *sqlx.DB) (err error)
 // Chargement
 //
 
-func (aff *Affacture) computeItemsChargementGlobal(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsChargementGlobal(db DBOrTx) (err error) {
 	list := []VenteCharge{}
-	query := "select * from ventecharge where id_chargeur=$1 and datecharge>=$2 and datecharge<=$3"
+	query := "select * from ventecharge where id_chargeur=$1 and datecharge>=$2 and datecharge<=$3 and " + sqlNonAffacture("CG")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -560,8 +872,10 @@ func (aff *Affacture) computeItemsChargementGlobal(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("CG"),
-			Date:  elt.DateCharge,
+			TypeActivite: "CG",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("CG"),
+			Date:         elt.DateCharge,
 		}
 		montantHT = elt.GlPrix
 		montantTVA = montantHT * elt.GlTVA / 100
@@ -594,9 +908,9 @@ func (aff *Affacture) computeItemsChargementGlobal(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsChargementConducteur(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsChargementConducteur(db DBOrTx) (err error) {
 	list := []VenteCharge{}
-	query := "select * from ventecharge where id_conducteur=$1 and datecharge>=$2 and datecharge<=$3"
+	query := "select * from ventecharge where id_conducteur=$1 and datecharge>=$2 and datecharge<=$3 and " + sqlNonAffacture("CG-CO")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -605,8 +919,10 @@ func (aff *Affacture) computeItemsChargementConducteur(db *sqlx.DB) (err error)
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("CG"),
-			Date:  elt.DateCharge,
+			TypeActivite: "CG-CO",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("CG"),
+			Date:         elt.DateCharge,
 		}
 		montantHT = elt.MoNHeure * elt.MoPrixH
 		montantTVA = montantHT * elt.MoTVA / 100
@@ -647,9 +963,9 @@ func (aff *Affacture) computeItemsChargementConducteur(db *sqlx.DB) (err error)
 	return nil
 }
 
-func (aff *Affacture) computeItemsChargementProprioutil(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsChargementProprioutil(db DBOrTx) (err error) {
 	list := []VenteCharge{}
-	query := "select * from ventecharge where id_proprioutil=$1 and datecharge>=$2 and datecharge<=$3"
+	query := "select * from ventecharge where id_proprioutil=$1 and datecharge>=$2 and datecharge<=$3 and " + sqlNonAffacture("CG-OU")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -658,8 +974,10 @@ func (aff *Affacture) computeItemsChargementProprioutil(db *sqlx.DB) (err error)
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("CG"),
-			Date:  elt.DateCharge,
+			TypeActivite: "CG-OU",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("CG"),
+			Date:         elt.DateCharge,
 		}
 		montantHT = elt.OuPrix
 		montantTVA = montantHT * elt.OuTVA / 100
@@ -696,9 +1014,9 @@ func (aff *Affacture) computeItemsChargementProprioutil(db *sqlx.DB) (err error)
 // Livraison
 //
 
-func (aff *Affacture) computeItemsLivraisonGlobal(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsLivraisonGlobal(db DBOrTx) (err error) {
 	list := []VenteLivre{}
-	query := "select * from ventelivre where id_livreur=$1 and datelivre>=$2 and datelivre<=$3"
+	query := "select * from ventelivre where id_livreur=$1 and datelivre>=$2 and datelivre<=$3 and " + sqlNonAffacture("LV")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -707,8 +1025,10 @@ func (aff *Affacture) computeItemsLivraisonGlobal(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("LV"),
-			Date:  elt.DateLivre,
+			TypeActivite: "LV",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("LV"),
+			Date:         elt.DateLivre,
 		}
 		montantHT = elt.GlPrix
 		montantTVA = montantHT * elt.GlTVA / 100
@@ -741,9 +1061,9 @@ func (aff *Affacture) computeItemsLivraisonGlobal(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsLivraisonConducteur(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsLivraisonConducteur(db DBOrTx) (err error) {
 	list := []VenteLivre{}
-	query := "select * from ventelivre where id_conducteur=$1 and datelivre>=$2 and datelivre<=$3"
+	query := "select * from ventelivre where id_conducteur=$1 and datelivre>=$2 and datelivre<=$3 and " + sqlNonAffacture("LV-CO")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -752,8 +1072,10 @@ func (aff *Affacture) computeItemsLivraisonConducteur(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("LV"),
-			Date:  elt.DateLivre,
+			TypeActivite: "LV-CO",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("LV"),
+			Date:         elt.DateLivre,
 		}
 		//
 		// Detail - Main d'oeuvre (livreur)
@@ -797,9 +1119,9 @@ func (aff *Affacture) computeItemsLivraisonConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (aff *Affacture) computeItemsLivraisonOutil(db *sqlx.DB) (err error) {
+func (aff *Affacture) computeItemsLivraisonOutil(db DBOrTx) (err error) {
 	list := []VenteLivre{}
-	query := "select * from ventelivre where id_proprioutil=$1 and datelivre>=$2 and datelivre<=$3"
+	query := "select * from ventelivre where id_proprioutil=$1 and datelivre>=$2 and datelivre<=$3 and " + sqlNonAffacture("LV-OU")
 	err = db.Select(&list, query, aff.IdActeur, tiglib.DateIso(aff.DateDebut), tiglib.DateIso(aff.DateFin))
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
@@ -808,8 +1130,10 @@ func (aff *Affacture) computeItemsLivraisonOutil(db *sqlx.DB) (err error) {
 	var ligne AffactureLigne
 	for _, elt := range list {
 		item := AffactureItem{
-			Titre: LabelActivite("RG"),
-			Date:  elt.DateLivre,
+			TypeActivite: "LV-OU",
+			IdLigne:      elt.Id,
+			Titre:        LabelActivite("LV"),
+			Date:         elt.DateLivre,
 		}
 		montantHT = elt.OuPrix
 		montantTVA = montantHT * elt.OuTVA / 100
@@ -841,3 +1165,292 @@ func (aff *Affacture) computeItemsLivraisonOutil(db *sqlx.DB) (err error) {
 	}
 	return nil
 }
+
+// ************************** Get one *******************************
+
+func GetAffacture(db DBOrTx, id int) (aff *Affacture, err error) {
+	aff = &Affacture{}
+	query := "select * from affacture where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(aff)
+	if err != nil {
+		return aff, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	return aff, nil
+}
+
+// Renvoie une affacture avec son acteur et ses items, triés par date
+func GetAffactureFull(db DBOrTx, id int) (aff *Affacture, err error) {
+	aff, err = GetAffacture(db, id)
+	if err != nil {
+		return aff, werr.Wrapf(err, "Erreur appel GetAffacture()")
+	}
+	aff.Acteur, err = GetActeur(db, aff.IdActeur)
+	if err != nil {
+		return aff, werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	query := "select * from affactureitem where id_affacture=$1 order by dateitem, id"
+	err = db.Select(&aff.Items, query, id)
+	if err != nil {
+		return aff, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, item := range aff.Items {
+		err = json.Unmarshal([]byte(item.LignesJSON), &item.Lignes)
+		if err != nil {
+			return aff, werr.Wrapf(err, "Erreur appel json.Unmarshal()")
+		}
+	}
+	return aff, nil
+}
+
+// ************************** Get many *******************************
+
+// Renvoie les affactures d'une année (date d'affacture), avec leurs acteurs, sans les items
+func GetAffacturesOfYear(db DBOrTx, annee string) (res []*Affacture, err error) {
+	res = []*Affacture{}
+	query := "select * from affacture where extract(year from dateaffacture)=$1 order by numero"
+	err = db.Select(&res, query, annee)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, aff := range res {
+		aff.Acteur, err = GetActeur(db, aff.IdActeur)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetActeur()")
+		}
+	}
+	return res, nil
+}
+
+// Renvoie les affactures d'un acteur, sans les items
+func GetAffacturesOfActeur(db DBOrTx, idActeur int) (res []*Affacture, err error) {
+	res = []*Affacture{}
+	query := "select * from affacture where id_acteur=$1 order by dateaffacture desc"
+	err = db.Select(&res, query, idActeur)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	return res, nil
+}
+
+// Renvoie la liste des années ayant des affactures
+// @param   exclude   Année à exclure du résultat
+// @return  Liste de string au format YYYY
+func GetAffactureDifferentYears(db DBOrTx, exclude string) (res []string, err error) {
+	res = []string{}
+	query := "select distinct extract(year from dateaffacture)::text from affacture order by 1"
+	err = db.Select(&res, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for i, y := range res {
+		if y == exclude {
+			return append(res[:i], res[i+1:]...), nil
+		}
+	}
+	return res, nil
+}
+
+// ************************** En attente *******************************
+
+// Calcule, pour chaque acteur, les montants des activités pas encore affacturées, jusqu'à aujourd'hui.
+// BDL n'est pas pris en compte. Résultat trié par montant TTC décroissant.
+func ComputeAffacturesEnAttente(db DBOrTx) (res []*AffactureEnAttente, err error) {
+	res = []*AffactureEnAttente{}
+	// acteurs intervenant dans les activités non affacturées
+	colonnesActeur := map[string]string{
+		"AB": "id_acteur", "TR": "id_transporteur", "TR-CO": "id_conducteur", "TR-OU": "id_proprioutil",
+		"RG": "id_rangeur", "RG-CO": "id_conducteur", "RG-OU": "id_proprioutil",
+		"CG": "id_chargeur", "CG-CO": "id_conducteur", "CG-OU": "id_proprioutil",
+		"LV": "id_livreur", "LV-CO": "id_conducteur", "LV-OU": "id_proprioutil",
+		"TF": "id_transporteur", "TF-CO": "id_conducteur", "TF-OU": "id_proprioutil",
+	}
+	selects := []string{}
+	for _, typeActivite := range AffactureTypesActivites {
+		colonne, ok := colonnesActeur[typeActivite]
+		if !ok {
+			continue // DB, DC, BR : même requête que AB
+		}
+		selects = append(selects, "select "+colonne+" from "+affactureChampsDatePay[typeActivite][0]+" where "+sqlNonAffacture(typeActivite))
+	}
+	idsActeur := []int{}
+	query := "select * from (" + strings.Join(selects, "\n    union ") + ") t order by 1"
+	err = db.Select(&idsActeur, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	debut := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC) // toutes les activités passées
+	for _, idActeur := range idsActeur {
+		if idActeur == 0 || idActeur == ID_BDL {
+			continue
+		}
+		aff := &Affacture{
+			IdActeur:       idActeur,
+			DateDebut:      debut,
+			DateFin:        time.Now(),
+			TypesActivites: AffactureTypesActivites,
+		}
+		err = aff.ComputeItems(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Affacture.ComputeItems()")
+		}
+		attente := &AffactureEnAttente{}
+		for _, item := range aff.Items {
+			if item.TotalTTC == 0 {
+				continue
+			}
+			if attente.NbActivites == 0 {
+				attente.DateMin = item.Date // items triés par date
+			}
+			attente.NbActivites++
+			attente.DateMax = item.Date
+			attente.TotalHT += item.TotalHT
+			attente.TotalTTC += item.TotalTTC
+		}
+		if attente.NbActivites == 0 {
+			continue
+		}
+		attente.Acteur, err = GetActeur(db, idActeur)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetActeur()")
+		}
+		res = append(res, attente)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].TotalTTC > res[j].TotalTTC })
+	return res, nil
+}
+
+// ************************** CRUD *******************************
+
+// Enregistre une affacture calculée par ComputeItems(), avec un nouveau numéro.
+// Les activités affacturées sont marquées en renseignant leur champ *DatePay avec DateAffacture.
+// Les affactures ne sont jamais modifiées ; pour corriger, supprimer puis recréer.
+func InsertAffacture(db DBOrTx, aff *Affacture) (id int, err error) {
+	if len(aff.Items) == 0 {
+		return id, errors.New("Aucune activité à affacturer")
+	}
+	aff.Numero, err = NouveauNumeroAffacture(db, strconv.Itoa(aff.DateAffacture.Year()))
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel NouveauNumeroAffacture()")
+	}
+	query := `insert into affacture(
+        numero,
+        id_acteur,
+        dateaffacture,
+        datedebut,
+        datefin,
+        totalht,
+        totalttc,
+        notes
+        ) values($1,$2,$3,$4,$5,$6,$7,$8) returning id`
+	err = db.QueryRow(
+		query,
+		aff.Numero,
+		aff.IdActeur,
+		aff.DateAffacture,
+		aff.DateDebut,
+		aff.DateFin,
+		aff.TotalHT,
+		aff.TotalTTC,
+		aff.Notes).Scan(&id)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = `insert into affactureitem(
+        id_affacture,
+        typeactivite,
+        id_ligne,
+        titre,
+        dateitem,
+        lignes,
+        totalht,
+        totalttc
+        ) values($1,$2,$3,$4,$5,$6,$7,$8)`
+	for _, item := range aff.Items {
+		lignes, err := json.Marshal(item.Lignes)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur appel json.Marshal()")
+		}
+		// la contrainte unique(typeactivite, id_ligne) empêche d'affacturer deux fois une activité
+		_, err = db.Exec(
+			query,
+			id,
+			item.TypeActivite,
+			item.IdLigne,
+			item.Titre,
+			item.Date,
+			string(lignes),
+			item.TotalHT,
+			item.TotalTTC)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		err = majDatePay(db, item.TypeActivite, item.IdLigne, aff.DateAffacture)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur appel majDatePay()")
+		}
+	}
+	err = insertAudit(db, "affacture", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return id, nil
+}
+
+// Supprime une affacture et ses items.
+// Les champs *DatePay des activités affacturées sont vidés : ces activités peuvent à nouveau être affacturées.
+func DeleteAffacture(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "affacture", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	items := []*AffactureItem{}
+	query := "select * from affactureitem where id_affacture=$1"
+	err = db.Select(&items, query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, item := range items {
+		err = majDatePay(db, item.TypeActivite, item.IdLigne, time.Time{})
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel majDatePay()")
+		}
+	}
+	query = "delete from affactureitem where id_affacture=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = "delete from affacture where id=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "affacture", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+// Met à jour le champ *datepay d'une activité, avec enregistrement dans l'historique de l'activité
+func majDatePay(db DBOrTx, typeActivite string, idLigne int, date time.Time) (err error) {
+	table, champ, err := champDatePay(db, typeActivite, idLigne)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel champDatePay()")
+	}
+	avant, err := auditEtat(db, table, idLigne)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	query := "update " + table + " set " + champ + "=$1 where id=$2"
+	_, err = db.Exec(query, date, idLigne)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, table, idLigne, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+/*
+Historique des modifications (audit).
+
+Chaque appel à une fonction Insert*(), Update*() ou Delete*() du model
+ajoute une ligne dans la table audit, contenant :
+  - l'entité modifiée (= nom de la table) et son id
+  - l'utilisateur ayant fait la modification (transmis par WithTx())
+  - la date de modification
+  - l'état de la ligne avant et après la modification, en JSON.
+
+L'état d'une ligne est calculé par postgres (to_jsonb()),
+complété pour certaines tables par les liens stockés dans des tables de liens
+(ex: les fermiers associés à un chantier plaquettes, cf auditLiens).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Audit struct {
+	Id            int
+	Entite        string // nom de la table
+	IdEntite      int    `db:"id_entite"`
+	Action        string // insert, update, delete
+	IdUtilisateur int    `db:"id_utilisateur"` // 0 si modification faite hors de l'application web (scripts)
+	Login         string // recopié, pour rester lisible si l'utilisateur est supprimé
+	DateAudit     time.Time
+	Avant         string // JSON - '{}' pour insert
+	Apres         string // JSON - '{}' pour delete
+	// Pas stocké en base
+	Diffs []*AuditDiff
+}
+
+// Différence entre avant et après pour un champ
+type AuditDiff struct {
+	Champ string
+	Avant string
+	Apres string
+}
+
+const (
+	AUDIT_INSERT = "insert"
+	AUDIT_UPDATE = "update"
+	AUDIT_DELETE = "delete"
+)
+
+// Association nom de table => label utilisé pour afficher l'historique
+var AuditEntiteMap = map[string]string{
+	"acteur":          "Acteur",
+	"affacture":       "Affacture",
+	"chaufer":         "Chantier chauffage fermier",
+	"chautre":         "Chantier autre valorisation",
+	"facture":         "Facture",
+	"facturepaiement": "Paiement facture",
+	"fermier":         "Fermier",
+	"humid":           "Mesure d'humidité",
+	"inventaire":      "Inventaire",
+	"plaq":            "Chantier plaquettes",
+	"plaqop":          "Opération simple",
+	"plaqrange":       "Rangement",
+	"plaqtrans":       "Transport",
+	"plaqtransfert":   "Transfert entre lieux de stockage",
+	"stockage":        "Lieu de stockage",
+	"stockfrais":      "Frais de stockage",
+	"tas":             "Tas",
+	"utilisateur":     "Utilisateur",
+	"ventecharge":     "Chargement",
+	"ventelivre":      "Livraison",
+	"venteplaq":       "Vente plaquettes",
+}
+
+// Champs non enregistrés dans l'historique
+var auditChampsExclus = map[string][]string{
+	"utilisateur": {"password"},
+}
+
+// Liens stockés dans des tables de liens, ajoutés à l'état d'une ligne
+// Pour chaque table, expression sql construisant un objet jsonb ; t désigne la ligne de la table
+var auditLiens = map[string]string{
+	"affacture": `jsonb_build_object(
+	    'activites', (select coalesce(jsonb_agg(typeactivite || ' ' || id_ligne order by id), '[]') from affactureitem where id_affacture=t.id)
+	)`,
+	"acteur": `jsonb_build_object(
+	    'codes_role', (select coalesce(jsonb_agg(code_role order by code_role), '[]') from acteur_role where id_acteur=t.id)
+	)`,
+	"plaq":    auditLiensChantier("plaq"),
+	"chautre": auditLiensChantier("chautre"),
+	"chaufer": `jsonb_build_object(
+	    'ids_ug', (select coalesce(jsonb_agg(id_ug order by id_ug), '[]') from chantier_ug where type_chantier='chaufer' and id_chantier=t.id),
+	    'ids_parcelle', (select coalesce(jsonb_agg(id_parcelle order by id_parcelle), '[]') from chantier_parcelle where type_chantier='chaufer' and id_chantier=t.id)
+	)`,
+	"inventaire": `jsonb_build_object(
+	    'stocks', (select coalesce(jsonb_agg(jsonb_build_object('id_tas', id_tas, 'stockcalcule', stockcalcule, 'stockmesure', stockmesure) order by id), '[]') from inventairetas where id_inventaire=t.id)
+	)`,
+	"humid": `jsonb_build_object(
+	    'ids_mesureur', (select coalesce(jsonb_agg(id_acteur order by id_acteur), '[]') from humid_acteur where id_humid=t.id)
+	)`,
+}
+
+// Entités dont l'historique est affiché avec celui de l'entité parente
+// table parente => tables enfants, avec le champ des enfants contenant l'id du parent
+var auditEnfants = map[string][][2]string{
+	"plaq": {
+		{"plaqop", "id_chantier"},
+		{"plaqtrans", "id_chantier"},
+		{"plaqrange", "id_chantier"},
+		{"plaqtransfert", "id_chantier"},
+		{"tas", "id_chantier"},
+	},
+	"venteplaq": {
+		{"ventelivre", "id_vente"},
+	},
+	"ventelivre": {
+		{"ventecharge", "id_livraison"},
+	},
+	"stockage": {
+		{"stockfrais", "id_stockage"},
+		{"tas", "id_stockage"},
+		{"inventaire", "id_stockage"},
+	},
+}
+
+func auditLiensChantier(typeChantier string) string {
+	res := "jsonb_build_object("
+	for i, lien := range []string{"ug", "lieudit", "fermier"} {
+		if i != 0 {
+			res += ","
+		}
+		res += fmt.Sprintf(`
+	    'ids_%[1]s', (select coalesce(jsonb_agg(id_%[1]s order by id_%[1]s), '[]') from chantier_%[1]s where type_chantier='%[2]s' and id_chantier=t.id)`,
+			lien, typeChantier)
+	}
+	return res + "\n    )"
+}
+
+// ************************** Ecriture *******************************
+
+// Renvoie l'état d'une ligne d'une table, en JSON.
+// A appeler avant un update ou un delete, pour fournir le paramètre avant de insertAudit().
+func auditEtat(db DBOrTx, table string, id int) (res string, err error) {
+	expr := "to_jsonb(t)"
+	if liens, ok := auditLiens[table]; ok {
+		expr += " || " + liens
+	}
+	for _, champ := range auditChampsExclus[table] {
+		expr = "(" + expr + ") - '" + champ + "'"
+	}
+	query := "select (" + expr + ")::text from " + table + " t where id=$1"
+	err = db.Get(&res, query, id)
+	if err != nil {
+		return "", werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return res, nil
+}
+
+// Enregistre une modification dans l'historique.
+// avant = état de la ligne avant modification, calculé par auditEtat() ; "" pour un insert
+// Pour insert et update, l'état après modification est calculé ici.
+// Un update ne modifiant rien n'est pas enregistré.
+func insertAudit(db DBOrTx, table string, id int, action string, avant string) (err error) {
+	apres := ""
+	if action != AUDIT_DELETE {
+		apres, err = auditEtat(db, table, id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel auditEtat()")
+		}
+	}
+	if action == AUDIT_UPDATE && avant == apres {
+		return nil
+	}
+	if avant == "" {
+		avant = "{}"
+	}
+	if apres == "" {
+		apres = "{}"
+	}
+	idUtilisateur, login := 0, ""
+	if tx, ok := db.(*txUtilisateur); ok && tx.utilisateur != nil {
+		idUtilisateur, login = tx.utilisateur.Id, tx.utilisateur.Login
+	}
+	query := `insert into audit(
+        entite,
+        id_entite,
+        action,
+        id_utilisateur,
+        login,
+        dateaudit,
+        avant,
+        apres
+        ) values($1,$2,$3,$4,$5,$6,$7,$8)`
+	_, err = db.Exec(
+		query,
+		table,
+		id,
+		action,
+		idUtilisateur,
+		login,
+		time.Now(),
+		avant,
+		apres)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
+
+// ************************** Lecture *******************************
+
+// Renvoie l'historique d'une entité et de ses entités enfants (cf auditEnfants),
+// trié par date décroissante
+func GetAuditsEntite(db DBOrTx, table string, id int) (res []*Audit, err error) {
+	res, err = getAuditsEntite(db, table, id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel getAuditsEntite()")
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].DateAudit.Equal(res[j].DateAudit) {
+			return res[i].Id > res[j].Id
+		}
+		return res[i].DateAudit.After(res[j].DateAudit)
+	})
+	for _, a := range res {
+		err = a.ComputeDiffs()
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Audit.ComputeDiffs()")
+		}
+	}
+	return res, nil
+}
+
+func getAuditsEntite(db DBOrTx, table string, id int) (res []*Audit, err error) {
+	res = []*Audit{}
+	query := "select * from audit where entite=$1 and id_entite=$2"
+	err = db.Select(&res, query, table, id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, enfant := range auditEnfants[table] {
+		idsEnfants := []int{}
+		// ->> renvoie null sur '{}', d'où le coalesce pour prendre l'état avant pour les delete
+		query = "select distinct id_entite from audit where entite=$1 and coalesce(apres->>($2::text), avant->>($2::text))=$3"
+		err = db.Select(&idsEnfants, query, enfant[0], enfant[1], strconv.Itoa(id))
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		for _, idEnfant := range idsEnfants {
+			tmp, err := getAuditsEntite(db, enfant[0], idEnfant)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel getAuditsEntite()")
+			}
+			res = append(res, tmp...)
+		}
+	}
+	return res, nil
+}
+
+// Calcule les champs différents entre Avant et Après
+func (a *Audit) ComputeDiffs() (err error) {
+	avant := map[string]interface{}{}
+	apres := map[string]interface{}{}
+	err = json.Unmarshal([]byte(a.Avant), &avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel json.Unmarshal()")
+	}
+	err = json.Unmarshal([]byte(a.Apres), &apres)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel json.Unmarshal()")
+	}
+	champs := []string{}
+	for k := range avant {
+		champs = append(champs, k)
+	}
+	for k := range apres {
+		if _, ok := avant[k]; !ok {
+			champs = append(champs, k)
+		}
+	}
+	sort.Strings(champs)
+	a.Diffs = []*AuditDiff{}
+	for _, champ := range champs {
+		strAvant := auditValeur2string(avant[champ])
+		strApres := auditValeur2string(apres[champ])
+		if strAvant == strApres {
+			continue
+		}
+		a.Diffs = append(a.Diffs, &AuditDiff{
+			Champ: champ,
+			Avant: strAvant,
+			Apres: strApres,
+		})
+	}
+	return nil
+}
+
+func auditValeur2string(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -5,10 +5,9 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 )
 
-func UpdateBlocnotes(db *sqlx.DB, contenu string) (err error) {
+func UpdateBlocnotes(db DBOrTx, contenu string) (err error) {
 	query := "update blocnotes set contenu=$1"
 	_, err = db.Exec(query, contenu)
 	if err != nil {
@@ -17,7 +16,7 @@ func UpdateBlocnotes(db *sqlx.DB, contenu string) (err error) {
 	return nil
 }
 
-func GetBlocnotes(db *sqlx.DB) (contenu string, err error) {
+func GetBlocnotes(db DBOrTx) (contenu string, err error) {
 	query := "select contenu from blocnotes"
     err = db.QueryRow(query).Scan(&contenu)
 	if err != nil {
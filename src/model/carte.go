@@ -0,0 +1,404 @@
+/*
+Géométrie des parcelles et export cartographique (GeoJSON).
+
+La géométrie des parcelles est importée d'un fichier cadastre au format GeoJSON
+publié par Etalab (https://cadastre.data.gouv.fr/datasets/cadastre-etalab),
+un fichier par commune : cadastre-<code insee>-parcelles.json (ou .json.gz).
+Elle est stockée dans la table parcelle_geom, liée à la table parcelle par code11
+(code insee de la commune + code parcelle, comme dans QGisUpdate()).
+
+Couches exportées (coordonnées WGS84) :
+- parcelles : une entité par parcelle ;
+- ugs : une entité par UG, géométrie = réunion des parcelles de l'UG (MultiPolygon) ;
+- chantiers : une entité par lien chantier - parcelle (mêmes champs que la table qgis_chantier).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Noms des couches pouvant être exportées
+var CouchesCarte = []string{"parcelles", "ugs", "chantiers"}
+
+type CoucheGeoJSON struct {
+	Type     string            `json:"type"` // toujours "FeatureCollection"
+	Name     string            `json:"name"`
+	Features []*FeatureGeoJSON `json:"features"`
+}
+
+type FeatureGeoJSON struct {
+	Type       string          `json:"type"` // toujours "Feature"
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type geometrieGeoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type ImportCadastre struct {
+	NbEntites           int      // nb d'entités du fichier
+	NbImportees         int      // nb de parcelles enregistrées dans parcelle_geom
+	NbHorsCommunes      int      // entités de communes absentes de la table commune
+	NbInvalides         int      // entités sans identifiant ou sans géométrie surfacique
+	Communes            []string // codes insee des communes importées
+	NbParcellesAvecGeom int      // après import, nb de parcelles de la table parcelle ayant une géométrie
+	NbParcellesSansGeom int
+}
+
+// Chantier affiché sur la carte pour une parcelle
+type ChantierCarte struct {
+	Titre string
+	URL   string
+}
+
+// ************************** Import *******************************
+
+// Importe un fichier cadastre Etalab (GeoJSON, éventuellement compressé en gzip).
+// Seules les parcelles des communes de la table commune sont enregistrées ;
+// une parcelle déjà présente dans parcelle_geom est remplacée.
+func ImporterCadastre(db DBOrTx, r io.Reader) (res *ImportCadastre, err error) {
+	res = &ImportCadastre{Communes: []string{}}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur lecture fichier gzip")
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	fichier := struct {
+		Features []struct {
+			Geometry   json.RawMessage
+			Properties struct {
+				Id      string
+				Commune string
+				Prefixe string
+			}
+		}
+	}{}
+	err = json.NewDecoder(r).Decode(&fichier)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur lecture fichier GeoJSON")
+	}
+	codesInsee := []string{}
+	query := "select codeinsee from commune"
+	err = db.Select(&codesInsee, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	communes := map[string]bool{}
+	for _, code := range codesInsee {
+		communes[code] = true
+	}
+	type parcelleCadastre struct {
+		IdCadastre string
+		Prefixe    string
+		Geometrie  json.RawMessage
+	}
+	parcelles := map[string]*parcelleCadastre{}
+	codes11 := []string{} // pour garder l'ordre du fichier
+	communesImportees := map[string]bool{}
+	res.NbEntites = len(fichier.Features)
+	for _, f := range fichier.Features {
+		// id Etalab : code insee (5) + préfixe (3) + section (2) + numéro (4), ex 120820000C0001
+		id := f.Properties.Id
+		var geom geometrieGeoJSON
+		if len(id) != 14 || json.Unmarshal(f.Geometry, &geom) != nil || (geom.Type != "Polygon" && geom.Type != "MultiPolygon") {
+			res.NbInvalides++
+			continue
+		}
+		codeInsee := id[:5]
+		if !communes[codeInsee] {
+			res.NbHorsCommunes++
+			continue
+		}
+		code11 := codeInsee + id[8:]
+		p, ok := parcelles[code11]
+		if !ok {
+			codes11 = append(codes11, code11)
+		} else if p.Prefixe == "000" {
+			continue // en cas de doublon (communes associées), garde la parcelle sans préfixe
+		}
+		parcelles[code11] = &parcelleCadastre{IdCadastre: id, Prefixe: f.Properties.Prefixe, Geometrie: f.Geometry}
+		if !communesImportees[codeInsee] {
+			communesImportees[codeInsee] = true
+			res.Communes = append(res.Communes, codeInsee)
+		}
+	}
+	query = `insert into parcelle_geom(code11, idcadastre, geometrie, dateimport) values($1,$2,$3,$4)
+        on conflict(code11) do update set idcadastre=excluded.idcadastre, geometrie=excluded.geometrie, dateimport=excluded.dateimport`
+	today := time.Now()
+	for _, code11 := range codes11 {
+		p := parcelles[code11]
+		_, err = db.Exec(query, code11, p.IdCadastre, string(p.Geometrie), today)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		res.NbImportees++
+	}
+	res.NbParcellesAvecGeom, res.NbParcellesSansGeom, err = CompteParcellesGeom(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel CompteParcellesGeom()")
+	}
+	return res, nil
+}
+
+// Renvoie le nb de parcelles de la table parcelle ayant une géométrie, et le nb de parcelles sans géométrie
+func CompteParcellesGeom(db DBOrTx) (avec, sans int, err error) {
+	query := `select
+        count(g.code11) as avec,
+        count(*) - count(g.code11) as sans
+        from parcelle p
+        join commune c on p.id_commune=c.id
+        left join parcelle_geom g on g.code11=c.codeinsee||p.code`
+	err = db.QueryRow(query).Scan(&avec, &sans)
+	if err != nil {
+		return 0, 0, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return avec, sans, nil
+}
+
+// ************************** Export *******************************
+
+// Renvoie une des couches de CouchesCarte
+func GetCoucheGeoJSON(db DBOrTx, couche string) (res *CoucheGeoJSON, err error) {
+	res = &CoucheGeoJSON{Type: "FeatureCollection", Name: couche, Features: []*FeatureGeoJSON{}}
+	switch couche {
+	case "parcelles":
+		err = computeCoucheParcelles(db, res)
+	case "ugs":
+		err = computeCoucheUGs(db, res)
+	case "chantiers":
+		err = computeCoucheChantiers(db, res)
+	default:
+		return res, werr.New("Couche inconnue : " + couche)
+	}
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur calcul couche "+couche)
+	}
+	return res, nil
+}
+
+func computeCoucheParcelles(db DBOrTx, couche *CoucheGeoJSON) (err error) {
+	lignes := []struct {
+		Id           int
+		Code11       string
+		Commune      string
+		Surface      float64
+		Proprietaire string
+		UGs          string `db:"ugs"`
+		Geometrie    string
+	}{}
+	query := `select p.id, c.codeinsee||p.code as code11, c.nom as commune, coalesce(p.surface, 0) as surface,
+            a.nom as proprietaire,
+            (select coalesce(string_agg(u.code, ', ' order by u.code), '')
+                from parcelle_ug pu join ug u on pu.id_ug=u.id where pu.id_parcelle=p.id) as ugs,
+            g.geometrie::text as geometrie
+        from parcelle p
+        join commune c on p.id_commune=c.id
+        join acteur a on p.id_proprietaire=a.id
+        join parcelle_geom g on g.code11=c.codeinsee||p.code
+        order by p.id`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		couche.Features = append(couche.Features, &FeatureGeoJSON{
+			Type:     "Feature",
+			Geometry: json.RawMessage(l.Geometrie),
+			Properties: map[string]any{
+				"id":           l.Id,
+				"code":         l.Code11,
+				"commune":      l.Commune,
+				"surface":      l.Surface,
+				"proprietaire": l.Proprietaire,
+				"ugs":          l.UGs,
+				"url":          "/parcelle/" + strconv.Itoa(l.Id),
+			},
+		})
+	}
+	return nil
+}
+
+func computeCoucheUGs(db DBOrTx, couche *CoucheGeoJSON) (err error) {
+	lignes := []struct {
+		Id                int
+		Code              string
+		CodeTypo          string  `db:"code_typo"`
+		Coupe             string  `db:"coupe"`
+		AnneeIntervention string  `db:"annee_intervention"`
+		SurfaceSIG        float64 `db:"surface_sig"`
+		Geometrie         string
+	}{}
+	query := `select u.id, u.code,
+            coalesce(u.code_typo, '') as code_typo,
+            coalesce(u.coupe, '') as coupe,
+            coalesce(u.annee_intervention, '') as annee_intervention,
+            u.surface_sig, g.geometrie::text as geometrie
+        from ug u
+        join parcelle_ug pu on pu.id_ug=u.id
+        join parcelle p on pu.id_parcelle=p.id
+        join commune c on p.id_commune=c.id
+        join parcelle_geom g on g.code11=c.codeinsee||p.code
+        order by u.id, p.id`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	// Une entité par UG, regroupe les polygones des parcelles de l'UG
+	var feature *FeatureGeoJSON
+	polygones := []json.RawMessage{}
+	ajouteUG := func() error {
+		if feature == nil {
+			return nil
+		}
+		coordinates, err := json.Marshal(polygones)
+		if err != nil {
+			return err
+		}
+		feature.Geometry, err = json.Marshal(geometrieGeoJSON{Type: "MultiPolygon", Coordinates: coordinates})
+		if err != nil {
+			return err
+		}
+		couche.Features = append(couche.Features, feature)
+		return nil
+	}
+	for _, l := range lignes {
+		if feature == nil || feature.Properties["id"] != l.Id {
+			if err = ajouteUG(); err != nil {
+				return werr.Wrap(err)
+			}
+			polygones = []json.RawMessage{}
+			feature = &FeatureGeoJSON{
+				Type: "Feature",
+				Properties: map[string]any{
+					"id":                 l.Id,
+					"code":               l.Code,
+					"code_typo":          l.CodeTypo,
+					"coupe":              l.Coupe,
+					"annee_intervention": l.AnneeIntervention,
+					"surface_sig":        l.SurfaceSIG,
+					"url":                "/ug/" + strconv.Itoa(l.Id),
+				},
+			}
+		}
+		polygones, err = ajoutePolygones(polygones, l.Geometrie)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur géométrie UG "+l.Code)
+		}
+	}
+	if err = ajouteUG(); err != nil {
+		return werr.Wrap(err)
+	}
+	return nil
+}
+
+func computeCoucheChantiers(db DBOrTx, couche *CoucheGeoJSON) (err error) {
+	lignes := []struct {
+		TypeChantier string `db:"typechantier"`
+		IdChantier   int    `db:"id_chantier"`
+		Code11       string
+		Titre        string
+		DateChantier time.Time `db:"datechantier"`
+		Essence      string
+		Quantite     float64
+		Unite        string
+		Geometrie    string
+	}{}
+	// Même contenu que la table qgis_chantier, cf QGisUpdate()
+	selectChantier := func(typeChantier, champDate, champQuantite, champUnite string) string {
+		return `select '` + typeChantier + `' as typechantier, ch.id as id_chantier, c.codeinsee||p.code as code11,
+                ch.titre, ch.` + champDate + ` as datechantier, coalesce(ch.essence::text, '') as essence,
+                ` + champQuantite + ` as quantite, ` + champUnite + ` as unite, g.geometrie::text as geometrie
+            from chantier_parcelle cp
+            join ` + typeChantier + ` ch on cp.id_chantier=ch.id
+            join parcelle p on cp.id_parcelle=p.id
+            join commune c on p.id_commune=c.id
+            join parcelle_geom g on g.code11=c.codeinsee||p.code
+            where cp.type_chantier='` + typeChantier + `'`
+	}
+	query := selectChantier("plaq", "datedeb", "0", "'MA'") +
+		"\n        union all\n        " + selectChantier("chautre", "datecontrat", "ch.volumerealise", "ch.unite::text") +
+		"\n        union all\n        " + selectChantier("chaufer", "datechantier", "ch.volume", "ch.unite::text") +
+		"\n        order by datechantier, typechantier, id_chantier, code11"
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		couche.Features = append(couche.Features, &FeatureGeoJSON{
+			Type:     "Feature",
+			Geometry: json.RawMessage(l.Geometrie),
+			Properties: map[string]any{
+				"typechantier":  l.TypeChantier,
+				"id_chantier":   l.IdChantier,
+				"code_parcelle": l.Code11,
+				"titre":         l.Titre,
+				"datechantier":  l.DateChantier.Format("2006-01-02"),
+				"essence":       l.Essence,
+				"quantite":      l.Quantite,
+				"unite":         l.Unite,
+				"url":           urlChantier(l.TypeChantier, l.IdChantier),
+			},
+		})
+	}
+	return nil
+}
+
+// ************************** Carte des activités *******************************
+
+// Renvoie les chantiers de chaque parcelle concernée par les activités.
+// @return  Map id parcelle => chantiers
+func ComputeChantiersCarte(db DBOrTx, activites []*Activite) (res map[int][]*ChantierCarte, err error) {
+	res = map[int][]*ChantierCarte{}
+	for _, a := range activites {
+		err = a.ComputeLiensParcelles(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Activite.ComputeLiensParcelles()")
+		}
+		for _, lien := range a.LiensParcelles {
+			res[lien.IdParcelle] = append(res[lien.IdParcelle], &ChantierCarte{Titre: a.Titre, URL: a.URL})
+		}
+	}
+	return res, nil
+}
+
+// ************************** Auxiliaires *******************************
+
+// Ajoute à polygones les polygones d'une géométrie GeoJSON Polygon ou MultiPolygon
+func ajoutePolygones(polygones []json.RawMessage, geometrie string) ([]json.RawMessage, error) {
+	var geom geometrieGeoJSON
+	err := json.Unmarshal([]byte(geometrie), &geom)
+	if err != nil {
+		return polygones, err
+	}
+	switch geom.Type {
+	case "Polygon":
+		polygones = append(polygones, geom.Coordinates)
+	case "MultiPolygon":
+		var multi []json.RawMessage
+		err = json.Unmarshal(geom.Coordinates, &multi)
+		if err != nil {
+			return polygones, err
+		}
+		polygones = append(polygones, multi...)
+	}
+	return polygones, nil
+}
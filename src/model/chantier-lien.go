@@ -10,7 +10,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 )
 
 // Lien entre une parcelle et un chantier (table chantier_parcelle)
@@ -29,7 +28,7 @@ type ChantierParcelle struct {
 
 // ************************** Liens chantier parcelle *******************************
 
-func computeLiensParcellesOfChantier(db *sqlx.DB, typeChantier string, idChantier int) (result []*ChantierParcelle, err error) {
+func computeLiensParcellesOfChantier(db DBOrTx, typeChantier string, idChantier int) (result []*ChantierParcelle, err error) {
 	query := `select * from chantier_parcelle where type_chantier='` + typeChantier + `' and id_chantier=$1`
 	err = db.Select(&result, query, idChantier)
 	if err != nil {
@@ -44,7 +43,7 @@ func computeLiensParcellesOfChantier(db *sqlx.DB, typeChantier string, idChantie
 	return result, nil
 }
 
-func insertLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier int, liensParcelles []*ChantierParcelle) (err error) {
+func insertLiensChantierParcelle(db DBOrTx, typeChantier string, idChantier int, liensParcelles []*ChantierParcelle) (err error) {
 	query := "insert into chantier_parcelle values($1,$2,$3,$4,$5)"
 	for _, lien := range liensParcelles {
 		_, err = db.Exec(
@@ -61,7 +60,7 @@ func insertLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier in
 	return nil
 }
 
-func deleteLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier int) (err error) {
+func deleteLiensChantierParcelle(db DBOrTx, typeChantier string, idChantier int) (err error) {
 	query := "delete from chantier_parcelle where type_chantier='" + typeChantier + "' and id_chantier=$1"
 	_, err = db.Exec(query, idChantier)
 	if err != nil {
@@ -70,7 +69,7 @@ func deleteLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier in
 	return nil
 }
 
-func updateLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier int, liensParcelles []*ChantierParcelle) (err error) {
+func updateLiensChantierParcelle(db DBOrTx, typeChantier string, idChantier int, liensParcelles []*ChantierParcelle) (err error) {
 	err = deleteLiensChantierParcelle(db, typeChantier, idChantier)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensChantierParcelle() à partir de updateLiensChantierParcelle()")
@@ -85,7 +84,7 @@ func updateLiensChantierParcelle(db *sqlx.DB, typeChantier string, idChantier in
 
 // ************************** Liens chantier UG *******************************
 
-func computeUGsOfChantier(db *sqlx.DB, typeChantier string, idChantier int) (result []*UG, err error) {
+func computeUGsOfChantier(db DBOrTx, typeChantier string, idChantier int) (result []*UG, err error) {
 	query := `select * from ug where id in(
 	    select id_ug from chantier_ug where type_chantier='` + typeChantier + `' and id_chantier=$1
     )`
@@ -96,7 +95,7 @@ func computeUGsOfChantier(db *sqlx.DB, typeChantier string, idChantier int) (res
 	return result, nil
 }
 
-func computeIdsChantiersFromUG(db *sqlx.DB, typeChantier string, idUG int) (idsUG []int, err error) {
+func computeIdsChantiersFromUG(db DBOrTx, typeChantier string, idUG int) (idsUG []int, err error) {
 	query := `select id from ` + typeChantier + ` where id in(
 	    select id_chantier from chantier_ug where type_chantier='` + typeChantier + `' and id_ug =$1
     )`
@@ -107,7 +106,7 @@ func computeIdsChantiersFromUG(db *sqlx.DB, typeChantier string, idUG int) (idsU
 	return idsUG, nil
 }
 
-func insertLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int, idsUG []int) (err error) {
+func insertLiensChantierUG(db DBOrTx, typeChantier string, idChantier int, idsUG []int) (err error) {
 	query := `insert into chantier_ug(
         type_chantier,
         id_chantier,
@@ -125,7 +124,7 @@ func insertLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int, ids
 	return nil
 }
 
-func deleteLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int) (err error) {
+func deleteLiensChantierUG(db DBOrTx, typeChantier string, idChantier int) (err error) {
 	query := "delete from chantier_ug where type_chantier='" + typeChantier + "' and id_chantier=$1"
 	_, err = db.Exec(query, idChantier)
 	if err != nil {
@@ -134,7 +133,7 @@ func deleteLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int) (er
 	return nil
 }
 
-func updateLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int, idsUG []int) (err error) {
+func updateLiensChantierUG(db DBOrTx, typeChantier string, idChantier int, idsUG []int) (err error) {
 	err = deleteLiensChantierUG(db, typeChantier, idChantier)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensChantierUG() à partir de updateLiensChantierUG()")
@@ -149,7 +148,7 @@ func updateLiensChantierUG(db *sqlx.DB, typeChantier string, idChantier int, ids
 
 // ************************** Liens chantier Lieudits *******************************
 
-func computeLieuditsOfChantier(db *sqlx.DB, typeChantier string, idChantier int) (result []*Lieudit, err error) {
+func computeLieuditsOfChantier(db DBOrTx, typeChantier string, idChantier int) (result []*Lieudit, err error) {
 	query := `select * from lieudit where id in(
 	    select id_lieudit from chantier_lieudit where type_chantier='` + typeChantier + `' and id_chantier=$1
     )`
@@ -160,7 +159,7 @@ func computeLieuditsOfChantier(db *sqlx.DB, typeChantier string, idChantier int)
 	return result, nil
 }
 
-func insertLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int, idsLieudit []int) (err error) {
+func insertLiensChantierLieudit(db DBOrTx, typeChantier string, idChantier int, idsLieudit []int) (err error) {
 	query := `insert into chantier_lieudit(
         type_chantier,
         id_chantier,
@@ -178,7 +177,7 @@ func insertLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int
 	return nil
 }
 
-func deleteLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int) (err error) {
+func deleteLiensChantierLieudit(db DBOrTx, typeChantier string, idChantier int) (err error) {
 	query := "delete from chantier_lieudit where type_chantier='" + typeChantier + "' and id_chantier=$1"
 	_, err = db.Exec(query, idChantier)
 	if err != nil {
@@ -187,7 +186,7 @@ func deleteLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int
 	return nil
 }
 
-func updateLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int, idsLieudit []int) (err error) {
+func updateLiensChantierLieudit(db DBOrTx, typeChantier string, idChantier int, idsLieudit []int) (err error) {
 	err = deleteLiensChantierLieudit(db, typeChantier, idChantier)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensChantierLieudit() à partir de updateLiensChantierLieudit()")
@@ -202,7 +201,7 @@ func updateLiensChantierLieudit(db *sqlx.DB, typeChantier string, idChantier int
 
 // ************************** Liens chantier Fermiers *******************************
 
-func computeFermiersOfChantier(db *sqlx.DB, typeChantier string, idChantier int) (result []*Fermier, err error) {
+func computeFermiersOfChantier(db DBOrTx, typeChantier string, idChantier int) (result []*Fermier, err error) {
 	query := `select * from fermier where id in(
 	    select id_fermier from chantier_fermier where type_chantier='` + typeChantier + `' and id_chantier=$1
     )`
@@ -213,7 +212,7 @@ func computeFermiersOfChantier(db *sqlx.DB, typeChantier string, idChantier int)
 	return result, nil
 }
 
-func insertLiensChantierFermier(db *sqlx.DB, typeChantier string, idChantier int, idsFermier []int) (err error) {
+func insertLiensChantierFermier(db DBOrTx, typeChantier string, idChantier int, idsFermier []int) (err error) {
 	query := `insert into chantier_fermier(
         type_chantier,
         id_chantier,
@@ -231,7 +230,7 @@ func insertLiensChantierFermier(db *sqlx.DB, typeChantier string, idChantier int
 	return nil
 }
 
-func deleteLiensChantierFermier(db *sqlx.DB, typeChantier string, idChantier int) (err error) {
+func deleteLiensChantierFermier(db DBOrTx, typeChantier string, idChantier int) (err error) {
 	query := "delete from chantier_fermier where type_chantier='" + typeChantier + "' and id_chantier=$1"
 	_, err = db.Exec(query, idChantier)
 	if err != nil {
@@ -240,7 +239,7 @@ func deleteLiensChantierFermier(db *sqlx.DB, typeChantier string, idChantier int
 	return nil
 }
 
-func updateLiensChantierFermier(db *sqlx.DB, typeChantier string, idChantier int, idsFermier []int) (err error) {
+func updateLiensChantierFermier(db DBOrTx, typeChantier string, idChantier int, idsFermier []int) (err error) {
 	err = deleteLiensChantierFermier(db, typeChantier, idChantier)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel deleteLiensChantierLieudit() à partir de updateLiensChantierFermier()")
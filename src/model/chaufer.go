@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -45,7 +44,7 @@ func (ch *Chaufer) FullString() string {
 
 // Renvoie un chantier chauffage fermier
 // contenant uniquement les données stockées en base
-func GetChaufer(db *sqlx.DB, idChantier int) (*Chaufer, error) {
+func GetChaufer(db DBOrTx, idChantier int) (*Chaufer, error) {
 	ch := &Chaufer{}
 	query := "select * from chaufer where id=$1"
 	row := db.QueryRowx(query, idChantier)
@@ -61,7 +60,7 @@ func GetChaufer(db *sqlx.DB, idChantier int) (*Chaufer, error) {
 //   - Fermier
 //   - UG
 //   - LiensParcelles
-func GetChauferFull(db *sqlx.DB, idChantier int) (*Chaufer, error) {
+func GetChauferFull(db DBOrTx, idChantier int) (*Chaufer, error) {
 	ch, err := GetChaufer(db, idChantier)
 	if err != nil {
 		return ch, werr.Wrapf(err, "Erreur appel Chaufer()")
@@ -83,7 +82,7 @@ func GetChauferFull(db *sqlx.DB, idChantier int) (*Chaufer, error) {
 
 // Renvoie la liste des années ayant des chantiers chauffage fermier,
 // @param exclude   Année à exclure du résultat
-func GetChauferDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
+func GetChauferDifferentYears(db DBOrTx, exclude string) ([]string, error) {
 	res := []string{}
 	list := []time.Time{}
 	query := "select datechantier from chaufer order by datechantier desc"
@@ -103,7 +102,7 @@ func GetChauferDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
 // Renvoie la liste des chantiers chauffage fermier pour une année donnée,
 // triés par ordre chronologique inverse.
 // Chaque chantier contient les mêmes champs que ceux renvoyés par GetChauferFull()
-func GetChaufersOfYear(db *sqlx.DB, annee string) ([]*Chaufer, error) {
+func GetChaufersOfYear(db DBOrTx, annee string) ([]*Chaufer, error) {
 	res := []*Chaufer{}
 	type ligne struct {
 		Id           int
@@ -128,7 +127,7 @@ func GetChaufersOfYear(db *sqlx.DB, annee string) ([]*Chaufer, error) {
 
 // ************************** Compute *******************************
 
-func (ch *Chaufer) ComputeFermier(db *sqlx.DB) error {
+func (ch *Chaufer) ComputeFermier(db DBOrTx) error {
 	if ch.Fermier != nil {
 		return nil
 	}
@@ -140,7 +139,7 @@ func (ch *Chaufer) ComputeFermier(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Chaufer) ComputeUGs(db *sqlx.DB) (err error) {
+func (ch *Chaufer) ComputeUGs(db DBOrTx) (err error) {
 	if len(ch.UGs) != 0 {
 		return nil // déjà calculé
 	}
@@ -151,7 +150,7 @@ func (ch *Chaufer) ComputeUGs(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chaufer) ComputeLiensParcelles(db *sqlx.DB) (err error) {
+func (ch *Chaufer) ComputeLiensParcelles(db DBOrTx) (err error) {
 	if len(ch.LiensParcelles) != 0 {
 		return nil
 	}
@@ -164,7 +163,7 @@ func (ch *Chaufer) ComputeLiensParcelles(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertChaufer(db *sqlx.DB, ch *Chaufer, idsUG []int) (idChantier int, err error) {
+func InsertChaufer(db DBOrTx, ch *Chaufer, idsUG []int) (idChantier int, err error) {
 	query := `insert into chaufer(
 	    titre,
         id_fermier,
@@ -201,10 +200,18 @@ func InsertChaufer(db *sqlx.DB, ch *Chaufer, idsUG []int) (idChantier int, err e
 	if err != nil {
 		return idChantier, werr.Wrapf(err, "Erreur appel insertLiensChantierParcelle()")
 	}
+	err = insertAudit(db, "chaufer", idChantier, AUDIT_INSERT, "")
+	if err != nil {
+		return idChantier, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return idChantier, nil
 }
 
-func UpdateChaufer(db *sqlx.DB, ch *Chaufer, idsUG []int) (err error) {
+func UpdateChaufer(db DBOrTx, ch *Chaufer, idsUG []int) (err error) {
+	avant, err := auditEtat(db, "chaufer", ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update chaufer set(
 	    titre,
         id_fermier,
@@ -242,10 +249,18 @@ func UpdateChaufer(db *sqlx.DB, ch *Chaufer, idsUG []int) (err error) {
 		return werr.Wrapf(err, "Erreur appel updateLiensChantierParcelle()")
 	}
 	//
+	err = insertAudit(db, "chaufer", ch.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteChaufer(db *sqlx.DB, id int) (err error) {
+func DeleteChaufer(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "chaufer", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	//
 	// delete associations avec UGs, Parcelles
 	//
@@ -266,5 +281,9 @@ func DeleteChaufer(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "chaufer", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -11,7 +11,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -66,7 +65,7 @@ func (ch *Chautre) FullString() string {
 
 // Renvoie un chantier autres valorisations
 // contenant uniquement les données stockées en base
-func GetChautre(db *sqlx.DB, idChantier int) (ch *Chautre, err error) {
+func GetChautre(db DBOrTx, idChantier int) (ch *Chautre, err error) {
 	ch = &Chautre{}
 	query := "select * from chautre where id=$1"
 	row := db.QueryRowx(query, idChantier)
@@ -84,7 +83,7 @@ func GetChautre(db *sqlx.DB, idChantier int) (ch *Chautre, err error) {
 //   - les parcelles
 //   - les lieux-dits
 //   - les fermiers
-func GetChautreFull(db *sqlx.DB, idChantier int) (ch *Chautre, err error) {
+func GetChautreFull(db DBOrTx, idChantier int) (ch *Chautre, err error) {
 	ch, err = GetChautre(db, idChantier)
 	if err != nil {
 		return ch, werr.Wrapf(err, "Erreur appel GetChautre()")
@@ -118,7 +117,7 @@ func GetChautreFull(db *sqlx.DB, idChantier int) (ch *Chautre, err error) {
 
 // Renvoie la liste des années ayant des chantiers autres valorisations,
 // @param exclude   Année à exclure du résultat
-func GetChautreDifferentYears(db *sqlx.DB, exclude string) (res []string, err error) {
+func GetChautreDifferentYears(db DBOrTx, exclude string) (res []string, err error) {
 	res = []string{}
 	list := []time.Time{}
 	query := "select datecontrat from chautre order by datecontrat desc"
@@ -138,7 +137,7 @@ func GetChautreDifferentYears(db *sqlx.DB, exclude string) (res []string, err er
 // Renvoie la liste des chantiers autres valorisations pour une année donnée,
 // triés par ordre chronologique inverse.
 // Chaque chantier contient les mêmes champs que ceux renvoyés par GetChautreFull()
-func GetChautresOfYear(db *sqlx.DB, annee string) (res []*Chautre, err error) {
+func GetChautresOfYear(db DBOrTx, annee string) (res []*Chautre, err error) {
 	res = []*Chautre{}
 	type ligne struct {
 		Id          int
@@ -162,7 +161,7 @@ func GetChautresOfYear(db *sqlx.DB, annee string) (res []*Chautre, err error) {
 
 // ************************** Compute *******************************
 
-func (ch *Chautre) ComputeAcheteur(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeAcheteur(db DBOrTx) (err error) {
 	if ch.Acheteur != nil {
 		return nil // déjà calculé
 	}
@@ -173,7 +172,7 @@ func (ch *Chautre) ComputeAcheteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chautre) ComputeUGs(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeUGs(db DBOrTx) (err error) {
 	if len(ch.UGs) != 0 {
 		return nil // déjà calculé
 	}
@@ -184,7 +183,7 @@ func (ch *Chautre) ComputeUGs(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chautre) ComputeLiensParcelles(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeLiensParcelles(db DBOrTx) (err error) {
 	if len(ch.LiensParcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -195,7 +194,7 @@ func (ch *Chautre) ComputeLiensParcelles(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chautre) ComputeLieudits(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeLieudits(db DBOrTx) (err error) {
 	if len(ch.Lieudits) != 0 {
 		return nil // déjà calculé
 	}
@@ -206,7 +205,7 @@ func (ch *Chautre) ComputeLieudits(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chautre) ComputeFermiers(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeFermiers(db DBOrTx) (err error) {
 	if len(ch.Fermiers) != 0 {
 		return nil // déjà calculé
 	}
@@ -217,7 +216,7 @@ func (ch *Chautre) ComputeFermiers(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Chautre) ComputeProprietaires(db *sqlx.DB) (err error) {
+func (ch *Chautre) ComputeProprietaires(db DBOrTx) (err error) {
 	if len(ch.Proprietaires) != 0 {
 		return nil // déjà calculé
 	}
@@ -242,7 +241,7 @@ func (ch *Chautre) ComputeProprietaires(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertChautre(db *sqlx.DB, ch *Chautre, idsUG, idsLieudit, idsFermier []int) (idChantier int, err error) {
+func InsertChautre(db DBOrTx, ch *Chautre, idsUG, idsLieudit, idsFermier []int) (idChantier int, err error) {
 	query := `insert into chautre(
         titre,
         id_acheteur,
@@ -306,10 +305,18 @@ func InsertChautre(db *sqlx.DB, ch *Chautre, idsUG, idsLieudit, idsFermier []int
 		return idChantier, werr.Wrapf(err, "Erreur appel insertLiensChantierFermier()")
 	}
 	//
+	err = insertAudit(db, "chautre", idChantier, AUDIT_INSERT, "")
+	if err != nil {
+		return idChantier, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return idChantier, nil
 }
 
-func UpdateChautre(db *sqlx.DB, ch *Chautre, idsUG, idsLieudit, idsFermier []int) (err error) {
+func UpdateChautre(db DBOrTx, ch *Chautre, idsUG, idsLieudit, idsFermier []int) (err error) {
+	avant, err := auditEtat(db, "chautre", ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update chautre set(
         titre,
         id_acheteur,
@@ -373,10 +380,18 @@ func UpdateChautre(db *sqlx.DB, ch *Chautre, idsUG, idsLieudit, idsFermier []int
 		return werr.Wrapf(err, "Erreur appel updateLiensChantierFermier()")
 	}
 	//
+	err = insertAudit(db, "chautre", ch.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteChautre(db *sqlx.DB, id int) (err error) {
+func DeleteChautre(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "chautre", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	//
 	// delete associations avec UGs, Parcelles, Lieudits, Fermiers
 	//
@@ -407,5 +422,9 @@ func DeleteChautre(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "chautre", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -0,0 +1,426 @@
+/*
+Vérification de la cohérence des données.
+
+Chaque règle liste les anomalies trouvées dans la base, avec un lien vers l'enregistrement concerné.
+Les règles ne modifient pas la base ; la correction se fait à la main, à partir des anomalies listées.
+Utilisé par la page /coherence et par manage/check.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ecart toléré entre deux quantités de plaquettes, en maps
+const TOLERANCE_STOCK = 0.01
+
+type RegleCoherence struct {
+	Code     string
+	Label    string
+	verifier func(db DBOrTx) ([]*AnomalieCoherence, error)
+}
+
+type AnomalieCoherence struct {
+	Message string
+	URL     string // vide si pas d'enregistrement à afficher
+}
+
+type ResultatCoherence struct {
+	Regle     *RegleCoherence
+	Anomalies []*AnomalieCoherence
+}
+
+// Liste des règles, dans l'ordre d'exécution
+var ReglesCoherence = []*RegleCoherence{
+	{"acteurs-speciaux", "Les acteurs SCTL, BDL et GFA existent", verifierActeursSpeciaux},
+	{"tas-stock", "Les mouvements de stock des tas correspondent aux transports et aux chargements", verifierStockTas},
+	{"tas-vides", "Les tas signalés vides n'ont plus de stock", verifierTasVides},
+	{"tas-mouvements", "Pas de transport, transfert ni chargement après le vidage d'un tas", verifierMouvementsTasVides},
+	{"liens-chantiers", "Les liens chantier - UG / parcelle / lieu-dit / fermier pointent vers un chantier existant", verifierLiensChantiers},
+	{"liens-cibles", "Les UGs, parcelles, lieux-dits et fermiers liés aux chantiers existent", verifierCiblesLiensChantiers},
+	{"surface-parcelles", "La surface exploitée d'une parcelle ne dépasse pas la surface de la parcelle", verifierSurfacesParcelles},
+	{"lieudits-doublons", "Pas de lieux-dits en double dans une commune (données SCTL)", verifierLieuditsDoublons},
+}
+
+// Tables de liens entre chantiers et autres entités, avec la table et le champ de l'entité liée
+var liensChantiersCoherence = []struct {
+	Table, TableCible, Champ string
+}{
+	{"chantier_ug", "ug", "id_ug"},
+	{"chantier_parcelle", "parcelle", "id_parcelle"},
+	{"chantier_lieudit", "lieudit", "id_lieudit"},
+	{"chantier_fermier", "fermier", "id_fermier"},
+}
+
+// Types de chantier (= nom de la table du chantier)
+var typesChantierCoherence = []string{"plaq", "chautre", "chaufer"}
+
+// Renvoie la règle correspondant à code, nil si inexistante
+func GetRegleCoherence(code string) *RegleCoherence {
+	for _, regle := range ReglesCoherence {
+		if regle.Code == code {
+			return regle
+		}
+	}
+	return nil
+}
+
+// Exécute les règles passées en paramètre (toutes les règles si regles est vide)
+func VerifierCoherence(db DBOrTx, regles []*RegleCoherence) (res []*ResultatCoherence, err error) {
+	if len(regles) == 0 {
+		regles = ReglesCoherence
+	}
+	res = []*ResultatCoherence{}
+	for _, regle := range regles {
+		anomalies, err := regle.verifier(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur vérification règle "+regle.Code)
+		}
+		res = append(res, &ResultatCoherence{Regle: regle, Anomalies: anomalies})
+	}
+	return res, nil
+}
+
+func NbAnomaliesCoherence(res []*ResultatCoherence) (nb int) {
+	for _, r := range res {
+		nb += len(r.Anomalies)
+	}
+	return nb
+}
+
+// ************************** Règles *******************************
+
+func verifierActeursSpeciaux(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	speciaux := []struct {
+		Id  int
+		Nom string
+	}{
+		{ID_SCTL, "SCTL"},
+		{ID_BDL, "BDL"},
+		{ID_GFA, "GFA"},
+	}
+	var nb int
+	query := "select count(*) from acteur where id=$1"
+	for _, s := range speciaux {
+		err = db.Get(&nb, query, s.Id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		if nb == 0 {
+			res = append(res, &AnomalieCoherence{
+				Message: "L'acteur " + s.Nom + " (id " + strconv.Itoa(s.Id) + ") n'existe pas",
+				URL:     "/acteur/liste",
+			})
+		}
+	}
+	return res, nil
+}
+
+// Compare les mouvements de stock de type transport et chargement des tas
+// aux quantités transportées (après perte au séchage) moins les quantités chargées
+func verifierStockTas(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		Id         int
+		IdChantier int `db:"id_chantier"`
+		Mouvements float64
+		Entrees    float64
+		Sorties    float64
+	}{}
+	query := `select t.id, t.id_chantier,
+        coalesce((select sum(qte) from mouvementstock where id_tas=t.id and typemvt in($1,$2)), 0) as mouvements,
+        coalesce((select sum(qte * (100 - pourcentperte) / 100) from plaqtrans where id_tas=t.id), 0) as entrees,
+        coalesce((select sum(qte) from ventecharge where id_tas=t.id), 0) as sorties
+        from tas t order by t.id`
+	err = db.Select(&lignes, query, MVT_TRANSPORT, MVT_CHARGEMENT)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		calcule := l.Entrees - l.Sorties
+		if math.Abs(l.Mouvements-calcule) <= TOLERANCE_STOCK {
+			continue
+		}
+		res = append(res, &AnomalieCoherence{
+			Message: fmt.Sprintf("%s : mouvements transports et chargements %.2f maps, transports - chargements = %.2f maps",
+				nomTasCoherence(db, l.Id), l.Mouvements, calcule),
+			URL: "/chantier/plaquette/" + strconv.Itoa(l.IdChantier),
+		})
+	}
+	return res, nil
+}
+
+func verifierTasVides(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		Id         int
+		IdChantier int `db:"id_chantier"`
+		Stock      float64
+		DateVidage time.Time
+	}{}
+	query := `select id, id_chantier, stock, datevidage from (` + SELECT_TAS + ` where not actif) t
+        where abs(stock) > $1 order by id`
+	err = db.Select(&lignes, query, TOLERANCE_STOCK)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		res = append(res, &AnomalieCoherence{
+			Message: fmt.Sprintf("%s : signalé vide le %s, mais stock restant %.2f maps",
+				nomTasCoherence(db, l.Id), l.DateVidage.Format("02/01/2006"), l.Stock),
+			URL: "/chantier/plaquette/" + strconv.Itoa(l.IdChantier),
+		})
+	}
+	return res, nil
+}
+
+func verifierMouvementsTasVides(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		IdTas      int `db:"id_tas"`
+		Label      string
+		URL        string
+		DateMvt    time.Time `db:"datemvt"`
+		DateVidage time.Time
+	}{}
+	query := `select t.id as id_tas, 'Transport' as label, '/chantier/plaquette/' || pt.id_chantier as url,
+            pt.datetrans as datemvt, t.datevidage
+        from plaqtrans pt join tas t on pt.id_tas=t.id
+        where not t.actif and pt.datetrans > t.datevidage
+        union all
+        select t.id as id_tas, 'Transfert' as label, '/chantier/plaquette/' || tf.id_chantier || '/chantiers' as url,
+            tf.datetransfert as datemvt, t.datevidage
+        from plaqtransfert tf join tas t on t.id in(tf.id_tas_origine, tf.id_tas_destination)
+        where not t.actif and tf.datetransfert > t.datevidage
+        union all
+        select t.id as id_tas, 'Chargement' as label, '/vente/' || vl.id_vente as url,
+            vc.datecharge as datemvt, t.datevidage
+        from ventecharge vc join tas t on vc.id_tas=t.id join ventelivre vl on vc.id_livraison=vl.id
+        where not t.actif and vc.datecharge > t.datevidage
+        order by id_tas, datemvt`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		res = append(res, &AnomalieCoherence{
+			Message: fmt.Sprintf("%s : signalé vide le %s, mais %s le %s",
+				nomTasCoherence(db, l.IdTas), l.DateVidage.Format("02/01/2006"),
+				strings.ToLower(l.Label), l.DateMvt.Format("02/01/2006")),
+			URL: l.URL,
+		})
+	}
+	return res, nil
+}
+
+// Liens vers des chantiers supprimés ou de type inconnu
+func verifierLiensChantiers(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	existe := []string{}
+	for _, typeChantier := range typesChantierCoherence {
+		existe = append(existe, "(l.type_chantier='"+typeChantier+"' and exists(select 1 from "+typeChantier+" where id=l.id_chantier))")
+	}
+	for _, lien := range liensChantiersCoherence {
+		lignes := []struct {
+			TypeChantier string `db:"type_chantier"`
+			IdChantier   int    `db:"id_chantier"`
+			Nb           int
+		}{}
+		query := `select coalesce(l.type_chantier, '') as type_chantier, l.id_chantier, count(*) as nb
+            from ` + lien.Table + ` l
+            where not coalesce(` + strings.Join(existe, " or ") + `, false)
+            group by l.type_chantier, l.id_chantier order by l.type_chantier, l.id_chantier`
+		err = db.Select(&lignes, query)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		for _, l := range lignes {
+			res = append(res, &AnomalieCoherence{
+				Message: fmt.Sprintf("Table %s : %d lien(s) vers %s, qui n'existe pas",
+					lien.Table, l.Nb, labelChantierCoherence(l.TypeChantier, l.IdChantier)),
+			})
+		}
+	}
+	return res, nil
+}
+
+// Liens de chantiers vers des UGs, parcelles, lieux-dits ou fermiers inexistants
+// (ex : chantier plaquettes associé à un fermier qui n'existe pas)
+func verifierCiblesLiensChantiers(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		TypeChantier string `db:"type_chantier"`
+		IdChantier   int    `db:"id_chantier"`
+		IdCible      int    `db:"id_cible"`
+	}{}
+	for _, lien := range liensChantiersCoherence {
+		lignes = lignes[:0]
+		query := `select l.type_chantier, l.id_chantier, l.` + lien.Champ + ` as id_cible
+            from ` + lien.Table + ` l
+            where not exists(select 1 from ` + lien.TableCible + ` c where c.id=l.` + lien.Champ + `)
+            order by l.type_chantier, l.id_chantier, l.` + lien.Champ
+		err = db.Select(&lignes, query)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		for _, l := range lignes {
+			res = append(res, &AnomalieCoherence{
+				Message: fmt.Sprintf("%s lié à %s %d, qui n'existe pas",
+					labelChantierCoherence(l.TypeChantier, l.IdChantier), lien.TableCible, l.IdCible),
+				URL: urlChantier(l.TypeChantier, l.IdChantier),
+			})
+		}
+	}
+	// chaufer contient directement id_fermier
+	lignes = lignes[:0]
+	query := `select 'chaufer' as type_chantier, id as id_chantier, id_fermier as id_cible from chaufer c
+        where not exists(select 1 from fermier f where f.id=c.id_fermier) order by id`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		res = append(res, &AnomalieCoherence{
+			Message: fmt.Sprintf("%s lié à fermier %d, qui n'existe pas",
+				labelChantierCoherence(l.TypeChantier, l.IdChantier), l.IdCible),
+			URL: urlChantier(l.TypeChantier, l.IdChantier),
+		})
+	}
+	return res, nil
+}
+
+func verifierSurfacesParcelles(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		TypeChantier    string `db:"type_chantier"`
+		IdChantier      int    `db:"id_chantier"`
+		IdParcelle      int    `db:"id_parcelle"`
+		Code            string
+		Surface         float64
+		SurfaceParcelle float64 `db:"surface_parcelle"`
+	}{}
+	query := `select cp.type_chantier, cp.id_chantier, cp.id_parcelle, p.code, cp.surface, p.surface as surface_parcelle
+        from chantier_parcelle cp join parcelle p on cp.id_parcelle=p.id
+        where not cp.entiere and p.surface is not null and cp.surface > p.surface
+        order by cp.type_chantier, cp.id_chantier, cp.id_parcelle`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range lignes {
+		res = append(res, &AnomalieCoherence{
+			Message: fmt.Sprintf("%s : parcelle %s exploitée sur %.4f ha, alors que sa surface est %.4f ha",
+				labelChantierCoherence(l.TypeChantier, l.IdChantier), strings.TrimSpace(l.Code), l.Surface, l.SurfaceParcelle),
+			URL: urlChantier(l.TypeChantier, l.IdChantier),
+		})
+	}
+	return res, nil
+}
+
+// Lieux-dits d'une même commune dont les noms ne diffèrent que par
+// les accents, la casse, les espaces ou le pluriel (ex : SERRES DES ARETS / SERRE DES ARETS).
+func verifierLieuditsDoublons(db DBOrTx) (res []*AnomalieCoherence, err error) {
+	lignes := []struct {
+		IdCommune  int `db:"id_commune"`
+		NomCommune string
+		Id         int
+		Nom        string
+	}{}
+	query := `select cl.id_commune, c.nom as nomcommune, l.id, l.nom
+        from lieudit l
+        join commune_lieudit cl on cl.id_lieudit=l.id
+        join commune c on cl.id_commune=c.id
+        order by c.nom, l.id`
+	err = db.Select(&lignes, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	type cle struct {
+		IdCommune int
+		Nom       string
+	}
+	groupes := map[cle][]int{}
+	cles := []cle{} // pour garder l'ordre de la requête
+	noms := map[int]string{}
+	communes := map[cle]string{}
+	for _, l := range lignes {
+		k := cle{l.IdCommune, normaliserNomLieudit(l.Nom)}
+		if _, ok := groupes[k]; !ok {
+			cles = append(cles, k)
+		}
+		groupes[k] = append(groupes[k], l.Id)
+		noms[l.Id] = l.Nom
+		communes[k] = l.NomCommune
+	}
+	for _, k := range cles {
+		ids := groupes[k]
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Ints(ids)
+		libelles := []string{}
+		for _, id := range ids {
+			libelles = append(libelles, noms[id]+" ("+strconv.Itoa(id)+")")
+		}
+		res = append(res, &AnomalieCoherence{
+			Message: "Commune " + communes[k] + " : lieux-dits " + strings.Join(libelles, ", "),
+			URL:     "/lieudit/" + strconv.Itoa(ids[0]),
+		})
+	}
+	return res, nil
+}
+
+// ************************** Auxiliaires *******************************
+
+var remplacementAccentsLieudit = strings.NewReplacer(
+	"À", "A", "Â", "A", "Ä", "A",
+	"É", "E", "È", "E", "Ê", "E", "Ë", "E",
+	"Î", "I", "Ï", "I",
+	"Ô", "O", "Ö", "O",
+	"Ù", "U", "Û", "U", "Ü", "U",
+	"Ç", "C",
+	"-", " ", "'", " ",
+)
+
+func normaliserNomLieudit(nom string) string {
+	mots := strings.Fields(remplacementAccentsLieudit.Replace(strings.ToUpper(nom)))
+	for i, mot := range mots {
+		if len(mot) > 3 {
+			mots[i] = strings.TrimRight(mot, "SX")
+		}
+	}
+	return strings.Join(mots, " ")
+}
+
+// Nom du tas, ou son id si le nom ne peut pas être calculé (chantier ou stockage inexistant)
+func nomTasCoherence(db DBOrTx, id int) string {
+	tas, err := GetTasFull(db, id)
+	if err != nil {
+		return "Tas " + strconv.Itoa(id)
+	}
+	return "Tas " + tas.Nom
+}
+
+func labelChantierCoherence(typeChantier string, id int) string {
+	label, ok := AuditEntiteMap[typeChantier]
+	if !ok {
+		label = "Chantier de type inconnu \"" + typeChantier + "\""
+	}
+	return label + " " + strconv.Itoa(id)
+}
+
+func urlChantier(typeChantier string, id int) string {
+	switch typeChantier {
+	case "plaq":
+		return "/chantier/plaquette/" + strconv.Itoa(id)
+	case "chautre":
+		return "/chantier/autre/" + strconv.Itoa(id)
+	case "chaufer":
+		return "/chantier/chauffage-fermier/" + strconv.Itoa(id)
+	}
+	return ""
+}
@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 )
 
 type Commune struct {
@@ -31,7 +30,7 @@ func (c *Commune) String() string {
 // ************************** Get one *******************************
 // Renvoie une Commune contenant Id et Nom.
 // Les autres champs ne sont pas remplis.
-func GetCommune(db *sqlx.DB, id int) (commune *Commune, err error) {
+func GetCommune(db DBOrTx, id int) (commune *Commune, err error) {
 	commune = &Commune{}
 	query := "select * from commune where id=$1"
 	row := db.QueryRowx(query, id)
@@ -46,7 +45,7 @@ func GetCommune(db *sqlx.DB, id int) (commune *Commune, err error) {
 
 // Renvoie une liste de communes triés en utilisant un champ de la table
 // @param field    Champ de la table commune utilisé pour le tri
-func GetSortedCommunes(db *sqlx.DB, field string) (communes []*Commune, err error) {
+func GetSortedCommunes(db DBOrTx, field string) (communes []*Commune, err error) {
 	communes = []*Commune{}
 	query := "select * from commune order by " + field
 	err = db.Select(&communes, query)
@@ -57,7 +56,7 @@ func GetSortedCommunes(db *sqlx.DB, field string) (communes []*Commune, err erro
 }
 
 // Renvoie la liste de toutes les communes avec leurs lieux-dits
-func ListCommunesEtLieudits(db *sqlx.DB) (communes []*Commune, err error) {
+func ListCommunesEtLieudits(db DBOrTx) (communes []*Commune, err error) {
 	communes = make([]*Commune, N_COMMUNES)
 	query := "select * from commune"
 	rows, err := db.Queryx(query)
@@ -0,0 +1,477 @@
+/*
+Export comptable des ventes et des achats d'une période,
+au format FEC (fichier des écritures comptables) ou en journal CSV.
+
+Ventes : factures des ventes plaquettes et des chantiers autres valorisations.
+Les factures du registre (cf facture.go) sont utilisées, avoirs compris ;
+pour les ventes facturées sans passer par le registre, la facture est recalculée à partir de la vente.
+
+Achats : coûts des activités des intervenants extérieurs
+(opérations simples, transports, rangements, chargements, livraisons).
+Une écriture par activité ; la pièce est le numéro de l'affacture si l'activité a été affacturée.
+
+Les montants sont ventilés par taux de TVA, sur les comptes définis dans config.yml (section compta).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Une ligne d'écriture comptable, avec les champs du FEC
+type LigneCompta struct {
+	JournalCode  string
+	JournalLib   string
+	EcritureNum  int
+	EcritureDate time.Time
+	CompteNum    string
+	CompteLib    string
+	CompAuxNum   string
+	CompAuxLib   string
+	PieceRef     string
+	PieceDate    time.Time
+	EcritureLib  string
+	Debit        float64
+	Credit       float64
+}
+
+type ExportCompta struct {
+	DateDebut   time.Time
+	DateFin     time.Time
+	Lignes      []*LigneCompta
+	TotalDebit  float64
+	TotalCredit float64
+	// Problèmes rencontrés (taux de TVA ou compte absent de la configuration...)
+	Anomalies []string
+	// Numéro provisoire de la dernière écriture, avant le tri final
+	nbEcritures int
+}
+
+// Colonnes du FEC, dans l'ordre imposé par l'administration fiscale
+var ColonnesFEC = []string{
+	"JournalCode", "JournalLib", "EcritureNum", "EcritureDate", "CompteNum", "CompteLib",
+	"CompAuxNum", "CompAuxLib", "PieceRef", "PieceDate", "EcritureLib", "Debit", "Credit",
+	"EcritureLet", "DateLet", "ValidDate", "Montantdevise", "Idevise",
+}
+
+// Colonnes du journal CSV si config.yml ne précise rien
+var colonnesCSVDefaut = []string{
+	"JournalCode", "EcritureDate", "CompteNum", "CompAuxNum", "PieceRef", "EcritureLib", "Debit", "Credit",
+}
+
+// Activités donnant lieu à une écriture d'achat
+// - typeActivite : expression SQL donnant le code d'activité, comme dans affactureitem
+// - montantHT : expression SQL du montant HT, comme dans Affacture.ComputeItems()
+type achatCompta struct {
+	table        string
+	typeActivite string
+	colActeur    string
+	colDate      string
+	montantHT    string
+	colTVA       string
+	condition    string
+	libelle      string
+}
+
+var achatsCompta = []achatCompta{
+	{"plaqop", "t.typop", "id_acteur", "datedeb", "t.qte*t.puht", "tva", "", ""},
+	{"plaqtrans", "'TR'", "id_transporteur", "datetrans", "t.glprix", "gltva", "", ""},
+	{"plaqtrans", "'TR-CO'", "id_conducteur", "datetrans", "t.conheure*t.coprixh", "cotva", "", "conducteur"},
+	{"plaqtrans", "'TR-OU'", "id_proprioutil", "datetrans", "t.cankm*t.caprixkm", "catva", "t.typecout='C'", "camion"},
+	{"plaqtrans", "'TR-OU'", "id_proprioutil", "datetrans", "t.tbnbenne*t.tbduree*t.tbprixh", "tbtva", "t.typecout<>'C'", "tracteur + benne"},
+	{"plaqrange", "'RG'", "id_rangeur", "daterange", "t.glprix", "gltva", "", ""},
+	{"plaqrange", "'RG-CO'", "id_conducteur", "daterange", "t.conheure*t.coprixh", "cotva", "", "conducteur"},
+	{"plaqrange", "'RG-OU'", "id_proprioutil", "daterange", "t.ouprix", "outva", "", "outil"},
+	{"plaqtransfert", "'TF'", "id_transporteur", "datetransfert", "t.glprix", "gltva", "", ""},
+	{"plaqtransfert", "'TF-CO'", "id_conducteur", "datetransfert", "t.conheure*t.coprixh", "cotva", "", "conducteur"},
+	{"plaqtransfert", "'TF-OU'", "id_proprioutil", "datetransfert", "t.ouprix", "outva", "", "outil"},
+	{"ventecharge", "'CG'", "id_chargeur", "datecharge", "t.glprix", "gltva", "", ""},
+	{"ventecharge", "'CG-CO'", "id_conducteur", "datecharge", "t.monheure*t.moprixh", "motva", "", "conducteur"},
+	{"ventecharge", "'CG-OU'", "id_proprioutil", "datecharge", "t.ouprix", "outva", "", "outil"},
+	{"ventelivre", "'LV'", "id_livreur", "datelivre", "t.glprix", "gltva", "", ""},
+	{"ventelivre", "'LV-CO'", "id_conducteur", "datelivre", "t.monheure*t.moprixh", "motva", "", "conducteur"},
+	{"ventelivre", "'LV-OU'", "id_proprioutil", "datelivre", "t.ouprix", "outva", "", "outil"},
+}
+
+// ************************** Calcul *******************************
+
+// Calcule les écritures comptables des ventes et des achats d'une période.
+func ComputeExportCompta(db DBOrTx, config *Config, dateDebut, dateFin time.Time) (res *ExportCompta, err error) {
+	res = &ExportCompta{DateDebut: dateDebut, DateFin: dateFin}
+	acteurs := map[int]*Acteur{}
+	err = res.computeVentes(db, config)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel ExportCompta.computeVentes()")
+	}
+	err = res.computeAchats(db, config, acteurs)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel ExportCompta.computeAchats()")
+	}
+	// Numérotation continue des écritures, par journal puis par date
+	sort.SliceStable(res.Lignes, func(i, j int) bool {
+		li, lj := res.Lignes[i], res.Lignes[j]
+		if li.JournalCode != lj.JournalCode {
+			return li.JournalCode == config.Compta.JournalVentes // ventes avant achats
+		}
+		if !li.EcritureDate.Equal(lj.EcritureDate) {
+			return li.EcritureDate.Before(lj.EcritureDate)
+		}
+		return li.EcritureNum < lj.EcritureNum
+	})
+	num, precedent := 0, -1
+	for _, ligne := range res.Lignes {
+		if ligne.EcritureNum != precedent {
+			num++
+			precedent = ligne.EcritureNum
+		}
+		ligne.EcritureNum = num
+		res.TotalDebit = arrondiCentime(res.TotalDebit + ligne.Debit)
+		res.TotalCredit = arrondiCentime(res.TotalCredit + ligne.Credit)
+	}
+	return res, nil
+}
+
+// Ecritures de ventes : une écriture par facture ou avoir
+func (e *ExportCompta) computeVentes(db DBOrTx, config *Config) (err error) {
+	factures := []*Facture{}
+	// Factures du registre
+	ids := []int{}
+	query := "select id from facture where datefacture>=$1 and datefacture<=$2 order by datefacture, numero"
+	err = db.Select(&ids, query, e.DateDebut, e.DateFin)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, id := range ids {
+		f, err := GetFactureFull(db, id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetFactureFull()")
+		}
+		factures = append(factures, f)
+	}
+	// Ventes facturées hors registre
+	query = `select id from venteplaq where datefacture>=$1 and datefacture<=$2
+        and id not in(select id_origine from facture where typeorigine='venteplaq')`
+	ids = []int{}
+	err = db.Select(&ids, query, e.DateDebut, e.DateFin)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, id := range ids {
+		vp, err := GetVentePlaqFull(db, id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetVentePlaqFull()")
+		}
+		factures = append(factures, NewFactureVentePlaq(vp))
+	}
+	query = `select id from chautre where datefacture>=$1 and datefacture<=$2
+        and id not in(select id_origine from facture where typeorigine='chautre')`
+	ids = []int{}
+	err = db.Select(&ids, query, e.DateDebut, e.DateFin)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, id := range ids {
+		ch, err := GetChautreFull(db, id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetChautreFull()")
+		}
+		factures = append(factures, NewFactureChautre(ch))
+	}
+	//
+	tauxAutorises := append([]float64{config.TVABDL.Livraison, config.TVABDL.VentePlaquettes}, config.TVABDL.AutresValorisations...)
+	for _, f := range factures {
+		if f.Numero == "" {
+			e.Anomalies = append(e.Anomalies, "Vente facturée le "+tiglib.DateFr(f.DateFacture)+" sans numéro de facture : "+f.Client)
+		}
+		client := strings.Split(f.Client, "\n")[0]
+		e.nbEcritures++
+		base := LigneCompta{
+			JournalCode:  config.Compta.JournalVentes,
+			JournalLib:   "Ventes",
+			EcritureNum:  e.nbEcritures,
+			EcritureDate: f.DateFacture,
+			PieceRef:     f.Numero,
+			PieceDate:    f.DateFacture,
+			EcritureLib:  f.String() + " - " + client,
+		}
+		// client
+		e.ajouterLigne(base, config.Compta.CompteClients, "Clients", strconv.Itoa(f.IdClient), client, f.TotalTTC, false)
+		// produits, par compte et par taux
+		type cle struct {
+			compte string
+			taux   float64
+		}
+		produits := map[cle]float64{}
+		cles := []cle{}
+		for _, ligne := range f.Lignes {
+			compte := config.Compta.CompteVenteAutres
+			if f.TypeOrigine == "venteplaq" {
+				compte = config.Compta.CompteVentePlaquettes
+				if ligne.Designation == "Livraison" {
+					compte = config.Compta.CompteVenteLivraison
+				}
+			}
+			k := cle{compte, ligne.TauxTVA}
+			if _, ok := produits[k]; !ok {
+				cles = append(cles, k)
+			}
+			produits[k] += ligne.MontantHT
+		}
+		for _, k := range cles {
+			e.ajouterLigne(base, k.compte, "Ventes", "", "", produits[k], true)
+		}
+		// TVA collectée, par taux
+		for _, tva := range f.TVAs() {
+			e.verifierTaux(tva.Taux, tauxAutorises, "tva-bdl", base.EcritureLib)
+			compte := e.compteTVA(config.Compta.TVACollectee, tva.Taux, "tva-collectee")
+			e.ajouterLigne(base, compte, "TVA collectée "+formatTaux(tva.Taux)+"%", "", "", tva.Montant, true)
+		}
+	}
+	return nil
+}
+
+// Ecritures d'achats : une écriture par activité d'un intervenant extérieur (BDL exclu)
+func (e *ExportCompta) computeAchats(db DBOrTx, config *Config, acteurs map[int]*Acteur) (err error) {
+	type ligneAchat struct {
+		Id           int
+		TypeActivite string
+		IdActeur     int `db:"id_acteur"`
+		DateActivite time.Time
+		MontantHT    float64
+		TauxTVA      float64
+		Numero       string
+	}
+	for _, achat := range achatsCompta {
+		query := fmt.Sprintf(`select t.id, %[2]s as typeactivite, t.%[3]s as id_acteur, t.%[4]s as dateactivite,
+            coalesce(%[5]s, 0) as montantht, coalesce(t.%[6]s, 0) as tauxtva, coalesce(a.numero, '') as numero
+        from %[1]s t
+            left join affactureitem ai on ai.typeactivite=%[2]s and ai.id_ligne=t.id
+            left join affacture a on ai.id_affacture=a.id
+        where t.%[4]s>=$1 and t.%[4]s<=$2 and t.%[3]s<>0 and t.%[3]s<>$3 and coalesce(%[5]s, 0)<>0`,
+			achat.table, achat.typeActivite, achat.colActeur, achat.colDate, achat.montantHT, achat.colTVA)
+		if achat.condition != "" {
+			query += " and " + achat.condition
+		}
+		lignes := []*ligneAchat{}
+		err = db.Select(&lignes, query, e.DateDebut, e.DateFin, ID_BDL)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query DB : "+query)
+		}
+		for _, l := range lignes {
+			if _, ok := acteurs[l.IdActeur]; !ok {
+				acteurs[l.IdActeur], err = GetActeur(db, l.IdActeur)
+				if err != nil {
+					return werr.Wrapf(err, "Erreur appel GetActeur()")
+				}
+			}
+			acteur := acteurs[l.IdActeur].String()
+			codeActivite := strings.Split(l.TypeActivite, "-")[0]
+			libelle := LabelActivite(codeActivite)
+			if achat.libelle != "" {
+				libelle += " " + achat.libelle
+			}
+			piece := l.Numero
+			if piece == "" {
+				piece = l.TypeActivite + "-" + strconv.Itoa(l.Id)
+			}
+			e.nbEcritures++
+			base := LigneCompta{
+				JournalCode:  config.Compta.JournalAchats,
+				JournalLib:   "Achats",
+				EcritureNum:  e.nbEcritures,
+				EcritureDate: l.DateActivite,
+				PieceRef:     piece,
+				PieceDate:    l.DateActivite,
+				EcritureLib:  libelle + " " + tiglib.DateFr(l.DateActivite) + " - " + acteur,
+			}
+			ht := arrondiCentime(l.MontantHT)
+			tva := arrondiCentime(ht * l.TauxTVA / 100)
+			compte, ok := config.Compta.ComptesAchats[codeActivite]
+			if !ok {
+				e.ajouterAnomalie("Compte d'achat absent de config.yml (compta / comptes-achats) pour l'activité " + codeActivite)
+			}
+			e.ajouterLigne(base, compte, "Achats "+LabelActivite(codeActivite), "", "", ht, false)
+			if tva != 0 {
+				e.verifierTaux(l.TauxTVA, config.TVAExt, "tva-ext", base.EcritureLib)
+				compteTVA := e.compteTVA(config.Compta.TVADeductible, l.TauxTVA, "tva-deductible")
+				e.ajouterLigne(base, compteTVA, "TVA déductible "+formatTaux(l.TauxTVA)+"%", "", "", tva, false)
+			}
+			e.ajouterLigne(base, config.Compta.CompteFournisseurs, "Fournisseurs", strconv.Itoa(l.IdActeur), acteur, ht+tva, true)
+		}
+	}
+	return nil
+}
+
+// Ajoute une ligne d'écriture ; un montant négatif (avoir) est passé dans l'autre colonne.
+// @param credit true pour un montant au crédit, false pour un montant au débit
+func (e *ExportCompta) ajouterLigne(base LigneCompta, compte, compteLib, auxNum, auxLib string, montant float64, credit bool) {
+	montant = arrondiCentime(montant)
+	if montant == 0 {
+		return
+	}
+	if montant < 0 {
+		montant, credit = -montant, !credit
+	}
+	ligne := base
+	ligne.CompteNum, ligne.CompteLib = compte, compteLib
+	ligne.CompAuxNum, ligne.CompAuxLib = auxNum, auxLib
+	if credit {
+		ligne.Credit = montant
+	} else {
+		ligne.Debit = montant
+	}
+	e.Lignes = append(e.Lignes, &ligne)
+}
+
+func (e *ExportCompta) compteTVA(comptes map[float64]string, taux float64, champConfig string) string {
+	compte, ok := comptes[taux]
+	if !ok {
+		e.ajouterAnomalie("Compte de TVA absent de config.yml (compta / " + champConfig + ") pour le taux " + formatTaux(taux) + "%")
+	}
+	return compte
+}
+
+func (e *ExportCompta) verifierTaux(taux float64, tauxAutorises []float64, champConfig string, libelle string) {
+	for _, t := range tauxAutorises {
+		if t == taux {
+			return
+		}
+	}
+	e.ajouterAnomalie("Taux de TVA " + formatTaux(taux) + "% absent de config.yml (" + champConfig + ") : " + libelle)
+}
+
+// Ajoute une anomalie, sans doublon
+func (e *ExportCompta) ajouterAnomalie(msg string) {
+	for _, a := range e.Anomalies {
+		if a == msg {
+			return
+		}
+	}
+	e.Anomalies = append(e.Anomalies, msg)
+}
+
+// ************************** Ecriture des fichiers *******************************
+
+// Nom du fichier FEC imposé : SIREN + "FEC" + date de clôture (AAAAMMJJ)
+func (e *ExportCompta) NomFichierFEC(config *Config) string {
+	siren := strings.ReplaceAll(config.Facture.Siret, " ", "")
+	if len(siren) > 9 {
+		siren = siren[:9]
+	}
+	return siren + "FEC" + e.DateFin.Format("20060102") + ".txt"
+}
+
+func (e *ExportCompta) NomFichierCSV() string {
+	return "journal-" + e.DateDebut.Format("20060102") + "-" + e.DateFin.Format("20060102") + ".csv"
+}
+
+// Ecrit le fichier FEC : séparateur |, dates AAAAMMJJ, montants avec virgule décimale
+func (e *ExportCompta) WriteFEC(w io.Writer) (err error) {
+	_, err = io.WriteString(w, strings.Join(ColonnesFEC, "|")+"\r\n")
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	for _, ligne := range e.Lignes {
+		valeurs := make([]string, len(ColonnesFEC))
+		for i, colonne := range ColonnesFEC {
+			valeurs[i] = strings.NewReplacer("|", " ", "\r", " ", "\n", " ").Replace(ligne.valeur(colonne, ","))
+		}
+		_, err = io.WriteString(w, strings.Join(valeurs, "|")+"\r\n")
+		if err != nil {
+			return werr.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// Ecrit le journal CSV, au format défini dans config.yml (compta / csv)
+func (e *ExportCompta) WriteCSV(w io.Writer, config *Config) (err error) {
+	colonnes := config.Compta.CSV.Colonnes
+	if len(colonnes) == 0 {
+		colonnes = colonnesCSVDefaut
+	}
+	for _, colonne := range colonnes {
+		if !tiglib.InArray(colonne, ColonnesFEC) {
+			return errors.New("Colonne inconnue dans config.yml (compta / csv / colonnes) : " + colonne)
+		}
+	}
+	separateur, decimale := config.Compta.CSV.Separateur, config.Compta.CSV.Decimale
+	if separateur == "" {
+		separateur = ";"
+	}
+	if decimale == "" {
+		decimale = ","
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = []rune(separateur)[0]
+	err = cw.Write(colonnes)
+	if err != nil {
+		return werr.Wrap(err)
+	}
+	for _, ligne := range e.Lignes {
+		valeurs := make([]string, len(colonnes))
+		for i, colonne := range colonnes {
+			valeurs[i] = ligne.valeur(colonne, decimale)
+		}
+		err = cw.Write(valeurs)
+		if err != nil {
+			return werr.Wrap(err)
+		}
+	}
+	cw.Flush()
+	return werr.Wrap(cw.Error())
+}
+
+// Valeur d'un champ FEC d'une ligne, formatée pour l'export
+func (l *LigneCompta) valeur(colonne string, decimale string) string {
+	montant := func(x float64) string {
+		return strings.Replace(strconv.FormatFloat(x, 'f', 2, 64), ".", decimale, 1)
+	}
+	switch colonne {
+	case "JournalCode":
+		return l.JournalCode
+	case "JournalLib":
+		return l.JournalLib
+	case "EcritureNum":
+		return strconv.Itoa(l.EcritureNum)
+	case "EcritureDate", "ValidDate":
+		return l.EcritureDate.Format("20060102")
+	case "CompteNum":
+		return l.CompteNum
+	case "CompteLib":
+		return l.CompteLib
+	case "CompAuxNum":
+		return l.CompAuxNum
+	case "CompAuxLib":
+		return l.CompAuxLib
+	case "PieceRef":
+		return l.PieceRef
+	case "PieceDate":
+		return l.PieceDate.Format("20060102")
+	case "EcritureLib":
+		return l.EcritureLib
+	case "Debit":
+		return montant(l.Debit)
+	case "Credit":
+		return montant(l.Credit)
+	}
+	return "" // EcritureLet, DateLet, Montantdevise, Idevise
+}
+
+// Taux de TVA sans décimales inutiles (5.5, 20...)
+func formatTaux(taux float64) string {
+	return strconv.FormatFloat(taux, 'f', -1, 64)
+}
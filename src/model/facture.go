@@ -1,18 +1,108 @@
 /*
-La table facture permet la génération automatique du numéro de facture.
+Registre des factures émises par BDL (ventes de plaquettes et chantiers autres valorisations).
+
+Une facture est une copie figée, faite au moment de son émission, des données nécessaires
+à son impression (client, lignes, taux de TVA, totaux).
+Modifier une vente après émission de sa facture ne modifie donc pas la facture.
+Pour corriger une facture émise, il faut émettre un avoir (qui annule la facture),
+puis émettre une nouvelle facture.
+
+Le statut d'une facture évolue avec les paiements (éventuellement partiels) et les avoirs :
+émise => payée (lorsque les paiements couvrent le montant TTC) ; émise ou payée => annulée (avoir).
+
+La table facturenum permet la génération automatique du numéro de facture.
 
 @copyright  BDL, Bois du Larzac.
 @licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
 @history    2023-02-23 17:55:53+01:00, Thierry Graff : Creation
+@history    2026-10-18 : Ajout du registre des factures
 */
 package model
 
 import (
+	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
+	"errors"
 	"fmt"
-	"github.com/jmoiron/sqlx"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Facture struct {
+	Id               int
+	Numero           string
+	TypeFacture      string // F (facture) ou A (avoir)
+	IdFactureOrigine int    `db:"id_facture_origine"` // pour un avoir, id de la facture annulée
+	TypeOrigine      string // "venteplaq" ou "chautre"
+	IdOrigine        int    `db:"id_origine"`
+	IdClient         int    `db:"id_client"`
+	Client           string // nom et adresse, tels qu'imprimés sur la facture
+	DateFacture      time.Time
+	Statut           string // cf constantes FACTURE_*
+	TotalHT          float64
+	TotalTVA         float64
+	TotalTTC         float64
+	Notes            string // imprimées dans le tableau, sous les lignes
+	Mentions         string // imprimées sous le tableau
+	// Pas stocké en base
+	Lignes         []*FactureLigne
+	Paiements      []*FacturePaiement
+	FactureOrigine *Facture // pour un avoir
+	Avoir          *Facture // pour une facture annulée
+}
+
+type FactureLigne struct {
+	Id          int
+	IdFacture   int `db:"id_facture"`
+	Ordre       int
+	Designation string
+	Quantite    float64
+	Unite       string
+	PUHT        float64
+	TauxTVA     float64
+	MontantHT   float64
+	MontantTVA  float64
+}
+
+type FacturePaiement struct {
+	Id           int
+	IdFacture    int `db:"id_facture"`
+	DatePaiement time.Time
+	Montant      float64
+	Mode         string // cf FacturePaiementModeMap
+	Notes        string
+}
+
+// Montant de TVA d'une facture pour un taux donné
+type FactureTVA struct {
+	Taux    float64
+	BaseHT  float64
+	Montant float64
+}
+
+const (
+	FACTURE_EMISE   = "emise"
+	FACTURE_PAYEE   = "payee"
+	FACTURE_ANNULEE = "annulee"
 )
 
+var FactureStatutMap = map[string]string{
+	FACTURE_EMISE:   "Émise",
+	FACTURE_PAYEE:   "Payée",
+	FACTURE_ANNULEE: "Annulée",
+}
+
+var FacturePaiementModeMap = map[string]string{
+	"virement": "Virement",
+	"cheque":   "Chèque",
+	"especes":  "Espèces",
+	"autre":    "Autre",
+}
+
+// ************************** Numéro *******************************
+
 // Si l'année demandée est déjà présente en base :
 //   - récupère lastnum,
 //   - incrémente de 1,
@@ -25,22 +115,22 @@ import (
 //
 // @param  annee   Format AAAA, ex 2023
 // @return         String du genre "2023054"
-func NouveauNumeroFacture(db *sqlx.DB, annee string) (result string, err error) {
+func NouveauNumeroFacture(db DBOrTx, annee string) (result string, err error) {
 	var lastnum int
-	query := "select lastnum from facture where annee=$1"
+	query := "select lastnum from facturenum where annee=$1"
 	_ = db.Get(&lastnum, query, annee) // empty => lastnum reste = 0
 	// lastnum = 0 si nouvelle année
 	lastnum++
 	if lastnum == 1 {
 		// année pas présente en base
-		query = "insert into facture(annee,lastnum) values($1, $2)"
+		query = "insert into facturenum(annee,lastnum) values($1, $2)"
 		_, err = db.Exec(query, annee, lastnum)
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur query DB : "+query)
 		}
 	} else {
 		// année déjà présente en base
-		query = "update facture set lastnum = $1 where annee=$2"
+		query = "update facturenum set lastnum = $1 where annee=$2"
 		_, err = db.Exec(query, lastnum, annee)
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur query DB : "+query)
@@ -48,3 +138,548 @@ func NouveauNumeroFacture(db *sqlx.DB, annee string) (result string, err error)
 	}
 	return fmt.Sprintf("%s%03d", annee, lastnum), nil
 }
+
+// ************************** Nom *******************************
+
+func (f *Facture) String() string {
+	if f.TypeFacture == "A" {
+		return "Avoir " + f.Numero
+	}
+	return "Facture " + f.Numero
+}
+
+// ************************** Montants *******************************
+
+// Renvoie les montants de TVA regroupés par taux, par taux croissant
+func (f *Facture) TVAs() (res []*FactureTVA) {
+	parTaux := map[float64]*FactureTVA{}
+	for _, ligne := range f.Lignes {
+		if _, ok := parTaux[ligne.TauxTVA]; !ok {
+			parTaux[ligne.TauxTVA] = &FactureTVA{Taux: ligne.TauxTVA}
+			res = append(res, parTaux[ligne.TauxTVA])
+		}
+		parTaux[ligne.TauxTVA].BaseHT += ligne.MontantHT
+		parTaux[ligne.TauxTVA].Montant += ligne.MontantTVA
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Taux < res[j].Taux })
+	return res
+}
+
+// Somme des paiements enregistrés
+// f.Paiements doit avoir été calculé
+func (f *Facture) TotalPaye() (res float64) {
+	for _, p := range f.Paiements {
+		res += p.Montant
+	}
+	return arrondiCentime(res)
+}
+
+// Montant restant à payer (à rembourser pour un avoir)
+// f.Paiements doit avoir été calculé
+func (f *Facture) ResteAPayer() float64 {
+	if f.Statut == FACTURE_ANNULEE {
+		return 0
+	}
+	return arrondiCentime(math.Abs(f.TotalTTC) - f.TotalPaye())
+}
+
+// Ajoute une ligne et met à jour les totaux
+func (f *Facture) ajouterLigne(designation string, quantite float64, unite string, puht, tauxTVA float64) {
+	ligne := &FactureLigne{
+		Ordre:       len(f.Lignes) + 1,
+		Designation: designation,
+		Quantite:    quantite,
+		Unite:       unite,
+		PUHT:        puht,
+		TauxTVA:     tauxTVA,
+		MontantHT:   arrondiCentime(quantite * puht),
+	}
+	ligne.MontantTVA = arrondiCentime(ligne.MontantHT * tauxTVA / 100)
+	f.Lignes = append(f.Lignes, ligne)
+	f.TotalHT = arrondiCentime(f.TotalHT + ligne.MontantHT)
+	f.TotalTVA = arrondiCentime(f.TotalTVA + ligne.MontantTVA)
+	f.TotalTTC = arrondiCentime(f.TotalHT + f.TotalTVA)
+}
+
+func arrondiCentime(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// ************************** Construction *******************************
+
+// Construit la facture d'une vente de plaquettes, à partir des données actuelles de la vente.
+// La facture n'est pas enregistrée en base.
+// @param vp Vente obtenue par GetVentePlaqFull()
+func NewFactureVentePlaq(vp *VentePlaq) (f *Facture) {
+	f = &Facture{
+		Numero:      vp.NumFacture,
+		TypeFacture: "F",
+		TypeOrigine: "venteplaq",
+		IdOrigine:   vp.Id,
+		IdClient:    vp.IdClient,
+		Client:      vp.Client.StringFacture(),
+		DateFacture: vp.DateFacture,
+		Statut:      FACTURE_EMISE,
+	}
+	f.ajouterLigne("Vente de plaquettes forestières", vp.Qte, "MAP", vp.PUHT, vp.TVA)
+	if vp.FactureLivraison {
+		if vp.FactureLivraisonUnite == "map" {
+			f.ajouterLigne("Livraison", vp.Qte, "MAP", vp.FactureLivraisonPUHT, vp.FactureLivraisonTVA)
+		} else {
+			f.ajouterLigne("Livraison", vp.FactureLivraisonNbKm, "KM", vp.FactureLivraisonPUHT, vp.FactureLivraisonTVA)
+		}
+	}
+	if vp.FactureNotes {
+		f.Notes = vp.Notes
+	}
+	if len(vp.Livraisons) != 0 {
+		f.Mentions = "Livraison effectuée par"
+		for _, livraison := range vp.Livraisons {
+			if livraison.TypeCout == "G" { // coût global
+				f.Mentions += "\n- " + livraison.Livreur.String()
+			} else { // coût détaillé
+				f.Mentions += "\n- " + livraison.Conducteur.String()
+			}
+			f.Mentions += ", le " + tiglib.DateFr(livraison.DateLivre)
+		}
+	}
+	return f
+}
+
+// Construit la facture d'un chantier autres valorisations, à partir des données actuelles du chantier.
+// La facture n'est pas enregistrée en base.
+// @param ch Chantier obtenu par GetChautreFull()
+func NewFactureChautre(ch *Chautre) (f *Facture) {
+	f = &Facture{
+		Numero:      ch.NumFacture,
+		TypeFacture: "F",
+		TypeOrigine: "chautre",
+		IdOrigine:   ch.Id,
+		IdClient:    ch.IdAcheteur,
+		Client:      ch.Acheteur.StringFacture(),
+		DateFacture: ch.DateFacture,
+		Statut:      FACTURE_EMISE,
+	}
+	designation := "Vente " + ValoMap[ch.TypeValo] + " - " + EssenceMap[ch.Essence]
+	f.ajouterLigne(designation, ch.VolumeRealise, UniteMap[ch.Unite], ch.PUHT, ch.TVA)
+	return f
+}
+
+// ************************** Emission *******************************
+
+// Enregistre la facture d'une vente de plaquettes dans le registre.
+// Utilise le numéro et la date de facture de la vente s'ils sont disponibles,
+// sinon attribue un nouveau numéro et utilise la date du jour ; la vente est alors mise à jour.
+// Erreur si la vente a déjà une facture non annulée.
+func EmettreFactureVentePlaq(db DBOrTx, idVente int) (id int, err error) {
+	vp, err := GetVentePlaqFull(db, idVente)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel GetVentePlaqFull()")
+	}
+	avant := vp.NumFacture + "|" + vp.DateFacture.String()
+	err = preparerEmission(db, "venteplaq", idVente, &vp.NumFacture, &vp.DateFacture)
+	if err != nil {
+		return 0, err
+	}
+	if avant != vp.NumFacture+"|"+vp.DateFacture.String() {
+		err = UpdateVentePlaq(db, vp)
+		if err != nil {
+			return 0, werr.Wrapf(err, "Erreur appel UpdateVentePlaq()")
+		}
+	}
+	return InsertFacture(db, NewFactureVentePlaq(vp))
+}
+
+// Enregistre la facture d'un chantier autres valorisations dans le registre.
+// Même fonctionnement que EmettreFactureVentePlaq()
+func EmettreFactureChautre(db DBOrTx, idChantier int) (id int, err error) {
+	ch, err := GetChautreFull(db, idChantier)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel GetChautreFull()")
+	}
+	avant := ch.NumFacture + "|" + ch.DateFacture.String()
+	err = preparerEmission(db, "chautre", idChantier, &ch.NumFacture, &ch.DateFacture)
+	if err != nil {
+		return 0, err
+	}
+	if avant != ch.NumFacture+"|"+ch.DateFacture.String() {
+		err = updateFactureChautre(db, ch)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return InsertFacture(db, NewFactureChautre(ch))
+}
+
+// Auxiliaire de EmettreFacture*()
+// Vérifie qu'il n'existe pas de facture non annulée,
+// et calcule si besoin le numéro et la date de la facture.
+func preparerEmission(db DBOrTx, typeOrigine string, idOrigine int, numero *string, date *time.Time) (err error) {
+	f, err := GetFactureActive(db, typeOrigine, idOrigine)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetFactureActive()")
+	}
+	if f != nil {
+		return errors.New("Une facture a déjà été émise (" + f.Numero + "), il faut d'abord émettre un avoir")
+	}
+	if date.IsZero() {
+		*date = time.Now()
+	}
+	if *numero != "" {
+		var count int
+		query := "select count(*) from facture where numero=$1"
+		err = db.Get(&count, query, *numero)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+		if count == 0 {
+			return nil
+		}
+	}
+	// pas de numéro, ou numéro déjà utilisé par une facture annulée
+	*numero, err = NouveauNumeroFacture(db, strconv.Itoa(date.Year()))
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel NouveauNumeroFacture()")
+	}
+	return nil
+}
+
+// Enregistre le numéro et la date de facture d'un chantier autres valorisations
+func updateFactureChautre(db DBOrTx, ch *Chautre) (err error) {
+	avant, err := auditEtat(db, "chautre", ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	query := "update chautre set numfacture=$1, datefacture=$2 where id=$3"
+	_, err = db.Exec(query, ch.NumFacture, ch.DateFacture, ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "chautre", ch.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+// Emet un avoir annulant totalement une facture.
+// L'avoir reprend les lignes de la facture, avec des quantités négatives.
+// La facture passe au statut annulée.
+func EmettreAvoir(db DBOrTx, idFacture int, date time.Time) (id int, err error) {
+	f, err := GetFactureFull(db, idFacture)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel GetFactureFull()")
+	}
+	if f.TypeFacture != "F" {
+		return 0, errors.New("Impossible d'émettre un avoir pour un avoir")
+	}
+	if f.Statut == FACTURE_ANNULEE {
+		return 0, errors.New("La facture " + f.Numero + " est déjà annulée")
+	}
+	avoir := &Facture{
+		TypeFacture:      "A",
+		IdFactureOrigine: f.Id,
+		TypeOrigine:      f.TypeOrigine,
+		IdOrigine:        f.IdOrigine,
+		IdClient:         f.IdClient,
+		Client:           f.Client,
+		DateFacture:      date,
+		Statut:           FACTURE_EMISE,
+		Mentions:         "Avoir annulant la facture n° " + f.Numero + " du " + tiglib.DateFr(f.DateFacture),
+	}
+	for _, ligne := range f.Lignes {
+		avoir.ajouterLigne(ligne.Designation, -ligne.Quantite, ligne.Unite, ligne.PUHT, ligne.TauxTVA)
+	}
+	avoir.Numero, err = NouveauNumeroFacture(db, strconv.Itoa(date.Year()))
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel NouveauNumeroFacture()")
+	}
+	id, err = InsertFacture(db, avoir)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel InsertFacture()")
+	}
+	err = updateStatutFacture(db, f.Id, FACTURE_ANNULEE)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel updateStatutFacture()")
+	}
+	return id, nil
+}
+
+// ************************** Get one *******************************
+
+func GetFacture(db DBOrTx, id int) (f *Facture, err error) {
+	f = &Facture{}
+	query := "select * from facture where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(f)
+	if err != nil {
+		return f, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	return f, nil
+}
+
+// Renvoie une facture avec ses lignes, ses paiements,
+// et selon le cas la facture annulée par l'avoir, ou l'avoir annulant la facture.
+func GetFactureFull(db DBOrTx, id int) (f *Facture, err error) {
+	f, err = GetFacture(db, id)
+	if err != nil {
+		return f, werr.Wrapf(err, "Erreur appel GetFacture()")
+	}
+	query := "select * from factureligne where id_facture=$1 order by ordre"
+	err = db.Select(&f.Lignes, query, id)
+	if err != nil {
+		return f, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	query = "select * from facturepaiement where id_facture=$1 order by datepaiement"
+	err = db.Select(&f.Paiements, query, id)
+	if err != nil {
+		return f, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	if f.IdFactureOrigine != 0 {
+		f.FactureOrigine, err = GetFacture(db, f.IdFactureOrigine)
+		if err != nil {
+			return f, werr.Wrapf(err, "Erreur appel GetFacture()")
+		}
+	}
+	if f.Statut == FACTURE_ANNULEE {
+		avoirs := []*Facture{}
+		query = "select * from facture where id_facture_origine=$1"
+		err = db.Select(&avoirs, query, id)
+		if err != nil {
+			return f, werr.Wrapf(err, "Erreur query DB : "+query)
+		}
+		if len(avoirs) != 0 {
+			f.Avoir = avoirs[0]
+		}
+	}
+	return f, nil
+}
+
+func GetFacturePaiement(db DBOrTx, id int) (p *FacturePaiement, err error) {
+	p = &FacturePaiement{}
+	query := "select * from facturepaiement where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(p)
+	if err != nil {
+		return p, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	return p, nil
+}
+
+// Renvoie la facture non annulée d'une vente ou d'un chantier, avec ses lignes et ses paiements.
+// Renvoie nil si aucune facture n'a été émise, ou si elles ont toutes été annulées.
+// @param typeOrigine "venteplaq" ou "chautre"
+func GetFactureActive(db DBOrTx, typeOrigine string, idOrigine int) (f *Facture, err error) {
+	ids := []int{}
+	query := "select id from facture where typefacture='F' and statut<>$1 and typeorigine=$2 and id_origine=$3"
+	err = db.Select(&ids, query, FACTURE_ANNULEE, typeOrigine, idOrigine)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return GetFactureFull(db, ids[0])
+}
+
+// ************************** Get many *******************************
+
+// Renvoie les factures et avoirs d'une année, par ordre de numéro.
+// Chaque facture contient ses paiements, mais pas ses lignes.
+func GetFacturesOfYear(db DBOrTx, annee string) (res []*Facture, err error) {
+	res = []*Facture{}
+	query := "select * from facture where extract(year from datefacture)=$1 order by numero"
+	err = db.Select(&res, query, annee)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for _, f := range res {
+		query = "select * from facturepaiement where id_facture=$1 order by datepaiement"
+		err = db.Select(&f.Paiements, query, f.Id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query DB : "+query)
+		}
+	}
+	return res, nil
+}
+
+// Renvoie la liste des années ayant des factures
+// @param   exclude   Année à exclure du résultat
+// @return  Liste de string au format YYYY
+func GetFactureDifferentYears(db DBOrTx, exclude string) (res []string, err error) {
+	res = []string{}
+	query := "select distinct extract(year from datefacture)::text from facture order by 1"
+	err = db.Select(&res, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query DB : "+query)
+	}
+	for i, y := range res {
+		if y == exclude {
+			return append(res[:i], res[i+1:]...), nil
+		}
+	}
+	return res, nil
+}
+
+// ************************** CRUD *******************************
+
+// Insère une facture et ses lignes.
+// Les factures ne sont jamais modifiées, à part leur statut.
+func InsertFacture(db DBOrTx, f *Facture) (id int, err error) {
+	query := `insert into facture(
+        numero,
+        typefacture,
+        id_facture_origine,
+        typeorigine,
+        id_origine,
+        id_client,
+        client,
+        datefacture,
+        statut,
+        totalht,
+        totaltva,
+        totalttc,
+        notes,
+        mentions
+        ) values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14) returning id`
+	err = db.QueryRow(
+		query,
+		f.Numero,
+		f.TypeFacture,
+		f.IdFactureOrigine,
+		f.TypeOrigine,
+		f.IdOrigine,
+		f.IdClient,
+		f.Client,
+		f.DateFacture,
+		f.Statut,
+		f.TotalHT,
+		f.TotalTVA,
+		f.TotalTTC,
+		f.Notes,
+		f.Mentions).Scan(&id)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = `insert into factureligne(
+        id_facture,
+        ordre,
+        designation,
+        quantite,
+        unite,
+        puht,
+        tauxtva,
+        montantht,
+        montanttva
+        ) values($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	for _, ligne := range f.Lignes {
+		_, err = db.Exec(
+			query,
+			id,
+			ligne.Ordre,
+			ligne.Designation,
+			ligne.Quantite,
+			ligne.Unite,
+			ligne.PUHT,
+			ligne.TauxTVA,
+			ligne.MontantHT,
+			ligne.MontantTVA)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	err = insertAudit(db, "facture", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return id, nil
+}
+
+func updateStatutFacture(db DBOrTx, id int, statut string) (err error) {
+	avant, err := auditEtat(db, "facture", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	query := "update facture set statut=$1 where id=$2"
+	_, err = db.Exec(query, statut, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "facture", id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+// Met à jour le statut d'une facture non annulée en fonction de ses paiements
+func majStatutPaiement(db DBOrTx, idFacture int) (err error) {
+	f, err := GetFactureFull(db, idFacture)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetFactureFull()")
+	}
+	if f.Statut == FACTURE_ANNULEE {
+		return nil
+	}
+	statut := FACTURE_EMISE
+	if f.ResteAPayer() <= 0 {
+		statut = FACTURE_PAYEE
+	}
+	if statut == f.Statut {
+		return nil
+	}
+	return updateStatutFacture(db, idFacture, statut)
+}
+
+// ************************** Paiements *******************************
+
+func InsertFacturePaiement(db DBOrTx, p *FacturePaiement) (id int, err error) {
+	query := `insert into facturepaiement(
+        id_facture,
+        datepaiement,
+        montant,
+        mode,
+        notes
+        ) values($1,$2,$3,$4,$5) returning id`
+	err = db.QueryRow(
+		query,
+		p.IdFacture,
+		p.DatePaiement,
+		p.Montant,
+		p.Mode,
+		p.Notes).Scan(&id)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "facturepaiement", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	err = majStatutPaiement(db, p.IdFacture)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel majStatutPaiement()")
+	}
+	return id, nil
+}
+
+func DeleteFacturePaiement(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "facturepaiement", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	var idFacture int
+	query := "delete from facturepaiement where id=$1 returning id_facture"
+	err = db.QueryRow(query, id).Scan(&idFacture)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "facturepaiement", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	err = majStatutPaiement(db, idFacture)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel majStatutPaiement()")
+	}
+	return nil
+}
@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strings"
 )
 
@@ -34,7 +33,7 @@ func (f *Fermier) String() string {
 
 // ************************** Divers *******************************
 
-func CountFermiers(db *sqlx.DB) (count int) {
+func CountFermiers(db DBOrTx) (count int) {
 	_ = db.QueryRow("select count(*) from fermier").Scan(&count)
 	return count
 }
@@ -42,7 +41,7 @@ func CountFermiers(db *sqlx.DB) (count int) {
 // ************************** Compute *******************************
 
 // Calcule le champ Parcelles d'un fermier
-func (f *Fermier) ComputeParcelles(db *sqlx.DB) (err error) {
+func (f *Fermier) ComputeParcelles(db DBOrTx) (err error) {
 	if len(f.Parcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -61,7 +60,7 @@ func (f *Fermier) ComputeParcelles(db *sqlx.DB) (err error) {
 // Renvoie un Fermier à partir de son id.
 // Ne contient que les champs de la table fermier.
 // Les autres champs ne sont pas remplis.
-func GetFermier(db *sqlx.DB, id int) (f *Fermier, err error) {
+func GetFermier(db DBOrTx, id int) (f *Fermier, err error) {
 	f = &Fermier{}
 	query := "select * from fermier where id=$1"
 	row := db.QueryRowx(query, id)
@@ -76,7 +75,7 @@ func GetFermier(db *sqlx.DB, id int) (f *Fermier, err error) {
 
 // Renvoie une liste de Fermiers triés en utilisant un champ de la table
 // @param field    Champ de la table fermier utilisé pour le tri
-func GetSortedFermiers(db *sqlx.DB, field string) (fermiers []*Fermier, err error) {
+func GetSortedFermiers(db DBOrTx, field string) (fermiers []*Fermier, err error) {
 	fermiers = []*Fermier{}
 	query := "select * from fermier where id<>0 order by " + field
 	err = db.Select(&fermiers, query)
@@ -93,7 +92,7 @@ func GetSortedFermiers(db *sqlx.DB, field string) (fermiers []*Fermier, err erro
 // Ne contient que les champs de la table fermier.
 // Les autres champs ne sont pas remplis.
 // Utilisé par ajax
-func GetFermiersFromLieudit(db *sqlx.DB, idLieudit int) ([]*Fermier, error) {
+func GetFermiersFromLieudit(db DBOrTx, idLieudit int) ([]*Fermier, error) {
 	fermiers := []*Fermier{}
 	query := `
 	    select * from fermier where id in(
@@ -113,7 +112,7 @@ func GetFermiersFromLieudit(db *sqlx.DB, idLieudit int) ([]*Fermier, error) {
 // Contient les champs de la table fermier.
 // Les autres champs ne sont pas remplis.
 // @param      strIdsUGs   Chaîne contenant les ids séparés par des virgules. ex : "1, 34, 87"
-func GetFermiersFromIdsUGs(db *sqlx.DB, strIdsUGs string) (fermiers []*Fermier, err error) {
+func GetFermiersFromIdsUGs(db DBOrTx, strIdsUGs string) (fermiers []*Fermier, err error) {
 	fermiers = []*Fermier{}
 	query := `
 	    select * from fermier where id in(
@@ -133,7 +132,7 @@ func GetFermiersFromIdsUGs(db *sqlx.DB, strIdsUGs string) (fermiers []*Fermier,
 // Ne contient que les champs de la table fermier.
 // Les autres champs ne sont pas remplis.
 // Utilisé par ajax
-func GetFermiersFromIdUG(db *sqlx.DB, idUG int) ([]*Fermier, error) {
+func GetFermiersFromIdUG(db DBOrTx, idUG int) ([]*Fermier, error) {
 	fermiers := []*Fermier{}
 	query := `
 	    select * from fermier where id in(
@@ -152,7 +151,7 @@ func GetFermiersFromIdUG(db *sqlx.DB, idUG int) ([]*Fermier, error) {
 
 // Pas un insert habituel car id est fourni.
 // Utilisé par manage/sctl-update/, pas par src/
-func InsertFermier(db *sqlx.DB, f *Fermier) (err error) {
+func InsertFermier(db DBOrTx, f *Fermier) (err error) {
 	query := `insert into fermier(
 	    id,
 	    nom,
@@ -176,10 +175,18 @@ func InsertFermier(db *sqlx.DB, f *Fermier) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "fermier", f.Id, AUDIT_INSERT, "")
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func UpdateFermier(db *sqlx.DB, f *Fermier) (err error) {
+func UpdateFermier(db DBOrTx, f *Fermier) (err error) {
+	avant, err := auditEtat(db, "fermier", f.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update fermier set(
 	    nom,
 	    prenom,
@@ -202,5 +209,9 @@ func UpdateFermier(db *sqlx.DB, f *Fermier) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "fermier", f.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
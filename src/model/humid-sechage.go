@@ -0,0 +1,201 @@
+/*
+Suivi du séchage des tas : courbe d'humidité et estimation de la date
+à laquelle un tas atteint l'humidité cible (humidite / cible dans config.yml).
+Liste des tas actifs sans mesure récente (humidite / jours-sans-mesure).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"math"
+	"sort"
+	"time"
+)
+
+const HUMIDITE_CIBLE_DEFAUT = 30.0           // %
+const HUMIDITE_JOURS_SANS_MESURE_DEFAUT = 30 // jours
+
+type CourbeSechage struct {
+	Tas *Tas
+	// Date de référence = premier transport vers le tas (ou première mesure s'il n'y a pas de transport)
+	DateReference time.Time
+	Points        []*PointSechage
+	Cible         float64
+	// true si la dernière mesure est inférieure ou égale à la cible
+	CibleAtteinte bool
+	// Estimation ; nulle si elle n'est pas possible (moins de 2 mesures, humidité qui ne baisse pas)
+	DateCible  time.Time
+	JoursCible int // nb de jours depuis DateReference
+	// Paramètres de l'estimation : valeur = exp(A + B * jours)
+	A, B float64
+}
+
+type PointSechage struct {
+	Date   time.Time
+	Jours  int // nb de jours depuis DateReference
+	Valeur float64
+}
+
+type TasSansMesure struct {
+	Tas            *Tas
+	DerniereMesure *Humid // nil si le tas n'a jamais été mesuré
+	NbJours        int    // nb de jours depuis la dernière mesure, ou depuis le premier transport
+}
+
+// Valeurs de config.yml, avec les valeurs par défaut si absentes
+func HumiditeCible(conf *Config) float64 {
+	if conf.Humidite.Cible <= 0 {
+		return HUMIDITE_CIBLE_DEFAUT
+	}
+	return conf.Humidite.Cible
+}
+
+func HumiditeJoursSansMesure(conf *Config) int {
+	if conf.Humidite.JoursSansMesure <= 0 {
+		return HUMIDITE_JOURS_SANS_MESURE_DEFAUT
+	}
+	return conf.Humidite.JoursSansMesure
+}
+
+// ************************** Courbes *******************************
+
+// Renvoie les courbes de séchage de tous les tas actifs ayant au moins une mesure d'humidité
+func ComputeCourbesSechageTasActifs(db DBOrTx, conf *Config) (res []*CourbeSechage, err error) {
+	res = []*CourbeSechage{}
+	tas, err := GetAllTasActifsFull(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetAllTasActifsFull()")
+	}
+	for _, t := range tas {
+		c, err := t.ComputeCourbeSechage(db, HumiditeCible(conf))
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Tas.ComputeCourbeSechage()")
+		}
+		if len(c.Points) != 0 {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Tas.Nom < res[j].Tas.Nom })
+	return res, nil
+}
+
+// Calcule la courbe de séchage d'un tas.
+// L'estimation ajuste une décroissance exponentielle (moindres carrés sur le logarithme des valeurs) :
+// valeur = exp(A + B * jours)
+func (t *Tas) ComputeCourbeSechage(db DBOrTx, cible float64) (c *CourbeSechage, err error) {
+	c = &CourbeSechage{Tas: t, Cible: cible}
+	err = t.ComputeMesuresHumidite(db)
+	if err != nil {
+		return c, werr.Wrapf(err, "Erreur appel Tas.ComputeMesuresHumidite()")
+	}
+	if len(t.MesuresHumidite) == 0 {
+		return c, nil
+	}
+	err = t.ComputeEvolutionStock(db)
+	if err != nil {
+		return c, werr.Wrapf(err, "Erreur appel Tas.ComputeEvolutionStock()")
+	}
+	mesures := append([]*Humid{}, t.MesuresHumidite...)
+	sort.Slice(mesures, func(i, j int) bool { return mesures[i].DateMesure.Before(mesures[j].DateMesure) })
+	c.DateReference = jour(mesures[0].DateMesure)
+	for _, mvt := range t.EvolutionStock {
+		if mvt.Delta > 0 {
+			c.DateReference = jour(mvt.Date)
+			break
+		}
+	}
+	for _, m := range mesures {
+		c.Points = append(c.Points, &PointSechage{
+			Date:   m.DateMesure,
+			Jours:  nbJours(c.DateReference, m.DateMesure) - 1,
+			Valeur: m.Valeur,
+		})
+	}
+	c.CibleAtteinte = c.Points[len(c.Points)-1].Valeur <= cible
+	c.estimerCible()
+	return c, nil
+}
+
+// Régression linéaire de ln(valeur) en fonction du nb de jours
+func (c *CourbeSechage) estimerCible() {
+	var n, sx, sy, sxx, sxy float64
+	for _, p := range c.Points {
+		if p.Valeur <= 0 {
+			continue
+		}
+		x, y := float64(p.Jours), math.Log(p.Valeur)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	denom := n*sxx - sx*sx
+	if n < 2 || denom == 0 {
+		return
+	}
+	c.B = (n*sxy - sx*sy) / denom
+	c.A = (sy - c.B*sx) / n
+	if c.B >= 0 {
+		return // l'humidité ne baisse pas, pas d'estimation
+	}
+	c.JoursCible = int(math.Ceil((math.Log(c.Cible) - c.A) / c.B))
+	if c.JoursCible < 0 {
+		c.JoursCible = 0
+	}
+	c.DateCible = c.DateReference.AddDate(0, 0, c.JoursCible)
+}
+
+// Valeur estimée au bout d'un nb de jours depuis DateReference
+func (c *CourbeSechage) ValeurEstimee(jours float64) float64 {
+	return math.Exp(c.A + c.B*jours)
+}
+
+// ************************** Alertes *******************************
+
+// Renvoie les tas actifs sans mesure d'humidité depuis au moins nbJours,
+// triés du plus ancien au plus récent.
+// Un tas jamais mesuré est signalé si son premier transport date d'au moins nbJours.
+func ComputeTasSansMesure(db DBOrTx, nbJours int) (res []*TasSansMesure, err error) {
+	res = []*TasSansMesure{}
+	aujourdhui := jour(time.Now())
+	tas, err := GetAllTasActifsFull(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetAllTasActifsFull()")
+	}
+	for _, t := range tas {
+		err = t.ComputeMesuresHumidite(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Tas.ComputeMesuresHumidite()")
+		}
+		tsm := &TasSansMesure{Tas: t}
+		var depuis time.Time
+		for _, m := range t.MesuresHumidite {
+			if tsm.DerniereMesure == nil || m.DateMesure.After(tsm.DerniereMesure.DateMesure) {
+				tsm.DerniereMesure = m
+			}
+		}
+		if tsm.DerniereMesure != nil {
+			depuis = tsm.DerniereMesure.DateMesure
+		} else {
+			err = t.ComputeEvolutionStock(db)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel Tas.ComputeEvolutionStock()")
+			}
+			if len(t.EvolutionStock) == 0 {
+				continue // tas pas encore rempli
+			}
+			depuis = t.EvolutionStock[0].Date
+		}
+		tsm.NbJours = int(aujourdhui.Sub(jour(depuis)).Hours()/24 + 0.5)
+		if tsm.NbJours >= nbJours {
+			res = append(res, tsm)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].NbJours > res[j].NbJours })
+	return res, nil
+}
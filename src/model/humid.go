@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -33,7 +32,7 @@ type Humid struct {
 // - les données stockées en base
 // - les mesureurs
 // - le stockage
-func GetHumidFull(db *sqlx.DB, idMesure int) (h *Humid, err error) {
+func GetHumidFull(db DBOrTx, idMesure int) (h *Humid, err error) {
 	h = &Humid{}
 	query := "select * from humid where id=$1"
 	row := db.QueryRowx(query, idMesure)
@@ -55,7 +54,7 @@ func GetHumidFull(db *sqlx.DB, idMesure int) (h *Humid, err error) {
 
 // ************************** Compute *******************************
 
-func (h *Humid) ComputeMesureurs(db *sqlx.DB) (err error) {
+func (h *Humid) ComputeMesureurs(db DBOrTx) (err error) {
 	if len(h.Mesureurs) != 0 {
 		return nil // déjà calculé
 	}
@@ -67,7 +66,7 @@ func (h *Humid) ComputeMesureurs(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (h *Humid) ComputeTas(db *sqlx.DB) (err error) {
+func (h *Humid) ComputeTas(db DBOrTx) (err error) {
 	if h.Tas == nil {
 		return nil // déjà calculé
 	}
@@ -82,7 +81,7 @@ func (h *Humid) ComputeTas(db *sqlx.DB) (err error) {
 
 // Renvoie la liste des années ayant des mesures d'humidité,
 // @param exclude   Année à exclure du résultat
-func GetHumidDifferentYears(db *sqlx.DB, exclude string) (res []string, err error) {
+func GetHumidDifferentYears(db DBOrTx, exclude string) (res []string, err error) {
 	res = []string{}
 	list := []time.Time{}
 	query := "select datemesure from humid order by datemesure desc"
@@ -102,7 +101,7 @@ func GetHumidDifferentYears(db *sqlx.DB, exclude string) (res []string, err erro
 // Renvoie la liste des mesures d'humidité pour une année donnée,
 // triés par ordre chronologique inverse.
 // Chaque mesure contient les mêmes champs que ceux renvoyés par GetHumidFull()
-func GetHumidsOfYear(db *sqlx.DB, annee string) (res []*Humid, err error) {
+func GetHumidsOfYear(db DBOrTx, annee string) (res []*Humid, err error) {
 	res = []*Humid{}
 	type ligne struct {
 		Id         int
@@ -126,7 +125,7 @@ func GetHumidsOfYear(db *sqlx.DB, annee string) (res []*Humid, err error) {
 
 // ************************** CRUD *******************************
 
-func InsertHumid(db *sqlx.DB, humid *Humid) (id int, err error) {
+func InsertHumid(db DBOrTx, humid *Humid) (id int, err error) {
 	query := `insert into humid(
         id_tas,
         valeur,
@@ -144,12 +143,23 @@ func InsertHumid(db *sqlx.DB, humid *Humid) (id int, err error) {
 	}
 	query = "insert into humid_acteur values($1,$2)"
 	for _, idMesureur := range humid.IdsMesureurs {
-		_ = db.QueryRow(query, id, idMesureur)
+		_, err = db.Exec(query, id, idMesureur)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	err = insertAudit(db, "humid", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
 	}
 	return id, nil
 }
 
-func UpdateHumid(db *sqlx.DB, humid *Humid) (err error) {
+func UpdateHumid(db DBOrTx, humid *Humid) (err error) {
+	avant, err := auditEtat(db, "humid", humid.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update humid set(
         id_tas,
         valeur,
@@ -173,12 +183,23 @@ func UpdateHumid(db *sqlx.DB, humid *Humid) (err error) {
 	}
 	query = "insert into humid_acteur values($1,$2)"
 	for _, idMesureur := range humid.IdsMesureurs {
-		_ = db.QueryRow(query, humid.Id, idMesureur)
+		_, err = db.Exec(query, humid.Id, idMesureur)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	err = insertAudit(db, "humid", humid.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
 	}
 	return nil
 }
 
-func DeleteHumid(db *sqlx.DB, id int) (err error) {
+func DeleteHumid(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "humid", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from humid_acteur where id_humid=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
@@ -189,5 +210,9 @@ func DeleteHumid(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "humid", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -0,0 +1,615 @@
+/*
+Tests d'intégration du model : chaîne complète d'un chantier plaquettes,
+chantier -> transport -> vente -> livraison -> chargement.
+Voir testdb_test.go pour le lancement.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"bdl.local/bdl/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// Ids des fixtures, cf testdata/fixtures.sql
+const (
+	ID_SCTL         = 1
+	ID_BDL          = 2
+	ID_GFA          = 3
+	ID_TRANSPORTEUR = 4
+	ID_CLIENT       = 5
+	ID_CHARGEUR     = 6
+	ID_LIVREUR      = 7
+	ID_DECHIQUETEUR = 8
+	ID_HANGAR       = 1
+	ID_HANGAR2      = 2
+	ID_UG           = 1
+)
+
+// Ids créés par le scénario
+type idsScenario struct {
+	Chantier   int
+	Tas        int
+	Transport  int
+	Vente      int
+	Livraison  int
+	Chargement int
+}
+
+// Vérifie que tous les fichiers de sql-create sont utilisés par la base de test,
+// pour que TABLES_TEST suive les ajouts de tables. Ne nécessite pas de base.
+func TestTablesTestCompletes(t *testing.T) {
+	fichiers, err := filepath.Glob(filepath.Join(DIR_SQL_CREATE, "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := map[string]bool{}
+	for _, table := range TABLES_TEST {
+		tables[table] = true
+	}
+	manquantes := []string{}
+	for _, fichier := range fichiers {
+		table := strings.TrimSuffix(filepath.Base(fichier), ".sql")
+		if !tables[table] {
+			manquantes = append(manquantes, table)
+		}
+		delete(tables, table)
+	}
+	sort.Strings(manquantes)
+	if len(manquantes) != 0 {
+		t.Errorf("Tables absentes de TABLES_TEST : %s", strings.Join(manquantes, ", "))
+	}
+	for table := range tables {
+		if _, err := os.Stat(filepath.Join(DIR_SQL_CREATE, table+".sql")); err != nil {
+			t.Errorf("Table de TABLES_TEST sans fichier sql : %s", table)
+		}
+	}
+}
+
+// Scénario :
+//   - chantier de 100 maps vertes déchiquetées (5 E HT / map), sur 2 parcelles (2 ha SCTL, 3 ha GFA)
+//   - transport de 100 maps vertes vers le hangar, 20 % de perte => 80 maps sèches dans le tas
+//   - vente au client, une livraison, un chargement de 50 maps => reste 30 maps dans le tas
+func TestChaineChantierVente(t *testing.T) {
+	db := ouvreBaseTest(t)
+	ids := insereScenario(t, db)
+
+	t.Run("stock", func(t *testing.T) {
+		tas, err := model.GetTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Tas.Stock", 30, tas.Stock)
+		err = tas.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tas.EvolutionStock) != 2 {
+			t.Fatalf("Tas.EvolutionStock : attendu 2 mouvements, obtenu %d", len(tas.EvolutionStock))
+		}
+		verifieValeur(t, "Mouvement transport", 80, tas.EvolutionStock[0].Delta)
+		verifieValeur(t, "Mouvement chargement", -50, tas.EvolutionStock[1].Delta)
+		vente, err := model.GetVentePlaqFull(db, ids.Vente)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "VentePlaq.Qte", 50, vente.Qte)
+	})
+
+	t.Run("couts", func(t *testing.T) {
+		ch, err := model.GetPlaqFull(db, ids.Chantier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Plaq.Volume", 100, ch.Volume)
+		err = ch.ComputeCouts(db, &model.Config{PourcentagePerte: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Stockage : 10 E / jour, du transport (10/01) à la fin du loyer (30/01) = 21 jours,
+		// tas seul dans le hangar et jamais vide
+		attendu := model.CoutPlaq{
+			Dechiquetage: 500,
+			FauxFrais:    80,
+			Transport:    200,
+			Stockage:     210,
+			Chargement:   40,
+			Livraison:    60,
+			Total:        1090,
+		}
+		verifieCoutPlaq(t, "CoutTotal", attendu, *ch.CoutTotal)
+		// 80 maps sèches
+		verifieValeur(t, "CoutParMap.Total", 1090.0/80, ch.CoutParMap.Total)
+		verifieValeur(t, "CoutParMap.Stockage", 210.0/80, ch.CoutParMap.Stockage)
+	})
+
+	t.Run("bilans-saison", func(t *testing.T) {
+		activites, err := model.ComputeActivitesFromFiltres(db, map[string][]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(activites) != 1 {
+			t.Fatalf("ComputeActivitesFromFiltres() : attendu 1 activité, obtenu %d", len(activites))
+		}
+		bilans, err := model.ComputeBilansActivitesParSaison(db, "01/09", activites)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bilans) != 1 {
+			t.Fatalf("ComputeBilansActivitesParSaison() : attendu 1 saison, obtenu %d", len(bilans))
+		}
+		bilan := bilans[0]
+		if !bilan.Datedeb.Equal(date(t, "2024-09-01")) || !bilan.Datefin.Equal(date(t, "2025-08-31")) {
+			t.Errorf("Saison : attendu 2024-09-01 - 2025-08-31, obtenu %s - %s",
+				bilan.Datedeb.Format("2006-01-02"), bilan.Datefin.Format("2006-01-02"))
+		}
+		// Volume du chantier et ventes répartis au prorata de la surface des parcelles (2/5 SCTL, 3/5 GFA)
+		verifieValeur(t, "Volume plaquettes SCTL", 40, bilan.TotalActivitesPlaquettesParProprio[ID_SCTL].Volume)
+		verifieValeur(t, "Volume plaquettes GFA", 60, bilan.TotalActivitesPlaquettesParProprio[ID_GFA].Volume)
+		verifieValeur(t, "Vente plaquettes SCTL", 20, bilan.TotalVentePlaquettesParProprio[ID_SCTL])
+		verifieValeur(t, "Vente plaquettes GFA", 30, bilan.TotalVentePlaquettesParProprio[ID_GFA])
+	})
+
+	t.Run("affactures", func(t *testing.T) {
+		for _, cas := range []struct {
+			idActeur     int
+			typeActivite string
+			idLigne      int
+			totalHT      float64
+			totalTTC     float64
+		}{
+			{ID_DECHIQUETEUR, "DC", 0, 500, 600},
+			{ID_TRANSPORTEUR, "TR", ids.Transport, 200, 240},
+			{ID_CHARGEUR, "CG", ids.Chargement, 40, 48},
+			{ID_LIVREUR, "LV", ids.Livraison, 60, 72},
+		} {
+			aff := computeAffactureJanvier(t, db, cas.idActeur)
+			if len(aff.Items) != 1 {
+				t.Errorf("Affacture acteur %d : attendu 1 item, obtenu %d", cas.idActeur, len(aff.Items))
+				continue
+			}
+			item := aff.Items[0]
+			if item.TypeActivite != cas.typeActivite || (cas.idLigne != 0 && item.IdLigne != cas.idLigne) {
+				t.Errorf("Affacture acteur %d : attendu item %s %d, obtenu %s %d",
+					cas.idActeur, cas.typeActivite, cas.idLigne, item.TypeActivite, item.IdLigne)
+			}
+			verifieValeur(t, "Affacture "+cas.typeActivite+" HT", cas.totalHT, aff.TotalHT)
+			verifieValeur(t, "Affacture "+cas.typeActivite+" TTC", cas.totalTTC, aff.TotalTTC)
+		}
+		// Une fois l'affacture enregistrée, le transport est marqué payé et ne peut plus être affacturé
+		aff := computeAffactureJanvier(t, db, ID_TRANSPORTEUR)
+		aff.DateAffacture = date(t, "2025-02-01")
+		err := model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			_, err := model.InsertAffacture(tx, aff)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport, err := model.GetPlaqTrans(db, ids.Transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !transport.GlDatePay.Equal(aff.DateAffacture) {
+			t.Errorf("PlaqTrans.GlDatePay : attendu 2025-02-01, obtenu %s", transport.GlDatePay.Format("2006-01-02"))
+		}
+		aff = computeAffactureJanvier(t, db, ID_TRANSPORTEUR)
+		if len(aff.Items) != 0 {
+			t.Errorf("Transport déjà affacturé : attendu 0 item, obtenu %d", len(aff.Items))
+		}
+		// date de paiement effacée dans le formulaire du transport : toujours affacturé (affactureitem)
+		_, err = db.Exec("update plaqtrans set gldatepay='0001-01-01' where id=$1", ids.Transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aff = computeAffactureJanvier(t, db, ID_TRANSPORTEUR)
+		if len(aff.Items) != 0 {
+			t.Errorf("Transport affacturé, date de paiement effacée : attendu 0 item, obtenu %d", len(aff.Items))
+		}
+		_, err = db.Exec("update plaqtrans set gldatepay=$1 where id=$2", transport.GlDatePay, ids.Transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Modifie les données - doit rester après les autres sous-tests
+	t.Run("journal-stock", func(t *testing.T) {
+		// chargement ramené de 50 à 40 maps : mouvement inverse + nouveau mouvement
+		err := model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			vc, err := model.GetVenteCharge(tx, ids.Chargement)
+			if err != nil {
+				return err
+			}
+			vc.Qte = 40
+			return model.UpdateVenteCharge(tx, vc)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mvts, err := model.GetMouvementsStockTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mvts) != 4 {
+			t.Fatalf("Mouvements enregistrés : attendu 4, obtenu %d", len(mvts))
+		}
+		tas, err := model.GetTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Tas.Stock après modif chargement", 40, tas.Stock)
+		err = tas.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tas.EvolutionStock) != 2 {
+			t.Fatalf("Tas.EvolutionStock : attendu 2 mouvements, obtenu %d", len(tas.EvolutionStock))
+		}
+		verifieValeur(t, "Mouvement chargement modifié", -40, tas.EvolutionStock[1].Delta)
+		// inventaire : 35 maps mesurés pour 40 calculés => ajustement de -5
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			_, err := model.InsertInventaire(tx, &model.Inventaire{
+				IdStockage:     ID_HANGAR,
+				DateInventaire: date(t, "2025-01-25"),
+				Lignes:         []*model.InventaireTas{{IdTas: ids.Tas, StockMesure: 35}},
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tas, err = model.GetTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Tas.Stock après inventaire", 35, tas.Stock)
+		err = tas.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tas.EvolutionStock) != 3 || tas.EvolutionStock[2].TypeMvt != model.MVT_AJUSTEMENT {
+			t.Fatalf("Tas.EvolutionStock : attendu 3 mouvements dont un ajustement, obtenu %d", len(tas.EvolutionStock))
+		}
+		verifieValeur(t, "Mouvement ajustement inventaire", -5, tas.EvolutionStock[2].Delta)
+		ecarts, err := model.ComputeEcartsInventaires(db, "01/09")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ecarts) != 1 {
+			t.Fatalf("Ecarts d'inventaire : attendu 1 saison / hangar, obtenu %d", len(ecarts))
+		}
+		verifieValeur(t, "Ecart inventaire saison", -5, ecarts[0].Ecart())
+		// transfert de 10 maps vers un nouveau tas dans le 2e hangar, coût global 50 E
+		transfert := &model.PlaqTransfert{
+			IdChantier:            ids.Chantier,
+			IdTasOrigine:          ids.Tas,
+			IdStockageDestination: ID_HANGAR2,
+			IdTransporteur:        ID_TRANSPORTEUR,
+			DateTransfert:         date(t, "2025-01-28"),
+			Qte:                   10,
+			TypeCout:              "G",
+			GlPrix:                50,
+			GlTVA:                 20,
+		}
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqTransfert(tx, transfert)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tas, err = model.GetTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Tas.Stock après transfert", 25, tas.Stock)
+		tasDestination, err := model.GetTas(db, transfert.IdTasDestination)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tasDestination.IdStockage != ID_HANGAR2 || tasDestination.IdChantier != ids.Chantier {
+			t.Errorf("Tas de destination : attendu hangar %d chantier %d, obtenu hangar %d chantier %d",
+				ID_HANGAR2, ids.Chantier, tasDestination.IdStockage, tasDestination.IdChantier)
+		}
+		verifieValeur(t, "Tas destination.Stock", 10, tasDestination.Stock)
+		err = tasDestination.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasDestination.EvolutionStock) != 1 || tasDestination.EvolutionStock[0].TypeMvt != model.MVT_TRANSFERT {
+			t.Fatalf("Tas destination.EvolutionStock : attendu 1 transfert, obtenu %d mouvements", len(tasDestination.EvolutionStock))
+		}
+		ch, err := model.GetPlaqFull(db, ids.Chantier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ch.ComputeCouts(db, &model.Config{PourcentagePerte: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "CoutTotal.Transfert", 50, ch.CoutTotal.Transfert)
+		// transfert supérieur au stock du tas d'origine
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqTransfert(tx, &model.PlaqTransfert{
+				IdChantier:       ids.Chantier,
+				IdTasOrigine:     ids.Tas,
+				IdTasDestination: transfert.IdTasDestination,
+				DateTransfert:    date(t, "2025-01-29"),
+				Qte:              30,
+				TypeCout:         "G",
+			})
+			return err
+		})
+		if err == nil {
+			t.Errorf("Transfert de 30 maps d'un tas de 25 maps : erreur attendue")
+		}
+		// transfert antérieur : 35 maps au 26/01, mais 25 maps après le transfert du 28/01
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			_, err := model.InsertPlaqTransfert(tx, &model.PlaqTransfert{
+				IdChantier:       ids.Chantier,
+				IdTasOrigine:     ids.Tas,
+				IdTasDestination: transfert.IdTasDestination,
+				DateTransfert:    date(t, "2025-01-26"),
+				Qte:              30,
+				TypeCout:         "G",
+			})
+			return err
+		})
+		if err == nil {
+			t.Errorf("Transfert de 30 maps rendant le stock négatif après le 28/01 : erreur attendue")
+		}
+		// vidage antérieur au dernier mouvement du tas
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			return model.DesactiverTas(tx, ids.Tas, date(t, "2024-12-01"), "PO")
+		})
+		if err == nil {
+			t.Errorf("Vidage antérieur au dernier mouvement : erreur attendue")
+		}
+		// vidage : le stock restant sort du tas
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			return model.DesactiverTas(tx, ids.Tas, date(t, "2025-01-31"), "PO")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tas, err = model.GetTas(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Tas.Stock après vidage", 0, tas.Stock)
+		err = tas.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dernier := tas.EvolutionStock[len(tas.EvolutionStock)-1]
+		if dernier.TypeMvt != model.MVT_VIDAGE {
+			t.Errorf("Dernier mouvement : attendu %s, obtenu %s", model.MVT_VIDAGE, dernier.TypeMvt)
+		}
+		verifieValeur(t, "Mouvement vidage", -25, dernier.Delta)
+		// réouverture : la perte est annulée
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			return model.RouvrirTas(tx, ids.Tas)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tas, err = model.GetTasFull(db, ids.Tas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tas.Actif {
+			t.Errorf("Tas rouvert : actif attendu")
+		}
+		verifieValeur(t, "Tas.Stock après réouverture", 25, tas.Stock)
+		err = tas.ComputeEvolutionStock(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mvt := range tas.EvolutionStock {
+			if mvt.TypeMvt == model.MVT_VIDAGE {
+				t.Errorf("Tas rouvert : vidage annulé encore affiché (%.2f)", mvt.Delta)
+			}
+		}
+		// nouveau vidage, avec un autre motif
+		err = model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) error {
+			return model.DesactiverTas(tx, ids.Tas, date(t, "2025-01-31"), "PS")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pertes, err := model.ComputePertesVidageChantiers(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pertes) != 1 {
+			t.Fatalf("Pertes au vidage : attendu 1 chantier, obtenu %d", len(pertes))
+		}
+		verifieValeur(t, "Perte pourriture (annulée)", 0, pertes[0].Perte("PO"))
+		verifieValeur(t, "Perte poussière", 25, pertes[0].Perte("PS"))
+		verifieValeur(t, "Perte totale", 25, pertes[0].Total())
+	})
+
+	t.Run("valorisation-stock", func(t *testing.T) {
+		// au 30/01/2025 : 25 maps dans le tas d'origine, 10 dans le tas créé par le transfert
+		config := &model.Config{PourcentagePerte: 20}
+		ch, err := model.GetPlaqFull(db, ids.Chantier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// stockage compté jusqu'au 30/01/2025 seulement
+		err = ch.ComputeCoutsALaDate(db, config, date(t, "2025-01-30"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		coutMap := ch.CoutParMap.Total - ch.CoutParMap.Chargement - ch.CoutParMap.Livraison
+		for _, methode := range []string{model.VALO_STOCK_TAS, model.VALO_STOCK_FIFO} {
+			valo, err := model.ComputeValorisationStock(db, config, date(t, "2025-01-30"), methode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(valo.Stockages) != 2 {
+				t.Fatalf("Valorisation %s : attendu 2 hangars, obtenu %d", methode, len(valo.Stockages))
+			}
+			verifieValeur(t, "Valorisation "+methode+" : quantité", 35, valo.Qte())
+			verifieValeur(t, "Valorisation "+methode+" : valeur", 35*coutMap, valo.Valeur())
+		}
+		// après le vidage du tas d'origine
+		valo, err := model.ComputeValorisationStock(db, config, date(t, "2025-02-01"), model.VALO_STOCK_TAS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifieValeur(t, "Valorisation après vidage : quantité", 10, valo.Qte())
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		var n int
+		err := db.Get(&n, "select count(*) from audit where entite='plaq' and id_entite=$1 and login=$2", ids.Chantier, utilisateurTest().Login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("Audit création chantier : attendu 1 ligne, obtenu %d", n)
+		}
+	})
+}
+
+// ************************** Auxiliaires *******************************
+
+func utilisateurTest() *model.Utilisateur {
+	return &model.Utilisateur{Id: 1, Login: "test"}
+}
+
+// Insère le chantier, le transport, la vente, la livraison et le chargement du scénario
+func insereScenario(t *testing.T, db *sqlx.DB) (ids idsScenario) {
+	t.Helper()
+	err := model.WithTx(db, utilisateurTest(), func(tx model.DBOrTx) (err error) {
+		ch := &model.Plaq{
+			Titre:           "Chantier test",
+			DateDebut:       date(t, "2025-01-05"),
+			DateFin:         date(t, "2025-01-06"),
+			Surface:         5,
+			Granulo:         "P16",
+			Exploitation:    "1",
+			Essence:         "PS",
+			FraisRepas:      50,
+			FraisReparation: 30,
+			LiensParcelles: []*model.ChantierParcelle{
+				{IdParcelle: 1, Entiere: true},
+				{IdParcelle: 2, Entiere: true},
+			},
+		}
+		ids.Chantier, err = model.InsertPlaq(tx, ch, []int{ID_HANGAR}, []int{ID_UG}, []int{}, []int{})
+		if err != nil {
+			return err
+		}
+		err = tx.Get(&ids.Tas, "select id from tas where id_chantier=$1", ids.Chantier)
+		if err != nil {
+			return err
+		}
+		_, err = model.InsertPlaqOp(tx, &model.PlaqOp{
+			TypOp:      "DC",
+			IdChantier: ids.Chantier,
+			IdActeur:   ID_DECHIQUETEUR,
+			DateDebut:  date(t, "2025-01-05"),
+			DateFin:    date(t, "2025-01-06"),
+			Qte:        100,
+			Unite:      "MA",
+			PUHT:       5,
+			TVA:        20,
+		})
+		if err != nil {
+			return err
+		}
+		ids.Transport, err = model.InsertPlaqTrans(tx, &model.PlaqTrans{
+			IdChantier:     ids.Chantier,
+			IdTas:          ids.Tas,
+			IdTransporteur: ID_TRANSPORTEUR,
+			DateTrans:      date(t, "2025-01-10"),
+			Qte:            100,
+			PourcentPerte:  20,
+			TypeCout:       "G",
+			GlPrix:         200,
+			GlTVA:          20,
+		})
+		if err != nil {
+			return err
+		}
+		ids.Vente, err = model.InsertVentePlaq(tx, &model.VentePlaq{
+			IdClient:      ID_CLIENT,
+			IdFournisseur: ID_BDL,
+			PUHT:          30,
+			TVA:           5.5,
+			DateVente:     date(t, "2025-01-20"),
+		})
+		if err != nil {
+			return err
+		}
+		ids.Livraison, err = model.InsertVenteLivre(tx, &model.VenteLivre{
+			IdVente:   ids.Vente,
+			IdLivreur: ID_LIVREUR,
+			DateLivre: date(t, "2025-01-20"),
+			TypeCout:  "G",
+			GlPrix:    60,
+			GlTVA:     20,
+		})
+		if err != nil {
+			return err
+		}
+		ids.Chargement, err = model.InsertVenteCharge(tx, &model.VenteCharge{
+			IdLivraison: ids.Livraison,
+			IdChargeur:  ID_CHARGEUR,
+			IdTas:       ids.Tas,
+			Qte:         50,
+			DateCharge:  date(t, "2025-01-20"),
+			TypeCout:    "G",
+			GlPrix:      40,
+			GlTVA:       20,
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Erreur insertion du scénario : %v", err)
+	}
+	return ids
+}
+
+// Calcule l'affacture de janvier 2025 d'un acteur, pour tous les types d'activité
+func computeAffactureJanvier(t *testing.T, db *sqlx.DB, idActeur int) *model.Affacture {
+	t.Helper()
+	aff := &model.Affacture{
+		IdActeur:       idActeur,
+		DateDebut:      date(t, "2025-01-01"),
+		DateFin:        date(t, "2025-01-31"),
+		TypesActivites: model.AffactureTypesActivites,
+	}
+	err := aff.ComputeItems(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aff
+}
+
+func verifieCoutPlaq(t *testing.T, label string, attendu, obtenu model.CoutPlaq) {
+	t.Helper()
+	verifieValeur(t, label+".Abattage", attendu.Abattage, obtenu.Abattage)
+	verifieValeur(t, label+".Debardage", attendu.Debardage, obtenu.Debardage)
+	verifieValeur(t, label+".Dechiquetage", attendu.Dechiquetage, obtenu.Dechiquetage)
+	verifieValeur(t, label+".Broyage", attendu.Broyage, obtenu.Broyage)
+	verifieValeur(t, label+".FauxFrais", attendu.FauxFrais, obtenu.FauxFrais)
+	verifieValeur(t, label+".Transport", attendu.Transport, obtenu.Transport)
+	verifieValeur(t, label+".Rangement", attendu.Rangement, obtenu.Rangement)
+	verifieValeur(t, label+".Transfert", attendu.Transfert, obtenu.Transfert)
+	verifieValeur(t, label+".Stockage", attendu.Stockage, obtenu.Stockage)
+	verifieValeur(t, label+".Chargement", attendu.Chargement, obtenu.Chargement)
+	verifieValeur(t, label+".Livraison", attendu.Livraison, obtenu.Livraison)
+	verifieValeur(t, label+".Total", attendu.Total, obtenu.Total)
+}
@@ -0,0 +1,330 @@
+/*
+Inventaires physiques des tas d'un lieu de stockage.
+
+Un inventaire enregistre, à une date donnée, le stock mesuré de chaque tas d'un lieu de stockage.
+L'écart avec le stock calculé (somme des mouvements de stock à cette date)
+est enregistré comme mouvement de stock d'ajustement (MVT_AJUSTEMENT),
+qui apparaît dans Tas.EvolutionStock.
+
+Les inventaires ne sont pas modifiés ; pour corriger, supprimer puis recréer.
+La suppression ajoute les mouvements inverses des ajustements.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type Inventaire struct {
+	Id             int
+	IdStockage     int `db:"id_stockage"`
+	DateInventaire time.Time
+	Notes          string
+	// pas stocké en base
+	Stockage *Stockage
+	Lignes   []*InventaireTas
+}
+
+// Mesure d'un tas lors d'un inventaire
+type InventaireTas struct {
+	Id           int
+	IdInventaire int `db:"id_inventaire"`
+	IdTas        int `db:"id_tas"`
+	StockCalcule float64
+	StockMesure  float64
+	// pas stocké en base
+	Tas *Tas
+}
+
+// Ecarts d'inventaire d'un lieu de stockage pendant une saison
+type EcartsInventaireSaison struct {
+	Stockage      *Stockage
+	DateDebut     time.Time
+	DateFin       time.Time
+	NbInventaires int
+	StockCalcule  float64
+	StockMesure   float64
+}
+
+// ************************** Ecarts *******************************
+
+// Ecart en maps : > 0 si le tas contient plus que le stock calculé
+func (l *InventaireTas) Ecart() float64 {
+	return l.StockMesure - l.StockCalcule
+}
+
+func (inv *Inventaire) StockCalcule() (res float64) {
+	for _, l := range inv.Lignes {
+		res += l.StockCalcule
+	}
+	return res
+}
+
+func (inv *Inventaire) StockMesure() (res float64) {
+	for _, l := range inv.Lignes {
+		res += l.StockMesure
+	}
+	return res
+}
+
+func (inv *Inventaire) Ecart() float64 {
+	return inv.StockMesure() - inv.StockCalcule()
+}
+
+func (e *EcartsInventaireSaison) Ecart() float64 {
+	return e.StockMesure - e.StockCalcule
+}
+
+// Ecart en pourcentage du stock calculé
+func (e *EcartsInventaireSaison) PourcentEcart() float64 {
+	if e.StockCalcule == 0 {
+		return 0
+	}
+	return e.Ecart() * 100 / e.StockCalcule
+}
+
+// ************************** Get one *******************************
+
+func GetInventaire(db DBOrTx, id int) (inv *Inventaire, err error) {
+	inv = &Inventaire{}
+	query := "select * from inventaire where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(inv)
+	if err != nil {
+		return inv, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return inv, nil
+}
+
+// Renvoie un inventaire avec son lieu de stockage et ses lignes (avec les tas)
+func GetInventaireFull(db DBOrTx, id int) (inv *Inventaire, err error) {
+	inv, err = GetInventaire(db, id)
+	if err != nil {
+		return inv, werr.Wrapf(err, "Erreur appel GetInventaire()")
+	}
+	err = inv.ComputeStockage(db)
+	if err != nil {
+		return inv, werr.Wrapf(err, "Erreur appel Inventaire.ComputeStockage()")
+	}
+	err = inv.ComputeLignes(db)
+	if err != nil {
+		return inv, werr.Wrapf(err, "Erreur appel Inventaire.ComputeLignes()")
+	}
+	return inv, nil
+}
+
+// ************************** Get many *******************************
+
+// Renvoie tous les inventaires, avec leur lieu de stockage et leurs lignes,
+// du plus récent au plus ancien
+func GetInventairesFull(db DBOrTx) (res []*Inventaire, err error) {
+	res = []*Inventaire{}
+	ids := []int{}
+	query := "select id from inventaire order by dateinventaire desc, id desc"
+	err = db.Select(&ids, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, id := range ids {
+		inv, err := GetInventaireFull(db, id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetInventaireFull()")
+		}
+		res = append(res, inv)
+	}
+	return res, nil
+}
+
+// ************************** Compute *******************************
+
+func (inv *Inventaire) ComputeStockage(db DBOrTx) (err error) {
+	if inv.Stockage != nil {
+		return nil // déjà calculé
+	}
+	inv.Stockage, err = GetStockage(db, inv.IdStockage)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetStockage()")
+	}
+	return nil
+}
+
+func (inv *Inventaire) ComputeLignes(db DBOrTx) (err error) {
+	if len(inv.Lignes) != 0 {
+		return nil // déjà calculé
+	}
+	query := "select * from inventairetas where id_inventaire=$1 order by id"
+	err = db.Select(&inv.Lignes, query, inv.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, l := range inv.Lignes {
+		l.Tas, err = GetTasFull(db, l.IdTas)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetTasFull()")
+		}
+	}
+	return nil
+}
+
+// Calcule les écarts d'inventaire par lieu de stockage et par saison
+// Résultat trié par saison (la plus récente d'abord), puis par nom de lieu de stockage
+// @param limiteSaison  format JJ/MM (tiré de 'debut-saison' en conf)
+func ComputeEcartsInventaires(db DBOrTx, limiteSaison string) (res []*EcartsInventaireSaison, err error) {
+	res = []*EcartsInventaireSaison{}
+	inventaires, err := GetInventairesFull(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetInventairesFull()")
+	}
+	type cle struct {
+		idStockage int
+		debut      time.Time
+	}
+	ecarts := map[cle]*EcartsInventaireSaison{}
+	for _, inv := range inventaires {
+		debut, err := DebutSaison(limiteSaison, inv.DateInventaire)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel DebutSaison()")
+		}
+		k := cle{inv.IdStockage, debut}
+		if _, ok := ecarts[k]; !ok {
+			ecarts[k] = &EcartsInventaireSaison{
+				Stockage:  inv.Stockage,
+				DateDebut: debut,
+				DateFin:   debut.AddDate(1, 0, -1),
+			}
+			res = append(res, ecarts[k])
+		}
+		ecarts[k].NbInventaires++
+		ecarts[k].StockCalcule += inv.StockCalcule()
+		ecarts[k].StockMesure += inv.StockMesure()
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].DateDebut.Equal(res[j].DateDebut) {
+			return res[i].DateDebut.After(res[j].DateDebut)
+		}
+		return res[i].Stockage.Nom < res[j].Stockage.Nom
+	})
+	return res, nil
+}
+
+// ************************** CRUD *******************************
+
+// Enregistre un inventaire et crée les mouvements d'ajustement de stock.
+// Pour chaque ligne, seuls IdTas et StockMesure doivent être remplis :
+// StockCalcule est calculé ici, à partir des mouvements de stock du tas à la date de l'inventaire.
+// Les tas doivent être actifs et appartenir au lieu de stockage de l'inventaire.
+func InsertInventaire(db DBOrTx, inv *Inventaire) (id int, err error) {
+	if len(inv.Lignes) == 0 {
+		return 0, werr.New("Inventaire sans mesure de tas")
+	}
+	for _, l := range inv.Lignes {
+		tas, err := GetTas(db, l.IdTas)
+		if err != nil {
+			return 0, werr.Wrapf(err, "Erreur appel GetTas()")
+		}
+		if tas.IdStockage != inv.IdStockage || !tas.Actif {
+			return 0, werr.New(fmt.Sprintf("Le tas %d n'est pas un tas actif du lieu de stockage %d", l.IdTas, inv.IdStockage))
+		}
+		l.Tas = tas
+		l.StockCalcule, err = tas.StockALaDate(db, inv.DateInventaire)
+		if err != nil {
+			return 0, werr.Wrapf(err, "Erreur appel Tas.StockALaDate()")
+		}
+	}
+	query := `insert into inventaire(
+        id_stockage,
+        dateinventaire,
+        notes
+        ) values($1,$2,$3) returning id`
+	err = db.QueryRow(
+		query,
+		inv.IdStockage,
+		inv.DateInventaire,
+		inv.Notes).Scan(&id)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = `insert into inventairetas(
+        id_inventaire,
+        id_tas,
+        stockcalcule,
+        stockmesure
+        ) values($1,$2,$3,$4) returning id`
+	for _, l := range inv.Lignes {
+		l.IdInventaire = id
+		err = db.QueryRow(query, id, l.IdTas, l.StockCalcule, l.StockMesure).Scan(&l.Id)
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		if math.Abs(l.Ecart()) < TOLERANCE_STOCK {
+			continue
+		}
+		err = l.Tas.ModifierStock(db, MVT_AJUSTEMENT, id, inv.DateInventaire, l.Ecart())
+		if err != nil {
+			return id, werr.Wrapf(err, "Erreur appel Tas.ModifierStock()")
+		}
+	}
+	err = insertAudit(db, "inventaire", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return id, nil
+}
+
+// Supprime un inventaire ; les ajustements de stock sont annulés par des mouvements inverses.
+func DeleteInventaire(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "inventaire", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	inv, err := GetInventaire(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetInventaire()")
+	}
+	err = inv.ComputeLignes(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel Inventaire.ComputeLignes()")
+	}
+	for _, l := range inv.Lignes {
+		if math.Abs(l.Ecart()) < TOLERANCE_STOCK {
+			continue
+		}
+		err = l.Tas.ModifierStock(db, MVT_AJUSTEMENT, id, inv.DateInventaire, -l.Ecart())
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel Tas.ModifierStock()")
+		}
+	}
+	query := "delete from inventairetas where id_inventaire=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = "delete from inventaire where id=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "inventaire", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+// Supprime les mesures d'un tas dans les inventaires - uniquement utilisé lors de la suppression du tas.
+func deleteInventairesTas(db DBOrTx, idTas int) (err error) {
+	query := "delete from inventairetas where id_tas=$1"
+	_, err = db.Exec(query, idTas)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
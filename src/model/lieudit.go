@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 )
 
 type Lieudit struct {
@@ -24,7 +23,7 @@ type Lieudit struct {
 // Renvoie un Lieudit à partir de son id.
 // Contient les champs de la table lieudit.
 // Les autres champs ne sont pas remplis.
-func GetLieudit(db *sqlx.DB, id int) (ld *Lieudit, err error) {
+func GetLieudit(db DBOrTx, id int) (ld *Lieudit, err error) {
 	ld = &Lieudit{}
 	query := "select * from lieudit where id=$1"
 	row := db.QueryRowx(query, id)
@@ -38,7 +37,7 @@ func GetLieudit(db *sqlx.DB, id int) (ld *Lieudit, err error) {
 // Renvoie un Lieudit à partir de son nom.
 // Contient les champs de la table lieudit.
 // Les autres champs ne sont pas remplis.
-func GetLieuditByNom(db *sqlx.DB, nom string) (ld *Lieudit, err error) {
+func GetLieuditByNom(db DBOrTx, nom string) (ld *Lieudit, err error) {
 	ld = &Lieudit{}
 	query := "select * from lieudit where nom=$1"
 	row := db.QueryRowx(query, nom)
@@ -53,7 +52,7 @@ func GetLieuditByNom(db *sqlx.DB, nom string) (ld *Lieudit, err error) {
 
 // Renvoie des Lieudit à partir du début du nom.
 // Les mots comme LE LA LES DE DU D' ne sont pas pris en compte.
-func GetLieuditsAutocomplete(db *sqlx.DB, str string) (lds []*Lieudit, err error) {
+func GetLieuditsAutocomplete(db DBOrTx, str string) (lds []*Lieudit, err error) {
 	lds = []*Lieudit{}
 	query := "select id,nom from lieudit_mot where mot ilike '" + str + "%'"
 	err = db.Select(&lds, query)
@@ -67,7 +66,7 @@ func GetLieuditsAutocomplete(db *sqlx.DB, str string) (lds []*Lieudit, err error
 // Contient les champs de la table lieudit + le champ Communes.
 // Les autres champs ne sont pas remplis.
 // @param      strIdsUGs   Chaîne contenant les ids séparés par des virgules. ex : "1, 34, 87"
-func GetLieuditsFromIdsUGs(db *sqlx.DB, strIdsUGs string) (lds []*Lieudit, err error) {
+func GetLieuditsFromIdsUGs(db DBOrTx, strIdsUGs string) (lds []*Lieudit, err error) {
 	lds = []*Lieudit{}
 	query := `
 	    select * from lieudit where id in(
@@ -91,7 +90,7 @@ func GetLieuditsFromIdsUGs(db *sqlx.DB, strIdsUGs string) (lds []*Lieudit, err e
 // ************************** Compute *******************************
 
 // Remplit le champ Parcelles d'un Lieudit
-func (ld *Lieudit) ComputeParcelles(db *sqlx.DB) (err error) {
+func (ld *Lieudit) ComputeParcelles(db DBOrTx) (err error) {
 	if len(ld.Parcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -107,7 +106,7 @@ func (ld *Lieudit) ComputeParcelles(db *sqlx.DB) (err error) {
 }
 
 // Remplit le champ Communes d'un Lieudit
-func (ld *Lieudit) ComputeCommune(db *sqlx.DB) (err error) {
+func (ld *Lieudit) ComputeCommune(db DBOrTx) (err error) {
 	if len(ld.Communes) != 0 {
 		return nil // déjà calculé
 	}
@@ -0,0 +1,146 @@
+/*
+Mouvements de stock des tas : journal en ajout seul.
+
+Chaque opération qui fait changer le stock d'un tas (transport, chargement, vidage, ajustement, transfert)
+écrit un mouvement dans la même transaction que l'opération.
+Les mouvements ne sont jamais modifiés : la modification ou la suppression d'un transport
+ou d'un chargement ajoute un mouvement inverse, daté comme le mouvement annulé.
+Le stock d'un tas est la somme des qte de ses mouvements.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types de mouvement, champ TypeMvt
+const (
+	MVT_TRANSPORT  = "TR"
+	MVT_CHARGEMENT = "CG"
+	MVT_VIDAGE     = "VI"
+	MVT_AJUSTEMENT = "AJ"
+	MVT_TRANSFERT  = "TF"
+)
+
+// MouvementStock = opération qui fait changer le stock du tas :
+// transports, chargements, vidage, ajustements, transferts
+type MouvementStock struct {
+	Id           int
+	IdTas        int       `db:"id_tas"`
+	TypeMvt      string    // MVT_TRANSPORT etc.
+	IdLigne      int       `db:"id_ligne"` // id dans plaqtrans, ventecharge, inventaire ou plaqtransfert, selon TypeMvt
+	Date         time.Time `db:"datemvt"`
+	Delta        float64   `db:"qte"` // en maps sèches, > 0 pour une entrée
+	Motif        string    // pour les vidages, motif de la perte, cf LabelMotifPerte()
+	Notes        string
+	DateCreation time.Time
+	// pas stocké en base
+	Label string
+	URL   string
+}
+
+// Libellés des types de mouvement
+var labelsMouvementStock = map[string]string{
+	MVT_TRANSPORT:  "Transport",
+	MVT_CHARGEMENT: "Chargement",
+	MVT_VIDAGE:     "Vidage",
+	MVT_AJUSTEMENT: "Ajustement",
+	MVT_TRANSFERT:  "Transfert",
+}
+
+// ************************** Get many *******************************
+
+// Renvoie les mouvements d'un tas tels qu'enregistrés, y compris les mouvements inverses,
+// triés par date puis par ordre d'enregistrement.
+func GetMouvementsStockTas(db DBOrTx, idTas int) (res []*MouvementStock, err error) {
+	res = []*MouvementStock{}
+	query := "select * from mouvementstock where id_tas=$1 order by datemvt,id"
+	err = db.Select(&res, query, idTas)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, mvt := range res {
+		mvt.computeLabel()
+	}
+	return res, nil
+}
+
+// ************************** Compute *******************************
+
+// Calcule le champ Label ; pour un vidage, précise le motif de la perte
+func (mvt *MouvementStock) computeLabel() {
+	mvt.Label = labelsMouvementStock[mvt.TypeMvt]
+	if mvt.TypeMvt == MVT_VIDAGE {
+		mvt.Label += " (" + strings.ToLower(LabelMotifPerte(mvt.Motif)) + ")"
+	}
+}
+
+// Calcule le champ URL : lien vers le chantier (transport, transfert), la vente (chargement)
+// ou les inventaires (ajustement).
+// Note : en théorie, l'url ne devrait pas être calculée dans le model mais dans le controller
+func (mvt *MouvementStock) ComputeURL(db DBOrTx, idChantier int) (err error) {
+	switch mvt.TypeMvt {
+	case MVT_CHARGEMENT:
+		vc, err := GetVenteCharge(db, mvt.IdLigne)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetVenteCharge()")
+		}
+		err = vc.ComputeIdVente(db)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel ComputeIdVente()")
+		}
+		mvt.URL = "/vente/" + strconv.Itoa(vc.IdVente)
+	case MVT_AJUSTEMENT:
+		mvt.URL = "/stockage/inventaires"
+	default:
+		mvt.URL = "/chantier/plaquette/" + strconv.Itoa(idChantier) + "/chantiers"
+	}
+	return nil
+}
+
+// ************************** CRUD *******************************
+
+// Ajoute un mouvement au journal.
+// Pas d'audit : le mouvement est écrit dans la transaction de l'opération qui l'a causé,
+// qui est elle-même auditée.
+func InsertMouvementStock(db DBOrTx, mvt *MouvementStock) (id int, err error) {
+	query := `insert into mouvementstock(
+        id_tas,
+        typemvt,
+        id_ligne,
+        datemvt,
+        qte,
+        motif,
+        notes
+        ) values($1,$2,$3,$4,$5,$6,$7) returning id`
+	err = db.QueryRow(
+		query,
+		mvt.IdTas,
+		mvt.TypeMvt,
+		mvt.IdLigne,
+		mvt.Date,
+		mvt.Delta,
+		mvt.Motif,
+		mvt.Notes).Scan(&id)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return id, nil
+}
+
+// Supprime les mouvements d'un tas - uniquement utilisé lors de la suppression du tas.
+func deleteMouvementsStockTas(db DBOrTx, idTas int) (err error) {
+	query := "delete from mouvementstock where id_tas=$1"
+	_, err = db.Exec(query, idTas)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
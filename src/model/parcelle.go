@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/wilk/werr"
 	"database/sql"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -45,7 +44,7 @@ func (p *Parcelle) String() string {
 // ************************** Get one *******************************
 
 // Renvoie une Parcelle à partir de son id.
-func GetParcelle(db *sqlx.DB, id int) (p *Parcelle, err error) {
+func GetParcelle(db DBOrTx, id int) (p *Parcelle, err error) {
 	p = &Parcelle{}
 	query := "select * from parcelle where id=$1"
 	row := db.QueryRowx(query, id)
@@ -59,7 +58,7 @@ func GetParcelle(db *sqlx.DB, id int) (p *Parcelle, err error) {
 // Renvoie une Parcelle à partir de son code et de l'id de la commune.
 // (id de la commune nécessaire car le code est unique au sein de la commune,
 // donc plusieurs parcelles avec le même code existent en base).
-func GetParcelleFromCodeAndCommuneId(db *sqlx.DB, codeParcelle string, idCommune int) (p *Parcelle, err error) {
+func GetParcelleFromCodeAndCommuneId(db DBOrTx, codeParcelle string, idCommune int) (p *Parcelle, err error) {
 	p = &Parcelle{}
 	query := "select * from parcelle where code=$1 and id_commune=$2"
 	row := db.QueryRowx(query, codeParcelle, strconv.Itoa(idCommune))
@@ -80,7 +79,7 @@ func GetParcelleFromCodeAndCommuneId(db *sqlx.DB, codeParcelle string, idCommune
 
 // Utilisé par ajax
 // @param  idsUG  string, par ex : "12,432,35"
-func GetParcellesFromIdsUGs(db *sqlx.DB, idsUG string) (result []*Parcelle, err error) {
+func GetParcellesFromIdsUGs(db DBOrTx, idsUG string) (result []*Parcelle, err error) {
 	query := `select * from parcelle where id in(select id_parcelle from parcelle_ug where id_ug in(` + idsUG + `)) order by code`
 	err = db.Select(&result, query)
 	return result, nil
@@ -88,7 +87,7 @@ func GetParcellesFromIdsUGs(db *sqlx.DB, idsUG string) (result []*Parcelle, err
 
 // ************************** Compute *******************************
 
-func (p *Parcelle) ComputeProprietaire(db *sqlx.DB) (err error) {
+func (p *Parcelle) ComputeProprietaire(db DBOrTx) (err error) {
 	p.Proprietaire, err = GetActeur(db, p.IdProprietaire)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel GetActeur()")
@@ -96,7 +95,7 @@ func (p *Parcelle) ComputeProprietaire(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (p *Parcelle) ComputeLieudits(db *sqlx.DB) (err error) {
+func (p *Parcelle) ComputeLieudits(db DBOrTx) (err error) {
 	if len(p.Lieudits) != 0 {
 		return nil // déjà calculé
 	}
@@ -111,7 +110,7 @@ func (p *Parcelle) ComputeLieudits(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (p *Parcelle) ComputeCommune(db *sqlx.DB) (err error) {
+func (p *Parcelle) ComputeCommune(db DBOrTx) (err error) {
 	if p.Commune != nil {
 		return nil // déjà calculé
 	}
@@ -122,7 +121,7 @@ func (p *Parcelle) ComputeCommune(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (p *Parcelle) ComputeFermiers(db *sqlx.DB) (err error) {
+func (p *Parcelle) ComputeFermiers(db DBOrTx) (err error) {
 	if len(p.Fermiers) != 0 {
 		return nil // déjà calculé
 	}
@@ -137,7 +136,7 @@ func (p *Parcelle) ComputeFermiers(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (p *Parcelle) ComputeUGs(db *sqlx.DB) (err error) {
+func (p *Parcelle) ComputeUGs(db DBOrTx) (err error) {
 	query := `
 	    select * from ug where id in(
 	        select id_ug from parcelle_ug where id_parcelle=$1
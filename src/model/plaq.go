@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -40,6 +39,7 @@ type Plaq struct {
 	Operations     []*PlaqOp
 	Transports     []*PlaqTrans
 	Rangements     []*PlaqRange
+	Transferts     []*PlaqTransfert
 	Ventes         []*VentePlaq
 	CoutTotal      *CoutPlaq
 	CoutParMap     *CoutPlaq
@@ -54,6 +54,7 @@ type CoutPlaq struct {
 	FauxFrais    float64 // repas et réparation
 	Transport    float64
 	Rangement    float64
+	Transfert    float64 // transferts entre lieux de stockage
 	Stockage     float64
 	Chargement   float64
 	Livraison    float64
@@ -64,7 +65,7 @@ type CoutPlaq struct {
 // ************************** Manipulation Volume *******************************
 
 // @param   vol en maps
-func (ch *Plaq) ModifierVolume(db *sqlx.DB, vol float64) {
+func (ch *Plaq) ModifierVolume(db DBOrTx, vol float64) {
 	ch.Volume += vol
 }
 
@@ -99,7 +100,7 @@ func (ch *Plaq) String() string {
 
 // Renvoie un chantier plaquette
 // contenant uniquement les données stockées en base
-func GetPlaq(db *sqlx.DB, idChantier int) (*Plaq, error) {
+func GetPlaq(db DBOrTx, idChantier int) (*Plaq, error) {
 	ch := &Plaq{}
 	query := "select * from plaq where id=$1"
 	row := db.QueryRowx(query, idChantier)
@@ -120,7 +121,8 @@ func GetPlaq(db *sqlx.DB, idChantier int) (*Plaq, error) {
 //   - les opérations simples (abattage...)
 //   - les transports vers le stockage
 //   - les opérations de rangement
-func GetPlaqFull(db *sqlx.DB, idChantier int) (*Plaq, error) {
+//   - les transferts entre lieux de stockage
+func GetPlaqFull(db DBOrTx, idChantier int) (*Plaq, error) {
 	ch, err := GetPlaq(db, idChantier)
 	if err != nil {
 		return ch, werr.Wrapf(err, "Erreur appel GetPlaq()")
@@ -157,6 +159,10 @@ func GetPlaqFull(db *sqlx.DB, idChantier int) (*Plaq, error) {
 	if err != nil {
 		return ch, werr.Wrapf(err, "Erreur appel Plaq.ComputeRangements()")
 	}
+	err = ch.ComputeTransferts(db)
+	if err != nil {
+		return ch, werr.Wrapf(err, "Erreur appel Plaq.ComputeTransferts()")
+	}
 	err = ch.ComputeTas(db)
 	if err != nil {
 		return ch, werr.Wrapf(err, "Erreur appel Plaq.ComputeTas()")
@@ -175,7 +181,7 @@ func GetPlaqFull(db *sqlx.DB, idChantier int) (*Plaq, error) {
 // Renvoie la liste des années ayant des chantiers bois sur pied,
 // triées par ordre chronologique inverse.
 // @param exclude   Année à exclure du résultat
-func GetPlaqDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
+func GetPlaqDifferentYears(db DBOrTx, exclude string) ([]string, error) {
 	res := []string{}
 	list := []time.Time{}
 	query := "select datedeb from plaq order by datedeb desc"
@@ -194,7 +200,7 @@ func GetPlaqDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
 
 // Renvoie la liste des chantiers plaquettes pour une année donnée,
 // Chaque chantier contient les mêmes champs que ceux renvoyés par GetPlaqFull()
-func GetPlaqsOfYear(db *sqlx.DB, annee string) ([]*Plaq, error) {
+func GetPlaqsOfYear(db DBOrTx, annee string) ([]*Plaq, error) {
 	res := []*Plaq{}
 	type ligne struct {
 		Id      int
@@ -218,7 +224,7 @@ func GetPlaqsOfYear(db *sqlx.DB, annee string) ([]*Plaq, error) {
 }
 
 // Renvoie la liste des chantiers plaquettes ayant des tas (stockage) vides
-func GetAllPlaqsVides(db *sqlx.DB) ([]*Plaq, error) {
+func GetAllPlaqsVides(db DBOrTx) ([]*Plaq, error) {
 	res := []*Plaq{}
 	var err error
 	var idsChantier []int
@@ -257,7 +263,7 @@ func GetAllPlaqsVides(db *sqlx.DB) ([]*Plaq, error) {
 
 // ************************** Compute *******************************
 
-func (ch *Plaq) ComputeUGs(db *sqlx.DB) (err error) {
+func (ch *Plaq) ComputeUGs(db DBOrTx) (err error) {
 	if len(ch.UGs) != 0 {
 		return nil // déjà calculé
 	}
@@ -268,7 +274,7 @@ func (ch *Plaq) ComputeUGs(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Plaq) ComputeLiensParcelles(db *sqlx.DB) (err error) {
+func (ch *Plaq) ComputeLiensParcelles(db DBOrTx) (err error) {
 	if len(ch.LiensParcelles) != 0 {
 		return nil
 	}
@@ -279,7 +285,7 @@ func (ch *Plaq) ComputeLiensParcelles(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Plaq) ComputeLieudits(db *sqlx.DB) (err error) {
+func (ch *Plaq) ComputeLieudits(db DBOrTx) (err error) {
 	if len(ch.Lieudits) != 0 {
 		return nil // déjà calculé
 	}
@@ -290,7 +296,7 @@ func (ch *Plaq) ComputeLieudits(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ch *Plaq) ComputeFermiers(db *sqlx.DB) (err error) {
+func (ch *Plaq) ComputeFermiers(db DBOrTx) (err error) {
 	if len(ch.Fermiers) != 0 {
 		return nil // déjà calculé
 	}
@@ -304,7 +310,7 @@ func (ch *Plaq) ComputeFermiers(db *sqlx.DB) (err error) {
 // Attention, deux calculs possibles du volume vert :
 // - Somme des quantités déchiquetées (utilisée ici)
 // - Somme des quantités transportées dans les tas
-func (ch *Plaq) ComputeVolume(db *sqlx.DB) error {
+func (ch *Plaq) ComputeVolume(db DBOrTx) error {
 	var volumes []float64
 	query := "select qte from plaqop where id_chantier=$1 and typop='DC'" // déchiquetage
 	err := db.Select(&volumes, query, ch.Id)
@@ -318,7 +324,7 @@ func (ch *Plaq) ComputeVolume(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Plaq) ComputeOperations(db *sqlx.DB) error {
+func (ch *Plaq) ComputeOperations(db DBOrTx) error {
 	if len(ch.Operations) != 0 {
 		return nil
 	}
@@ -333,7 +339,7 @@ func (ch *Plaq) ComputeOperations(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Plaq) ComputeTransports(db *sqlx.DB) error {
+func (ch *Plaq) ComputeTransports(db DBOrTx) error {
 	if len(ch.Transports) != 0 {
 		return nil
 	}
@@ -351,7 +357,7 @@ func (ch *Plaq) ComputeTransports(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Plaq) ComputeRangements(db *sqlx.DB) error {
+func (ch *Plaq) ComputeRangements(db DBOrTx) error {
 	if len(ch.Rangements) != 0 {
 		return nil
 	}
@@ -369,8 +375,26 @@ func (ch *Plaq) ComputeRangements(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Plaq) ComputeTas(db *sqlx.DB) error {
-	query := "select * from tas where id_chantier=$1"
+func (ch *Plaq) ComputeTransferts(db DBOrTx) error {
+	if len(ch.Transferts) != 0 {
+		return nil
+	}
+	query := "select * from plaqtransfert where id_chantier=$1 order by datetransfert"
+	err := db.Select(&ch.Transferts, query, &ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for i, _ := range ch.Transferts {
+		ch.Transferts[i].ComputeTas(db)
+		ch.Transferts[i].ComputeTransporteur(db)
+		ch.Transferts[i].ComputeConducteur(db)
+		ch.Transferts[i].ComputeProprioutil(db)
+	}
+	return nil
+}
+
+func (ch *Plaq) ComputeTas(db DBOrTx) error {
+	query := SELECT_TAS + " where id_chantier=$1"
 	err := db.Select(&ch.Tas, query, &ch.Id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -391,7 +415,7 @@ func (ch *Plaq) ComputeTas(db *sqlx.DB) error {
 	return nil
 }
 
-func (ch *Plaq) ComputeVentes(db *sqlx.DB) error {
+func (ch *Plaq) ComputeVentes(db DBOrTx) error {
 	ids := []int{}
 	query := `select id_vente from ventelivre where id in (
                   select id_livraison from ventecharge where id_tas in(
@@ -417,9 +441,17 @@ func (ch *Plaq) ComputeVentes(db *sqlx.DB) error {
 	return nil
 }
 
-// Calcule les différents coûts d'exploitation
+// Calcule les différents coûts d'exploitation, à ce jour
+// Doit être effectué sur un chantier obtenu par GetPlaqFull() - pas de vérification d'erreur
+func (ch *Plaq) ComputeCouts(db DBOrTx, config *Config) (err error) {
+	return ch.ComputeCoutsALaDate(db, config, time.Now())
+}
+
+// Calcule les différents coûts d'exploitation à la fin de la journée date :
+// le stockage n'est compté que jusqu'à cette date, et les transferts postérieurs ne sont pas comptés.
 // Doit être effectué sur un chantier obtenu par GetPlaqFull() - pas de vérification d'erreur
-func (ch *Plaq) ComputeCouts(db *sqlx.DB, config *Config) (err error) {
+func (ch *Plaq) ComputeCoutsALaDate(db DBOrTx, config *Config, date time.Time) (err error) {
+	fin := jour(date)
 	if ch.Volume == 0 {
 		// valeurs par défaut, tous les coûts restent à 0
 		return nil
@@ -493,6 +525,20 @@ func (ch *Plaq) ComputeCouts(db *sqlx.DB, config *Config) (err error) {
 	ch.CoutTotal.Rangement = cout
 	ch.CoutTotal.Total += ch.CoutTotal.Rangement
 	//
+	// Transferts entre lieux de stockage
+	//
+	cout = 0
+	for _, t := range ch.Transferts {
+		if jour(t.DateTransfert).After(fin) {
+			continue
+		}
+		cout += t.CoutHT()
+	}
+	ch.CoutParMap.Transfert = cout / nMapSec
+	ch.CoutParMap.Total += ch.CoutParMap.Transfert
+	ch.CoutTotal.Transfert = cout
+	ch.CoutTotal.Total += ch.CoutTotal.Transfert
+	//
 	// Chargement et livraisons
 	//
 	var coutC, coutL float64
@@ -523,7 +569,7 @@ func (ch *Plaq) ComputeCouts(db *sqlx.DB, config *Config) (err error) {
 	//
 	// Stockage
 	//
-	err = ch.computeCoutStockage(db)
+	err = ch.computeCoutStockage(db, nMapSec, fin)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel computeCoutStockage()")
 	}
@@ -531,6 +577,7 @@ func (ch *Plaq) ComputeCouts(db *sqlx.DB, config *Config) (err error) {
 	ch.CoutTotal.Livraison = coutL
 	ch.CoutTotal.Total += ch.CoutTotal.Chargement
 	ch.CoutTotal.Total += ch.CoutTotal.Livraison
+	ch.CoutTotal.Total += ch.CoutTotal.Stockage
 	ch.CoutParMap.Chargement = coutC / nMapSec
 	ch.CoutParMap.Livraison = coutL / nMapSec
 	ch.CoutParMap.Total += ch.CoutParMap.Chargement
@@ -540,57 +587,109 @@ func (ch *Plaq) ComputeCouts(db *sqlx.DB, config *Config) (err error) {
 	return nil
 }
 
-// Calcule ch.CoutParMap.Stockage
-// Auxiliaire de ComputeCouts(), donc ch est obtenu par GetPlaqFull()
-func (ch *Plaq) computeCoutStockage(db *sqlx.DB) (err error) {
+// Calcule ch.CoutTotal.Stockage et ch.CoutParMap.Stockage
+// Auxiliaire de ComputeCoutsALaDate(), donc ch est obtenu par GetPlaqFull()
+//
+// Pour chaque tas du chantier :
+//   - période considérée = du premier mouvement de stock du tas
+//     jusqu'à sa date de vidage (ou jusqu'à fin si le tas n'est pas vide), sans dépasser fin
+//   - chaque jour, le coût du hangar (cf Stockage.ComputeCout()) est partagé
+//     entre les tas présents dans le hangar ce jour-là, au prorata de leur stock.
+//
+// Les jours où le hangar ne contient aucun tas, ses frais ne sont attribués à aucun chantier.
+// Le stock journalier de chaque hangar est calculé une seule fois (cf Stockage.stocksJournaliers()).
+func (ch *Plaq) computeCoutStockage(db DBOrTx, nMapSec float64, fin time.Time) (err error) {
+	type periodeTas struct {
+		tas    *Tas
+		jD, jF time.Time
+	}
+	periodes := []periodeTas{}
+	bornes := map[int][2]time.Time{} // id stockage => période couvrant tous les tas du chantier
+	for _, t := range ch.Tas {
+		err = t.ComputeEvolutionStock(db)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel Tas.ComputeEvolutionStock()")
+		}
+		if len(t.EvolutionStock) == 0 {
+			continue
+		}
+		jD := jour(t.EvolutionStock[0].Date)
+		jF := jour(t.EvolutionStock[len(t.EvolutionStock)-1].Date)
+		if t.Actif {
+			jF = fin
+		} else if jour(t.DateVidage).After(jF) {
+			jF = jour(t.DateVidage)
+		}
+		if jF.After(fin) {
+			jF = fin
+		}
+		if jF.Before(jD) {
+			continue
+		}
+		periodes = append(periodes, periodeTas{tas: t, jD: jD, jF: jF})
+		b, ok := bornes[t.IdStockage]
+		if !ok || jD.Before(b[0]) {
+			b[0] = jD
+		}
+		if !ok || jF.After(b[1]) {
+			b[1] = jF
+		}
+		bornes[t.IdStockage] = b
+	}
 	//
-	// Calcule tous les hangars (Stockage) contenant des tas liés à ce chantier
+	// Coûts et stock total de chaque hangar pour chaque jour, tous chantiers confondus,
+	// calculés une seule fois par hangar
 	//
-	var stockages []*Stockage
-	for _, t := range ch.Tas {
-		s, err := GetStockage(db, t.IdStockage)
+	couts := map[int][]float64{}
+	stocksHangar := map[int][]float64{}
+	for idStockage, b := range bornes {
+		s := &Stockage{Id: idStockage}
+		couts[idStockage], err = s.ComputeCout(db, b[0].Format("2006-01-02"), b[1].Format("2006-01-02"))
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel Stockage.ComputeCout()")
+		}
+		stocksHangar[idStockage], err = s.stocksJournaliers(db, b[0], b[1])
 		if err != nil {
-			return werr.Wrapf(err, "Erreur appel GetStockage()")
-		}
-		stockages = append(stockages, s)
-	}
-
-	// j1, j2, DATE_MIN, DATE_MAX utilisés pour coût stockage
-	// j1 = date du premier transport
-	// j2 = date du dernier chargement
-	/*
-		DATE_MAX, _ := time.Parse("2006-01-02", "2999-12-31")
-		DATE_MIN, _ := time.Parse("2006-01-02", "1999-12-31")
-		j1 := DATE_MAX
-		j2 := DATE_MIN
-	*/
-	/*
-	   // TODO commenté car besoin de trouver le mode de calcul
-	   var tas *Tas
-	   cout = 0
-	   // s'il y a au moins un transport et un chargement
-	   if j1 != DATE_MAX && j2 != DATE_MIN {
-	       // vérifie que tous les tas du chantier ont été déclarés vides
-	       vides := true
-	       for _, tas = range(ch.Tas){
-	           if tas.Actif {
-	               vides = false
-	           }
-	       }
-	       if vides == true {
-
-	       }
-	   }
-	*/
+			return werr.Wrapf(err, "Erreur appel Stockage.stocksJournaliers()")
+		}
+	}
+	//
+	// Part des tas du chantier
+	//
+	for _, p := range periodes {
+		idStockage := p.tas.IdStockage
+		decalage := nbJours(bornes[idStockage][0], p.jD) - 1
+		for k, stock := range p.tas.stocksJournaliers(p.jD, p.jF) {
+			if stocksHangar[idStockage][decalage+k] > 0 {
+				ch.CoutTotal.Stockage += couts[idStockage][decalage+k] * stock / stocksHangar[idStockage][decalage+k]
+			}
+		}
+	}
+	ch.CoutParMap.Stockage = ch.CoutTotal.Stockage / nMapSec
 	return nil
 }
 
+// Renvoie le montant HT des ventes de plaquettes provenant des tas du chantier.
+// Chaque chargement est valorisé au prix unitaire de la vente correspondante.
+func (ch *Plaq) computeRecetteVentes(db DBOrTx) (res float64, err error) {
+	query := `
+        select coalesce(sum(ventecharge.qte * venteplaq.puht), 0) from ventecharge
+            join ventelivre on ventecharge.id_livraison=ventelivre.id
+            join venteplaq on ventelivre.id_vente=venteplaq.id
+        where ventecharge.id_tas in(select id from tas where id_chantier=$1)`
+	err = db.Get(&res, query, ch.Id)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return res, nil
+}
+
 // ************************** CRUD *******************************
 
 // Insère un chantier plaquette en base
 // + Crée et insère en base le(s) tas (crée un Tas par lieu de stockage)
 // + Insère en base les liens UGs, parcelles, lieux-dits, fermiers
-func InsertPlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermier []int) (idChantier int, err error) {
+func InsertPlaq(db DBOrTx, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermier []int) (idChantier int, err error) {
 	query := `insert into plaq(
         titre,
         datedeb,
@@ -623,7 +722,7 @@ func InsertPlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermi
 	// tas - crée un tas par lieu de stockage sélectionné
 	//
 	for _, idStockage := range idsStockages {
-		tas := NewTas(idStockage, idChantier, 0, true)
+		tas := NewTas(idStockage, idChantier, true)
 		_, err = InsertTas(db, tas)
 		if err != nil {
 			return idChantier, werr.Wrapf(err, "Erreur appel InsertTas()")
@@ -652,6 +751,10 @@ func InsertPlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermi
 		return idChantier, werr.Wrapf(err, "Erreur appel insertLiensChantierFermier()")
 	}
 	//
+	err = insertAudit(db, "plaq", idChantier, AUDIT_INSERT, "")
+	if err != nil {
+		return idChantier, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return idChantier, nil
 }
 
@@ -660,7 +763,11 @@ func InsertPlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermi
 // + MAJ en base les liens UGs, parcelles, lieux-dits, fermiers
 //
 // @param idsStockages ids tas APRÈS update
-func UpdatePlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermier []int) (err error) {
+func UpdatePlaq(db DBOrTx, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermier []int) (err error) {
+	avant, err := auditEtat(db, "plaq", ch.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update plaq set(
 	    titre,
         datedeb,
@@ -725,7 +832,7 @@ func UpdatePlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermi
 	// si AP et pas AV => créer tas AP
 	for _, ap := range idsStockageAP {
 		if !tiglib.InArray(ap, idsStockageAV) {
-			tas := NewTas(ap, ch.Id, 0, true)
+			tas := NewTas(ap, ch.Id, true)
 			_, err = InsertTas(db, tas)
 			if err != nil {
 				return werr.Wrapf(err, "Erreur appel InsertTas()")
@@ -755,10 +862,18 @@ func UpdatePlaq(db *sqlx.DB, ch *Plaq, idsStockages, idsUG, idsLieudit, idsFermi
 		return werr.Wrapf(err, "Erreur appel updateLiensChantierFermier()")
 	}
 	//
+	err = insertAudit(db, "plaq", ch.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeletePlaq(db *sqlx.DB, id int) (err error) {
+func DeletePlaq(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "plaq", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	var query string
 	var ids []int
 	var deletedId int
@@ -777,9 +892,25 @@ func DeletePlaq(db *sqlx.DB, id int) (err error) {
 		}
 	}
 	//
+	// delete transferts associés à ce chantier
+	//
+	query = "select id from plaqtransfert where id_chantier=$1"
+	ids = []int{} // Select() ajoute à la fin de la slice, ne pas réutiliser les ids précédents
+	err = db.Select(&ids, query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, deletedId = range ids {
+		err = DeletePlaqTransfert(db, deletedId)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur DeletePlaqTransfert()")
+		}
+	}
+	//
 	// delete rangements associés à ce chantier
 	//
 	query = "select id from plaqrange where id_chantier=$1"
+	ids = []int{} // Select() ajoute à la fin de la slice, ne pas réutiliser les ids précédents
 	err = db.Select(&ids, query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -794,6 +925,7 @@ func DeletePlaq(db *sqlx.DB, id int) (err error) {
 	// delete opérations simples associées à ce chantier
 	//
 	query = "select id from plaqop where id_chantier=$1"
+	ids = []int{}
 	err = db.Select(&ids, query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -808,6 +940,7 @@ func DeletePlaq(db *sqlx.DB, id int) (err error) {
 	// delete tas associés à ce chantier
 	//
 	query = "select id from tas where id_chantier=$1"
+	ids = []int{}
 	err = db.Select(&ids, query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -848,5 +981,9 @@ func DeletePlaq(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaq", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -10,7 +10,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -50,7 +49,7 @@ func (op *PlaqOp) RoleName() string {
 
 // ************************** Get *******************************
 
-func GetPlaqOp(db *sqlx.DB, id int) (op *PlaqOp, err error) {
+func GetPlaqOp(db DBOrTx, id int) (op *PlaqOp, err error) {
 	op = &PlaqOp{}
 	query := "select * from plaqop where id=$1"
 	row := db.QueryRowx(query, id)
@@ -64,7 +63,7 @@ func GetPlaqOp(db *sqlx.DB, id int) (op *PlaqOp, err error) {
 // ************************** Compute *******************************
 
 // Remplit le champ Acteur d'une opération
-func (op *PlaqOp) ComputeActeur(db *sqlx.DB) (err error) {
+func (op *PlaqOp) ComputeActeur(db DBOrTx) (err error) {
 	if op.Acteur != nil {
 		return nil // déjà calculé
 	}
@@ -77,7 +76,7 @@ func (op *PlaqOp) ComputeActeur(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertPlaqOp(db *sqlx.DB, op *PlaqOp) (id int, err error) {
+func InsertPlaqOp(db DBOrTx, op *PlaqOp) (id int, err error) {
 	query := `insert into plaqop(
 	    typop,
 	    id_chantier,
@@ -107,10 +106,18 @@ func InsertPlaqOp(db *sqlx.DB, op *PlaqOp) (id int, err error) {
 	if err != nil {
 		return id, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqop", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdatePlaqOp(db *sqlx.DB, op *PlaqOp) (err error) {
+func UpdatePlaqOp(db DBOrTx, op *PlaqOp) (err error) {
+	avant, err := auditEtat(db, "plaqop", op.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update plaqop set(
         typop,
         id_chantier,
@@ -141,14 +148,26 @@ func UpdatePlaqOp(db *sqlx.DB, op *PlaqOp) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqop", op.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeletePlaqOp(db *sqlx.DB, id int) (err error) {
+func DeletePlaqOp(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "plaqop", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from plaqop where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqop", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
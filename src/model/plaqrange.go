@@ -11,7 +11,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -49,7 +48,7 @@ type PlaqRange struct {
 
 // ************************** Get *******************************
 
-func GetPlaqRange(db *sqlx.DB, id int) (pr *PlaqRange, err error) {
+func GetPlaqRange(db DBOrTx, id int) (pr *PlaqRange, err error) {
 	pr = &PlaqRange{}
 	query := "select * from plaqrange where id=$1"
 	row := db.QueryRowx(query, id)
@@ -61,7 +60,7 @@ func GetPlaqRange(db *sqlx.DB, id int) (pr *PlaqRange, err error) {
 }
 
 // Calcule tous les champs utile à l'affichage d'un formulaire PlaqRange
-func GetPlaqRangeFull(db *sqlx.DB, id int) (pr *PlaqRange, err error) {
+func GetPlaqRangeFull(db DBOrTx, id int) (pr *PlaqRange, err error) {
 	pr, err = GetPlaqRange(db, id)
 	if err != nil {
 		return nil, werr.Wrapf(err, "Erreur appel GetPlaqRange()")
@@ -95,7 +94,7 @@ func GetPlaqRangeFull(db *sqlx.DB, id int) (pr *PlaqRange, err error) {
 
 // ************************** Compute *******************************
 
-func (pr *PlaqRange) ComputeTas(db *sqlx.DB) (err error) {
+func (pr *PlaqRange) ComputeTas(db DBOrTx) (err error) {
 	if pr.Tas != nil {
 		return nil // déjà calculé
 	}
@@ -106,7 +105,7 @@ func (pr *PlaqRange) ComputeTas(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pr *PlaqRange) ComputeRangeur(db *sqlx.DB) (err error) {
+func (pr *PlaqRange) ComputeRangeur(db DBOrTx) (err error) {
 	if pr.IdRangeur == 0 {
 		return nil // pas de rangeur (mais conducteur et proprioutil)
 	}
@@ -120,7 +119,7 @@ func (pr *PlaqRange) ComputeRangeur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pr *PlaqRange) ComputeConducteur(db *sqlx.DB) (err error) {
+func (pr *PlaqRange) ComputeConducteur(db DBOrTx) (err error) {
 	if pr.IdConducteur == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un rangeur)
 	}
@@ -134,7 +133,7 @@ func (pr *PlaqRange) ComputeConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pr *PlaqRange) ComputeProprioutil(db *sqlx.DB) (err error) {
+func (pr *PlaqRange) ComputeProprioutil(db DBOrTx) (err error) {
 	if pr.IdProprioutil == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un rangeur)
 	}
@@ -150,7 +149,7 @@ func (pr *PlaqRange) ComputeProprioutil(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertPlaqRange(db *sqlx.DB, pr *PlaqRange) (id int, err error) {
+func InsertPlaqRange(db DBOrTx, pr *PlaqRange) (id int, err error) {
 	query := `insert into plaqrange(
         id_chantier,
         id_tas,
@@ -194,10 +193,18 @@ func InsertPlaqRange(db *sqlx.DB, pr *PlaqRange) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqrange", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdatePlaqRange(db *sqlx.DB, pr *PlaqRange) (err error) {
+func UpdatePlaqRange(db DBOrTx, pr *PlaqRange) (err error) {
+	avant, err := auditEtat(db, "plaqrange", pr.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update plaqrange set(
         id_chantier,
         id_tas,
@@ -242,14 +249,26 @@ func UpdatePlaqRange(db *sqlx.DB, pr *PlaqRange) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqrange", pr.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeletePlaqRange(db *sqlx.DB, id int) (err error) {
+func DeletePlaqRange(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "plaqrange", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from plaqrange where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqrange", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
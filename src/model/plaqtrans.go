@@ -10,7 +10,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -56,7 +55,7 @@ type PlaqTrans struct {
 
 // ************************** Get *******************************
 
-func GetPlaqTrans(db *sqlx.DB, id int) (pt *PlaqTrans, err error) {
+func GetPlaqTrans(db DBOrTx, id int) (pt *PlaqTrans, err error) {
 	pt = &PlaqTrans{}
 	query := "select * from plaqtrans where id=$1"
 	row := db.QueryRowx(query, id)
@@ -69,7 +68,7 @@ func GetPlaqTrans(db *sqlx.DB, id int) (pt *PlaqTrans, err error) {
 
 // ************************** Compute *******************************
 
-func (pt *PlaqTrans) ComputeTas(db *sqlx.DB) (err error) {
+func (pt *PlaqTrans) ComputeTas(db DBOrTx) (err error) {
 	if pt.Tas != nil {
 		return nil // déjà calculé
 	}
@@ -80,7 +79,7 @@ func (pt *PlaqTrans) ComputeTas(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pt *PlaqTrans) ComputeTransporteur(db *sqlx.DB) (err error) {
+func (pt *PlaqTrans) ComputeTransporteur(db DBOrTx) (err error) {
 	if pt.IdTransporteur == 0 {
 		return nil // pas de transporteur (mais conducteur et proprioutil)
 	}
@@ -94,7 +93,7 @@ func (pt *PlaqTrans) ComputeTransporteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pt *PlaqTrans) ComputeConducteur(db *sqlx.DB) (err error) {
+func (pt *PlaqTrans) ComputeConducteur(db DBOrTx) (err error) {
 	if pt.IdConducteur == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un transporteur)
 	}
@@ -108,7 +107,7 @@ func (pt *PlaqTrans) ComputeConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (pt *PlaqTrans) ComputeProprioutil(db *sqlx.DB) (err error) {
+func (pt *PlaqTrans) ComputeProprioutil(db DBOrTx) (err error) {
 	if pt.IdProprioutil == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un transporteur)
 	}
@@ -124,19 +123,7 @@ func (pt *PlaqTrans) ComputeProprioutil(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertPlaqTrans(db *sqlx.DB, pt *PlaqTrans) (id int, err error) {
-	// Mise à jour du stock du tas
-	err = pt.ComputeTas(db)
-	if err != nil {
-		return 0, werr.Wrapf(err, "Erreur appel ComputeTas()")
-	}
-	// Ajoute plaquettes au tas
-	// Attention, transport en map vert et tas en map sec
-	// => qté pour le tas = qté du transport - pourcentage de perte
-	err = pt.Tas.ModifierStock(db, Vert2sec(pt.Qte, pt.PourcentPerte))
-	if err != nil {
-		return 0, werr.Wrapf(err, "Erreur appel PlaqTrans.Tas.ModifierStock()")
-	}
+func InsertPlaqTrans(db DBOrTx, pt *PlaqTrans) (id int, err error) {
 	query := `insert into plaqtrans(
         id_chantier,
         id_tas,
@@ -196,13 +183,33 @@ func InsertPlaqTrans(db *sqlx.DB, pt *PlaqTrans) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	// Mise à jour du stock du tas
+	err = pt.ComputeTas(db)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel ComputeTas()")
+	}
+	// Ajoute plaquettes au tas
+	// Attention, transport en map vert et tas en map sec
+	// => qté pour le tas = qté du transport - pourcentage de perte
+	err = pt.Tas.ModifierStock(db, MVT_TRANSPORT, id, pt.DateTrans, Vert2sec(pt.Qte, pt.PourcentPerte))
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel PlaqTrans.Tas.ModifierStock()")
+	}
+	err = insertAudit(db, "plaqtrans", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdatePlaqTrans(db *sqlx.DB, pt *PlaqTrans) (err error) {
+func UpdatePlaqTrans(db DBOrTx, pt *PlaqTrans) (err error) {
+	avant, err := auditEtat(db, "plaqtrans", pt.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	// Mise à jour du stock du tas
-	// Enlève la qté du transport avant update transport
-	// puis ajoute qté après update transport
+	// Annule le mouvement du transport avant update transport (mouvement inverse, à la date d'origine)
+	// puis ajoute le mouvement du transport après update
 	// Attention, le tas avant update n'est pas forcément le même que le tas après update
 	// (cas où plusieurs tas pour un chantier plaquette et changement de tas lors de update transport)
 	ptAvant, err := GetPlaqTrans(db, pt.Id)
@@ -213,18 +220,18 @@ func UpdatePlaqTrans(db *sqlx.DB, pt *PlaqTrans) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ptAvant.ComputeTas()")
 	}
-	err = ptAvant.Tas.ModifierStock(db, -Vert2sec(ptAvant.Qte, ptAvant.PourcentPerte)) // Retire des plaquettes au tas
+	err = ptAvant.Tas.ModifierStock(db, MVT_TRANSPORT, pt.Id, ptAvant.DateTrans, -Vert2sec(ptAvant.Qte, ptAvant.PourcentPerte)) // Retire des plaquettes au tas
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ptAvant.ModifierStock()")
 	}
 	//
 	err = pt.ComputeTas(db)
 	if err != nil {
-		return err
+		return werr.Wrapf(err, "Erreur appel PlaqTrans.ComputeTas()")
 	}
-	err = pt.Tas.ModifierStock(db, Vert2sec(pt.Qte, pt.PourcentPerte)) // Ajoute des plaquettes au tas
+	err = pt.Tas.ModifierStock(db, MVT_TRANSPORT, pt.Id, pt.DateTrans, Vert2sec(pt.Qte, pt.PourcentPerte)) // Ajoute des plaquettes au tas
 	if err != nil {
-		return werr.Wrapf(err, "Erreur appel PlaqTrans.ComputeTas()")
+		return werr.Wrapf(err, "Erreur appel PlaqTrans.Tas.ModifierStock()")
 	}
 	//
 	query := `update plaqtrans set(
@@ -287,11 +294,19 @@ func UpdatePlaqTrans(db *sqlx.DB, pt *PlaqTrans) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqtrans", pt.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeletePlaqTrans(db *sqlx.DB, id int) (err error) {
-	// Enlève le stock du tas concerné par le transport
+func DeletePlaqTrans(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "plaqtrans", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	// Annule le mouvement de stock du tas concerné par le transport
 	// avant de supprimer le transport
 	pt, err := GetPlaqTrans(db, id)
 	if err != nil {
@@ -301,7 +316,7 @@ func DeletePlaqTrans(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ComputeTas()")
 	}
-	err = pt.Tas.ModifierStock(db, -Vert2sec(pt.Qte, pt.PourcentPerte)) // Retire des plaquettes au tas
+	err = pt.Tas.ModifierStock(db, MVT_TRANSPORT, id, pt.DateTrans, -Vert2sec(pt.Qte, pt.PourcentPerte)) // Retire des plaquettes au tas
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel PlaqTrans.Tas.ModifierStock()")
 	}
@@ -311,5 +326,9 @@ func DeletePlaqTrans(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "plaqtrans", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -0,0 +1,450 @@
+/*
+Transfert de plaquettes d'un lieu de stockage vers un autre.
+
+Les plaquettes passent d'un tas à un tas du même chantier situé dans un autre lieu de stockage
+(tas existant ou créé lors du transfert), ce qui conserve le lien avec le chantier d'origine
+pour le calcul des coûts et la traçabilité.
+Le transfert écrit 2 mouvements de stock (MVT_TRANSFERT) : une sortie du tas d'origine
+et une entrée dans le tas de destination.
+
+Coût : global (transporteur) ou détaillé (conducteur + outil), comme PlaqRange.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"fmt"
+	"time"
+)
+
+type PlaqTransfert struct {
+	Id               int
+	IdChantier       int `db:"id_chantier"`
+	IdTasOrigine     int `db:"id_tas_origine"`
+	IdTasDestination int `db:"id_tas_destination"`
+	IdTransporteur   int `db:"id_transporteur"`
+	IdConducteur     int `db:"id_conducteur"`
+	IdProprioutil    int `db:"id_proprioutil"`
+	DateTransfert    time.Time
+	Qte              float64 // en maps sèches
+	TypeCout         string  // G (global) ou D (détail)
+	// coût global
+	GlPrix    float64 // HT
+	GlTVA     float64
+	GlDatePay time.Time
+	// coût détail - conducteur
+	CoPrixH   float64 // HT
+	CoNheure  float64
+	CoTVA     float64
+	CoDatePay time.Time
+	// coût détail - outil
+	OuPrix    float64 // HT
+	OuTVA     float64
+	OuDatePay time.Time
+	//
+	Notes string
+	// Pas stocké en base
+	// Lieu de stockage du tas de destination à créer, si IdTasDestination = 0
+	IdStockageDestination int
+	Chantier              *Plaq
+	TasOrigine            *Tas
+	TasDestination        *Tas
+	Transporteur          *Acteur
+	Conducteur            *Acteur
+	Proprioutil           *Acteur
+}
+
+// ************************** Get *******************************
+
+func GetPlaqTransfert(db DBOrTx, id int) (pt *PlaqTransfert, err error) {
+	pt = &PlaqTransfert{}
+	query := "select * from plaqtransfert where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(pt)
+	if err != nil {
+		return pt, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return pt, nil
+}
+
+// Calcule tous les champs utile à l'affichage d'un formulaire PlaqTransfert
+func GetPlaqTransfertFull(db DBOrTx, id int) (pt *PlaqTransfert, err error) {
+	pt, err = GetPlaqTransfert(db, id)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetPlaqTransfert()")
+	}
+	pt.Transporteur, err = GetActeur(db, pt.IdTransporteur)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	pt.Conducteur, err = GetActeur(db, pt.IdConducteur)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	pt.Proprioutil, err = GetActeur(db, pt.IdProprioutil)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	err = pt.ComputeTas(db)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel PlaqTransfert.ComputeTas()")
+	}
+	pt.Chantier, err = GetPlaq(db, pt.IdChantier)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetPlaq()")
+	}
+	err = pt.Chantier.ComputeTas(db)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel ComputeTas()")
+	}
+	err = pt.Chantier.ComputeLieudits(db) // pour le nom du chantier
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel ComputeLieudits()")
+	}
+	return pt, nil
+}
+
+// ************************** Compute *******************************
+
+// Calcule TasOrigine et TasDestination
+func (pt *PlaqTransfert) ComputeTas(db DBOrTx) (err error) {
+	if pt.TasOrigine == nil {
+		pt.TasOrigine, err = GetTasFull(db, pt.IdTasOrigine)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetTasFull()")
+		}
+	}
+	if pt.TasDestination == nil {
+		pt.TasDestination, err = GetTasFull(db, pt.IdTasDestination)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel GetTasFull()")
+		}
+	}
+	return nil
+}
+
+func (pt *PlaqTransfert) ComputeTransporteur(db DBOrTx) (err error) {
+	if pt.IdTransporteur == 0 {
+		return nil // pas de transporteur (mais conducteur et proprioutil)
+	}
+	if pt.Transporteur != nil {
+		return nil // déjà calculé
+	}
+	pt.Transporteur, err = GetActeur(db, pt.IdTransporteur)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	return nil
+}
+
+func (pt *PlaqTransfert) ComputeConducteur(db DBOrTx) (err error) {
+	if pt.IdConducteur == 0 {
+		return nil // pas de conducteur ni proprioutil (mais un transporteur)
+	}
+	if pt.Conducteur != nil {
+		return nil // déjà calculé
+	}
+	pt.Conducteur, err = GetActeur(db, pt.IdConducteur)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	return nil
+}
+
+func (pt *PlaqTransfert) ComputeProprioutil(db DBOrTx) (err error) {
+	if pt.IdProprioutil == 0 {
+		return nil // pas de conducteur ni proprioutil (mais un transporteur)
+	}
+	if pt.Proprioutil != nil {
+		return nil // déjà calculé
+	}
+	pt.Proprioutil, err = GetActeur(db, pt.IdProprioutil)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetActeur()")
+	}
+	return nil
+}
+
+// Coût HT du transfert
+func (pt *PlaqTransfert) CoutHT() float64 {
+	if pt.TypeCout == "G" {
+		return pt.GlPrix
+	}
+	return pt.CoNheure*pt.CoPrixH + pt.OuPrix // conducteur + outil
+}
+
+// ************************** Stock *******************************
+
+// Vérifie qu'un transfert peut être effectué, et calcule pt.TasOrigine et pt.TasDestination :
+//   - tas actifs, du chantier du transfert, dans 2 lieux de stockage différents
+//   - le tas d'origine contient la quantité transférée à la date du transfert,
+//     et tout au long des mouvements ultérieurs (sinon son stock deviendrait négatif)
+//
+// Doit être appelé après annulation des mouvements du transfert dans le cas d'un update.
+func (pt *PlaqTransfert) verifierTas(db DBOrTx) (err error) {
+	if pt.Qte <= 0 {
+		return werr.New("La quantité transférée doit être positive")
+	}
+	pt.TasOrigine, err = GetTasFull(db, pt.IdTasOrigine)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetTasFull()")
+	}
+	pt.TasDestination, err = GetTasFull(db, pt.IdTasDestination)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetTasFull()")
+	}
+	for _, tas := range []*Tas{pt.TasOrigine, pt.TasDestination} {
+		if tas.IdChantier != pt.IdChantier {
+			return werr.New(fmt.Sprintf("Le tas %d n'appartient pas au chantier %d", tas.Id, pt.IdChantier))
+		}
+		if !tas.Actif {
+			return werr.New("Transfert impossible, le tas " + tas.Nom + " est vide")
+		}
+	}
+	if pt.TasOrigine.IdStockage == pt.TasDestination.IdStockage {
+		return werr.New("Transfert impossible, les tas d'origine et de destination sont dans le même lieu de stockage")
+	}
+	stock, err := pt.TasOrigine.StockMinimumDepuis(db, pt.DateTransfert)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel Tas.StockMinimumDepuis()")
+	}
+	if pt.Qte > stock+TOLERANCE_STOCK {
+		return werr.New(fmt.Sprintf("Transfert impossible, le tas %s ne contient que %.2f maps à partir du %s",
+			pt.TasOrigine.Nom, stock, pt.DateTransfert.Format("02/01/2006")))
+	}
+	return nil
+}
+
+// Ajoute (sens = 1) ou annule (sens = -1) les mouvements de stock du transfert
+// pt.TasOrigine et pt.TasDestination doivent avoir été calculés
+func (pt *PlaqTransfert) modifierStocks(db DBOrTx, sens float64) (err error) {
+	err = pt.TasOrigine.ModifierStock(db, MVT_TRANSFERT, pt.Id, pt.DateTransfert, -sens*pt.Qte)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.TasOrigine.ModifierStock()")
+	}
+	err = pt.TasDestination.ModifierStock(db, MVT_TRANSFERT, pt.Id, pt.DateTransfert, sens*pt.Qte)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.TasDestination.ModifierStock()")
+	}
+	return nil
+}
+
+// Si pt.IdTasDestination = 0, crée un tas du chantier dans le lieu de stockage pt.IdStockageDestination
+func (pt *PlaqTransfert) creerTasDestination(db DBOrTx) (err error) {
+	if pt.IdTasDestination != 0 {
+		return nil
+	}
+	if pt.IdStockageDestination == 0 {
+		return werr.New("Transfert sans tas ni lieu de stockage de destination")
+	}
+	var n int
+	query := "select count(*) from tas where id_chantier=$1 and id_stockage=$2"
+	err = db.Get(&n, query, pt.IdChantier, pt.IdStockageDestination)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if n != 0 {
+		// un chantier a au plus un tas par lieu de stockage (cf UpdatePlaq())
+		return werr.New("Le chantier a déjà un tas dans ce lieu de stockage")
+	}
+	pt.IdTasDestination, err = InsertTas(db, NewTas(pt.IdStockageDestination, pt.IdChantier, true))
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel InsertTas()")
+	}
+	return nil
+}
+
+// ************************** CRUD *******************************
+
+// Si pt.IdTasDestination = 0, un nouveau tas est créé dans le lieu de stockage pt.IdStockageDestination
+func InsertPlaqTransfert(db DBOrTx, pt *PlaqTransfert) (id int, err error) {
+	err = pt.creerTasDestination(db)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel PlaqTransfert.creerTasDestination()")
+	}
+	err = pt.verifierTas(db)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur appel PlaqTransfert.verifierTas()")
+	}
+	query := `insert into plaqtransfert(
+        id_chantier,
+        id_tas_origine,
+        id_tas_destination,
+        id_transporteur,
+        id_conducteur,
+        id_proprioutil,
+        datetransfert,
+        qte,
+        typecout,
+        glprix,
+        gltva,
+        gldatepay,
+        conheure,
+        coprixh,
+        cotva,
+        codatepay,
+        ouprix,
+        outva,
+        oudatepay,
+        notes)
+        values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20) returning id`
+	err = db.QueryRow(
+		query,
+		pt.IdChantier,
+		pt.IdTasOrigine,
+		pt.IdTasDestination,
+		pt.IdTransporteur,
+		pt.IdConducteur,
+		pt.IdProprioutil,
+		pt.DateTransfert,
+		pt.Qte,
+		pt.TypeCout,
+		pt.GlPrix,
+		pt.GlTVA,
+		pt.GlDatePay,
+		pt.CoNheure,
+		pt.CoPrixH,
+		pt.CoTVA,
+		pt.CoDatePay,
+		pt.OuPrix,
+		pt.OuTVA,
+		pt.OuDatePay,
+		pt.Notes).Scan(&id)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	pt.Id = id
+	err = pt.modifierStocks(db, 1)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel PlaqTransfert.modifierStocks()")
+	}
+	err = insertAudit(db, "plaqtransfert", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return id, nil
+}
+
+// Si pt.IdTasDestination = 0, un nouveau tas est créé dans le lieu de stockage pt.IdStockageDestination
+func UpdatePlaqTransfert(db DBOrTx, pt *PlaqTransfert) (err error) {
+	avant, err := auditEtat(db, "plaqtransfert", pt.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	// Annule les mouvements du transfert avant update (mouvements inverses, à la date d'origine)
+	// puis ajoute les mouvements du transfert après update
+	ptAvant, err := GetPlaqTransfert(db, pt.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetPlaqTransfert()")
+	}
+	err = ptAvant.ComputeTas(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel ptAvant.ComputeTas()")
+	}
+	err = ptAvant.modifierStocks(db, -1)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel ptAvant.modifierStocks()")
+	}
+	//
+	err = pt.creerTasDestination(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.creerTasDestination()")
+	}
+	err = pt.verifierTas(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.verifierTas()")
+	}
+	err = pt.modifierStocks(db, 1)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.modifierStocks()")
+	}
+	//
+	query := `update plaqtransfert set(
+        id_chantier,
+        id_tas_origine,
+        id_tas_destination,
+        id_transporteur,
+        id_conducteur,
+        id_proprioutil,
+        datetransfert,
+        qte,
+        typecout,
+        glprix,
+        gltva,
+        gldatepay,
+        conheure,
+        coprixh,
+        cotva,
+        codatepay,
+        ouprix,
+        outva,
+        oudatepay,
+        notes
+        ) = ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20) where id=$21`
+	_, err = db.Exec(
+		query,
+		pt.IdChantier,
+		pt.IdTasOrigine,
+		pt.IdTasDestination,
+		pt.IdTransporteur,
+		pt.IdConducteur,
+		pt.IdProprioutil,
+		pt.DateTransfert,
+		pt.Qte,
+		pt.TypeCout,
+		pt.GlPrix,
+		pt.GlTVA,
+		pt.GlDatePay,
+		pt.CoNheure,
+		pt.CoPrixH,
+		pt.CoTVA,
+		pt.CoDatePay,
+		pt.OuPrix,
+		pt.OuTVA,
+		pt.OuDatePay,
+		pt.Notes,
+		pt.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "plaqtransfert", pt.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+// Supprime un transfert ; ses mouvements de stock sont annulés par des mouvements inverses.
+// Le tas de destination n'est pas supprimé, même s'il a été créé par le transfert.
+func DeletePlaqTransfert(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "plaqtransfert", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	pt, err := GetPlaqTransfert(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetPlaqTransfert()")
+	}
+	err = pt.ComputeTas(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.ComputeTas()")
+	}
+	err = pt.modifierStocks(db, -1)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel PlaqTransfert.modifierStocks()")
+	}
+	query := "delete from plaqtransfert where id=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "plaqtransfert", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
@@ -31,10 +31,9 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 )
 
-func QGisUpdate(db *sqlx.DB) (err error) {
+func QGisUpdate(db DBOrTx) (err error) {
 	table := "qgis_chantier"
 	query := "drop table if exists " + table
 	if _, err = db.Exec(query); err != nil {
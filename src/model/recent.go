@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -21,7 +20,7 @@ type Recent struct {
 
 // Renvoie les dernières activités visitées
 // (les plus récentes sont renvoyées en premier)
-func GetRecents(db *sqlx.DB) ([]*Recent, error) {
+func GetRecents(db DBOrTx) ([]*Recent, error) {
 	r := []*Recent{}
 	query := "select * from recent order by datevisite desc"
 	err := db.Select(&r, query)
@@ -44,7 +43,7 @@ func GetRecents(db *sqlx.DB) ([]*Recent, error) {
 // /chantier/chauffage-fermier/liste/2021
 // La logique de dédoublonnage n'est pas gérée ici,
 // mais dans les contrôleurs, dans le code qui appelle AddRecent()
-func AddRecent(db *sqlx.DB, conf *Config, r *Recent) error {
+func AddRecent(db DBOrTx, conf *Config, r *Recent) error {
 	var err error
 	var count int
 	now := time.Now()
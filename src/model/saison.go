@@ -11,7 +11,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"strings"
 	"time"
@@ -26,7 +25,7 @@ import (
 //   - un tableau de 2 time.Time avec les dates limites des saisons
 //   - un bool indiquant s'il existe des chantiers ou des ventes en base
 //   - une erreur éventuelle
-func ComputeLimitesSaisons(db *sqlx.DB, limiteSaison string) ([][2]time.Time, bool, error) {
+func ComputeLimitesSaisons(db DBOrTx, limiteSaison string) ([][2]time.Time, bool, error) {
 	// retour
 	var res [][2]time.Time
 	var err error
@@ -143,3 +142,23 @@ func ComputeLimitesSaisons(db *sqlx.DB, limiteSaison string) ([][2]time.Time, bo
 	}
 	return res, true, nil
 }
+
+// Renvoie la date de début de la saison contenant une date
+// ex avec limite = 01/09 : 2020-12-15 => 2020-09-01 ; 2020-07-15 => 2019-09-01
+// @param limiteSaison string au format JJ/MM (tiré de 'debut-saison' en conf)
+func DebutSaison(limiteSaison string, d time.Time) (time.Time, error) {
+	limits := strings.Split(limiteSaison, "/")
+	if len(limits) != 2 {
+		return time.Time{}, werr.New("Limite de saison incorrecte : " + limiteSaison)
+	}
+	jLim, mLim := limits[0], limits[1]
+	strParse := strconv.Itoa(d.Year()) + "-" + mLim + "-" + jLim
+	res, err := time.Parse("2006-01-02", strParse)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel time.Parse("+strParse+")")
+	}
+	if res.After(d) {
+		res = res.AddDate(-1, 0, 0)
+	}
+	return res, nil
+}
@@ -0,0 +1,365 @@
+/*
+Sauvegardes de la base (pg_dump), manuelles ou automatiques.
+
+Chaque sauvegarde est un fichier zip contenant le dump, dans BACKUP_DIR (config.env),
+accompagné d'un fichier manifeste (même nom + .json) contenant
+la somme de contrôle SHA-256 du zip et le nombre de lignes de chaque table au moment de la sauvegarde.
+Les lignes sont comptées dans l'instantané (snapshot) utilisé par pg_dump : les nombres correspondent exactement au dump.
+Le manifeste est utilisé pour vérifier le zip et pour contrôler une restauration (cf manage/db-restore).
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"archive/zip"
+	"bdl.local/bdl/generic/wilk/werr"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Sauvegarde struct {
+	Fichier   string // nom du zip, sans répertoire
+	Date      time.Time
+	Taille    int64
+	Manifeste *ManifesteSauvegarde // nil si le fichier manifeste est absent
+	// pas stocké dans le manifeste
+	ChecksumOK bool
+	Conservee  []string // raisons de la conservation par la politique de rétention : "quotidienne", "hebdomadaire", "mensuelle"
+}
+
+type ManifesteSauvegarde struct {
+	Fichier  string         `json:"fichier"`
+	Date     time.Time      `json:"date"`
+	Schema   string         `json:"schema"`
+	SHA256   string         `json:"sha256"`
+	NbLignes map[string]int `json:"nb-lignes"` // clé = nom de table
+}
+
+const FORMAT_NOM_SAUVEGARDE = "2006-01-02-150405"
+
+var regexpNomSauvegarde = regexp.MustCompile(`^bdl-(\d{4}-\d{2}-\d{2}-\d{6})\.pgdump\.zip$`)
+
+// Evite que deux sauvegardes (manuelle et automatique) tournent en même temps
+var mutexSauvegarde sync.Mutex
+
+func (s *Sauvegarde) TailleKo() int64 {
+	return (s.Taille + 1023) / 1024
+}
+
+// ************************** Création *******************************
+
+// Lance pg_dump, zippe le dump et écrit le manifeste.
+// @return  la sauvegarde créée
+func CreerSauvegarde(db *sqlx.DB) (s *Sauvegarde, err error) {
+	mutexSauvegarde.Lock()
+	defer mutexSauvegarde.Unlock()
+	dirname := SERVER_ENV.BACKUP_DIR
+	date := time.Now()
+	filename := "bdl-" + date.Format(FORMAT_NOM_SAUVEGARDE) + ".pgdump"
+	dumpPath := filepath.Join(dirname, filename)
+	//
+	// 1 - nb de lignes par table, dans une transaction dont l'instantané est exporté pour pg_dump.
+	// La transaction doit rester ouverte jusqu'à la fin de pg_dump.
+	//
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel db.BeginTxx()")
+	}
+	defer tx.Rollback()
+	var snapshot string
+	query := "select pg_export_snapshot()"
+	err = tx.Get(&snapshot, query)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	nbLignes, err := CompterLignes(tx, SERVER_ENV.DATABASE_SCHEMA)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel CompterLignes()")
+	}
+	//
+	// 2 - pg_dump
+	//
+	// PGPASSWORD='my_password' pg_dump --file my_dump_file -h _my_host -n my_schema -p my_port -U my_user my_database
+	cmd := exec.Command(
+		SERVER_ENV.CMD_PGDUMP,
+		SERVER_ENV.DATABASE_URL,
+		"--file="+dumpPath,
+		"--schema="+SERVER_ENV.DATABASE_SCHEMA,
+		"--snapshot="+snapshot,
+	)
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		if SERVER_ENV.RUN_MODE == "prod" {
+			return nil, werr.Wrapf(err, "Paramètres BDD invalides")
+		}
+		return nil, werr.Wrapf(err, "Paramètres BDD invalides:\n%v", cmd.Args)
+	}
+	defer os.Remove(dumpPath)
+	//
+	// 3 - zip
+	//
+	zipPath := dumpPath + ".zip"
+	err = zipperFichier(dumpPath, zipPath, filename)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel zipperFichier()")
+	}
+	//
+	// 4 - manifeste
+	//
+	checksum, err := ChecksumFichier(zipPath)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel ChecksumFichier()")
+	}
+	manifeste := &ManifesteSauvegarde{
+		Fichier:  filename + ".zip",
+		Date:     date,
+		Schema:   SERVER_ENV.DATABASE_SCHEMA,
+		SHA256:   checksum,
+		NbLignes: nbLignes,
+	}
+	contenu, err := json.MarshalIndent(manifeste, "", "    ")
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel json.MarshalIndent()")
+	}
+	err = os.WriteFile(zipPath+".json", contenu, 0644)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur écriture manifeste")
+	}
+	return GetSauvegarde(filename + ".zip")
+}
+
+func zipperFichier(src, dest, nom string) (err error) {
+	zipfile, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer zipfile.Close()
+	zipwriter := zip.NewWriter(zipfile)
+	f, err := zipwriter.Create(nom)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(f, in)
+	if err != nil {
+		return err
+	}
+	return zipwriter.Close()
+}
+
+// Renvoie le nombre de lignes de chaque table d'un schéma
+func CompterLignes(db DBOrTx, schema string) (res map[string]int, err error) {
+	res = map[string]int{}
+	tables := []string{}
+	query := `select table_name from information_schema.tables where table_schema=$1 and table_type='BASE TABLE' order by table_name`
+	err = db.Select(&tables, query, schema)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, table := range tables {
+		var n int
+		query = `select count(*) from "` + schema + `"."` + table + `"`
+		err = db.Get(&n, query)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		res[table] = n
+	}
+	return res, nil
+}
+
+// Somme de contrôle SHA-256 d'un fichier, en hexadécimal
+func ChecksumFichier(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ************************** Get *******************************
+
+// Renvoie une sauvegarde de BACKUP_DIR, avec son manifeste et la vérification de la somme de contrôle
+// @param fichier  nom du zip, ex bdl-2026-10-18-030000.pgdump.zip
+func GetSauvegarde(fichier string) (s *Sauvegarde, err error) {
+	m := regexpNomSauvegarde.FindStringSubmatch(fichier)
+	if m == nil {
+		return nil, werr.New("Nom de sauvegarde invalide : " + fichier)
+	}
+	s = &Sauvegarde{Fichier: fichier}
+	s.Date, err = time.ParseInLocation(FORMAT_NOM_SAUVEGARDE, m[1], time.Local)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel time.Parse("+m[1]+")")
+	}
+	path := filepath.Join(SERVER_ENV.BACKUP_DIR, fichier)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel os.Stat()")
+	}
+	s.Taille = info.Size()
+	s.Manifeste, err = LireManifeste(path + ".json")
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel LireManifeste()")
+	}
+	if s.Manifeste != nil {
+		checksum, err := ChecksumFichier(path)
+		if err != nil {
+			return nil, werr.Wrapf(err, "Erreur appel ChecksumFichier()")
+		}
+		s.ChecksumOK = checksum == s.Manifeste.SHA256
+	}
+	return s, nil
+}
+
+// Renvoie nil, nil si le manifeste n'existe pas (sauvegardes antérieures aux manifestes)
+func LireManifeste(path string) (m *ManifesteSauvegarde, err error) {
+	contenu, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m = &ManifesteSauvegarde{}
+	err = json.Unmarshal(contenu, m)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Manifeste invalide : "+path)
+	}
+	return m, nil
+}
+
+// Renvoie les sauvegardes de BACKUP_DIR, de la plus récente à la plus ancienne.
+// Le champ Conservee est calculé avec la politique de rétention de config.yml.
+func GetSauvegardes(conf *Config) (res []*Sauvegarde, err error) {
+	res = []*Sauvegarde{}
+	entries, err := os.ReadDir(SERVER_ENV.BACKUP_DIR)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur lecture répertoire "+SERVER_ENV.BACKUP_DIR)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !regexpNomSauvegarde.MatchString(entry.Name()) {
+			continue
+		}
+		s, err := GetSauvegarde(entry.Name())
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetSauvegarde()")
+		}
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Date.After(res[j].Date) })
+	calculerRetention(res, conf)
+	return res, nil
+}
+
+// ************************** Rétention *******************************
+
+// Remplit le champ Conservee de chaque sauvegarde :
+// la plus récente sauvegarde de chacun des n derniers jours, semaines et mois (n fixé dans config.yml).
+// @param sauvegardes  triées de la plus récente à la plus ancienne
+func calculerRetention(sauvegardes []*Sauvegarde, conf *Config) {
+	periodes := []struct {
+		label string
+		nb    int
+		cle   func(time.Time) string
+	}{
+		{"quotidienne", conf.Sauvegarde.Retention.Quotidiennes, func(d time.Time) string { return d.Format("2006-01-02") }},
+		{"hebdomadaire", conf.Sauvegarde.Retention.Hebdomadaires, func(d time.Time) string {
+			annee, semaine := d.ISOWeek()
+			return strconv.Itoa(annee) + "-" + strconv.Itoa(semaine)
+		}},
+		{"mensuelle", conf.Sauvegarde.Retention.Mensuelles, func(d time.Time) string { return d.Format("2006-01") }},
+	}
+	for _, periode := range periodes {
+		vues := map[string]bool{}
+		for _, s := range sauvegardes {
+			if len(vues) >= periode.nb {
+				break
+			}
+			cle := periode.cle(s.Date)
+			if vues[cle] {
+				continue
+			}
+			vues[cle] = true
+			s.Conservee = append(s.Conservee, periode.label)
+		}
+	}
+}
+
+// Efface les sauvegardes qui ne sont pas conservées par la politique de rétention.
+// Si aucune rétention n'est définie dans config.yml, n'efface rien.
+// @return  les noms des fichiers effacés
+func AppliquerRetention(conf *Config) (effaces []string, err error) {
+	effaces = []string{}
+	r := conf.Sauvegarde.Retention
+	if r.Quotidiennes <= 0 && r.Hebdomadaires <= 0 && r.Mensuelles <= 0 {
+		return effaces, nil
+	}
+	mutexSauvegarde.Lock()
+	defer mutexSauvegarde.Unlock()
+	sauvegardes, err := GetSauvegardes(conf)
+	if err != nil {
+		return effaces, werr.Wrapf(err, "Erreur appel GetSauvegardes()")
+	}
+	for _, s := range sauvegardes {
+		if len(s.Conservee) != 0 {
+			continue
+		}
+		path := filepath.Join(SERVER_ENV.BACKUP_DIR, s.Fichier)
+		err = os.Remove(path)
+		if err != nil {
+			return effaces, werr.Wrapf(err, "Erreur suppression "+path)
+		}
+		err = os.Remove(path + ".json")
+		if err != nil && !os.IsNotExist(err) {
+			return effaces, werr.Wrapf(err, "Erreur suppression "+path+".json")
+		}
+		effaces = append(effaces, s.Fichier)
+	}
+	return effaces, nil
+}
+
+// ************************** Planification *******************************
+
+// Renvoie la date de la prochaine sauvegarde automatique après une date donnée.
+// @return  date nulle si aucune heure de sauvegarde n'est définie dans config.yml
+func ProchaineSauvegarde(conf *Config, apres time.Time) (time.Time, error) {
+	if conf.Sauvegarde.Heure == "" {
+		return time.Time{}, nil
+	}
+	heure, err := time.Parse("15:04", conf.Sauvegarde.Heure)
+	if err != nil {
+		return time.Time{}, werr.Wrapf(err, "Heure de sauvegarde invalide dans config.yml : "+conf.Sauvegarde.Heure)
+	}
+	res := time.Date(apres.Year(), apres.Month(), apres.Day(), heure.Hour(), heure.Minute(), 0, 0, apres.Location())
+	if !res.After(apres) {
+		res = res.AddDate(0, 0, 1)
+	}
+	return res, nil
+}
@@ -0,0 +1,600 @@
+/*
+Différences entre les données SCTL (cf sctl-import.go) et la base BDL,
+et application de ces différences.
+
+Règles :
+  - Communes : ajout des nouvelles, mise à jour du code insee ;
+    les noms ne sont pas modifiés (noms retouchés dans manage/data/commune.csv).
+  - Lieux-dits, fermiers : ajout et mise à jour.
+  - Parcelles : ajout et mise à jour ; une parcelle disparue de la base SCTL est supprimée,
+    sauf si elle est liée à un chantier (table chantier_parcelle), auquel cas elle est conservée avec ses liens.
+  - Communes, lieux-dits, fermiers et UGs disparus ne sont jamais supprimés (utilisés par les chantiers),
+    ils sont seulement signalés.
+  - Liens parcelle - lieu-dit, parcelle - fermier, parcelle - UG, commune - lieu-dit : ajout et suppression,
+    uniquement pour les parcelles et communes présentes dans la base SCTL.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/tiglib"
+	"bdl.local/bdl/generic/wilk/werr"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tables de liens gérées par l'import
+const (
+	LIEN_PARCELLE_LIEUDIT = "parcelle_lieudit"
+	LIEN_PARCELLE_FERMIER = "parcelle_fermier"
+	LIEN_PARCELLE_UG      = "parcelle_ug"
+	LIEN_COMMUNE_LIEUDIT  = "commune_lieudit"
+)
+
+type DiffSCTL struct {
+	CommunesNouvelles  []*Commune
+	CommunesModifiees  []*ModifSCTL
+	CommunesDisparues  []*Commune
+	LieuditsNouveaux   []*Lieudit
+	LieuditsModifies   []*ModifSCTL
+	LieuditsDisparus   []*Lieudit
+	FermiersNouveaux   []*Fermier
+	FermiersModifies   []*ModifSCTL
+	FermiersDisparus   []*Fermier
+	ParcellesNouvelles []*Parcelle
+	ParcellesModifiees []*ModifSCTL
+	ParcellesDisparues []*ParcelleDisparueSCTL
+	// Fermiers dont les parcelles changent
+	FermiersParcelles []*FermierParcellesSCTL
+	// Codes UG de ug.csv absents de la table ug ; les liens correspondants ne sont pas importés
+	UGsInconnues []string
+	// Clé = nom de la table de liens
+	LiensAjoutes   map[string][]LienSCTL
+	LiensSupprimes map[string][]LienSCTL
+	// Pour information
+	AvecUG                  bool // ug.csv fourni
+	NbNonAgricoles          int
+	NbParcellesNonAgricoles int
+	NbLignesIgnorees        int
+}
+
+// Entité modifiée
+type ModifSCTL struct {
+	Id     int
+	Label  string
+	Champs []ChampModifieSCTL
+}
+
+type ChampModifieSCTL struct {
+	Nom   string
+	Avant string
+	Apres string
+}
+
+type ParcelleDisparueSCTL struct {
+	Parcelle    *Parcelle
+	NbChantiers int // nb de liens dans chantier_parcelle ; si > 0, la parcelle est conservée
+}
+
+type FermierParcellesSCTL struct {
+	Fermier  *Fermier
+	Ajoutees []*Parcelle
+	Retirees []*Parcelle
+}
+
+// Nombre de liens ajoutés / supprimés pour une table de liens
+type NbLiensSCTL struct {
+	Table     string
+	Ajoutes   int
+	Supprimes int
+}
+
+func (p *ParcelleDisparueSCTL) Conservee() bool {
+	return p.NbChantiers > 0
+}
+
+// Indique si l'import ne change rien à la base
+func (d *DiffSCTL) EstVide() bool {
+	return len(d.CommunesNouvelles)+len(d.CommunesModifiees)+
+		len(d.LieuditsNouveaux)+len(d.LieuditsModifies)+
+		len(d.FermiersNouveaux)+len(d.FermiersModifies)+
+		len(d.ParcellesNouvelles)+len(d.ParcellesModifiees)+len(d.ParcellesDisparues)+
+		len(d.LiensAjoutes)+len(d.LiensSupprimes) == 0
+}
+
+func (d *DiffSCTL) NbLiens() (res []NbLiensSCTL) {
+	for _, table := range []string{LIEN_PARCELLE_LIEUDIT, LIEN_PARCELLE_FERMIER, LIEN_PARCELLE_UG, LIEN_COMMUNE_LIEUDIT} {
+		res = append(res, NbLiensSCTL{Table: table, Ajoutes: len(d.LiensAjoutes[table]), Supprimes: len(d.LiensSupprimes[table])})
+	}
+	return res
+}
+
+// Somme de contrôle du diff, pour vérifier au moment de l'application
+// que la base n'a pas changé depuis l'affichage du diff.
+func (d *DiffSCTL) Checksum() (string, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return "", werr.Wrapf(err, "Erreur appel json.Marshal()")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ************************** Calcul *******************************
+
+func ComputeDiffSCTL(db DBOrTx, donnees *DonneesSCTL) (d *DiffSCTL, err error) {
+	d = &DiffSCTL{
+		LiensAjoutes:            map[string][]LienSCTL{},
+		LiensSupprimes:          map[string][]LienSCTL{},
+		AvecUG:                  donnees.ParcelleUG != nil,
+		NbNonAgricoles:          donnees.NbNonAgricoles,
+		NbParcellesNonAgricoles: donnees.NbParcellesNonAgricoles,
+		NbLignesIgnorees:        donnees.NbLignesIgnorees,
+	}
+	//
+	// Communes
+	//
+	communes := []*Commune{}
+	query := "select * from commune order by id"
+	err = db.Select(&communes, query)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	communesBDL := map[int]*Commune{}
+	for _, c := range communes {
+		communesBDL[c.Id] = c
+		if donnees.Communes[c.Id] == nil {
+			d.CommunesDisparues = append(d.CommunesDisparues, c)
+		}
+	}
+	for _, id := range clesTriees(donnees.Communes) {
+		c := donnees.Communes[id]
+		cBDL, ok := communesBDL[id]
+		if !ok {
+			d.CommunesNouvelles = append(d.CommunesNouvelles, c)
+			continue
+		}
+		m := &ModifSCTL{Id: id, Label: cBDL.Nom}
+		m.compare("Code insee", cBDL.CodeInsee, c.CodeInsee)
+		if len(m.Champs) != 0 {
+			d.CommunesModifiees = append(d.CommunesModifiees, m)
+		}
+	}
+	//
+	// Lieux-dits
+	//
+	lieudits := []*Lieudit{}
+	query = "select id,nom from lieudit order by id"
+	err = db.Select(&lieudits, query)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	lieuditsBDL := map[int]*Lieudit{}
+	for _, ld := range lieudits {
+		lieuditsBDL[ld.Id] = ld
+		if donnees.Lieudits[ld.Id] == nil {
+			d.LieuditsDisparus = append(d.LieuditsDisparus, ld)
+		}
+	}
+	for _, id := range clesTriees(donnees.Lieudits) {
+		ld := donnees.Lieudits[id]
+		ldBDL, ok := lieuditsBDL[id]
+		if !ok {
+			d.LieuditsNouveaux = append(d.LieuditsNouveaux, ld)
+			continue
+		}
+		m := &ModifSCTL{Id: id, Label: ldBDL.Nom}
+		m.compare("Nom", ldBDL.Nom, ld.Nom)
+		if len(m.Champs) != 0 {
+			d.LieuditsModifies = append(d.LieuditsModifies, m)
+		}
+	}
+	//
+	// Fermiers
+	//
+	fermiers := []*Fermier{}
+	query = "select * from fermier order by id"
+	err = db.Select(&fermiers, query)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	fermiersBDL := map[int]*Fermier{}
+	for _, f := range fermiers {
+		fermiersBDL[f.Id] = f
+		if donnees.Fermiers[f.Id] == nil {
+			d.FermiersDisparus = append(d.FermiersDisparus, f)
+		}
+	}
+	for _, id := range clesTriees(donnees.Fermiers) {
+		f := donnees.Fermiers[id]
+		fBDL, ok := fermiersBDL[id]
+		if !ok {
+			d.FermiersNouveaux = append(d.FermiersNouveaux, f)
+			continue
+		}
+		m := &ModifSCTL{Id: id, Label: fBDL.String()}
+		m.compare("Nom", fBDL.Nom, f.Nom)
+		m.compare("Prénom", fBDL.Prenom, f.Prenom)
+		m.compare("Adresse", fBDL.Adresse, f.Adresse)
+		m.compare("Code postal", fBDL.Cp, f.Cp)
+		m.compare("Ville", fBDL.Ville, f.Ville)
+		m.compare("Téléphone", fBDL.Tel, f.Tel)
+		m.compare("Email", fBDL.Email, f.Email)
+		if len(m.Champs) != 0 {
+			d.FermiersModifies = append(d.FermiersModifies, m)
+		}
+	}
+	//
+	// Parcelles
+	//
+	idSCTL, _, err := getIdsProprietairesSCTL(db)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur appel getIdsProprietairesSCTL()")
+	}
+	nomProprietaire := func(id int) string {
+		if id == idSCTL {
+			return "SCTL"
+		}
+		return "GFA Larzac"
+	}
+	nomCommune := func(id int) string {
+		if c, ok := communesBDL[id]; ok {
+			return c.NomCourt
+		}
+		if c, ok := donnees.Communes[id]; ok {
+			return c.NomCourt
+		}
+		return strconv.Itoa(id)
+	}
+	parcelles := []*Parcelle{}
+	query = "select id,id_proprietaire,code,coalesce(surface,0) as surface,coalesce(id_commune,0) as id_commune from parcelle order by id"
+	err = db.Select(&parcelles, query)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	nbChantiers := map[int]int{}
+	type nbChantiersParcelle struct {
+		IdParcelle int `db:"id_parcelle"`
+		N          int
+	}
+	nbs := []*nbChantiersParcelle{}
+	query = "select id_parcelle,count(*) as n from chantier_parcelle group by id_parcelle"
+	err = db.Select(&nbs, query)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, nb := range nbs {
+		nbChantiers[nb.IdParcelle] = nb.N
+	}
+	parcellesBDL := map[int]*Parcelle{}
+	for _, p := range parcelles {
+		p.Commune = &Commune{NomCourt: nomCommune(p.IdCommune)}
+		parcellesBDL[p.Id] = p
+		if donnees.Parcelles[p.Id] == nil {
+			d.ParcellesDisparues = append(d.ParcellesDisparues, &ParcelleDisparueSCTL{Parcelle: p, NbChantiers: nbChantiers[p.Id]})
+		}
+	}
+	for _, id := range clesTriees(donnees.Parcelles) {
+		p := donnees.Parcelles[id]
+		p.Commune = &Commune{NomCourt: nomCommune(p.IdCommune)}
+		pBDL, ok := parcellesBDL[id]
+		if !ok {
+			d.ParcellesNouvelles = append(d.ParcellesNouvelles, p)
+			continue
+		}
+		m := &ModifSCTL{Id: id, Label: pBDL.Code + " (" + pBDL.Commune.NomCourt + ")"}
+		m.compare("Code", strings.TrimSpace(pBDL.Code), p.Code)
+		m.compare("Surface (ha)", strconv.FormatFloat(pBDL.Surface, 'f', 4, 64), strconv.FormatFloat(p.Surface, 'f', 4, 64))
+		m.compare("Commune", nomCommune(pBDL.IdCommune), nomCommune(p.IdCommune))
+		m.compare("Propriétaire", nomProprietaire(pBDL.IdProprietaire), nomProprietaire(p.IdProprietaire))
+		if len(m.Champs) != 0 {
+			d.ParcellesModifiees = append(d.ParcellesModifiees, m)
+		}
+	}
+	//
+	// Liens
+	//
+	err = d.computeLiens(db, LIEN_PARCELLE_LIEUDIT, "select id_parcelle as id1,id_lieudit as id2 from parcelle_lieudit", donnees.ParcelleLieudit, donnees.Parcelles)
+	if err != nil {
+		return d, err
+	}
+	err = d.computeLiens(db, LIEN_PARCELLE_FERMIER, "select id_parcelle as id1,id_fermier as id2 from parcelle_fermier", donnees.ParcelleFermier, donnees.Parcelles)
+	if err != nil {
+		return d, err
+	}
+	communesParcelles := map[int]*Parcelle{} // pour computeLiens(), seules les clés sont utilisées
+	for id := range donnees.Communes {
+		communesParcelles[id] = nil
+	}
+	err = d.computeLiens(db, LIEN_COMMUNE_LIEUDIT, "select id_commune as id1,id_lieudit as id2 from commune_lieudit", donnees.CommuneLieudit, communesParcelles)
+	if err != nil {
+		return d, err
+	}
+	if donnees.ParcelleUG != nil {
+		codesUG := []string{}
+		query = "select code from ug"
+		err = db.Select(&codesUG, query)
+		if err != nil {
+			return d, werr.Wrapf(err, "Erreur query : "+query)
+		}
+		liensUG := map[LienSCTL]bool{}
+		inconnues := map[string]bool{}
+		for lien := range donnees.ParcelleUG {
+			if tiglib.InArray(lien.Code, codesUG) {
+				liensUG[lien] = true
+			} else {
+				inconnues[lien.Code] = true
+			}
+		}
+		for code := range inconnues {
+			d.UGsInconnues = append(d.UGsInconnues, code)
+		}
+		sort.Strings(d.UGsInconnues)
+		err = d.computeLiens(db, LIEN_PARCELLE_UG, "select pu.id_parcelle as id1,ug.code as code from parcelle_ug pu join ug on ug.id=pu.id_ug", liensUG, donnees.Parcelles)
+		if err != nil {
+			return d, err
+		}
+	}
+	//
+	// Fermiers dont les parcelles changent
+	//
+	parParcelle := map[int]*FermierParcellesSCTL{}
+	getFermier := func(id int) *Fermier {
+		if f, ok := donnees.Fermiers[id]; ok {
+			return f
+		}
+		if f, ok := fermiersBDL[id]; ok {
+			return f
+		}
+		return &Fermier{Id: id, Nom: "Exploitant " + strconv.Itoa(id)}
+	}
+	getParcelle := func(id int) *Parcelle {
+		if p, ok := donnees.Parcelles[id]; ok {
+			return p
+		}
+		return parcellesBDL[id]
+	}
+	for _, lien := range d.LiensAjoutes[LIEN_PARCELLE_FERMIER] {
+		if parParcelle[lien.Id2] == nil {
+			parParcelle[lien.Id2] = &FermierParcellesSCTL{Fermier: getFermier(lien.Id2)}
+		}
+		parParcelle[lien.Id2].Ajoutees = append(parParcelle[lien.Id2].Ajoutees, getParcelle(lien.Id1))
+	}
+	for _, lien := range d.LiensSupprimes[LIEN_PARCELLE_FERMIER] {
+		if parParcelle[lien.Id2] == nil {
+			parParcelle[lien.Id2] = &FermierParcellesSCTL{Fermier: getFermier(lien.Id2)}
+		}
+		parParcelle[lien.Id2].Retirees = append(parParcelle[lien.Id2].Retirees, getParcelle(lien.Id1))
+	}
+	for _, id := range clesTriees(parParcelle) {
+		d.FermiersParcelles = append(d.FermiersParcelles, parParcelle[id])
+	}
+	return d, nil
+}
+
+// Compare les liens de la base BDL (sélectionnés par query) avec ceux de la base SCTL.
+// Seuls les liens dont Id1 est dans ids1 sont supprimés.
+func (d *DiffSCTL) computeLiens(db DBOrTx, table, query string, liensSCTL map[LienSCTL]bool, ids1 map[int]*Parcelle) error {
+	liens := []LienSCTL{}
+	err := db.Select(&liens, query)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	liensBDL := map[LienSCTL]bool{}
+	for _, lien := range liens {
+		liensBDL[lien] = true
+		if _, ok := ids1[lien.Id1]; ok && !liensSCTL[lien] {
+			d.LiensSupprimes[table] = append(d.LiensSupprimes[table], lien)
+		}
+	}
+	for lien := range liensSCTL {
+		if !liensBDL[lien] {
+			d.LiensAjoutes[table] = append(d.LiensAjoutes[table], lien)
+		}
+	}
+	trieLiens(d.LiensAjoutes[table])
+	trieLiens(d.LiensSupprimes[table])
+	return nil
+}
+
+func (m *ModifSCTL) compare(nom, avant, apres string) {
+	if avant != apres {
+		m.Champs = append(m.Champs, ChampModifieSCTL{Nom: nom, Avant: avant, Apres: apres})
+	}
+}
+
+// ************************** Application *******************************
+
+// Applique le diff, calculé par ComputeDiffSCTL() à partir de donnees.
+// A appeler dans une transaction (cf WithTx()).
+func AppliqueDiffSCTL(db DBOrTx, donnees *DonneesSCTL, d *DiffSCTL) (err error) {
+	var query string
+	//
+	// Communes
+	//
+	query = "insert into commune(id,nom,nomcourt,codeinsee) values($1,$2,$3,$4)"
+	for _, c := range d.CommunesNouvelles {
+		_, err = db.Exec(query, c.Id, c.Nom, c.NomCourt, c.CodeInsee)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	query = "update commune set codeinsee=$1 where id=$2"
+	for _, m := range d.CommunesModifiees {
+		_, err = db.Exec(query, donnees.Communes[m.Id].CodeInsee, m.Id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	//
+	// Lieux-dits
+	//
+	query = "insert into lieudit(id,nom) values($1,$2)"
+	for _, ld := range d.LieuditsNouveaux {
+		_, err = db.Exec(query, ld.Id, ld.Nom)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+		err = majLieuditMot(db, ld)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel majLieuditMot()")
+		}
+	}
+	query = "update lieudit set nom=$1 where id=$2"
+	for _, m := range d.LieuditsModifies {
+		ld := donnees.Lieudits[m.Id]
+		_, err = db.Exec(query, ld.Nom, ld.Id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+		err = majLieuditMot(db, ld)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel majLieuditMot()")
+		}
+	}
+	//
+	// Fermiers
+	//
+	for _, f := range d.FermiersNouveaux {
+		err = InsertFermier(db, f)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel InsertFermier()")
+		}
+	}
+	for _, m := range d.FermiersModifies {
+		err = UpdateFermier(db, donnees.Fermiers[m.Id])
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel UpdateFermier()")
+		}
+	}
+	//
+	// Parcelles
+	//
+	query = "insert into parcelle(id,id_proprietaire,code,surface,id_commune) values($1,$2,$3,$4,$5)"
+	for _, p := range d.ParcellesNouvelles {
+		_, err = db.Exec(query, p.Id, p.IdProprietaire, p.Code, p.Surface, p.IdCommune)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	query = "update parcelle set id_proprietaire=$1,code=$2,surface=$3,id_commune=$4 where id=$5"
+	for _, m := range d.ParcellesModifiees {
+		p := donnees.Parcelles[m.Id]
+		_, err = db.Exec(query, p.IdProprietaire, p.Code, p.Surface, p.IdCommune, p.Id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	//
+	// Liens
+	//
+	queriesSupprime := map[string]string{
+		LIEN_PARCELLE_LIEUDIT: "delete from parcelle_lieudit where id_parcelle=$1 and id_lieudit=$2",
+		LIEN_PARCELLE_FERMIER: "delete from parcelle_fermier where id_parcelle=$1 and id_fermier=$2",
+		LIEN_COMMUNE_LIEUDIT:  "delete from commune_lieudit where id_commune=$1 and id_lieudit=$2",
+		LIEN_PARCELLE_UG:      "delete from parcelle_ug where id_parcelle=$1 and id_ug=(select id from ug where code=$2 limit 1)",
+	}
+	queriesAjoute := map[string]string{
+		LIEN_PARCELLE_LIEUDIT: "insert into parcelle_lieudit(id_parcelle,id_lieudit) values($1,$2)",
+		LIEN_PARCELLE_FERMIER: "insert into parcelle_fermier(id_parcelle,id_fermier) values($1,$2)",
+		LIEN_COMMUNE_LIEUDIT:  "insert into commune_lieudit(id_commune,id_lieudit) values($1,$2)",
+		LIEN_PARCELLE_UG:      "insert into parcelle_ug(id_parcelle,id_ug) select $1,id from ug where code=$2 limit 1",
+	}
+	for table, liens := range d.LiensSupprimes {
+		for _, lien := range liens {
+			_, err = db.Exec(queriesSupprime[table], lien.Id1, lien.idOuCode())
+			if err != nil {
+				return werr.Wrapf(err, "Erreur query : "+queriesSupprime[table])
+			}
+		}
+	}
+	for table, liens := range d.LiensAjoutes {
+		for _, lien := range liens {
+			_, err = db.Exec(queriesAjoute[table], lien.Id1, lien.idOuCode())
+			if err != nil {
+				return werr.Wrapf(err, "Erreur query : "+queriesAjoute[table])
+			}
+		}
+	}
+	//
+	// Parcelles disparues, pas liées à un chantier
+	//
+	queries := []string{
+		"delete from parcelle_fermier where id_parcelle=$1",
+		"delete from parcelle_lieudit where id_parcelle=$1",
+		"delete from parcelle_ug where id_parcelle=$1",
+		"delete from parcelle where id=$1",
+	}
+	for _, p := range d.ParcellesDisparues {
+		if p.Conservee() {
+			continue
+		}
+		for _, query := range queries {
+			_, err = db.Exec(query, p.Parcelle.Id)
+			if err != nil {
+				return werr.Wrapf(err, "Erreur query : "+query)
+			}
+		}
+	}
+	return nil
+}
+
+// Met à jour l'index des mots du nom d'un lieu-dit (table lieudit_mot, utilisée pour la recherche).
+// Mêmes règles que manage/db-install, FillLieuditMot().
+func majLieuditMot(db DBOrTx, ld *Lieudit) (err error) {
+	ignore := []string{"LE", "LA", "LES", "DE", "DU", "D'", "DES", "DEL", "ET", "L'"}
+	query := "delete from lieudit_mot where id=$1"
+	_, err = db.Exec(query, ld.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = "insert into lieudit_mot(mot,id,nom) values($1,$2,$3)"
+	for _, mot := range strings.Split(ld.Nom, " ") {
+		if tiglib.InArray(mot, ignore) {
+			continue
+		}
+		_, err = db.Exec(query, mot, ld.Id, ld.Nom)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	return nil
+}
+
+// ************************** Auxiliaires *******************************
+
+// Deuxième paramètre des requêtes sur les liens
+func (l LienSCTL) idOuCode() any {
+	if l.Code != "" {
+		return l.Code
+	}
+	return l.Id2
+}
+
+func trieLiens(liens []LienSCTL) {
+	sort.Slice(liens, func(i, j int) bool {
+		if liens[i].Id1 != liens[j].Id1 {
+			return liens[i].Id1 < liens[j].Id1
+		}
+		if liens[i].Id2 != liens[j].Id2 {
+			return liens[i].Id2 < liens[j].Id2
+		}
+		return liens[i].Code < liens[j].Code
+	})
+}
+
+func clesTriees[T any](m map[int]T) []int {
+	res := make([]int, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Ints(res)
+	return res
+}
@@ -0,0 +1,372 @@
+/*
+Import des données SCTL (base Access du logiciel foncier) :
+communes, lieux-dits, parcelles, exploitants (fermiers) et leurs liens.
+Les liens parcelles - UGs viennent du fichier ug.csv du PSG, optionnel.
+
+Les données sont lues dans des exports csv de la base SCTL,
+produits par ExporteMdbSCTL() ou par manage/sctl-update/sctl-mdb2csv.
+Voir sctl-diff.go pour le calcul et l'application des différences avec la base BDL.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"encoding/csv"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Tables de la base SCTL utilisées par l'import ; chacune est exportée dans <table>.csv
+var TablesSCTL = []string{"Commune", "LieuDit", "Parcelle", "Exploita", "SubdivCadastre", "Subdivision"}
+
+// Fichier du PSG contenant les liens parcelles - UGs, optionnel
+const FICHIER_UG_SCTL = "ug.csv"
+
+// Id de l'exploitant "PERSONNE" dans la base SCTL
+const ID_EXPLOITANT_PERSONNE = 1
+
+// Données lues dans les exports de la base SCTL
+type DonneesSCTL struct {
+	Communes  map[int]*Commune
+	Lieudits  map[int]*Lieudit
+	Parcelles map[int]*Parcelle
+	Fermiers  map[int]*Fermier
+	// Liens
+	ParcelleLieudit map[LienSCTL]bool
+	CommuneLieudit  map[LienSCTL]bool
+	ParcelleFermier map[LienSCTL]bool
+	ParcelleUG      map[LienSCTL]bool // nil si ug.csv n'est pas fourni
+	// Pour information
+	NbNonAgricoles          int // exploitants non agricoles, pas importés
+	NbParcellesNonAgricoles int // parcelles exploitées uniquement par des non agricoles, pas importées
+	NbLignesIgnorees        int // lignes csv mal formées
+}
+
+// Lien entre 2 entités.
+// Id1 : id parcelle ou commune ; Id2 : id lieu-dit ou fermier ; Code : code UG (table parcelle_ug).
+type LienSCTL struct {
+	Id1  int
+	Id2  int
+	Code string
+}
+
+// ************************** Export mdb *******************************
+
+// Exporte les tables utiles de la base Access SCTL dans des fichiers csv du répertoire dir.
+// Utilise mdb-export (paquet mdbtools).
+func ExporteMdbSCTL(mdbPath, dir string) (err error) {
+	cmdMdbExport := SERVER_ENV.CMD_MDBEXPORT
+	if cmdMdbExport == "" {
+		cmdMdbExport = "mdb-export"
+	}
+	for _, table := range TablesSCTL {
+		out, err := os.Create(filepath.Join(dir, table+".csv"))
+		if err != nil {
+			return werr.Wrapf(err, "Erreur création fichier csv pour table "+table)
+		}
+		// Pas d'option -Q : les champs texte sont entre guillemets,
+		// ce qui permet de lire les retours à la ligne de Parcelle.Observations
+		cmd := exec.Command(cmdMdbExport, "-d", ";", mdbPath, table)
+		cmd.Stdout = out
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+		err = cmd.Run()
+		out.Close()
+		if err != nil {
+			return werr.Wrapf(err, "Erreur export table %s : %s", table, stderr.String())
+		}
+	}
+	return nil
+}
+
+// ************************** Lecture *******************************
+
+// Lit les exports csv de la base SCTL contenus dans dir.
+// Les exploitants non agricoles ne sont pas importés (voir manage/db-migrate/2023-05-22-non-agricoles--20.go),
+// ni les parcelles exploitées uniquement par des non agricoles.
+func LitDonneesSCTL(db DBOrTx, dir string) (d *DonneesSCTL, err error) {
+	d = &DonneesSCTL{
+		Communes:        map[int]*Commune{},
+		Lieudits:        map[int]*Lieudit{},
+		Parcelles:       map[int]*Parcelle{},
+		Fermiers:        map[int]*Fermier{},
+		ParcelleLieudit: map[LienSCTL]bool{},
+		CommuneLieudit:  map[LienSCTL]bool{},
+		ParcelleFermier: map[LienSCTL]bool{},
+	}
+	records := map[string][]map[string]string{}
+	for _, table := range TablesSCTL {
+		records[table], err = d.litCsv(filepath.Join(dir, table+".csv"), ';')
+		if err != nil {
+			return d, werr.Wrapf(err, "Erreur lecture "+table+".csv")
+		}
+	}
+	//
+	// Communes
+	//
+	for _, r := range records["Commune"] {
+		id, err := strconv.Atoi(r["IdCommune"])
+		if err != nil {
+			return d, werr.Wrapf(err, "Commune.csv : IdCommune incorrect : "+r["IdCommune"])
+		}
+		d.Communes[id] = &Commune{Id: id, Nom: r["NOM"], NomCourt: r["NOM"], CodeInsee: r["CodeInsee"]}
+	}
+	//
+	// Lieux-dits
+	//
+	for _, r := range records["LieuDit"] {
+		id, err := strconv.Atoi(r["IdLieuDit"])
+		if err != nil {
+			return d, werr.Wrapf(err, "LieuDit.csv : IdLieuDit incorrect : "+r["IdLieuDit"])
+		}
+		d.Lieudits[id] = &Lieudit{Id: id, Nom: r["Libelle"]}
+	}
+	//
+	// Exploitants
+	//
+	nonAgricoles := map[int]bool{}
+	for _, r := range records["Exploita"] {
+		id, err := strconv.Atoi(r["IdExploitant"])
+		if err != nil {
+			return d, werr.Wrapf(err, "Exploita.csv : IdExploitant incorrect : "+r["IdExploitant"])
+		}
+		if id == ID_EXPLOITANT_PERSONNE {
+			continue
+		}
+		if r["Agricole"] != "1" {
+			nonAgricoles[id] = true
+			continue
+		}
+		d.Fermiers[id] = &Fermier{
+			Id:      id,
+			Nom:     r["NOMEXP"],
+			Prenom:  r["Prenom"],
+			Adresse: r["AdresseExp"],
+			Cp:      tronque(r["CPExp"], 5), // fix une typo dans la base SCTL
+			Ville:   r["VilleExp"],
+			Tel:     tronque(r["Telephone"], 15),
+			Email:   r["Mail"],
+		}
+	}
+	d.NbNonAgricoles = len(nonAgricoles)
+	//
+	// Liens parcelle - exploitant, pour exclure les parcelles des non agricoles
+	//
+	exploitants := map[int][]int{} // id parcelle => ids exploitants
+	for _, r := range records["Subdivision"] {
+		idP, err1 := strconv.Atoi(r["IdParcelle"])
+		idE, err2 := strconv.Atoi(r["IdExploitant"])
+		if err1 != nil || err2 != nil {
+			d.NbLignesIgnorees++
+			continue
+		}
+		exploitants[idP] = append(exploitants[idP], idE)
+	}
+	//
+	// Parcelles
+	//
+	idSCTL, idGFA, err := getIdsProprietairesSCTL(db)
+	if err != nil {
+		return d, werr.Wrapf(err, "Erreur appel getIdsProprietairesSCTL()")
+	}
+	for _, r := range records["Parcelle"] {
+		id, err := strconv.Atoi(r["IdParcelle"])
+		if err != nil {
+			d.NbLignesIgnorees++
+			continue
+		}
+		if len(exploitants[id]) != 0 {
+			agricole := false
+			for _, idE := range exploitants[id] {
+				if !nonAgricoles[idE] {
+					agricole = true
+					break
+				}
+			}
+			if !agricole {
+				d.NbParcellesNonAgricoles++
+				continue
+			}
+		}
+		surface, err := strconv.ParseFloat(strings.ReplaceAll(r["SURFACE"], ",", "."), 64)
+		if err != nil {
+			d.NbLignesIgnorees++
+			continue
+		}
+		idCommune, _ := strconv.Atoi(r["IdCommune"])
+		p := &Parcelle{
+			Id:             id,
+			Code:           codeParcelleSCTL(r["PARCELLE"]),
+			Surface:        math.Round(surface) / 10000, // m2 -> ha
+			IdCommune:      idCommune,
+			IdProprietaire: idGFA,
+		}
+		if r["SCTL"] == "1" {
+			p.IdProprietaire = idSCTL
+		}
+		d.Parcelles[id] = p
+		idLieudit, err := strconv.Atoi(r["IdLieuDit"])
+		if err == nil && d.Lieudits[idLieudit] != nil {
+			d.ParcelleLieudit[LienSCTL{Id1: id, Id2: idLieudit}] = true
+		}
+	}
+	for idP, idsE := range exploitants {
+		if d.Parcelles[idP] == nil {
+			continue
+		}
+		for _, idE := range idsE {
+			if d.Fermiers[idE] != nil {
+				d.ParcelleFermier[LienSCTL{Id1: idP, Id2: idE}] = true
+			}
+		}
+	}
+	//
+	// Liens commune - lieu-dit
+	//
+	for _, r := range records["SubdivCadastre"] {
+		idC, err1 := strconv.Atoi(r["IdCommune"])
+		idLD, err2 := strconv.Atoi(r["IdLieuDit"])
+		if err1 != nil || err2 != nil {
+			d.NbLignesIgnorees++
+			continue
+		}
+		if d.Communes[idC] == nil || d.Lieudits[idLD] == nil {
+			continue // ex Les Mares, bug sctl
+		}
+		d.CommuneLieudit[LienSCTL{Id1: idC, Id2: idLD}] = true
+	}
+	//
+	// Liens parcelle - UG
+	//
+	filename := filepath.Join(dir, FICHIER_UG_SCTL)
+	if _, err = os.Stat(filename); err == nil {
+		err = d.litParcelleUG(db, filename)
+		if err != nil {
+			return d, werr.Wrapf(err, "Erreur lecture "+FICHIER_UG_SCTL)
+		}
+	}
+	return d, nil
+}
+
+// Utilise la colonne ID_PARCELLE_11 de ug.csv = code insee de la commune + code parcelle
+func (d *DonneesSCTL) litParcelleUG(db DBOrTx, filename string) error {
+	records, err := d.litCsv(filename, ',')
+	if err != nil {
+		return err
+	}
+	// codes insee des communes pas présentes dans Commune.csv
+	communes, err := GetSortedCommunes(db, "id")
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetSortedCommunes()")
+	}
+	codesInsee := map[int]string{}
+	for _, c := range communes {
+		codesInsee[c.Id] = c.CodeInsee
+	}
+	for _, c := range d.Communes {
+		if c.CodeInsee != "" {
+			codesInsee[c.Id] = c.CodeInsee
+		}
+	}
+	idsParcelles := map[string]int{} // code 11 => id parcelle
+	for _, p := range d.Parcelles {
+		idsParcelles[codesInsee[p.IdCommune]+p.Code] = p.Id
+	}
+	d.ParcelleUG = map[LienSCTL]bool{}
+	for _, r := range records {
+		codeUG := r["PG"]
+		if codeUG == "" || codeUG == "0" {
+			continue
+		}
+		idP, ok := idsParcelles[r["ID_PARCELLE_11"]]
+		if !ok {
+			continue
+		}
+		d.ParcelleUG[LienSCTL{Id1: idP, Code: codeUG}] = true
+	}
+	return nil
+}
+
+// Lit un fichier csv exporté de la base SCTL.
+// Plus tolérant que tiglib.CsvMap() : accepte les exports avec ou sans guillemets
+// et ignore les lignes mal formées (ex : retour à la ligne dans Parcelle.Observations exporté sans guillemets).
+func (d *DonneesSCTL) litCsv(filename string, sep rune) (res []map[string]string, err error) {
+	res = []map[string]string{}
+	fd, err := os.Open(filename)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel os.Open("+filename+")")
+	}
+	defer fd.Close()
+	reader := csv.NewReader(fd)
+	reader.Comma = sep
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	head, err := reader.Read()
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur lecture entête de "+filename)
+	}
+	for i := range head {
+		head[i] = strings.TrimSpace(strings.TrimPrefix(head[i], "\ufeff"))
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(record) != len(head) {
+			d.NbLignesIgnorees++
+			continue
+		}
+		m := make(map[string]string, len(head))
+		for i, field := range head {
+			m[field] = strings.TrimSpace(record[i])
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// ************************** Auxiliaires *******************************
+
+// Ids des acteurs propriétaires des parcelles.
+// ATTENTION : comme dans manage/db-install, les ids sont récupérés à partir du nom.
+func getIdsProprietairesSCTL(db DBOrTx) (idSCTL, idGFA int, err error) {
+	query := "select id from acteur where nom=$1"
+	err = db.Get(&idSCTL, query, "SCTL")
+	if err != nil {
+		return 0, 0, werr.Wrapf(err, "Erreur query : "+query+" - SCTL")
+	}
+	err = db.Get(&idGFA, query, "GFA Larzac")
+	if err != nil {
+		return 0, 0, werr.Wrapf(err, "Erreur query : "+query+" - GFA Larzac")
+	}
+	return idSCTL, idGFA, nil
+}
+
+// Code parcelle à 6 caractères (ex 0C0001), stocké dans la table parcelle.
+// Les exports récents contiennent parfois le code à 11 caractères (ex 120820C0001),
+// précédé du code insee de la commune.
+func codeParcelleSCTL(code string) string {
+	if len(code) == 11 {
+		return code[5:]
+	}
+	return code
+}
+
+// Tronque s à n caractères, pour respecter la taille des colonnes
+func tronque(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
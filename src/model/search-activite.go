@@ -13,7 +13,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"sort"
 	"strconv"
 	"time"
@@ -57,7 +56,7 @@ func (a *Activite) String() string {
 
 // ************************** Instance methods *******************************
 
-func (a *Activite) ComputeLiensParcelles(db *sqlx.DB) (err error) {
+func (a *Activite) ComputeLiensParcelles(db DBOrTx) (err error) {
 	if len(a.LiensParcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -68,7 +67,7 @@ func (a *Activite) ComputeLiensParcelles(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (a *Activite) ComputeFermiers(db *sqlx.DB) (err error) {
+func (a *Activite) ComputeFermiers(db DBOrTx) (err error) {
 	if len(a.Fermiers) != 0 {
 		return nil // déjà calculé
 	}
@@ -79,7 +78,7 @@ func (a *Activite) ComputeFermiers(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (a *Activite) ComputeUGs(db *sqlx.DB) (err error) {
+func (a *Activite) ComputeUGs(db DBOrTx) (err error) {
 	if len(a.UGs) != 0 {
 		return nil // déjà calculé
 	}
@@ -91,7 +90,7 @@ func (a *Activite) ComputeUGs(db *sqlx.DB) (err error) {
 }
 
 // Calcule a.SurfaceParProprio et a.SurfaceTotale
-func (a *Activite) ComputeSurfaceParProprio(db *sqlx.DB) (err error) {
+func (a *Activite) ComputeSurfaceParProprio(db DBOrTx) (err error) {
 	err = a.ComputeLiensParcelles(db)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ComputeLiensParcelles()")
@@ -123,7 +122,7 @@ func (a *Activite) ComputeSurfaceParProprio(db *sqlx.DB) (err error) {
 
 // ************************** Get many *******************************
 
-func ComputeActivitesFromFiltres(db *sqlx.DB, filtres map[string][]string) (res []*Activite, err error) {
+func ComputeActivitesFromFiltres(db DBOrTx, filtres map[string][]string) (res []*Activite, err error) {
 	res = []*Activite{}
 	//
 	// Première sélection, par filtre période
@@ -224,7 +223,7 @@ func (p activiteSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 // ************************** Selection initiale, par période *******************************
 // Fabriquent des activités
 
-func computePlaqActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []string) (res []*Activite, err error) {
+func computePlaqActivitesFromFiltrePeriode(db DBOrTx, filtrePeriode []string) (res []*Activite, err error) {
 	var query string
 	chantiers := []*Plaq{}
 	query = "select * from plaq"
@@ -247,7 +246,7 @@ func computePlaqActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []string)
 	return res, nil
 }
 
-func computeChautreActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []string) (res []*Activite, err error) {
+func computeChautreActivitesFromFiltrePeriode(db DBOrTx, filtrePeriode []string) (res []*Activite, err error) {
 	var query string
 	chantiers := []*Chautre{}
 	query = "select * from chautre"
@@ -270,7 +269,7 @@ func computeChautreActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []strin
 	return res, nil
 }
 
-func computeChauferActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []string) (res []*Activite, err error) {
+func computeChauferActivitesFromFiltrePeriode(db DBOrTx, filtrePeriode []string) (res []*Activite, err error) {
 	var query string
 	chantiers := []*Chaufer{}
 	query = "select * from chaufer"
@@ -296,7 +295,7 @@ func computeChauferActivitesFromFiltrePeriode(db *sqlx.DB, filtrePeriode []strin
 // ************************** Conversion de struct vers une Activite *******************************
 // Auxiliaires des fonctions compute*ActivitesFromFiltrePeriode()
 
-func plaq2Activite(db *sqlx.DB, ch *Plaq) (a *Activite, err error) {
+func plaq2Activite(db DBOrTx, ch *Plaq) (a *Activite, err error) {
 	a = &Activite{}
 	a.Id = ch.Id
 	a.TypeActivite = "plaq"
@@ -314,7 +313,7 @@ func plaq2Activite(db *sqlx.DB, ch *Plaq) (a *Activite, err error) {
 	return a, nil
 }
 
-func chautre2Activite(db *sqlx.DB, ch *Chautre) (a *Activite, err error) {
+func chautre2Activite(db DBOrTx, ch *Chautre) (a *Activite, err error) {
 	a = &Activite{}
 	a.Id = ch.Id
 	a.TypeActivite = "chautre"
@@ -330,7 +329,7 @@ func chautre2Activite(db *sqlx.DB, ch *Chautre) (a *Activite, err error) {
 	return a, nil
 }
 
-func chaufer2Activite(db *sqlx.DB, ch *Chaufer) (a *Activite, err error) {
+func chaufer2Activite(db DBOrTx, ch *Chaufer) (a *Activite, err error) {
 	a = &Activite{}
 	a.Id = ch.Id
 	a.TypeActivite = "chaufer"
@@ -348,7 +347,7 @@ func chaufer2Activite(db *sqlx.DB, ch *Chaufer) (a *Activite, err error) {
 // En entrée : liste d'activités
 // En sortie : liste d'activités qui satisfont au filtre
 
-func filtreActivite_essence(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite) {
+func filtreActivite_essence(db DBOrTx, input []*Activite, filtre []string) (res []*Activite) {
 	res = []*Activite{}
 	for _, a := range input {
 		for _, f := range filtre {
@@ -361,7 +360,7 @@ func filtreActivite_essence(db *sqlx.DB, input []*Activite, filtre []string) (re
 	return res
 }
 
-func filtreActivite_valo(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite) {
+func filtreActivite_valo(db DBOrTx, input []*Activite, filtre []string) (res []*Activite) {
 	res = []*Activite{}
 	for _, a := range input {
 		for _, f := range filtre {
@@ -374,7 +373,7 @@ func filtreActivite_valo(db *sqlx.DB, input []*Activite, filtre []string) (res [
 	return res
 }
 
-func filtreActivite_fermier(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite) {
+func filtreActivite_fermier(db DBOrTx, input []*Activite, filtre []string) (res []*Activite) {
 	res = []*Activite{}
 	for _, a := range input {
 		for _, f := range filtre {
@@ -390,7 +389,7 @@ func filtreActivite_fermier(db *sqlx.DB, input []*Activite, filtre []string) (re
 	return res
 }
 
-func filtreActivite_ug(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite) {
+func filtreActivite_ug(db DBOrTx, input []*Activite, filtre []string) (res []*Activite) {
 	res = []*Activite{}
 	// map pour ne pas inclure des activités en double.
 	// Se produit si on demande des ugs voisines,
@@ -415,7 +414,7 @@ ActiviteLoop:
 	return res
 }
 
-func filtreActivite_parcelle(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite) {
+func filtreActivite_parcelle(db DBOrTx, input []*Activite, filtre []string) (res []*Activite) {
 	res = []*Activite{}
 	for _, a := range input {
 		for _, f := range filtre {
@@ -431,7 +430,7 @@ func filtreActivite_parcelle(db *sqlx.DB, input []*Activite, filtre []string) (r
 	return res
 }
 
-func filtreActivite_proprio(db *sqlx.DB, input []*Activite, filtre []string) (res []*Activite, err error) {
+func filtreActivite_proprio(db DBOrTx, input []*Activite, filtre []string) (res []*Activite, err error) {
 	res = []*Activite{}
 	for _, a := range input {
 		for _, f := range filtre {
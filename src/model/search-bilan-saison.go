@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -33,7 +32,7 @@ type BilanActivitesParSaison struct {
 	TotalVentePlaquettesParProprio     map[int]float64     // key = id proprio - value = total vendu
 }
 
-func ComputeBilansActivitesParSaison(db *sqlx.DB, debutSaison string, activites []*Activite) (result []*BilanActivitesParSaison, err error) {
+func ComputeBilansActivitesParSaison(db DBOrTx, debutSaison string, activites []*Activite) (result []*BilanActivitesParSaison, err error) {
 	//
 	activitesParSaison, err := computeActivitesParSaison(db, debutSaison, activites)
 	if err != nil {
@@ -94,7 +93,7 @@ func ComputeBilansActivitesParSaison(db *sqlx.DB, debutSaison string, activites
 
 // Auxiliaire de ComputeBilansActivitesParSaison()
 // Parmi les activités passées en paramètre, ne retient que les activités ayant lieu dans une saison donnée.
-func computeActivitesParSaison(db *sqlx.DB, debutSaison string, activites []*Activite) (result []*ActiviteParSaison, err error) {
+func computeActivitesParSaison(db DBOrTx, debutSaison string, activites []*Activite) (result []*ActiviteParSaison, err error) {
 	limites, _, err := ComputeLimitesSaisons(db, debutSaison)
 	if err != nil {
 		return result, werr.Wrapf(err, "Erreur appel ComputeLimitesSaisons()")
@@ -11,7 +11,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 )
 
@@ -19,7 +18,7 @@ import (
 
 // fonction à optimiser pour n'appeler filtreUG_sansfiltre() que s'il n'y a aucun filtre
 // mais attendre que la demande de BDL soit stabilisée
-func ComputeUGsFromFiltres(db *sqlx.DB, filtres map[string][]string) (result []*UG, err error) {
+func ComputeUGsFromFiltres(db DBOrTx, filtres map[string][]string) (result []*UG, err error) {
 	result = []*UG{}
 	// Booléens indiquant si les Compute*() ont été appelés (pas si les filtres ont été appliqués)
 	essenceDone := false
@@ -105,7 +104,7 @@ func ComputeUGsFromFiltres(db *sqlx.DB, filtres map[string][]string) (result []*
 
 // ************************** Selection initiale, par champs de la table ug *******************************
 
-func filtreUG_sansfiltre(db *sqlx.DB) (result []*UG, err error) {
+func filtreUG_sansfiltre(db DBOrTx) (result []*UG, err error) {
 	result = []*UG{}
 	query := "select * from ug"
 	err = db.Select(&result, query)
@@ -119,7 +118,7 @@ func filtreUG_sansfiltre(db *sqlx.DB) (result []*UG, err error) {
 // En entrée : liste d'UGs
 // En sortie : liste d'UGs qui satisfont au filtre
 
-func filtreUG_essence(db *sqlx.DB, input []*UG, filtre []string) (result []*UG) {
+func filtreUG_essence(db DBOrTx, input []*UG, filtre []string) (result []*UG) {
 	result = []*UG{}
 	for _, ug := range input {
 		for _, codeEssence := range ug.CodesEssence {
@@ -132,7 +131,7 @@ func filtreUG_essence(db *sqlx.DB, input []*UG, filtre []string) (result []*UG)
 	return result
 }
 
-func filtreUG_fermier(db *sqlx.DB, input []*UG, filtre []string) (result []*UG) {
+func filtreUG_fermier(db DBOrTx, input []*UG, filtre []string) (result []*UG) {
 	result = []*UG{}
 	idFermier, _ := strconv.Atoi(filtre[0])
 	for _, ug := range input {
@@ -146,7 +145,7 @@ func filtreUG_fermier(db *sqlx.DB, input []*UG, filtre []string) (result []*UG)
 	return result
 }
 
-func filtreUG_commune(db *sqlx.DB, input []*UG, filtre []string) (result []*UG) {
+func filtreUG_commune(db DBOrTx, input []*UG, filtre []string) (result []*UG) {
 	result = []*UG{}
 	idCommune, _ := strconv.Atoi(filtre[0])
 	for _, ug := range input {
@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -28,13 +27,14 @@ type BilanVentesParSaison struct {
 }
 
 type TotalVentesParValo struct {
-	TypeValo string
-	Volume   float64
-	Unite    string
-	PrixHT   float64
+	TypeValo   string
+	Volume     float64
+	Unite      string
+	PrixHT     float64
+	ParProprio map[int]VolumePrixHT // key = id proprio (0 pour les ventes sans parcelle connue)
 }
 
-func ComputeBilansVentesParSaison(db *sqlx.DB, debutSaison string, ventes []*Vente) (result []*BilanVentesParSaison, err error) {
+func ComputeBilansVentesParSaison(db DBOrTx, debutSaison string, ventes []*Vente) (result []*BilanVentesParSaison, err error) {
 	ventesParSaison, err := ComputeVentesParSaison(db, debutSaison, ventes)
 	if err != nil {
 		return result, werr.Wrapf(err, "Erreur appel ComputeVentesParSaison()")
@@ -54,21 +54,33 @@ func ComputeBilansVentesParSaison(db *sqlx.DB, debutSaison string, ventes []*Ven
 		for _, vente := range venteParSaison.Ventes {
 			valo := vente.TypeValo
 			if _, ok := mapValos[valo]; !ok {
-				mapValos[valo] = TotalVentesParValo{TypeValo: valo}
+				mapValos[valo] = TotalVentesParValo{TypeValo: valo, ParProprio: map[int]VolumePrixHT{}}
 			}
 			entry := mapValos[valo]
 			entry.Volume += vente.Volume
 			entry.Unite = vente.Unite
 			entry.PrixHT += vente.PrixHT
+			// répartition par proprio, comme pour la traçabilité
+			parts, err := partsProprioVente(db, vente)
+			if err != nil {
+				return result, werr.Wrapf(err, "Erreur appel partsProprioVente()")
+			}
+			for idProprio, part := range parts {
+				parProprio := entry.ParProprio[idProprio]
+				parProprio.Volume += vente.Volume * part
+				parProprio.PrixHT += vente.PrixHT * part
+				entry.ParProprio[idProprio] = parProprio
+			}
 			mapValos[valo] = entry
 		}
 		// utilise map pour remplir currentRes
 		for valo, total := range mapValos {
 			newRes := TotalVentesParValo{
-				TypeValo: valo,
-				Volume:   total.Volume,
-				Unite:    total.Unite,
-				PrixHT:   total.PrixHT,
+				TypeValo:   valo,
+				Volume:     total.Volume,
+				Unite:      total.Unite,
+				PrixHT:     total.PrixHT,
+				ParProprio: total.ParProprio,
 			}
 			currentRes.TotalVentesParValo = append(currentRes.TotalVentesParValo, &newRes)
 		}
@@ -77,7 +89,50 @@ func ComputeBilansVentesParSaison(db *sqlx.DB, debutSaison string, ventes []*Ven
 	return result, nil
 }
 
-func ComputeVentesParSaison(db *sqlx.DB, debutSaison string, ventes []*Vente) (result []*VenteParSaison, err error) {
+// Renvoie la part (entre 0 et 1) de chaque proprio dans une vente - key = id proprio (0 si parcelle inconnue).
+// Vente plaquettes : au prorata des quantités chargées provenant de chaque parcelle (cf VentePlaq.ComputeOrigines()),
+// pour ne pas mélanger les parcelles de chantiers différents.
+// Vente autre valorisation : un seul chantier, au prorata des surfaces de ses parcelles.
+// Auxiliaire de ComputeBilansVentesParSaison()
+func partsProprioVente(db DBOrTx, vente *Vente) (res map[int]float64, err error) {
+	res = map[int]float64{}
+	if vente.TypeVente == "plaq" {
+		vp, err := GetVentePlaq(db, vente.Id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetVentePlaq()")
+		}
+		origines, err := vp.ComputeOrigines(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel VentePlaq.ComputeOrigines()")
+		}
+		total := 0.0
+		for _, origine := range origines {
+			total += origine.Qte
+		}
+		if total == 0 {
+			res[0] = 1 // vente sans chargement
+			return res, nil
+		}
+		for _, origine := range origines {
+			res[origine.IdProprietaire] += origine.Qte / total
+		}
+		return res, nil
+	}
+	err = vente.ComputeLiensParcelles(db)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel Vente.ComputeLiensParcelles()")
+	}
+	if len(vente.LiensParcelles) == 0 {
+		res[0] = 1
+		return res, nil
+	}
+	for i, part := range partsParcelles(vente.LiensParcelles) {
+		res[vente.LiensParcelles[i].Parcelle.IdProprietaire] += part
+	}
+	return res, nil
+}
+
+func ComputeVentesParSaison(db DBOrTx, debutSaison string, ventes []*Vente) (result []*VenteParSaison, err error) {
 	limites, _, err := ComputeLimitesSaisons(db, debutSaison)
 	tiglib.ArrayReverse(limites)
 	if err != nil {
@@ -12,7 +12,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"sort"
 	"strconv"
 	"strings"
@@ -51,7 +50,7 @@ func (v *Vente) String() string {
 
 // Rajouté pour issue #24 (implémenter filtre proprio dans bilans vente)
 // Un peu bidouille pour utiliser le code de bilan activité
-func (v *Vente) ComputeLiensParcelles(db *sqlx.DB) (err error) {
+func (v *Vente) ComputeLiensParcelles(db DBOrTx) (err error) {
 	if len(v.LiensParcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -86,7 +85,7 @@ func (v *Vente) ComputeLiensParcelles(db *sqlx.DB) (err error) {
 
 // ************************** Get many *******************************
 
-func ComputeVentesFromFiltres(db *sqlx.DB, filtres map[string][]string) (res []*Vente, err error) {
+func ComputeVentesFromFiltres(db DBOrTx, filtres map[string][]string) (res []*Vente, err error) {
 	res = []*Vente{}
 	//
 	// 1 - détermine dans quelles tables rechercher à partir du filtre valorisations
@@ -157,7 +156,7 @@ func (p venteSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 // ************************** Selection par période et client et valo *******************************
 
 // Fabrique des Ventes à partir de la table venteplaq
-func computeVentePlaqVenteFromFiltresPeriodeEtClient(db *sqlx.DB, filtrePeriode, filtreClient []string) (res []*Vente, err error) {
+func computeVentePlaqVenteFromFiltresPeriodeEtClient(db DBOrTx, filtrePeriode, filtreClient []string) (res []*Vente, err error) {
 	ventePlaqs := []*VentePlaq{}
 	and := []string{}
 	var args []interface{}
@@ -191,7 +190,7 @@ func computeVentePlaqVenteFromFiltresPeriodeEtClient(db *sqlx.DB, filtrePeriode,
 }
 
 // Fabrique des Ventes à partir de la table chautre
-func computeChautreVentreFromFiltresPeriodeEtClientEtValo(db *sqlx.DB, filtrePeriode, filtreClient, filtreValo []string) (res []*Vente, err error) {
+func computeChautreVentreFromFiltresPeriodeEtClientEtValo(db DBOrTx, filtrePeriode, filtreClient, filtreValo []string) (res []*Vente, err error) {
 	chantiers := []*Chautre{}
 	and := []string{}
 	var args []interface{}
@@ -233,7 +232,7 @@ func computeChautreVentreFromFiltresPeriodeEtClientEtValo(db *sqlx.DB, filtrePer
 // En entrée : liste de ventes
 // En sortie : liste de ventes qui satisfont au filtre
 
-func filtreVente_proprio(db *sqlx.DB, input []*Vente, filtre []string) (res []*Vente, err error) {
+func filtreVente_proprio(db DBOrTx, input []*Vente, filtre []string) (res []*Vente, err error) {
 	res = []*Vente{}
     for _, vente := range input {
         err = vente.ComputeLiensParcelles(db)
@@ -259,7 +258,7 @@ func filtreVente_proprio(db *sqlx.DB, input []*Vente, filtre []string) (res []*V
 
 // ************************** Conversion de struct vers une Vente *******************************
 
-func ventePlaq2Vente(db *sqlx.DB, vp *VentePlaq) (v *Vente, err error) {
+func ventePlaq2Vente(db DBOrTx, vp *VentePlaq) (v *Vente, err error) {
 	v = &Vente{}
 	err = vp.ComputeClient(db) // Obligatoire pour pouvoir utiliser String()
 	if err != nil {
@@ -287,7 +286,7 @@ func ventePlaq2Vente(db *sqlx.DB, vp *VentePlaq) (v *Vente, err error) {
 	return v, nil
 }
 
-func chautre2Vente(db *sqlx.DB, ch *Chautre) (v *Vente, err error) {
+func chautre2Vente(db DBOrTx, ch *Chautre) (v *Vente, err error) {
 	v = &Vente{}
 	v.Id = ch.Id
 	v.TypeVente = "autre"
@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"strings"
 	"time"
@@ -21,50 +20,75 @@ type VolumePrixHT struct {
     PrixHT float64
 }
 
+// Un filtre choisi dans un formulaire de recherche, ex "Propriétaire : SCTL"
+type RecapFiltre struct {
+	Label   string
+	Valeurs []string
+	URLs    []string // même longueur que Valeurs ; chaîne vide si la valeur n'a pas de page de détail
+}
+
 // Calcule un récapitulatif des choix effetués dans un formulaires contenant des filtres.
 // Pour affichage dans la page de résultat.
-func ComputeRecapFiltres(db *sqlx.DB, filtres map[string][]string) (result string, err error) {
-	result = ""
-	// Si aucun filtre
-	aucun := true
-	for k, _ := range filtres {
-		if len(filtres[k]) != 0 {
-			aucun = false
-			break
-		}
+func ComputeRecapFiltres(db DBOrTx, filtres map[string][]string) (result string, err error) {
+	recaps, err := ComputeRecapFiltresListe(db, filtres)
+	if err != nil {
+		return result, werr.Wrapf(err, "Erreur appel ComputeRecapFiltresListe()")
 	}
-	if aucun {
+	if len(recaps) == 0 {
 		return "Aucun filtre, tout est affiché", nil
 	}
 	//
 	result += "<table>\n"
+	for _, recap := range recaps {
+		tmp := []string{}
+		for i, valeur := range recap.Valeurs {
+			if recap.URLs[i] != "" {
+				valeur = "<a href=\"" + recap.URLs[i] + "\">" + valeur + "</a>"
+			}
+			tmp = append(tmp, valeur)
+		}
+		result += "<tr><td>" + recap.Label + " :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
+	}
+	result += "</table>\n"
+	//
+	return result, nil
+}
+
+// Version texte de ComputeRecapFiltres(), ex pour les PDF.
+// Renvoie un tableau vide si aucun filtre n'est choisi.
+func ComputeRecapFiltresListe(db DBOrTx, filtres map[string][]string) (result []*RecapFiltre, err error) {
+	result = []*RecapFiltre{}
+	ajoute := func(label string) *RecapFiltre {
+		recap := &RecapFiltre{Label: label}
+		result = append(result, recap)
+		return recap
+	}
 	//
 	if len(filtres["periode"]) != 0 {
 		deb, err := time.Parse("2006-01-02", filtres["periode"][0])
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur appel time.Parse("+filtres["periode"][0]+")")
 		}
-		strDeb := tiglib.DateFr(deb)
-		//
 		fin, err := time.Parse("2006-01-02", filtres["periode"][1])
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur appel time.Parse("+filtres["periode"][1]+")")
 		}
-		strFin := tiglib.DateFr(fin)
-		result += "<tr><td>Période :</td><td>" + strDeb + " - " + strFin + "</td></tr>\n"
+		recap := ajoute("Période")
+		recap.Valeurs = []string{tiglib.DateFr(deb) + " - " + tiglib.DateFr(fin)}
+		recap.URLs = []string{""}
 	}
 	//
 	if len(filtres["proprio"]) != 0 {
-		tmp := []string{} // Comme il n'y a que 2 propriétaires, tmp ne contient qu'un élément - mais code écrit pour un cas plus général
+		recap := ajoute("Propriétaire") // Comme il n'y a que 2 propriétaires, ne contient qu'un élément - mais code écrit pour un cas plus général
 		for _, value := range filtres["proprio"] {
 			id, _ := strconv.Atoi(value)
 			proprio, err := GetActeur(db, id)
 			if err != nil {
 				return result, werr.Wrapf(err, "Erreur appel GetActeur()")
 			}
-			tmp = append(tmp, "<a href=\"/acteur/"+strconv.Itoa(proprio.Id)+"\">"+proprio.String()+"</a>")
+			recap.Valeurs = append(recap.Valeurs, proprio.String())
+			recap.URLs = append(recap.URLs, "/acteur/"+strconv.Itoa(proprio.Id))
 		}
-		result += "<tr><td>Propriétaire :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
 	}
 	//
 	if len(filtres["fermier"]) != 0 {
@@ -73,7 +97,9 @@ func ComputeRecapFiltres(db *sqlx.DB, filtres map[string][]string) (result strin
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur appel GetFermier()")
 		}
-		result += "<tr><td>Fermier :</td><td><a href=\"/fermier/" + strconv.Itoa(fermier.Id) + "\">" + fermier.String() + "</a>" + "</td></tr>\n"
+		recap := ajoute("Fermier")
+		recap.Valeurs = []string{fermier.String()}
+		recap.URLs = []string{"/fermier/" + strconv.Itoa(fermier.Id)}
 	}
 	//
 	if len(filtres["commune"]) != 0 {
@@ -82,7 +108,9 @@ func ComputeRecapFiltres(db *sqlx.DB, filtres map[string][]string) (result strin
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur appel GetCommune()")
 		}
-		result += "<tr><td>Commune :</td><td>" + commune.String() + "</td></tr>\n"
+		recap := ajoute("Commune")
+		recap.Valeurs = []string{commune.String()}
+		recap.URLs = []string{""}
 	}
 	//
 	if len(filtres["client"]) != 0 {
@@ -91,52 +119,56 @@ func ComputeRecapFiltres(db *sqlx.DB, filtres map[string][]string) (result strin
 		if err != nil {
 			return result, werr.Wrapf(err, "Erreur appel GetActeur()")
 		}
-		result += "<tr><td>Client :</td><td><a href=\"/acteur/" + strconv.Itoa(client.Id) + "\">" + client.String() + "</a>" + "</td></tr>\n"
+		recap := ajoute("Client")
+		recap.Valeurs = []string{client.String()}
+		recap.URLs = []string{"/acteur/" + strconv.Itoa(client.Id)}
 	}
 	//
 	if len(filtres["essence"]) != 0 {
-		tmp := []string{}
+		recap := ajoute("Essences")
 		for _, code := range filtres["essence"] {
-			tmp = append(tmp, EssenceMap[code])
+			recap.Valeurs = append(recap.Valeurs, EssenceMap[code])
+			recap.URLs = append(recap.URLs, "")
 		}
-		result += "<tr><td>Essences :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
 	}
 	//
 	if len(filtres["valo"]) != 0 {
-		tmp := []string{}
+		recap := ajoute("Valorisations")
 		for _, code := range filtres["valo"] {
-			tmp = append(tmp, ValoMap[code])
+			recap.Valeurs = append(recap.Valeurs, ValoMap[code])
+			recap.URLs = append(recap.URLs, "")
 		}
-		result += "<tr><td>Valorisations :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
 	}
 	//
 	if len(filtres["ug"]) != 0 {
-		tmp := []string{}
+		recap := ajoute("UGs")
 		for _, value := range filtres["ug"] {
 			id, _ := strconv.Atoi(value)
 			ug, err := GetUG(db, id)
 			if err != nil {
 				return result, werr.Wrapf(err, "Erreur appel GetUG()")
 			}
-			tmp = append(tmp, "<a href=\"/ug/"+strconv.Itoa(ug.Id)+"\">"+ug.String()+"</a>")
+			recap.Valeurs = append(recap.Valeurs, ug.String())
+			recap.URLs = append(recap.URLs, "/ug/"+strconv.Itoa(ug.Id))
 		}
-		result += "<tr><td>UGs :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
 	}
 	//
 	if len(filtres["parcelle"]) != 0 {
-		tmp := []string{}
+		recap := ajoute("Parcelles")
 		for _, value := range filtres["parcelle"] {
 			id, _ := strconv.Atoi(value)
 			parcelle, err := GetParcelle(db, id)
 			if err != nil {
 				return result, werr.Wrapf(err, "Erreur appel GetParcelle()")
 			}
-			tmp = append(tmp, "<a href=\"/parcelle/"+strconv.Itoa(parcelle.Id)+"\">"+parcelle.String()+"</a>")
+			recap.Valeurs = append(recap.Valeurs, parcelle.String())
+			recap.URLs = append(recap.URLs, "/parcelle/"+strconv.Itoa(parcelle.Id))
 		}
-		result += "<tr><td>Parcelles :</td><td>" + strings.Join(tmp, ", ") + "</td></tr>\n"
 	}
-	//
-	result += "</table>\n"
-	//
 	return result, nil
 }
+
+// Texte d'un filtre, ex "Propriétaire : SCTL"
+func (recap *RecapFiltre) String() string {
+	return recap.Label + " : " + strings.Join(recap.Valeurs, ", ")
+}
@@ -0,0 +1,93 @@
+/*
+Sessions des utilisateurs connectés.
+Une session est identifiée par un jeton aléatoire, stocké dans un cookie du navigateur.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type Session struct {
+	Token         string
+	IdUtilisateur int `db:"id_utilisateur"`
+	DateExpire    time.Time
+}
+
+// Durée de session utilisée si duree-session n'est pas renseigné dans config.yml
+const DUREE_SESSION_DEFAUT = 12 // heures
+
+// Crée une session pour un utilisateur et renvoie son jeton
+// Efface au passage les sessions expirées
+func InsertSession(db DBOrTx, conf *Config, idUtilisateur int) (s *Session, err error) {
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel rand.Read()")
+	}
+	duree := conf.DureeSession
+	if duree <= 0 {
+		duree = DUREE_SESSION_DEFAUT
+	}
+	s = &Session{
+		Token:         hex.EncodeToString(buf),
+		IdUtilisateur: idUtilisateur,
+		DateExpire:    time.Now().Add(time.Duration(duree) * time.Hour),
+	}
+	query := "delete from session where dateexpire<$1"
+	_, err = db.Exec(query, time.Now())
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	query = "insert into session(token,id_utilisateur,dateexpire) values($1,$2,$3)"
+	_, err = db.Exec(query, s.Token, s.IdUtilisateur, s.DateExpire)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return s, nil
+}
+
+// Renvoie l'utilisateur associé à une session valide
+// Renvoie nil (sans erreur) si la session n'existe pas, a expiré ou si l'utilisateur est inactif
+func GetUtilisateurFromSession(db DBOrTx, token string) (u *Utilisateur, err error) {
+	if token == "" {
+		return nil, nil
+	}
+	res := []*Utilisateur{}
+	query := `select * from utilisateur where actif and id in(
+	    select id_utilisateur from session where token=$1 and dateexpire>$2
+    )`
+	err = db.Select(&res, query, token, time.Now())
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return res[0], nil
+}
+
+func DeleteSession(db DBOrTx, token string) (err error) {
+	query := "delete from session where token=$1"
+	_, err = db.Exec(query, token)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
+
+func DeleteSessionsUtilisateur(db DBOrTx, idUtilisateur int) (err error) {
+	query := "delete from session where id_utilisateur=$1"
+	_, err = db.Exec(query, idUtilisateur)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Evolution du stock des hangars et prévision de la date à laquelle ils seront vides.
+
+Le stock journalier d'un hangar est reconstitué à partir des mouvements
+(transports, chargements) de tous ses tas, cf Tas.ComputeEvolutionStock().
+La prévision utilise le rythme moyen des chargements des dernières saisons complètes.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"time"
+)
+
+type PrevisionStockage struct {
+	Stockage *Stockage
+	// Stocks[k] = stock du hangar à la fin du jour DateDebut + k ; le dernier jour est aujourd'hui
+	DateDebut time.Time
+	Stocks    []float64
+	// Période utilisée pour calculer le rythme des chargements
+	DebutRythme time.Time
+	FinRythme   time.Time
+	// Chargements sur la période, en maps
+	TotalCharge float64
+	// En maps par jour
+	RythmeCharge float64
+	// Date prévue où le hangar sera vide ; nulle si le rythme est nul
+	DateVide time.Time
+	// Nb de jours avant que le hangar soit vide
+	NbJoursRestants int
+}
+
+// Stock du hangar à la fin d'aujourd'hui
+func (p *PrevisionStockage) StockActuel() float64 {
+	if len(p.Stocks) == 0 {
+		return 0
+	}
+	return p.Stocks[len(p.Stocks)-1]
+}
+
+// Calcule l'évolution du stock et la prévision de vidage de tous les hangars actifs.
+// @param limiteSaison  format JJ/MM (tiré de 'debut-saison' en conf)
+// @param nbSaisons     nb de saisons complètes utilisées pour calculer le rythme des chargements.
+// S'il n'y a pas encore de saison complète, utilise la saison en cours.
+func ComputePrevisionsStockages(db DBOrTx, limiteSaison string, nbSaisons int) (res []*PrevisionStockage, err error) {
+	res = []*PrevisionStockage{}
+	aujourdhui := jour(time.Now())
+	debutRythme, finRythme, err := periodeRythmeCharge(db, limiteSaison, nbSaisons, aujourdhui)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel periodeRythmeCharge()")
+	}
+	stockages, err := GetStockages(db, true)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetStockages()")
+	}
+	for _, s := range stockages {
+		p, err := computePrevisionStockage(db, s, debutRythme, finRythme, aujourdhui)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel computePrevisionStockage()")
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+func computePrevisionStockage(db DBOrTx, s *Stockage, debutRythme, finRythme, aujourdhui time.Time) (p *PrevisionStockage, err error) {
+	p = &PrevisionStockage{
+		Stockage:    s,
+		DebutRythme: debutRythme,
+		FinRythme:   finRythme,
+	}
+	idsTas := []int{}
+	query := "select id from tas where id_stockage=$1"
+	err = db.Select(&idsTas, query, s.Id)
+	if err != nil {
+		return p, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	tas := []*Tas{}
+	for _, idTas := range idsTas {
+		t, err := GetTas(db, idTas)
+		if err != nil {
+			return p, werr.Wrapf(err, "Erreur appel GetTas()")
+		}
+		err = t.ComputeEvolutionStock(db)
+		if err != nil {
+			return p, werr.Wrapf(err, "Erreur appel Tas.ComputeEvolutionStock()")
+		}
+		if len(t.EvolutionStock) == 0 {
+			continue
+		}
+		if p.DateDebut.IsZero() || t.EvolutionStock[0].Date.Before(p.DateDebut) {
+			p.DateDebut = jour(t.EvolutionStock[0].Date)
+		}
+		for _, mvt := range t.EvolutionStock {
+			d := jour(mvt.Date)
+			if mvt.TypeMvt == MVT_CHARGEMENT && !d.Before(debutRythme) && !d.After(finRythme) {
+				p.TotalCharge -= mvt.Delta
+			}
+		}
+		tas = append(tas, t)
+	}
+	if p.DateDebut.IsZero() || p.DateDebut.After(aujourdhui) {
+		p.DateDebut = aujourdhui
+	}
+	p.Stocks = make([]float64, nbJours(p.DateDebut, aujourdhui))
+	for _, t := range tas {
+		for k, stock := range t.stocksJournaliers(p.DateDebut, aujourdhui) {
+			p.Stocks[k] += stock
+		}
+	}
+	// rythme : si le hangar a été utilisé après le début de la période, seuls les jours d'utilisation comptent
+	debut := debutRythme
+	if p.DateDebut.After(debut) {
+		debut = p.DateDebut
+	}
+	if !debut.After(finRythme) {
+		p.RythmeCharge = p.TotalCharge / float64(nbJours(debut, finRythme))
+	}
+	if p.RythmeCharge > 0 {
+		p.NbJoursRestants = int(p.StockActuel() / p.RythmeCharge)
+		p.DateVide = aujourdhui.AddDate(0, 0, p.NbJoursRestants)
+	}
+	return p, nil
+}
+
+// Renvoie la période utilisée pour calculer le rythme des chargements :
+// les nbSaisons dernières saisons terminées avant aujourd'hui,
+// ou la saison en cours jusqu'à aujourd'hui s'il n'y a pas de saison terminée.
+func periodeRythmeCharge(db DBOrTx, limiteSaison string, nbSaisons int, aujourdhui time.Time) (debut, fin time.Time, err error) {
+	saisons, ok, err := ComputeLimitesSaisons(db, limiteSaison)
+	if err != nil {
+		return debut, fin, werr.Wrapf(err, "Erreur appel ComputeLimitesSaisons()")
+	}
+	if !ok || len(saisons) == 0 {
+		return aujourdhui, aujourdhui, nil
+	}
+	n := 0
+	for _, saison := range saisons { // ordre chrono inverse
+		if !saison[1].Before(aujourdhui) {
+			continue
+		}
+		if n == 0 {
+			fin = saison[1]
+		}
+		debut = saison[0]
+		n++
+		if n == nbSaisons {
+			break
+		}
+	}
+	if n == 0 {
+		return saisons[len(saisons)-1][0], aujourdhui, nil
+	}
+	return debut, fin, nil
+}
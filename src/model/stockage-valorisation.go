@@ -0,0 +1,236 @@
+/*
+Valorisation du stock de plaquettes à une date, pour le bilan comptable (ex au 30/09 ou au 31/12).
+
+Quantités : reconstituées à partir des mouvements de stock, à la fin de la journée demandée.
+Coût d'une map : coût de revient par map du chantier à la date (cf Plaq.ComputeCoutsALaDate()).
+Sont compris les coûts de production et d'acheminement jusqu'au lieu de stockage :
+abattage, débardage, broyage, déchiquetage, faux frais, transport, rangement,
+transferts effectués au plus tard à la date, et stockage jusqu'à la date.
+Ne sont pas compris le chargement et la livraison : ce sont des frais de vente,
+engagés quand les plaquettes sortent du stock.
+
+Deux méthodes :
+  - VALO_STOCK_TAS : chaque tas est valorisé avec le coût de son chantier.
+  - VALO_STOCK_FIFO : dans chaque lieu de stockage, les plaquettes sorties sont les plus anciennes ;
+    le stock restant est constitué des dernières entrées (transports, transferts, ajustements),
+    chacune valorisée avec le coût de son chantier.
+    Ne change le résultat que si plusieurs chantiers alimentent le même lieu de stockage.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Méthodes de valorisation du stock
+const (
+	VALO_STOCK_TAS  = "tas"
+	VALO_STOCK_FIFO = "fifo"
+)
+
+type ValorisationStock struct {
+	Date      time.Time
+	Methode   string // VALO_STOCK_TAS ou VALO_STOCK_FIFO
+	Stockages []*ValorisationStockage
+}
+
+// Valorisation du stock d'un lieu de stockage
+type ValorisationStockage struct {
+	Stockage *Stockage
+	Lignes   []*LigneValorisationStock
+}
+
+// Avec VALO_STOCK_TAS, une ligne par tas ; avec VALO_STOCK_FIFO, une ligne par chantier
+type LigneValorisationStock struct {
+	Chantier   *Plaq
+	Tas        *Tas    // nil avec VALO_STOCK_FIFO
+	Qte        float64 // en maps sèches
+	CoutParMap float64 // HT
+}
+
+// ************************** Totaux *******************************
+
+func (l *LigneValorisationStock) Valeur() float64 {
+	return l.Qte * l.CoutParMap
+}
+
+func (vs *ValorisationStockage) Qte() (res float64) {
+	for _, l := range vs.Lignes {
+		res += l.Qte
+	}
+	return res
+}
+
+func (vs *ValorisationStockage) Valeur() (res float64) {
+	for _, l := range vs.Lignes {
+		res += l.Valeur()
+	}
+	return res
+}
+
+func (v *ValorisationStock) Qte() (res float64) {
+	for _, vs := range v.Stockages {
+		res += vs.Qte()
+	}
+	return res
+}
+
+func (v *ValorisationStock) Valeur() (res float64) {
+	for _, vs := range v.Stockages {
+		res += vs.Valeur()
+	}
+	return res
+}
+
+// ************************** Calcul *******************************
+
+// Calcule la valorisation du stock de tous les lieux de stockage à la fin de la journée date.
+// Les lieux de stockage sont triés par nom, les lignes par ordre décroissant de valeur.
+// @param methode   VALO_STOCK_TAS ou VALO_STOCK_FIFO
+func ComputeValorisationStock(db DBOrTx, config *Config, date time.Time, methode string) (res *ValorisationStock, err error) {
+	res = &ValorisationStock{Date: date, Methode: methode}
+	if methode != VALO_STOCK_TAS && methode != VALO_STOCK_FIFO {
+		return res, werr.New("Méthode de valorisation du stock inconnue : " + methode)
+	}
+	stocks := []struct {
+		IdTas      int `db:"id_tas"`
+		IdStockage int `db:"id_stockage"`
+		IdChantier int `db:"id_chantier"`
+		Stock      float64
+	}{}
+	query := `select m.id_tas, t.id_stockage, t.id_chantier, sum(m.qte) as stock
+        from mouvementstock m join tas t on m.id_tas=t.id
+        where m.datemvt<=$1
+        group by m.id_tas, t.id_stockage, t.id_chantier
+        having sum(m.qte) > $2
+        order by m.id_tas`
+	err = db.Select(&stocks, query, date, TOLERANCE_STOCK)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	couts := map[int]*Plaq{} // id chantier => chantier avec ses coûts
+	parStockage := map[int]*ValorisationStockage{}
+	stockStockages := map[int]float64{} // id stockage => stock à la date
+	for _, s := range stocks {
+		vs, ok := parStockage[s.IdStockage]
+		if !ok {
+			vs = &ValorisationStockage{}
+			vs.Stockage, err = GetStockage(db, s.IdStockage)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel GetStockage()")
+			}
+			parStockage[s.IdStockage] = vs
+			res.Stockages = append(res.Stockages, vs)
+		}
+		stockStockages[s.IdStockage] += s.Stock
+		if methode != VALO_STOCK_TAS {
+			continue
+		}
+		ligne := &LigneValorisationStock{Qte: s.Stock}
+		ligne.Chantier, ligne.CoutParMap, err = coutMapValorisation(db, config, couts, s.IdChantier, date)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel coutMapValorisation()")
+		}
+		ligne.Tas, err = GetTas(db, s.IdTas)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetTas()")
+		}
+		ligne.Tas.Stock = s.Stock // stock à la date
+		ligne.Tas.Chantier = ligne.Chantier
+		ligne.Tas.Stockage = vs.Stockage
+		err = ligne.Tas.ComputeNom(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Tas.ComputeNom()")
+		}
+		vs.Lignes = append(vs.Lignes, ligne)
+	}
+	if methode == VALO_STOCK_FIFO {
+		for idStockage, vs := range parStockage {
+			vs.Lignes, err = lignesValorisationFIFO(db, config, couts, idStockage, date, stockStockages[idStockage])
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel lignesValorisationFIFO()")
+			}
+		}
+	}
+	for _, vs := range res.Stockages {
+		sort.Slice(vs.Lignes, func(i, j int) bool { return vs.Lignes[i].Valeur() > vs.Lignes[j].Valeur() })
+	}
+	sort.Slice(res.Stockages, func(i, j int) bool {
+		return strings.ToLower(res.Stockages[i].Stockage.Nom) < strings.ToLower(res.Stockages[j].Stockage.Nom)
+	})
+	return res, nil
+}
+
+// Lignes de valorisation FIFO d'un lieu de stockage :
+// le stock est réparti sur les entrées, de la plus récente à la plus ancienne.
+// Une entrée = mouvement positif (après compensation des mouvements inverses)
+// de type transport, transfert ou ajustement, dans un tas du lieu de stockage.
+// Auxiliaire de ComputeValorisationStock()
+func lignesValorisationFIFO(db DBOrTx, config *Config, couts map[int]*Plaq, idStockage int, date time.Time, stock float64) (res []*LigneValorisationStock, err error) {
+	res = []*LigneValorisationStock{}
+	entrees := []struct {
+		IdChantier int `db:"id_chantier"`
+		Qte        float64
+	}{}
+	query := `select t.id_chantier, sum(m.qte) as qte
+        from mouvementstock m join tas t on m.id_tas=t.id
+        where t.id_stockage=$1 and m.datemvt<=$2 and m.typemvt in ($3, $4, $5)
+        group by m.id_tas, t.id_chantier, m.typemvt, m.id_ligne, m.datemvt
+        having sum(m.qte) > 0
+        order by m.datemvt desc, max(m.id) desc`
+	err = db.Select(&entrees, query, idStockage, date, MVT_TRANSPORT, MVT_TRANSFERT, MVT_AJUSTEMENT)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	parChantier := map[int]*LigneValorisationStock{}
+	for _, e := range entrees {
+		if stock <= TOLERANCE_STOCK {
+			break
+		}
+		qte := math.Min(e.Qte, stock)
+		stock -= qte
+		ligne, ok := parChantier[e.IdChantier]
+		if !ok {
+			ligne = &LigneValorisationStock{}
+			ligne.Chantier, ligne.CoutParMap, err = coutMapValorisation(db, config, couts, e.IdChantier, date)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel coutMapValorisation()")
+			}
+			parChantier[e.IdChantier] = ligne
+			res = append(res, ligne)
+		}
+		ligne.Qte += qte
+	}
+	return res, nil
+}
+
+// Renvoie un chantier et son coût par map à la date, utilisé pour valoriser le stock
+// (hors chargement et livraison, cf commentaire en tête de fichier).
+// couts sert de cache : le calcul des coûts d'un chantier est coûteux.
+func coutMapValorisation(db DBOrTx, config *Config, couts map[int]*Plaq, idChantier int, date time.Time) (ch *Plaq, cout float64, err error) {
+	ch, ok := couts[idChantier]
+	if !ok {
+		ch, err = GetPlaqFull(db, idChantier)
+		if err != nil {
+			return ch, 0, werr.Wrapf(err, "Erreur appel GetPlaqFull()")
+		}
+		err = ch.ComputeCoutsALaDate(db, config, date)
+		if err != nil {
+			return ch, 0, werr.Wrapf(err, "Erreur appel Plaq.ComputeCoutsALaDate()")
+		}
+		couts[idChantier] = ch
+	}
+	if ch.CoutParMap == nil {
+		return ch, 0, nil // chantier sans volume, coûts non calculés
+	}
+	cout = ch.CoutParMap.Total - ch.CoutParMap.Chargement - ch.CoutParMap.Livraison
+	return ch, cout, nil
+}
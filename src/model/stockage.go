@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/wilk/werr"
 	"errors"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -32,7 +31,7 @@ type Stockage struct {
 
 // Renvoie un lieu de stockage contenant les données stockées en base.
 // Les autres champs ne sont pas remplis.
-func GetStockage(db *sqlx.DB, id int) (s *Stockage, err error) {
+func GetStockage(db DBOrTx, id int) (s *Stockage, err error) {
 	s = &Stockage{}
 	query := "select * from stockage where id=$1"
 	row := db.QueryRowx(query, id)
@@ -48,7 +47,7 @@ func GetStockage(db *sqlx.DB, id int) (s *Stockage, err error) {
 // - les frais
 // - les champs Deletable et Archivable
 // - les tas non vides
-func GetStockageFull(db *sqlx.DB, id int) (s *Stockage, err error) {
+func GetStockageFull(db DBOrTx, id int) (s *Stockage, err error) {
 	s, err = GetStockage(db, id)
 	if err != nil {
 		return s, werr.Wrapf(err, "Erreur appel GetStockage()")
@@ -81,7 +80,7 @@ func GetStockageFull(db *sqlx.DB, id int) (s *Stockage, err error) {
 //
 //	true => ne renvoie que les stockages actifs (pas archivés)
 //	false => ne renvoie que les stockages archivés
-func GetStockages(db *sqlx.DB, actifs bool) (stockages []*Stockage, err error) {
+func GetStockages(db DBOrTx, actifs bool) (stockages []*Stockage, err error) {
 	stockages = []*Stockage{}
 	query := "select * from stockage where archived="
 	if actifs {
@@ -102,7 +101,7 @@ func GetStockages(db *sqlx.DB, actifs bool) (stockages []*Stockage, err error) {
 //
 //	true => ne renvoie que les stockages actifs (pas archivés)
 //	false => ne renvoie que les stockages archivés
-func GetStockagesFull(db *sqlx.DB, actifs bool) (stockages []*Stockage, err error) {
+func GetStockagesFull(db DBOrTx, actifs bool) (stockages []*Stockage, err error) {
 	res := []*Stockage{}
 	stockages, err = GetStockages(db, actifs)
 	if err != nil {
@@ -120,7 +119,7 @@ func GetStockagesFull(db *sqlx.DB, actifs bool) (stockages []*Stockage, err erro
 
 // ************************** Compute *******************************
 
-func (s *Stockage) ComputeFrais(db *sqlx.DB) (err error) {
+func (s *Stockage) ComputeFrais(db DBOrTx) (err error) {
 	query := "select * from stockfrais where id_stockage=$1 order by datedeb"
 	frais := []*StockFrais{}
 	err = db.Select(&frais, query, s.Id)
@@ -131,8 +130,8 @@ func (s *Stockage) ComputeFrais(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (s *Stockage) ComputeTasActifs(db *sqlx.DB) (err error) {
-	query := "select * from tas where actif and id_stockage=$1"
+func (s *Stockage) ComputeTasActifs(db DBOrTx) (err error) {
+	query := SELECT_TAS + " where actif and id_stockage=$1"
 	err = db.Select(&s.TasActifs, query, &s.Id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -151,24 +150,20 @@ func (s *Stockage) ComputeTasActifs(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (s *Stockage) ComputeStock(db *sqlx.DB) (err error) {
-	var stocks []float64
-	query := "select stock from tas where actif and id_stockage=$1"
-	err = db.Select(&stocks, query, s.Id)
+func (s *Stockage) ComputeStock(db DBOrTx) (err error) {
+	query := `select coalesce(sum(qte), 0) from mouvementstock
+        where id_tas in(select id from tas where actif and id_stockage=$1)`
+	err = db.Get(&s.Stock, query, s.Id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query DB : "+query)
 	}
-	s.Stock = 0
-	for _, stock := range stocks {
-		s.Stock += stock
-	}
 	return nil
 }
 
 // Calcule les champs Deletable et Archivable
 // Un stockage est Deletable s'il n'est associé à aucune activité
 // Un stockage est Archivable s'il est associé à des activités mais ne contient pas de tas actif
-func (s *Stockage) ComputeDeletableAndArchivable(db *sqlx.DB) (err error) {
+func (s *Stockage) ComputeDeletableAndArchivable(db DBOrTx) (err error) {
 	var count int
 	// Deletable
 	// il suffit de compter les tas associés au lieu de stockage
@@ -190,15 +185,15 @@ func (s *Stockage) ComputeDeletableAndArchivable(db *sqlx.DB) (err error) {
 	return nil
 }
 
-// Calcule le coût du stockage pour une période donnée.
+// Calcule le coût journalier du stockage pour une période donnée.
 // Prend en compte tous les frais du hangar (loyer, elec, assurance)
-// Le coût est ramené à la période considérée.
-// Ex : pour un loyer de 6000 E / an, si j2 - j1 = 6 mois, va compter 3000
-// @param   jourD, jour2 jours de début / fin de la période au format YYYY-MM-DD
+// Chaque frais est réparti uniformément sur les jours de sa période [DateDebut, DateFin].
+// Ex : pour un loyer de 6000 E / an, chaque jour de l'année compte 6000 / 365
+// @param   jourD, jourF jours de début / fin de la période au format YYYY-MM-DD
 // @return  Tableau contenant les coûts pour chaque jour de la période [jourD, jourF]
 //
 //	res[0] = frais pour jourD, res[1] = frais pour jourD + 1, etc.
-func (s *Stockage) ComputeCout(db *sqlx.DB, jourD, jourF string) (res []float64, err error) {
+func (s *Stockage) ComputeCout(db DBOrTx, jourD, jourF string) (res []float64, err error) {
 	res = []float64{}
 	jD, err := time.Parse("2006-01-02", jourD)
 	if err != nil {
@@ -209,97 +204,92 @@ func (s *Stockage) ComputeCout(db *sqlx.DB, jourD, jourF string) (res []float64,
 		return res, werr.Wrapf(err, "Format de date incorrect : "+jourF)
 	}
 	if jF.Before(jD) {
-		return res, errors.New("ComputeCout() a besoin de jourD < jourF")
-	}
-	//	duree := jF.Sub(jD)
-	// Récupère les frais
-	// tels que datedeb ou datefin sont dans [jD, jF]
-	var frais []StockFrais
-	query := `select * from stockfrais where id_stockage=$1
-	    and ( (datedeb>=$2 and datedeb<=$3) or (datefin>=$2 and datefin<=$3) )`
-	err = db.Select(&frais, query, s.Id, &jD, &jF)
+		return res, errors.New("ComputeCout() a besoin de jourD <= jourF")
+	}
+	res = make([]float64, nbJours(jD, jF))
+	// Récupère les frais dont la période a une intersection avec [jD, jF]
+	frais := []*StockFrais{}
+	query := `select * from stockfrais where id_stockage=$1 and datedeb<=$3 and datefin>=$2`
+	err = db.Select(&frais, query, s.Id, jD, jF)
 	if err != nil {
 		return res, werr.Wrapf(err, "Erreur query : "+query)
 	}
-	/*
-	   	var debFrais, finFrais time.Time
-	   	var dureeFraisTotale time.Duration  // durée totale du frais, peut dépasser [jD, jF]
-	   	var dureeFraisPeriode time.Duration // durée du frais dans [jD, jF]
-	   	//
-	   	for _, f := range frais {
-	   		dureeFraisTotale = f.DateFin.Sub(f.DateDebut)
-	   		if jD.After(f.DateDebut) {
-	   			debFrais = jD
-	   		} else {
-	   			debFrais = f.DateDebut
-	   		}
-	   		if jF.Before(f.DateFin) {
-	   			finFrais = jF
-	   		} else {
-	   			finFrais = f.DateFin
-	   		}
-	   		dureeFraisPeriode = finFrais.Sub(debFrais)
-	   		// contribution du frais sur la période [jD, jF]
-	   //		total += (dureeFraisPeriode.Hours() * f.Montant / dureeFraisTotale.Hours())
-	   	}
-	*/
+	for _, f := range frais {
+		debFrais, finFrais := jour(f.DateDebut), jour(f.DateFin)
+		if finFrais.Before(debFrais) {
+			continue
+		}
+		montantJour := f.Montant / float64(nbJours(debFrais, finFrais))
+		// intersection de [debFrais, finFrais] et [jD, jF]
+		if debFrais.Before(jD) {
+			debFrais = jD
+		}
+		if finFrais.After(jF) {
+			finFrais = jF
+		}
+		for d := debFrais; !d.After(finFrais); d = d.AddDate(0, 0, 1) {
+			res[nbJours(jD, d)-1] += montantJour
+		}
+	}
 	return res, nil
 }
 
-/*
-// Calcule le coût du stockage pour une période donnée.
-// Prend en compte tous les frais du hangar (loyer, elec, assurance)
-// Le coût est ramené à la période considérée.
-// Ex : pour un loyer de 6000 E / an, si j2 - j1 = 6 mois, va compter 3000
-// @param j1, j2 jours de début / fin de la période au format YYYY-MM-DD
-func (s *Stockage) ComputeCout(db *sqlx.DB, jour1, jour2 string) (total float64, err error) {
-	j1, err := time.Parse("2006-01-02", jour1)
+// Renvoie le stock total du lieu de stockage (tous tas confondus) à la fin de chaque jour de la période [jD, jF]
+// res[0] = stock à la fin de jD, res[1] = stock à la fin de jD + 1, etc.
+// Les mouvements de tous les tas sont obtenus par une seule requête ;
+// le stock de chaque tas est calculé comme dans Tas.stocksJournaliers().
+func (s *Stockage) stocksJournaliers(db DBOrTx, jD, jF time.Time) (res []float64, err error) {
+	res = make([]float64, nbJours(jD, jF))
+	mvts := []struct {
+		IdTas      int `db:"id_tas"`
+		Actif      bool
+		DateVidage time.Time
+		Date       time.Time `db:"datemvt"`
+		Qte        float64
+	}{}
+	// les vidages sont pris en compte par la date de vidage, cf Tas.stocksJournaliers()
+	query := `select m.id_tas, t.actif, t.datevidage, m.datemvt, sum(m.qte) as qte
+        from mouvementstock m join tas t on m.id_tas=t.id
+        where t.id_stockage=$1 and m.typemvt<>$2 and m.datemvt<=$3
+        group by m.id_tas, t.actif, t.datevidage, m.datemvt
+        order by m.id_tas, m.datemvt`
+	err = db.Select(&mvts, query, s.Id, MVT_VIDAGE, jF)
 	if err != nil {
-		return 0, werr.Wrapf(err, "Format de date incorrect : "+jour1)
-	}
-	j2, err := time.Parse("2006-01-02", jour2)
-	if err != nil {
-		return 0, werr.Wrapf(err, "Format de date incorrect : "+jour2)
-	}
-	if j2.Before(j1) {
-		return 0, errors.New("ComputeCout() a besoin de j1 < j2")
-	}
-	// Récupère les frais
-	// tels que datedeb ou datefin sont dans [j1, j2]
-	var frais []StockFrais
-	query := `select * from stockfrais where id_stockage=$1
-	    and ( (datedeb>=$2 and datedeb<=$3) or (datefin>=$2 and datefin<=$3) )`
-	err = db.Select(&frais, query, s.Id, &jour1, &jour2)
-	if err != nil {
-		return 0, werr.Wrapf(err, "Erreur query : "+query)
+		return res, werr.Wrapf(err, "Erreur query : "+query)
 	}
-	var debFrais, finFrais time.Time
-	var dureeFraisTotale time.Duration  // durée totale du frais, peut dépasser [j1, j2]
-	var dureeFraisPeriode time.Duration // durée du frais dans [j1, j2]
-	//
-	for _, f := range frais {
-		dureeFraisTotale = f.DateFin.Sub(f.DateDebut)
-		if j1.After(f.DateDebut) {
-			debFrais = j1
-		} else {
-			debFrais = f.DateDebut
+	var tas *Tas
+	ajouteStocks := func() {
+		if tas == nil {
+			return
+		}
+		for k, stock := range tas.stocksJournaliers(jD, jF) {
+			res[k] += stock
 		}
-		if j2.Before(f.DateFin) {
-			finFrais = j2
-		} else {
-			finFrais = f.DateFin
+	}
+	for _, mvt := range mvts {
+		if tas == nil || tas.Id != mvt.IdTas {
+			ajouteStocks()
+			tas = &Tas{Id: mvt.IdTas, Actif: mvt.Actif, DateVidage: mvt.DateVidage}
 		}
-		dureeFraisPeriode = finFrais.Sub(debFrais)
-		// contribution du frais sur la période [j1, j2]
-		total += (dureeFraisPeriode.Hours() * f.Montant / dureeFraisTotale.Hours())
+		tas.EvolutionStock = append(tas.EvolutionStock, &MouvementStock{Date: mvt.Date, Delta: mvt.Qte})
 	}
-	return total, nil
+	ajouteStocks()
+	return res, nil
+}
+
+// Renvoie le jour (à 0h UTC) correspondant à une date
+func jour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Renvoie le nombre de jours de la période [j1, j2], bornes incluses
+func nbJours(j1, j2 time.Time) int {
+	return int(jour(j2).Sub(jour(j1)).Hours()/24+0.5) + 1
 }
-*/
 
 // ************************** CRUD *******************************
 
-func InsertStockage(db *sqlx.DB, s *Stockage) (id int, err error) {
+func InsertStockage(db DBOrTx, s *Stockage) (id int, err error) {
 	query := `insert into stockage(nom) values($1) returning id`
 	err = db.QueryRow(
 		query,
@@ -307,10 +297,18 @@ func InsertStockage(db *sqlx.DB, s *Stockage) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockage", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateStockage(db *sqlx.DB, s *Stockage) (err error) {
+func UpdateStockage(db DBOrTx, s *Stockage) (err error) {
+	avant, err := auditEtat(db, "stockage", s.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update stockage set(
 	    nom,
 	    archived
@@ -323,19 +321,37 @@ func UpdateStockage(db *sqlx.DB, s *Stockage) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockage", s.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteStockage(db *sqlx.DB, id int) (err error) {
+func DeleteStockage(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "stockage", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from stockfrais where id_stockage=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	// les mesures des inventaires ont été supprimées avec les tas
+	query = "delete from inventaire where id_stockage=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
 	query = "delete from stockage where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockage", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -33,7 +32,7 @@ var StockFraisMap = map[string]string{
 }
 
 // *********************************************************
-func GetStockFrais(db *sqlx.DB, id int) (sf *StockFrais, err error) {
+func GetStockFrais(db DBOrTx, id int) (sf *StockFrais, err error) {
 	sf = &StockFrais{}
 	query := "select * from stockfrais where id=$1"
 	row := db.QueryRowx(query, id)
@@ -45,7 +44,7 @@ func GetStockFrais(db *sqlx.DB, id int) (sf *StockFrais, err error) {
 }
 
 // *********************************************************
-func InsertStockFrais(db *sqlx.DB, sf *StockFrais) (id int, err error) {
+func InsertStockFrais(db DBOrTx, sf *StockFrais) (id int, err error) {
 	query := `insert into stockfrais(
 	    id_stockage,
 	    typefrais,
@@ -65,11 +64,19 @@ func InsertStockFrais(db *sqlx.DB, sf *StockFrais) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockfrais", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
 // *********************************************************
-func UpdateStockFrais(db *sqlx.DB, sf *StockFrais) (err error) {
+func UpdateStockFrais(db DBOrTx, sf *StockFrais) (err error) {
+	avant, err := auditEtat(db, "stockfrais", sf.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update stockfrais set(
 	    typefrais,
         montant,
@@ -88,15 +95,27 @@ func UpdateStockFrais(db *sqlx.DB, sf *StockFrais) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockfrais", sf.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
 // *********************************************************
-func DeleteStockFrais(db *sqlx.DB, id int) (err error) {
+func DeleteStockFrais(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "stockfrais", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := "delete from stockfrais where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "stockfrais", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
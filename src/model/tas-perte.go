@@ -0,0 +1,146 @@
+/*
+Pertes constatées au vidage des tas, par chantier et par lieu de stockage.
+
+Lors du vidage d'un tas, le stock restant (calculé) est retiré par un mouvement de vidage :
+ce stock restant correspond à des plaquettes qui ont disparu en plus de la perte au séchage
+déjà appliquée aux transports (Config.PourcentagePerte, cf Vert2sec()).
+
+Seuls les tas vides sont pris en compte : pour un tas vide, les entrées (transports et transferts)
+moins les sorties (chargements) moins les ajustements d'inventaire donnent la perte au vidage.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"sort"
+	"strings"
+)
+
+// Pertes au vidage des tas vides d'un chantier (Chantier renseigné)
+// ou d'un lieu de stockage (Stockage renseigné)
+type PertesVidage struct {
+	Chantier *Plaq
+	Stockage *Stockage
+	NbTas    int
+	Entrees  float64            // en maps sèches, transports et transferts dans les tas vides
+	Pertes   map[string]float64 // en maps sèches, par motif ; < 0 pour un gain
+}
+
+// ************************** Calculs *******************************
+
+func (p *PertesVidage) Total() (res float64) {
+	for _, perte := range p.Pertes {
+		res += perte
+	}
+	return res
+}
+
+// Perte totale en pourcentage des entrées
+func (p *PertesVidage) Pourcent() float64 {
+	if p.Entrees == 0 {
+		return 0
+	}
+	return p.Total() * 100 / p.Entrees
+}
+
+// Perte pour un motif, en maps
+func (p *PertesVidage) Perte(motif string) float64 {
+	return p.Pertes[motif]
+}
+
+// ************************** Get many *******************************
+
+// Renvoie les pertes au vidage par chantier, du chantier le plus récent au plus ancien
+func ComputePertesVidageChantiers(db DBOrTx) (res []*PertesVidage, err error) {
+	res = []*PertesVidage{}
+	pertes, err := computePertesVidage(db, "id_chantier")
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel computePertesVidage()")
+	}
+	for id, p := range pertes {
+		p.Chantier, err = GetPlaq(db, id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetPlaq()")
+		}
+		err = p.Chantier.ComputeLieudits(db) // pour le nom du chantier
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel Plaq.ComputeLieudits()")
+		}
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Chantier.DateDebut.Equal(res[j].Chantier.DateDebut) {
+			return res[i].Chantier.DateDebut.After(res[j].Chantier.DateDebut)
+		}
+		return res[i].Chantier.Id > res[j].Chantier.Id
+	})
+	return res, nil
+}
+
+// Renvoie les pertes au vidage par lieu de stockage, triées par nom de lieu de stockage
+func ComputePertesVidageStockages(db DBOrTx) (res []*PertesVidage, err error) {
+	res = []*PertesVidage{}
+	pertes, err := computePertesVidage(db, "id_stockage")
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel computePertesVidage()")
+	}
+	for id, p := range pertes {
+		p.Stockage, err = GetStockage(db, id)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel GetStockage()")
+		}
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return strings.ToLower(res[i].Stockage.Nom) < strings.ToLower(res[j].Stockage.Nom)
+	})
+	return res, nil
+}
+
+// Auxiliaire de ComputePertesVidageChantiers() et ComputePertesVidageStockages()
+// Les transferts sont comptés avec leur signe : un transfert entre 2 tas vides d'un même regroupement
+// ne change pas les entrées, un transfert vers un tas encore actif les diminue.
+// @param colonne   colonne de la table tas sur laquelle regrouper : id_chantier ou id_stockage
+// @return          map id chantier ou id stockage => pertes
+func computePertesVidage(db DBOrTx, colonne string) (res map[int]*PertesVidage, err error) {
+	res = map[int]*PertesVidage{}
+	entrees := []struct {
+		Id      int
+		NbTas   int
+		Entrees float64
+	}{}
+	query := `select t.` + colonne + ` as id, count(distinct t.id) as nbtas,
+            coalesce(sum(m.qte) filter (where m.typemvt in ($1, $2)), 0) as entrees
+        from tas t left join mouvementstock m on m.id_tas=t.id
+        where not t.actif
+        group by t.` + colonne
+	err = db.Select(&entrees, query, MVT_TRANSPORT, MVT_TRANSFERT)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, e := range entrees {
+		res[e.Id] = &PertesVidage{NbTas: e.NbTas, Entrees: e.Entrees, Pertes: map[string]float64{}}
+	}
+	pertes := []struct {
+		Id    int
+		Motif string
+		Perte float64
+	}{}
+	query = `select t.` + colonne + ` as id, m.motif, -sum(m.qte) as perte
+        from tas t join mouvementstock m on m.id_tas=t.id
+        where not t.actif and m.typemvt=$1
+        group by t.` + colonne + `, m.motif
+        having sum(m.qte) <> 0`
+	err = db.Select(&pertes, query, MVT_VIDAGE)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, p := range pertes {
+		res[p.Id].Pertes[p.Motif] = p.Perte
+	}
+	return res, nil
+}
@@ -9,18 +9,17 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
+	"database/sql"
 	"errors"
-	"github.com/jmoiron/sqlx"
-	"sort"
-	"strconv"
+	"fmt"
 	"time"
 )
 
 type Tas struct {
 	Id         int
-	IdStockage int `db:"id_stockage"`
-	IdChantier int `db:"id_chantier"`
-	Stock      float64
+	IdStockage int     `db:"id_stockage"`
+	IdChantier int     `db:"id_chantier"`
+	Stock      float64 // pas stocké dans la table tas, calculé à partir des mouvements de stock, cf SELECT_TAS
 	DateVidage time.Time
 	Actif      bool
 	// pas stocké en base
@@ -31,20 +30,13 @@ type Tas struct {
 	EvolutionStock  []*MouvementStock
 }
 
-// MouvementStock = opération qui fait changer le stock du tas :
-// transports, chargements, vidage
-type MouvementStock struct {
-	Date  time.Time
-	Label string
-	URL   string
-	Delta float64
-}
+// Requête de sélection des tas, avec le stock = somme des mouvements de stock du tas
+const SELECT_TAS = `select tas.*, coalesce((select sum(qte) from mouvementstock where id_tas=tas.id), 0) as stock from tas`
 
-func NewTas(idStockage, idChantier int, stock float64, actif bool) *Tas {
+func NewTas(idStockage, idChantier int, actif bool) *Tas {
 	return &Tas{
 		IdStockage: idStockage,
 		IdChantier: idChantier,
-		Stock:      stock,
 		Actif:      actif,
 	}
 }
@@ -53,19 +45,66 @@ func NewTas(idStockage, idChantier int, stock float64, actif bool) *Tas {
 
 // Si qte > 0, ajoute des plaquettes au tas
 // Si qte < 0, retire des plaquettes au tas
-// Fait la maj en BDD
+// Ajoute un mouvement dans le journal des mouvements de stock (le tas n'est pas modifié en base)
+// @param   typeMvt MVT_TRANSPORT etc.
+// @param   idLigne id du transport ou du chargement qui cause le mouvement, 0 sinon
 // @param   qte en maps
-func (t *Tas) ModifierStock(db *sqlx.DB, qte float64) error {
+func (t *Tas) ModifierStock(db DBOrTx, typeMvt string, idLigne int, date time.Time, qte float64) error {
+	_, err := InsertMouvementStock(db, &MouvementStock{
+		IdTas:   t.Id,
+		TypeMvt: typeMvt,
+		IdLigne: idLigne,
+		Date:    date,
+		Delta:   qte,
+	})
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel InsertMouvementStock()")
+	}
 	t.Stock += qte
-	return UpdateTas(db, t)
+	return nil
 }
 
 // Pour indiquer qu'un tas est vide
-func DesactiverTas(db *sqlx.DB, id int, date time.Time) (err error) {
+// Le stock restant à la date du vidage est retiré du tas par un mouvement de vidage, qui enregistre la perte
+// (ou le gain si le stock restant est négatif) avec son motif.
+// La date ne peut pas être antérieure au dernier mouvement du tas :
+// un mouvement postérieur au vidage fausserait le stock du tas vide.
+// @param   motif  un des codes de MotifsPerte
+func DesactiverTas(db DBOrTx, id int, date time.Time, motif string) (err error) {
+	if !motifPerteValide(motif) {
+		return werr.New("Motif de perte invalide : " + motif)
+	}
 	tas, err := GetTas(db, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel GetTas()")
 	}
+	if !tas.Actif {
+		return werr.New(fmt.Sprintf("Le tas %d est déjà vide", id))
+	}
+	var dernierMvt sql.NullTime
+	query := "select max(datemvt) from mouvementstock where id_tas=$1"
+	err = db.Get(&dernierMvt, query, tas.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if dernierMvt.Valid && date.Before(dernierMvt.Time) {
+		return werr.New(fmt.Sprintf("Date de vidage (%s) antérieure au dernier mouvement du tas %d (%s)",
+			date.Format("02/01/2006"), id, dernierMvt.Time.Format("02/01/2006")))
+	}
+	stock, err := tas.StockALaDate(db, date)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel Tas.StockALaDate()")
+	}
+	_, err = InsertMouvementStock(db, &MouvementStock{
+		IdTas:   tas.Id,
+		TypeMvt: MVT_VIDAGE,
+		Date:    date,
+		Delta:   -stock,
+		Motif:   motif,
+	})
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel InsertMouvementStock()")
+	}
 	tas.Actif = false
 	tas.DateVidage = date
 	err = UpdateTas(db, tas)
@@ -75,11 +114,94 @@ func DesactiverTas(db *sqlx.DB, id int, date time.Time) (err error) {
 	return nil
 }
 
+// Pour rouvrir un tas signalé vide par erreur
+// Les mouvements de vidage sont annulés par des mouvements inverses (même date, même motif) :
+// le tas retrouve son stock d'avant le vidage et la perte n'est plus comptée.
+func RouvrirTas(db DBOrTx, id int) (err error) {
+	tas, err := GetTas(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetTas()")
+	}
+	if tas.Actif {
+		return werr.New(fmt.Sprintf("Le tas %d n'est pas vide", id))
+	}
+	vidages := []*MouvementStock{}
+	query := `select datemvt, motif, sum(qte) as qte from mouvementstock
+        where id_tas=$1 and typemvt=$2
+        group by datemvt, motif
+        having sum(qte) <> 0`
+	err = db.Select(&vidages, query, tas.Id, MVT_VIDAGE)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, vidage := range vidages {
+		_, err = InsertMouvementStock(db, &MouvementStock{
+			IdTas:   tas.Id,
+			TypeMvt: MVT_VIDAGE,
+			Date:    vidage.Date,
+			Delta:   -vidage.Delta,
+			Motif:   vidage.Motif,
+		})
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel InsertMouvementStock()")
+		}
+	}
+	tas.Actif = true
+	tas.DateVidage = time.Time{}
+	err = UpdateTas(db, tas)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel UpdateTas()")
+	}
+	return nil
+}
+
+func motifPerteValide(motif string) bool {
+	for _, m := range MotifsPerte {
+		if m == motif {
+			return true
+		}
+	}
+	return false
+}
+
+// Renvoie le stock du tas à la fin d'une journée, d'après les mouvements de stock
+func (t *Tas) StockALaDate(db DBOrTx, date time.Time) (stock float64, err error) {
+	query := "select coalesce(sum(qte), 0) from mouvementstock where id_tas=$1 and datemvt<=$2"
+	err = db.Get(&stock, query, t.Id, date)
+	if err != nil {
+		return stock, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return stock, nil
+}
+
+// Renvoie le stock minimum du tas à partir de la fin de la journée date :
+// le plus petit des stocks à la date et après chacun des mouvements ultérieurs.
+func (t *Tas) StockMinimumDepuis(db DBOrTx, date time.Time) (stock float64, err error) {
+	stock, err = t.StockALaDate(db, date)
+	if err != nil {
+		return stock, werr.Wrapf(err, "Erreur appel Tas.StockALaDate()")
+	}
+	var minApres sql.NullFloat64
+	query := `select min(stock) from (
+            select datemvt, sum(sum(qte)) over (order by datemvt) as stock
+            from mouvementstock where id_tas=$1
+            group by datemvt
+        ) t where datemvt>$2`
+	err = db.Get(&minApres, query, t.Id, date)
+	if err != nil {
+		return stock, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if minApres.Valid && minApres.Float64 < stock {
+		stock = minApres.Float64
+	}
+	return stock, nil
+}
+
 // ************************** Get one *******************************
 
-func GetTas(db *sqlx.DB, idTas int) (tas *Tas, err error) {
+func GetTas(db DBOrTx, idTas int) (tas *Tas, err error) {
 	tas = &Tas{}
-	query := "select * from tas where id=$1"
+	query := SELECT_TAS + " where id=$1"
 	row := db.QueryRowx(query, idTas)
 	err = row.StructScan(tas)
 	if err != nil {
@@ -88,7 +210,7 @@ func GetTas(db *sqlx.DB, idTas int) (tas *Tas, err error) {
 	return tas, nil
 }
 
-func GetTasFull(db *sqlx.DB, idTas int) (tas *Tas, err error) {
+func GetTasFull(db DBOrTx, idTas int) (tas *Tas, err error) {
 	tas, err = GetTas(db, idTas)
 	if err != nil {
 		return tas, werr.Wrapf(err, "Erreur appel GetTas()")
@@ -112,7 +234,7 @@ func GetTasFull(db *sqlx.DB, idTas int) (tas *Tas, err error) {
 
 // Utilisé pour select html
 // Obligé d'avoir tas full, car besoin du nom du tas, qui a besoin de chantier et stockage
-func GetAllTasActifsFull(db *sqlx.DB) (tas []*Tas, err error) {
+func GetAllTasActifsFull(db DBOrTx) (tas []*Tas, err error) {
 	tas = []*Tas{}
 	ids := []int{}
 	query := "select id from tas where actif"
@@ -132,7 +254,7 @@ func GetAllTasActifsFull(db *sqlx.DB) (tas []*Tas, err error) {
 
 // ************************** Compute *******************************
 
-func (t *Tas) ComputeNom(db *sqlx.DB) (err error) {
+func (t *Tas) ComputeNom(db DBOrTx) (err error) {
 	if t.Nom != "" {
 		return nil // déjà calculé
 	}
@@ -147,7 +269,7 @@ func (t *Tas) ComputeNom(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (t *Tas) ComputeStockage(db *sqlx.DB) (err error) {
+func (t *Tas) ComputeStockage(db DBOrTx) (err error) {
 	if t.Stockage != nil {
 		return nil // déjà calculé
 	}
@@ -158,7 +280,7 @@ func (t *Tas) ComputeStockage(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (t *Tas) ComputeChantier(db *sqlx.DB) (err error) {
+func (t *Tas) ComputeChantier(db DBOrTx) (err error) {
 	if t.Chantier != nil {
 		return nil // déjà calculé
 	}
@@ -170,7 +292,7 @@ func (t *Tas) ComputeChantier(db *sqlx.DB) (err error) {
 }
 
 // Pas inclus par défaut dans GetTasFull()
-func (t *Tas) ComputeMesuresHumidite(db *sqlx.DB) (err error) {
+func (t *Tas) ComputeMesuresHumidite(db DBOrTx) (err error) {
 	if len(t.MesuresHumidite) != 0 {
 		return nil // déjà calculé
 	}
@@ -189,123 +311,128 @@ func (t *Tas) ComputeMesuresHumidite(db *sqlx.DB) (err error) {
 }
 
 // Pas inclus par défaut dans GetTasFull()
-// Note : en théorie, l'url des mouvements ne devrait pas
-// être calculée dans le model mais dans le controller
-func (t *Tas) ComputeEvolutionStock(db *sqlx.DB) (err error) {
+// Lit le journal des mouvements de stock ; un transport ou un chargement modifié ou supprimé
+// apparaît avec sa quantité finale (les mouvements inverses sont regroupés avec le mouvement annulé).
+func (t *Tas) ComputeEvolutionStock(db DBOrTx) (err error) {
 	if len(t.EvolutionStock) != 0 {
 		return nil // déjà calculé
 	}
 	res := []*MouvementStock{}
-	// transports
-	var tmp1 = []*struct {
-		Id            int
-		Id_chantier   int
-		Qte           float64
-		PourcentPerte float64
-		DateTrans     time.Time
-	}{}
-	query := "select id,id_chantier,qte,pourcentperte,datetrans from plaqtrans where id_tas=$1"
-	err = db.Select(&tmp1, query, t.Id)
+	query := `select typemvt, id_ligne, datemvt, motif, sum(qte) as qte from mouvementstock
+        where id_tas=$1
+        group by typemvt, id_ligne, datemvt, motif
+        having sum(qte) <> 0 or typemvt=$2
+        order by datemvt, min(id)`
+	mvts := []*MouvementStock{}
+	err = db.Select(&mvts, query, t.Id, MVT_VIDAGE)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
-	for _, line := range tmp1 {
-		mvt := MouvementStock{
-			Date:  line.DateTrans,
-			Label: "Transport",
-			URL:   "/chantier/plaquette/" + strconv.Itoa(line.Id_chantier) + "/chantiers",
-			Delta: line.Qte * (1 - line.PourcentPerte/100),
+	for _, mvt := range mvts {
+		// Un vidage sans perte n'est affiché que s'il correspond au vidage actuel du tas
+		// (pas s'il a été annulé par la réouverture du tas)
+		if mvt.TypeMvt == MVT_VIDAGE && mvt.Delta == 0 && (t.Actif || !jour(mvt.Date).Equal(jour(t.DateVidage))) {
+			continue
 		}
-		res = append(res, &mvt)
-	}
-	// chargements (utilise GetVenteCharge() pour récupérer id vente)
-	idsCharge := []int{}
-	query = "select id from ventecharge where id_tas=$1"
-	err = db.Select(&idsCharge, query, t.Id)
-	if err != nil {
-		return werr.Wrapf(err, "Erreur query : "+query)
+		res = append(res, mvt)
 	}
-	for _, idCharge := range idsCharge {
-		vc, err := GetVenteCharge(db, idCharge)
-		if err != nil {
-			return werr.Wrapf(err, "Erreur appel GetVenteCharge()")
-		}
-		err = vc.ComputeIdVente(db)
+	for _, mvt := range res {
+		mvt.IdTas = t.Id
+		mvt.computeLabel()
+		err = mvt.ComputeURL(db, t.IdChantier)
 		if err != nil {
-			return werr.Wrapf(err, "Erreur appel ComputeIdVente()")
+			return werr.Wrapf(err, "Erreur appel MouvementStock.ComputeURL()")
 		}
-		mvt := MouvementStock{
-			Date:  vc.DateCharge,
-			Label: "Chargement",
-			URL:   "/vente/" + strconv.Itoa(vc.IdVente),
-			Delta: -vc.Qte,
-		}
-		res = append(res, &mvt)
-	}
-	// tri par date
-	sortedRes := make(mouvementStockSlice, 0, len(res))
-	for _, elt := range res {
-		sortedRes = append(sortedRes, elt)
 	}
-	sort.Sort(sortedRes)
-	t.EvolutionStock = sortedRes
-	//
+	t.EvolutionStock = res
 	return nil
 }
 
-// Auxiliaires de ComputeEvolutionStock() pour trier par date
-type mouvementStockSlice []*MouvementStock
-
-func (m mouvementStockSlice) Len() int           { return len(m) }
-func (m mouvementStockSlice) Less(i, j int) bool { return m[i].Date.Before(m[j].Date) }
-func (m mouvementStockSlice) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+// Renvoie le stock du tas à la fin de chaque jour de la période [jD, jF]
+// res[0] = stock à la fin de jD, res[1] = stock à la fin de jD + 1, etc.
+// Utilise t.EvolutionStock, qui doit avoir été calculé par ComputeEvolutionStock().
+// Le stock d'un tas vide est considéré nul après sa date de vidage.
+func (t *Tas) stocksJournaliers(jD, jF time.Time) (res []float64) {
+	res = make([]float64, nbJours(jD, jF))
+	stock := 0.0
+	i := 0
+	for k := range res {
+		d := jD.AddDate(0, 0, k)
+		for i < len(t.EvolutionStock) && !jour(t.EvolutionStock[i].Date).After(d) {
+			// le vidage est pris en compte par le test sur DateVidage
+			if t.EvolutionStock[i].TypeMvt != MVT_VIDAGE {
+				stock += t.EvolutionStock[i].Delta
+			}
+			i++
+		}
+		if !t.Actif && d.After(jour(t.DateVidage)) {
+			break // les jours suivants restent à 0
+		}
+		if stock > 0 {
+			res[k] = stock
+		}
+	}
+	return res
+}
 
 // ************************** CRUD *******************************
 
-func InsertTas(db *sqlx.DB, tas *Tas) (id int, err error) {
+func InsertTas(db DBOrTx, tas *Tas) (id int, err error) {
 	query := `insert into tas(
         id_stockage,                              
         id_chantier,
-        stock,
         datevidage,
         actif
-        ) values($1,$2,$3,$4,$5) returning id`
+        ) values($1,$2,$3,$4) returning id`
 	err = db.QueryRow(
 		query,
 		tas.IdStockage,
 		tas.IdChantier,
-		tas.Stock,
 		tas.DateVidage,
 		tas.Actif).Scan(&id)
 	if err != nil {
 		return id, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "tas", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateTas(db *sqlx.DB, tas *Tas) (err error) {
+func UpdateTas(db DBOrTx, tas *Tas) (err error) {
+	avant, err := auditEtat(db, "tas", tas.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update tas set(
         id_stockage,
         id_chantier,
-        stock,
         datevidage,
         actif
-        ) = ($1,$2,$3,$4,$5) where id=$6`
+        ) = ($1,$2,$3,$4) where id=$5`
 	_, err = db.Exec(
 		query,
 		tas.IdStockage,
 		tas.IdChantier,
-		tas.Stock,
 		tas.DateVidage,
 		tas.Actif,
 		tas.Id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "tas", tas.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteTas(db *sqlx.DB, id int) (err error) {
+func DeleteTas(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "tas", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	var query string
 	var ids []int
 	var deletedId int
@@ -321,8 +448,22 @@ func DeleteTas(db *sqlx.DB, id int) (err error) {
 			return werr.Wrapf(err, "Erreur DeletePlaqTrans()")
 		}
 	}
+	// delete transferts depuis ou vers ce tas
+	query = "select id from plaqtransfert where id_tas_origine=$1 or id_tas_destination=$1"
+	ids = []int{} // Select() ajoute à la fin de la slice, ne pas réutiliser les ids précédents
+	err = db.Select(&ids, query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	for _, deletedId = range ids {
+		err = DeletePlaqTransfert(db, deletedId)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur DeletePlaqTransfert()")
+		}
+	}
 	// delete chargements liés à ce tas
 	query = "select id from ventecharge where id_tas=$1"
+	ids = []int{} // Select() ajoute à la fin de la slice, ne pas réutiliser les ids précédents
 	err = db.Select(&ids, query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
@@ -333,11 +474,25 @@ func DeleteTas(db *sqlx.DB, id int) (err error) {
 			return werr.Wrapf(err, "Erreur DeleteVenteCharge()")
 		}
 	}
+	// delete les mesures du tas dans les inventaires
+	err = deleteInventairesTas(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel deleteInventairesTas()")
+	}
+	// delete les mouvements de stock du tas
+	err = deleteMouvementsStockTas(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel deleteMouvementsStockTas()")
+	}
 	// delete le tas
 	query = "delete from tas where id=$1"
 	_, err = db.Exec(query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "tas", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
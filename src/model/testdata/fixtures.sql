@@ -0,0 +1,46 @@
+-- Données minimales pour les tests d'intégration du model (cf testdb_test.go)
+
+-- Acteurs 0 à 3 : acteurs initiaux, dont les ids sont utilisés par l'appli (cf manage/db-install/install/acteur.go)
+-- Acteurs suivants : intervenants du scénario de test
+insert into acteur(id, nom, prenom, proprietaire, fournisseur, actif) values
+    (0, '',             '',               false, false, false),
+    (1, 'SCTL',         '',               true,  false, true),
+    (2, 'BDL',          'Bois du Larzac', false, true,  true),
+    (3, 'GFA Larzac',   '',               true,  false, true),
+    (4, 'Transporteur', 'Test',           false, false, true),
+    (5, 'Client',       'Test',           false, false, true),
+    (6, 'Chargeur',     'Test',           false, false, true),
+    (7, 'Livreur',      'Test',           false, false, true),
+    (8, 'Dechiqueteur', 'Test',           false, false, true);
+select setval('acteur_id_seq', (select max(id) from acteur));
+
+insert into acteur_role(id_acteur, code_role) values
+    (1, 'DIV-PF'),
+    (2, 'DIV-FO'),
+    (3, 'DIV-PF'),
+    (4, 'PLT-TR'),
+    (5, 'VPL-CL'),
+    (6, 'VPC-CH'),
+    (7, 'VPL-LI'),
+    (8, 'PLA-DC');
+
+insert into commune(id, nom, nomcourt, codeinsee) values(1, 'La Bastide-Pradines', 'La Bastide', '12022');
+
+-- 2 parcelles de 2 propriétaires différents : 2 ha SCTL, 3 ha GFA
+insert into parcelle(id, id_proprietaire, code, surface, id_commune) values
+    (1, 1, '0A0001', 2, 1),
+    (2, 3, '0A0002', 3, 1);
+
+insert into ug(id, code, surface_sig, code_typo, coupe, annee_intervention, psg_suivant,
+    volume_stock_ou_recouvrement, intensite_prelevement, amenagement_divers)
+    values(1, 'XIX-30', 5, 'N', '', '', '', '', '', '');
+select setval('ug_id_seq', 1);
+insert into parcelle_ug(id_parcelle, id_ug) values(1, 1), (2, 1);
+
+-- Hangar avec un loyer de 300 E sur 30 jours, soit 10 E / jour
+insert into stockage(id, nom) values(1, 'Hangar test');
+-- Hangar sans frais, destination des transferts
+insert into stockage(id, nom) values(2, 'Hangar transfert');
+select setval('stockage_id_seq', 2);
+insert into stockfrais(id_stockage, typefrais, montant, datedeb, datefin, notes)
+    values(1, 'LO', 300, '2025-01-01', '2025-01-30', '');
@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"golang.org/x/exp/slices"
 	"sort"
 	"strconv"
@@ -46,7 +45,8 @@ type RecapUG struct {
 	ChauffageFermier LigneRecapUG
 	Chauffage        LigneRecapUG
 	Palette          LigneRecapUG
-	Piquets          LigneRecapUG
+	Piquets          LigneRecapUG // piquets vendus en stères
+	PiquetsNombre    LigneRecapUG // piquets vendus à l'unité (unité NP)
 	BoisOeuvre       LigneRecapUG
 	BoisSurPied      LigneRecapUG
 }
@@ -113,7 +113,7 @@ func SortableUGCode(code string) string {
 // Renvoie une UG à partir de son id.
 // Ne contient que les champs de la table ug.
 // Les autres champs ne sont pas remplis.
-func GetUG(db *sqlx.DB, id int) (ug *UG, err error) {
+func GetUG(db DBOrTx, id int) (ug *UG, err error) {
 	ug = &UG{}
 	query := "select * from ug where id=$1"
 	row := db.QueryRowx(query, id)
@@ -128,7 +128,7 @@ func GetUG(db *sqlx.DB, id int) (ug *UG, err error) {
 // Mais ne calcule pas les activités - parce que pas fait dans la v1 - mais pourrait être ajouté (?)
 // TODO voir si on ne devrait pas directement faire UG.ComputeLieudits, ComputeProprietaire et ComputeCommune
 // avec des jointures plutôt que de passer par la table parcelle
-func GetUGFull(db *sqlx.DB, id int) (ug *UG, err error) {
+func GetUGFull(db DBOrTx, id int) (ug *UG, err error) {
 	ug, err = GetUG(db, id)
 	if err != nil {
 		return ug, werr.Wrapf(err, "Erreur appel GetUG()")
@@ -170,7 +170,7 @@ func GetUGFull(db *sqlx.DB, id int) (ug *UG, err error) {
 // Ne contient que les champs de la table ug.
 // Les autres champs ne sont pas remplis.
 // Utilisé par ajax
-func GetUGFromCode(db *sqlx.DB, code string) (*UG, error) {
+func GetUGFromCode(db DBOrTx, code string) (*UG, error) {
 	ug := UG{}
 	query := "select * from ug where code=$1"
 	err := db.Get(&ug, query, code)
@@ -189,7 +189,7 @@ func GetUGFromCode(db *sqlx.DB, code string) (*UG, error) {
 // Utilisé par ajax
 //
 // TODO bizarre, pourquoi ne pas écrire avec une jointure ?
-func GetUGsFromLieudit(db *sqlx.DB, idLieudit int) (ugs []*UG, err error) {
+func GetUGsFromLieudit(db DBOrTx, idLieudit int) (ugs []*UG, err error) {
 	ugs = []*UG{}
 	// parcelles
 	idsParcelles := []int{}
@@ -227,7 +227,7 @@ func GetUGsFromLieudit(db *sqlx.DB, idLieudit int) (ugs []*UG, err error) {
 // Ne contient que les champs de la table ug.
 // Les autres champs ne sont pas remplis.
 // Utilisé par ajax
-func GetUGsFromFermier(db *sqlx.DB, idFermier int) (ugs []*UG, err error) {
+func GetUGsFromFermier(db DBOrTx, idFermier int) (ugs []*UG, err error) {
 	ugs = []*UG{}
 	query := `
         select * from ug where id in(
@@ -246,7 +246,7 @@ func GetUGsFromFermier(db *sqlx.DB, idFermier int) (ugs []*UG, err error) {
 
 // Renvoie les ugs triées par code (nombre romain) et par numéro au sein d'un code (nombres arabes)
 // en respectant l'ordre des chiffres romains et arabes.
-func GetUGsSortedByCode(db *sqlx.DB) (ugs []*UG, err error) {
+func GetUGsSortedByCode(db DBOrTx) (ugs []*UG, err error) {
 	ugs = []*UG{}
 	query := `select * from ug`
 	err = db.Select(&ugs, query)
@@ -283,7 +283,7 @@ func GetUGsSortedByCode(db *sqlx.DB) (ugs []*UG, err error) {
 // res[0] : ugs avec code commençant par I-
 // res[1] : ugs avec code commençant par II-
 // etc.
-func GetUGsSortedByCodeAndSeparated(db *sqlx.DB) ([][]*UG, error) {
+func GetUGsSortedByCodeAndSeparated(db DBOrTx) ([][]*UG, error) {
 	res := [][]*UG{}
 	ugs, err := GetUGsSortedByCode(db)
 	if err != nil {
@@ -309,7 +309,7 @@ func GetUGsSortedByCodeAndSeparated(db *sqlx.DB) ([][]*UG, error) {
 
 // ************************** Compute *******************************
 
-func (ug *UG) ComputeParcelles(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeParcelles(db DBOrTx) (err error) {
 	if len(ug.Parcelles) != 0 {
 		return nil // déjà calculé
 	}
@@ -320,7 +320,7 @@ func (ug *UG) ComputeParcelles(db *sqlx.DB) (err error) {
 	return db.Select(&ug.Parcelles, query, ug.Id)
 }
 
-func (ug *UG) ComputeFermiers(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeFermiers(db DBOrTx) (err error) {
 	if len(ug.Fermiers) != 0 {
 		return nil // déjà calculé
 	}
@@ -338,7 +338,7 @@ func (ug *UG) ComputeFermiers(db *sqlx.DB) (err error) {
 }
 
 // Pas utilisé par GetUGFull() - mais pourraît l'être
-func (ug *UG) ComputeCommunes(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeCommunes(db DBOrTx) (err error) {
 	if len(ug.Communes) != 0 {
 		return nil // déjà calculé
 	}
@@ -355,7 +355,7 @@ func (ug *UG) ComputeCommunes(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ug *UG) ComputeProprietaires(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeProprietaires(db DBOrTx) (err error) {
 	if len(ug.Proprietaires) != 0 {
 		return nil // déjà calculé
 	}
@@ -372,7 +372,7 @@ func (ug *UG) ComputeProprietaires(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (ug *UG) ComputeEssences(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeEssences(db DBOrTx) (err error) {
 	if len(ug.CodesEssence) != 0 {
 		return nil // déjà calculé
 	}
@@ -385,7 +385,7 @@ func (ug *UG) ComputeEssences(db *sqlx.DB) (err error) {
 }
 
 // Pas inclus dans GetUGFull()
-func (ug *UG) ComputeActivites(db *sqlx.DB) (err error) {
+func (ug *UG) ComputeActivites(db DBOrTx) (err error) {
 	// code possible - mais pas optimisé
 	//filtres := map[string][]string{"ug":[]string{strconv.Itoa(ug.Id)}}
 	//activites, err := model.ComputeActivitesFromFiltres(ctx.DB, filtres)
@@ -438,7 +438,9 @@ func (ug *UG) ComputeActivites(db *sqlx.DB) (err error) {
 // ************************** Recap *******************************
 
 // Pas inclus dans GetUGFull()
-func (ug *UG) ComputeRecap(db *sqlx.DB) error {
+// Lorsqu'un chantier plaquettes ou autre valorisation concerne plusieurs UGs, ses quantités, sa superficie,
+// ses coûts et ses recettes sont répartis entre les UGs au prorata de leurs surfaces, cf partUG().
+func (ug *UG) ComputeRecap(db DBOrTx, config *Config) error {
 	var err error
 	ids := []int{}
 	ug.Recaps = make(map[string]RecapUG)
@@ -454,13 +456,26 @@ func (ug *UG) ComputeRecap(db *sqlx.DB) error {
 		if err != nil {
 			return werr.Wrapf(err, "Erreur appel GetPlaqFull()")
 		}
+		err = chantier.ComputeCouts(db, config)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel Plaq.ComputeCouts()")
+		}
+		recette, err := chantier.computeRecetteVentes(db)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel Plaq.computeRecetteVentes()")
+		}
+		cout := 0.0
+		if chantier.CoutTotal != nil { // nil si le chantier n'a pas de volume
+			cout = chantier.CoutTotal.Total
+		}
+		part := partUG(chantier.UGs, ug.Id)
 		y := strconv.Itoa(chantier.DateDebut.Year())
 		myrecap := ug.Recaps[y] // à cause de pb "cannot assign"
 		myrecap.Annee = y       // au cas où on l'utilise pour la 1e fois
-		myrecap.Plaquettes.Quantite += chantier.Volume
-		myrecap.Plaquettes.Superficie += chantier.Surface
-		// TODO myrecap.Plaquettes.CoutExploitation
-		// TODO myrecap.Plaquettes.Benefice
+		myrecap.Plaquettes.Quantite += chantier.Volume * part
+		myrecap.Plaquettes.Superficie += chantier.Surface * part
+		myrecap.Plaquettes.CoutExploitation += cout * part
+		myrecap.Plaquettes.Benefice += (recette - cout) * part
 		ug.Recaps[y] = myrecap
 	}
 	//
@@ -470,6 +485,12 @@ func (ug *UG) ComputeRecap(db *sqlx.DB) error {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel computeIdsChantiersFromUG()")
 	}
+	idsParcelles := []int{}
+	query := "select id_parcelle from parcelle_ug where id_ug=$1"
+	err = db.Select(&idsParcelles, query, ug.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query DB : "+query)
+	}
 	for _, idChantier := range ids {
 		chantier, err := GetChauferFull(db, idChantier)
 		if err != nil {
@@ -479,7 +500,18 @@ func (ug *UG) ComputeRecap(db *sqlx.DB) error {
 		myrecap := ug.Recaps[y] // à cause de pb "cannot assign"
 		myrecap.Annee = y       // au cas où on l'utilise pour la 1e fois
 		myrecap.ChauffageFermier.Quantite += chantier.Volume
-		// TODO myrecap.ChauffageFermier.Superficie
+		// Superficie = surfaces des parcelles de l'UG concernées par le chantier
+		for _, lien := range chantier.LiensParcelles {
+			if !slices.Contains(idsParcelles, lien.IdParcelle) {
+				continue
+			}
+			if lien.Entiere {
+				myrecap.ChauffageFermier.Superficie += lien.Parcelle.Surface
+			} else {
+				myrecap.ChauffageFermier.Superficie += lien.Surface
+			}
+		}
+		// le bois de chauffage fermier n'est ni acheté ni vendu par BDL
 		myrecap.ChauffageFermier.CoutExploitation = 0
 		myrecap.ChauffageFermier.Benefice = 0
 		ug.Recaps[y] = myrecap
@@ -496,26 +528,33 @@ func (ug *UG) ComputeRecap(db *sqlx.DB) error {
 		if err != nil {
 			return werr.Wrapf(err, "Erreur appel GetChautreFull()")
 		}
+		part := partUG(chantier.UGs, ug.Id)
+		qte := chantier.VolumeRealise * part
 		y := strconv.Itoa(chantier.DateContrat.Year())
 		myrecap := ug.Recaps[y] // à cause de pb "cannot assign"
 		myrecap.Annee = y       // au cas où on l'utilise pour la 1e fois
 		switch chantier.TypeValo {
 		case "BO":
-			myrecap.BoisOeuvre.Quantite += chantier.VolumeRealise
-			myrecap.BoisOeuvre.Benefice += chantier.VolumeRealise * chantier.PUHT
+			myrecap.BoisOeuvre.Quantite += qte
+			myrecap.BoisOeuvre.Benefice += qte * chantier.PUHT
 		case "CH":
-			myrecap.Chauffage.Quantite += chantier.VolumeRealise
-			myrecap.Chauffage.Benefice += chantier.VolumeRealise * chantier.PUHT
+			myrecap.Chauffage.Quantite += qte
+			myrecap.Chauffage.Benefice += qte * chantier.PUHT
 		case "PI":
-			// ICI PROBLEME, car piquets en stères ou en nb de piquets => calcul faux
-			myrecap.Piquets.Quantite += chantier.VolumeRealise
-			myrecap.Piquets.Benefice += chantier.VolumeRealise * chantier.PUHT
+			// piquets vendus en stères ou à l'unité
+			if chantier.Unite == "NP" {
+				myrecap.PiquetsNombre.Quantite += qte
+				myrecap.PiquetsNombre.Benefice += qte * chantier.PUHT
+			} else {
+				myrecap.Piquets.Quantite += qte
+				myrecap.Piquets.Benefice += qte * chantier.PUHT
+			}
 		case "PL":
-			myrecap.Palette.Quantite += chantier.VolumeRealise
-			myrecap.Palette.Benefice += chantier.VolumeRealise * chantier.PUHT
+			myrecap.Palette.Quantite += qte
+			myrecap.Palette.Benefice += qte * chantier.PUHT
 		case "PP":
-			myrecap.PateAPapier.Quantite += chantier.VolumeRealise
-			myrecap.PateAPapier.Benefice += chantier.VolumeRealise * chantier.PUHT
+			myrecap.PateAPapier.Quantite += qte
+			myrecap.PateAPapier.Benefice += qte * chantier.PUHT
 		}
 		ug.Recaps[y] = myrecap
 	}
@@ -528,3 +567,24 @@ func (ug *UG) ComputeRecap(db *sqlx.DB) error {
 	//
 	return nil
 }
+
+// Renvoie la part (entre 0 et 1) d'un chantier attribuée à l'UG idUG,
+// au prorata des surfaces SIG des UGs du chantier.
+// Si une des UGs n'a pas de surface exploitable, le chantier est réparti à parts égales.
+func partUG(ugs []*UG, idUG int) float64 {
+	if len(ugs) == 0 {
+		return 1
+	}
+	total, surfaceUG := 0.0, 0.0
+	for _, u := range ugs {
+		surface, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(u.SurfaceSIG), ",", ".", 1), 64)
+		if err != nil || surface <= 0 {
+			return 1 / float64(len(ugs))
+		}
+		total += surface
+		if u.Id == idUG {
+			surfaceUG = surface
+		}
+	}
+	return surfaceUG / total
+}
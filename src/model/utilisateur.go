@@ -0,0 +1,286 @@
+/*
+Utilisateur de l'application (personne pouvant se connecter)
+
+Les mots de passe sont stockés hachés (PBKDF2-SHA256, avec sel), au format
+pbkdf2-sha256$<nb itérations>$<sel en base64>$<hash en base64>
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type Utilisateur struct {
+	Id       int
+	Login    string
+	Password string // hash
+	Role     string
+	Actif    bool
+	Notes    string
+}
+
+// Association code rôle utilisateur => label
+// Les codes correspondent aux valeurs stockées en base dans utilisateur.role
+// Chaque rôle a aussi les droits des rôles précédents
+var UtilisateurRoleMap = map[string]string{
+	"lecteur": "Lecture seule",
+	"editeur": "Modification des données",
+	"admin":   "Administration",
+}
+
+// Niveau de chaque rôle, pour comparer les rôles
+var utilisateurRoleNiveau = map[string]int{
+	"lecteur": 1,
+	"editeur": 2,
+	"admin":   3,
+}
+
+const (
+	pbkdf2Iterations = 100000
+	pbkdf2SaltLen    = 16
+	pbkdf2KeyLen     = 32
+)
+
+// ************************** Rôles *******************************
+
+// Indique si l'utilisateur a au moins les droits du rôle passé en paramètre
+func (u *Utilisateur) APermission(role string) bool {
+	if u == nil || !u.Actif {
+		return false
+	}
+	return utilisateurRoleNiveau[u.Role] >= utilisateurRoleNiveau[role] && utilisateurRoleNiveau[role] > 0
+}
+
+func (u *Utilisateur) PeutModifier() bool {
+	return u.APermission("editeur")
+}
+
+func (u *Utilisateur) EstAdmin() bool {
+	return u.APermission("admin")
+}
+
+// ************************** Mot de passe *******************************
+
+// Calcule le hash à stocker en base à partir d'un mot de passe en clair
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, pbkdf2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", werr.Wrapf(err, "Erreur appel rand.Read()")
+	}
+	key := pbkdf2SHA256([]byte(password), salt, pbkdf2Iterations, pbkdf2KeyLen)
+	return "pbkdf2-sha256$" + strconv.Itoa(pbkdf2Iterations) +
+		"$" + base64.RawStdEncoding.EncodeToString(salt) +
+		"$" + base64.RawStdEncoding.EncodeToString(key), nil
+}
+
+// Vérifie un mot de passe en clair par rapport au hash stocké en base
+func (u *Utilisateur) CheckPassword(password string) bool {
+	parts := strings.Split(u.Password, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key := pbkdf2SHA256([]byte(password), salt, iter, len(expected))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// PBKDF2 (RFC 8018) avec HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	nBlocks := (keyLen + hashLen - 1) / hashLen
+	res := make([]byte, 0, nBlocks*hashLen)
+	buf := make([]byte, 4)
+	for block := 1; block <= nBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u := prf.Sum(nil)
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		res = append(res, t...)
+	}
+	return res[:keyLen]
+}
+
+// ************************** Get *******************************
+
+func GetUtilisateur(db DBOrTx, id int) (u *Utilisateur, err error) {
+	u = &Utilisateur{}
+	query := "select * from utilisateur where id=$1"
+	row := db.QueryRowx(query, id)
+	err = row.StructScan(u)
+	if err != nil {
+		return u, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return u, nil
+}
+
+// Renvoie nil si le login n'existe pas
+func GetUtilisateurByLogin(db DBOrTx, login string) (u *Utilisateur, err error) {
+	res := []*Utilisateur{}
+	query := "select * from utilisateur where login=$1"
+	err = db.Select(&res, query, login)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return res[0], nil
+}
+
+func GetUtilisateurs(db DBOrTx) (res []*Utilisateur, err error) {
+	res = []*Utilisateur{}
+	query := "select * from utilisateur order by login"
+	err = db.Select(&res, query)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return res, nil
+}
+
+// Vérifie login et mot de passe.
+// Renvoie nil (sans erreur) si la connexion est refusée.
+func AuthentifierUtilisateur(db DBOrTx, login, password string) (u *Utilisateur, err error) {
+	u, err = GetUtilisateurByLogin(db, login)
+	if err != nil {
+		return nil, werr.Wrapf(err, "Erreur appel GetUtilisateurByLogin()")
+	}
+	if u == nil || !u.Actif || !u.CheckPassword(password) {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// ************************** CRUD *******************************
+
+func InsertUtilisateur(db DBOrTx, u *Utilisateur) (id int, err error) {
+	if _, ok := UtilisateurRoleMap[u.Role]; !ok {
+		return 0, errors.New("Rôle utilisateur inexistant : " + u.Role)
+	}
+	query := `insert into utilisateur(
+        login,
+        password,
+        role,
+        actif,
+        notes
+        ) values($1,$2,$3,$4,$5) returning id`
+	err = db.QueryRow(
+		query,
+		u.Login,
+		u.Password,
+		u.Role,
+		u.Actif,
+		u.Notes).Scan(&id)
+	if err != nil {
+		return 0, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "utilisateur", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return id, nil
+}
+
+// Ne modifie pas le mot de passe si u.Password est vide.
+// Supprime les sessions de l'utilisateur s'il est désactivé ou si son mot de passe change.
+func UpdateUtilisateur(db DBOrTx, u *Utilisateur) (err error) {
+	avant, err := auditEtat(db, "utilisateur", u.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	if _, ok := UtilisateurRoleMap[u.Role]; !ok {
+		return errors.New("Rôle utilisateur inexistant : " + u.Role)
+	}
+	query := `update utilisateur set(
+        login,
+        role,
+        actif,
+        notes
+        ) = ($1,$2,$3,$4) where id=$5`
+	_, err = db.Exec(
+		query,
+		u.Login,
+		u.Role,
+		u.Actif,
+		u.Notes,
+		u.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	if u.Password != "" {
+		query = "update utilisateur set password=$1 where id=$2"
+		_, err = db.Exec(query, u.Password, u.Id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur query : "+query)
+		}
+	}
+	// Un utilisateur désactivé ou dont le mot de passe change doit se reconnecter
+	if !u.Actif || u.Password != "" {
+		err = DeleteSessionsUtilisateur(db, u.Id)
+		if err != nil {
+			return werr.Wrapf(err, "Erreur appel DeleteSessionsUtilisateur()")
+		}
+	}
+	err = insertAudit(db, "utilisateur", u.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
+
+func DeleteUtilisateur(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "utilisateur", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	err = DeleteSessionsUtilisateur(db, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel DeleteSessionsUtilisateur()")
+	}
+	query := "delete from utilisateur where id=$1"
+	_, err = db.Exec(query, id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur query : "+query)
+	}
+	err = insertAudit(db, "utilisateur", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
+	return nil
+}
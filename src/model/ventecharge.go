@@ -9,7 +9,6 @@ package model
 
 import (
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -49,7 +48,7 @@ type VenteCharge struct {
 
 // ************************** Get *******************************
 
-func GetVenteCharge(db *sqlx.DB, id int) (vc *VenteCharge, err error) {
+func GetVenteCharge(db DBOrTx, id int) (vc *VenteCharge, err error) {
 	vc = &VenteCharge{}
 	query := "select * from ventecharge where id=$1"
 	row := db.QueryRowx(query, id)
@@ -60,7 +59,7 @@ func GetVenteCharge(db *sqlx.DB, id int) (vc *VenteCharge, err error) {
 	return vc, nil
 }
 
-func GetVenteChargeFull(db *sqlx.DB, id int) (vc *VenteCharge, err error) {
+func GetVenteChargeFull(db DBOrTx, id int) (vc *VenteCharge, err error) {
 	vc, err = GetVenteCharge(db, id)
 	if err != nil {
 		return vc, werr.Wrapf(err, "Erreur appel GetVenteCharge()")
@@ -86,7 +85,7 @@ func GetVenteChargeFull(db *sqlx.DB, id int) (vc *VenteCharge, err error) {
 
 // ************************** Compute *******************************
 
-func (vc *VenteCharge) ComputeChargeur(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeChargeur(db DBOrTx) (err error) {
 	if vc.IdChargeur == 0 {
 		return nil // pas de chargeur (mais conducteur et proprioutil)
 	}
@@ -100,7 +99,7 @@ func (vc *VenteCharge) ComputeChargeur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vc *VenteCharge) ComputeConducteur(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeConducteur(db DBOrTx) (err error) {
 	if vc.IdConducteur == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un chargeur)
 	}
@@ -114,7 +113,7 @@ func (vc *VenteCharge) ComputeConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vc *VenteCharge) ComputeProprioutil(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeProprioutil(db DBOrTx) (err error) {
 	if vc.IdProprioutil == 0 {
 		return nil // pas de conducteur ni proprioutil (mais un chargeur)
 	}
@@ -128,7 +127,7 @@ func (vc *VenteCharge) ComputeProprioutil(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vc *VenteCharge) ComputeLivraison(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeLivraison(db DBOrTx) (err error) {
 	if vc.Livraison != nil {
 		return nil // déjà calculé
 	}
@@ -139,7 +138,7 @@ func (vc *VenteCharge) ComputeLivraison(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vc *VenteCharge) ComputeTas(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeTas(db DBOrTx) (err error) {
 	if vc.Tas != nil {
 		return nil // déjà calculé
 	}
@@ -150,7 +149,7 @@ func (vc *VenteCharge) ComputeTas(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vc *VenteCharge) ComputeIdVente(db *sqlx.DB) (err error) {
+func (vc *VenteCharge) ComputeIdVente(db DBOrTx) (err error) {
 	if vc.IdVente != 0 {
 		return nil // déjà calculé
 	}
@@ -164,7 +163,7 @@ func (vc *VenteCharge) ComputeIdVente(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertVenteCharge(db *sqlx.DB, vc *VenteCharge) (id int, err error) {
+func InsertVenteCharge(db DBOrTx, vc *VenteCharge) (id int, err error) {
 	query := `insert into ventecharge(
         id_livraison,
         id_chargeur,
@@ -210,10 +209,54 @@ func InsertVenteCharge(db *sqlx.DB, vc *VenteCharge) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	// Mise à jour du stock du tas
+	err = vc.ComputeTas(db)
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel VenteCharge.ComputeTas()")
+	}
+	err = vc.Tas.ModifierStock(db, MVT_CHARGEMENT, id, vc.DateCharge, -vc.Qte) // Retire des plaquettes au tas
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel VenteCharge.Tas.ModifierStock()")
+	}
+	err = insertAudit(db, "ventecharge", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateVenteCharge(db *sqlx.DB, vc *VenteCharge) (err error) {
+func UpdateVenteCharge(db DBOrTx, vc *VenteCharge) (err error) {
+	avant, err := auditEtat(db, "ventecharge", vc.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	// Mise à jour du stock du tas
+	// Annule le mouvement du chargement avant update chargement (mouvement inverse, à la date d'origine)
+	// puis ajoute le mouvement du chargement après update
+	// Attention, le tas avant update n'est pas forcément le même que le tas après update
+	// (cas où changement de tas lors de update chargement)
+	vcAvant, err := GetVenteCharge(db, vc.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel GetVenteCharge()")
+	}
+	err = vcAvant.ComputeTas(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel vcAvant.ComputeTas()")
+	}
+	err = vcAvant.Tas.ModifierStock(db, MVT_CHARGEMENT, vc.Id, vcAvant.DateCharge, vcAvant.Qte) // Ajoute des plaquettes au tas
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel vcAvant.Tas.ModifierStock()")
+	}
+	//
+	err = vc.ComputeTas(db)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel VenteCharge.ComputeTas()")
+	}
+	err = vc.Tas.ModifierStock(db, MVT_CHARGEMENT, vc.Id, vc.DateCharge, -vc.Qte) // Retire des plaquettes au tas
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel VenteCharge.Tas.ModifierStock()")
+	}
+	//
 	query := `update ventecharge set(
         id_livraison,
         id_chargeur,
@@ -260,11 +303,19 @@ func UpdateVenteCharge(db *sqlx.DB, vc *VenteCharge) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "ventecharge", vc.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteVenteCharge(db *sqlx.DB, id int) (err error) {
-	// rétablit le stock du tas concerné par le chargement
+func DeleteVenteCharge(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "ventecharge", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
+	// annule le mouvement de stock du tas concerné par le chargement
 	// avant de supprimer le chargement
 	vc, err := GetVenteCharge(db, id)
 	if err != nil {
@@ -274,7 +325,7 @@ func DeleteVenteCharge(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ComputeTas()")
 	}
-	err = vc.Tas.ModifierStock(db, vc.Qte) // Ajoute des plaquettes au tas
+	err = vc.Tas.ModifierStock(db, MVT_CHARGEMENT, id, vc.DateCharge, vc.Qte) // Ajoute des plaquettes au tas
 	if err != nil {
 		return werr.Wrapf(err, "Erreur appel ModifierStock()")
 	}
@@ -284,5 +335,9 @@ func DeleteVenteCharge(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "ventecharge", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
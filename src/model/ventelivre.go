@@ -10,7 +10,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -77,7 +76,7 @@ func (vl *VenteLivre) FullString() string {
 
 // ************************** Get *******************************
 
-func GetVenteLivre(db *sqlx.DB, id int) (vl *VenteLivre, err error) {
+func GetVenteLivre(db DBOrTx, id int) (vl *VenteLivre, err error) {
 	vl = &VenteLivre{}
 	query := "select * from ventelivre where id=$1"
 	row := db.QueryRowx(query, id)
@@ -88,7 +87,7 @@ func GetVenteLivre(db *sqlx.DB, id int) (vl *VenteLivre, err error) {
 	return vl, nil
 }
 
-func GetVenteLivreFull(db *sqlx.DB, id int) (vl *VenteLivre, err error) {
+func GetVenteLivreFull(db DBOrTx, id int) (vl *VenteLivre, err error) {
 	vl, err = GetVenteLivre(db, id)
 	if err != nil {
 		return vl, werr.Wrapf(err, "Erreur appel GetVenteLivre()")
@@ -114,7 +113,7 @@ func GetVenteLivreFull(db *sqlx.DB, id int) (vl *VenteLivre, err error) {
 
 // ************************** Compute *******************************
 
-func (vl *VenteLivre) ComputeLivreur(db *sqlx.DB) (err error) {
+func (vl *VenteLivre) ComputeLivreur(db DBOrTx) (err error) {
 	if vl.Livreur != nil {
 		return nil
 	}
@@ -125,7 +124,7 @@ func (vl *VenteLivre) ComputeLivreur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vl *VenteLivre) ComputeConducteur(db *sqlx.DB) (err error) {
+func (vl *VenteLivre) ComputeConducteur(db DBOrTx) (err error) {
 	if vl.Conducteur != nil {
 		return nil
 	}
@@ -136,7 +135,7 @@ func (vl *VenteLivre) ComputeConducteur(db *sqlx.DB) (err error) {
 	return nil
 }
 
-func (vl *VenteLivre) ComputeProprioutil(db *sqlx.DB) (err error) {
+func (vl *VenteLivre) ComputeProprioutil(db DBOrTx) (err error) {
 	if vl.Proprioutil != nil {
 		return nil
 	}
@@ -148,7 +147,7 @@ func (vl *VenteLivre) ComputeProprioutil(db *sqlx.DB) (err error) {
 }
 
 // Calcule à la fois les chargements et la quantité de la livraison
-func (vl *VenteLivre) ComputeChargements(db *sqlx.DB) (err error) {
+func (vl *VenteLivre) ComputeChargements(db DBOrTx) (err error) {
 	if vl.Chargements != nil {
 		return nil
 	}
@@ -171,7 +170,7 @@ func (vl *VenteLivre) ComputeChargements(db *sqlx.DB) (err error) {
 
 // ************************** CRUD *******************************
 
-func InsertVenteLivre(db *sqlx.DB, vl *VenteLivre) (id int, err error) {
+func InsertVenteLivre(db DBOrTx, vl *VenteLivre) (id int, err error) {
 	query := `insert into ventelivre(
         id_vente,
         id_livreur,
@@ -213,10 +212,18 @@ func InsertVenteLivre(db *sqlx.DB, vl *VenteLivre) (id int, err error) {
 	if err != nil {
 		return 0, werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "ventelivre", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateVenteLivre(db *sqlx.DB, vl *VenteLivre) (err error) {
+func UpdateVenteLivre(db DBOrTx, vl *VenteLivre) (err error) {
+	avant, err := auditEtat(db, "ventelivre", vl.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update ventelivre set(
         id_vente,
         id_livreur,
@@ -259,10 +266,18 @@ func UpdateVenteLivre(db *sqlx.DB, vl *VenteLivre) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "ventelivre", vl.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteVenteLivre(db *sqlx.DB, id int) (err error) {
+func DeleteVenteLivre(db DBOrTx, id int) (err error) {
+	avant, err := auditEtat(db, "ventelivre", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	// delete les chargements dépendant de cette livraison
 	idsCharge := []int{}
 	query := "select id from ventecharge where id_livraison=$1"
@@ -284,5 +299,9 @@ func DeleteVenteLivre(db *sqlx.DB, id int) (err error) {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "ventelivre", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
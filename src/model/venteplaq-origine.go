@@ -0,0 +1,380 @@
+/*
+Traçabilité des ventes de plaquettes :
+origine (chantier, parcelle, UG, propriétaire, commune) des plaquettes vendues.
+
+Chaque chargement (VenteCharge) provient d'un tas, qui appartient à un chantier plaquettes.
+La quantité chargée est répartie entre les parcelles du chantier au prorata
+de la surface exploitée sur chaque parcelle (cf ChantierParcelle),
+puis la part de chaque parcelle entre ses UGs (table parcelle_ug) au prorata de leur surface SIG.
+
+@copyright  BDL, Bois du Larzac.
+@licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+@history    2026-10-18 : Creation
+*/
+package model
+
+import (
+	"bdl.local/bdl/generic/wilk/werr"
+	"sort"
+	"time"
+)
+
+// Quantité de plaquettes d'une vente provenant d'une parcelle d'un chantier
+type OrigineVentePlaq struct {
+	IdVente        int
+	IdClient       int
+	IdChargement   int
+	IdChantier     int
+	IdParcelle     int     // 0 si le chantier n'est associé à aucune parcelle
+	IdUG           int     // 0 si la parcelle n'est associée à aucune UG
+	IdProprietaire int     // 0 si IdParcelle = 0
+	IdCommune      int     // 0 si IdParcelle = 0
+	Qte            float64 // en maps
+	// Pas stocké en base
+	Chantier *Plaq
+	Parcelle *Parcelle
+	UG       *UG
+}
+
+// Quantité vendue regroupée par origine (propriétaire, commune...)
+type QteOrigine struct {
+	Id    int
+	Label string
+	Qte   float64 // en maps
+}
+
+// Traçabilité d'une vente
+type TracabiliteVente struct {
+	Vente       *VentePlaq
+	Origines    []*OrigineVentePlaq
+	ParChantier []*QteOrigine
+	ParUG       []*QteOrigine
+	ParProprio  []*QteOrigine
+	ParCommune  []*QteOrigine
+}
+
+// Traçabilité de toutes les ventes d'un client
+type TracabiliteClient struct {
+	Client      *Acteur
+	Qte         float64 // en maps
+	ParChantier []*QteOrigine
+	ParUG       []*QteOrigine
+	ParProprio  []*QteOrigine
+	ParCommune  []*QteOrigine
+}
+
+// Traçabilité des ventes d'une période
+type TracabiliteVentes struct {
+	Ventes  []*TracabiliteVente
+	Clients []*TracabiliteClient
+}
+
+// ************************** Origines *******************************
+
+// Calcule l'origine des plaquettes d'une vente, chargement par chargement.
+// Le total des quantités renvoyées est égal à la quantité vendue (somme des chargements).
+func (vp *VentePlaq) ComputeOrigines(db DBOrTx) (res []*OrigineVentePlaq, err error) {
+	res = []*OrigineVentePlaq{}
+	type ligne struct {
+		Id         int
+		Qte        float64
+		IdChantier int `db:"id_chantier"`
+	}
+	chargements := []*ligne{}
+	query := `
+        select ventecharge.id, ventecharge.qte, tas.id_chantier from ventecharge
+            join ventelivre on ventecharge.id_livraison=ventelivre.id
+            join tas on ventecharge.id_tas=tas.id
+        where ventelivre.id_vente=$1
+        order by ventecharge.datecharge`
+	err = db.Select(&chargements, query, vp.Id)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	chantiers := map[int]*Plaq{}
+	liens := map[int][]*ChantierParcelle{}
+	ugsParcelles := map[int][]*UG{} // id parcelle => UGs de la parcelle
+	for _, chargement := range chargements {
+		if _, ok := chantiers[chargement.IdChantier]; !ok {
+			chantiers[chargement.IdChantier], err = GetPlaq(db, chargement.IdChantier)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel GetPlaq()")
+			}
+			err = chantiers[chargement.IdChantier].ComputeUGs(db)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel Plaq.ComputeUGs()")
+			}
+			liens[chargement.IdChantier], err = computeLiensParcellesOfChantier(db, "plaq", chargement.IdChantier)
+			if err != nil {
+				return res, werr.Wrapf(err, "Erreur appel computeLiensParcellesOfChantier()")
+			}
+		}
+		chantier := chantiers[chargement.IdChantier]
+		liensParcelles := liens[chargement.IdChantier]
+		if len(liensParcelles) == 0 {
+			res = append(res, &OrigineVentePlaq{
+				IdVente:      vp.Id,
+				IdClient:     vp.IdClient,
+				IdChargement: chargement.Id,
+				IdChantier:   chantier.Id,
+				Qte:          chargement.Qte,
+				Chantier:     chantier,
+			})
+			continue
+		}
+		for i, part := range partsParcelles(liensParcelles) {
+			parcelle := liensParcelles[i].Parcelle
+			if _, ok := ugsParcelles[parcelle.Id]; !ok {
+				ugsParcelles[parcelle.Id], err = computeUGsOrigine(db, parcelle.Id)
+				if err != nil {
+					return res, werr.Wrapf(err, "Erreur appel computeUGsOrigine()")
+				}
+			}
+			ugs := ugsChantierParcelle(chantier.UGs, ugsParcelles[parcelle.Id])
+			origine := OrigineVentePlaq{
+				IdVente:        vp.Id,
+				IdClient:       vp.IdClient,
+				IdChargement:   chargement.Id,
+				IdChantier:     chantier.Id,
+				IdParcelle:     parcelle.Id,
+				IdProprietaire: parcelle.IdProprietaire,
+				IdCommune:      parcelle.IdCommune,
+				Qte:            chargement.Qte * part,
+				Chantier:       chantier,
+				Parcelle:       parcelle,
+			}
+			if len(ugs) == 0 {
+				res = append(res, &origine)
+				continue
+			}
+			for _, ug := range ugs {
+				parUG := origine // copie
+				parUG.IdUG = ug.Id
+				parUG.UG = ug
+				parUG.Qte = origine.Qte * partUG(ugs, ug.Id)
+				res = append(res, &parUG)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Renvoie les UGs d'une parcelle (table parcelle_ug)
+// Auxiliaire de ComputeOrigines()
+func computeUGsOrigine(db DBOrTx, idParcelle int) (res []*UG, err error) {
+	res = []*UG{}
+	query := "select * from ug where id in(select id_ug from parcelle_ug where id_parcelle=$1) order by code"
+	err = db.Select(&res, query, idParcelle)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur query : "+query)
+	}
+	return res, nil
+}
+
+// Renvoie les UGs entre lesquelles est répartie la part d'une parcelle :
+// les UGs de la parcelle associées au chantier, ou toutes les UGs de la parcelle
+// si aucune n'est associée au chantier.
+// Auxiliaire de ComputeOrigines()
+func ugsChantierParcelle(ugsChantier, ugsParcelle []*UG) (res []*UG) {
+	for _, ugParcelle := range ugsParcelle {
+		for _, ugChantier := range ugsChantier {
+			if ugChantier.Id == ugParcelle.Id {
+				res = append(res, ugParcelle)
+				break
+			}
+		}
+	}
+	if len(res) == 0 {
+		return ugsParcelle
+	}
+	return res
+}
+
+// Renvoie la part (entre 0 et 1) de chaque parcelle d'un chantier, au prorata des surfaces exploitées.
+// Si aucune surface n'est renseignée, les parcelles ont des parts égales.
+func partsParcelles(liens []*ChantierParcelle) (res []float64) {
+	res = make([]float64, len(liens))
+	total := 0.0
+	for i, lien := range liens {
+		if lien.Entiere {
+			res[i] = lien.Parcelle.Surface
+		} else {
+			res[i] = lien.Surface
+		}
+		total += res[i]
+	}
+	for i := range res {
+		if total == 0 {
+			res[i] = 1 / float64(len(res))
+		} else {
+			res[i] /= total
+		}
+	}
+	return res
+}
+
+// ************************** Traçabilité *******************************
+
+// Calcule la traçabilité des ventes de plaquettes d'une période,
+// par vente et par client, avec des regroupements par chantier, UG, propriétaire et commune.
+func ComputeTracabiliteVentes(db DBOrTx, date1, date2 time.Time) (res *TracabiliteVentes, err error) {
+	res = &TracabiliteVentes{}
+	ventes, err := GetVentePlaqsOfPeriod(db, date1, date2)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetVentePlaqsOfPeriod()")
+	}
+	labels := &labelsOrigine{db: db, proprios: map[int]string{}, communes: map[int]string{}, chantiers: map[int]string{}, ugs: map[int]string{}}
+	clients := map[int]*TracabiliteClient{}
+	originesClients := map[int][]*OrigineVentePlaq{}
+	for _, vente := range ventes {
+		origines, err := vente.ComputeOrigines(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel VentePlaq.ComputeOrigines()")
+		}
+		tv := &TracabiliteVente{Vente: vente, Origines: origines}
+		tv.ParChantier, tv.ParUG, tv.ParProprio, tv.ParCommune, err = labels.regroupements(origines)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel labelsOrigine.regroupements()")
+		}
+		res.Ventes = append(res.Ventes, tv)
+		if _, ok := clients[vente.IdClient]; !ok {
+			clients[vente.IdClient] = &TracabiliteClient{Client: vente.Client}
+			res.Clients = append(res.Clients, clients[vente.IdClient])
+		}
+		clients[vente.IdClient].Qte += vente.Qte
+		originesClients[vente.IdClient] = append(originesClients[vente.IdClient], origines...)
+	}
+	for _, tc := range res.Clients {
+		tc.ParChantier, tc.ParUG, tc.ParProprio, tc.ParCommune, err = labels.regroupements(originesClients[tc.Client.Id])
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel labelsOrigine.regroupements()")
+		}
+	}
+	sort.Slice(res.Clients, func(i, j int) bool {
+		return res.Clients[i].Client.String() < res.Clients[j].Client.String()
+	})
+	return res, nil
+}
+
+// Pour une période donnée, calcule la quantité de plaquettes (en maps) vendues
+// en répartissant par propriétaire des parcelles d'où proviennent les plaquettes (cf ComputeOrigines())
+// @return
+//
+//	key = id proprio (0 pour les plaquettes provenant de chantiers sans parcelle)
+//	value = quantité vendue provenant des parcelles de ce proprio, pour toutes les ventes de la période
+func ComputeQuantiteVenteParProprio(db DBOrTx, date1, date2 time.Time) (res map[int]float64, err error) {
+	res = map[int]float64{}
+	ventes, err := GetVentePlaqsOfPeriod(db, date1, date2)
+	if err != nil {
+		return res, werr.Wrapf(err, "Erreur appel GetVentePlaqsOfPeriod()")
+	}
+	for _, vente := range ventes {
+		origines, err := vente.ComputeOrigines(db)
+		if err != nil {
+			return res, werr.Wrapf(err, "Erreur appel VentePlaq.ComputeOrigines()")
+		}
+		for _, origine := range origines {
+			res[origine.IdProprietaire] += origine.Qte
+		}
+	}
+	return res, nil
+}
+
+// ************************** Auxiliaires *******************************
+
+// Cache des noms de propriétaires, communes, chantiers et UGs, utilisé par ComputeTracabiliteVentes()
+type labelsOrigine struct {
+	db        DBOrTx
+	proprios  map[int]string
+	communes  map[int]string
+	chantiers map[int]string
+	ugs       map[int]string
+}
+
+func (l *labelsOrigine) proprio(id int) (string, error) {
+	if _, ok := l.proprios[id]; !ok {
+		acteur, err := GetActeur(l.db, id)
+		if err != nil {
+			return "", werr.Wrapf(err, "Erreur appel GetActeur()")
+		}
+		l.proprios[id] = acteur.String()
+	}
+	return l.proprios[id], nil
+}
+
+func (l *labelsOrigine) commune(id int) (string, error) {
+	if _, ok := l.communes[id]; !ok {
+		commune, err := GetCommune(l.db, id)
+		if err != nil {
+			return "", werr.Wrapf(err, "Erreur appel GetCommune()")
+		}
+		l.communes[id] = commune.Nom
+	}
+	return l.communes[id], nil
+}
+
+func (l *labelsOrigine) chantier(id int) (string, error) {
+	if _, ok := l.chantiers[id]; !ok {
+		chantier, err := GetPlaq(l.db, id)
+		if err != nil {
+			return "", werr.Wrapf(err, "Erreur appel GetPlaq()")
+		}
+		l.chantiers[id] = chantier.String()
+	}
+	return l.chantiers[id], nil
+}
+
+func (l *labelsOrigine) ug(id int) (string, error) {
+	if _, ok := l.ugs[id]; !ok {
+		ug, err := GetUG(l.db, id)
+		if err != nil {
+			return "", werr.Wrapf(err, "Erreur appel GetUG()")
+		}
+		l.ugs[id] = ug.String()
+	}
+	return l.ugs[id], nil
+}
+
+// Regroupe des origines par chantier, UG, propriétaire et commune
+func (l *labelsOrigine) regroupements(origines []*OrigineVentePlaq) (parChantier, parUG, parProprio, parCommune []*QteOrigine, err error) {
+	parChantier, err = l.regrouper(origines, l.chantier, "", func(o *OrigineVentePlaq) int { return o.IdChantier })
+	if err != nil {
+		return parChantier, parUG, parProprio, parCommune, werr.Wrapf(err, "Erreur regroupement par chantier")
+	}
+	parUG, err = l.regrouper(origines, l.ug, "UG inconnue", func(o *OrigineVentePlaq) int { return o.IdUG })
+	if err != nil {
+		return parChantier, parUG, parProprio, parCommune, werr.Wrapf(err, "Erreur regroupement par UG")
+	}
+	parProprio, err = l.regrouper(origines, l.proprio, "Parcelle inconnue", func(o *OrigineVentePlaq) int { return o.IdProprietaire })
+	if err != nil {
+		return parChantier, parUG, parProprio, parCommune, werr.Wrapf(err, "Erreur regroupement par propriétaire")
+	}
+	parCommune, err = l.regrouper(origines, l.commune, "Parcelle inconnue", func(o *OrigineVentePlaq) int { return o.IdCommune })
+	if err != nil {
+		return parChantier, parUG, parProprio, parCommune, werr.Wrapf(err, "Erreur regroupement par commune")
+	}
+	return parChantier, parUG, parProprio, parCommune, nil
+}
+
+// Regroupe des origines selon la clé renvoyée par cle(), triées par quantité décroissante.
+// La clé 0 correspond aux plaquettes dont l'origine est inconnue, libellées inconnu.
+func (l *labelsOrigine) regrouper(origines []*OrigineVentePlaq, label func(int) (string, error), inconnu string, cle func(*OrigineVentePlaq) int) (res []*QteOrigine, err error) {
+	res = []*QteOrigine{}
+	groupes := map[int]*QteOrigine{}
+	for _, origine := range origines {
+		id := cle(origine)
+		if _, ok := groupes[id]; !ok {
+			groupes[id] = &QteOrigine{Id: id, Label: inconnu}
+			if id != 0 {
+				groupes[id].Label, err = label(id)
+				if err != nil {
+					return res, err
+				}
+			}
+			res = append(res, groupes[id])
+		}
+		groupes[id].Qte += origine.Qte
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Qte > res[j].Qte })
+	return res, nil
+}
@@ -21,7 +21,6 @@ package model
 import (
 	"bdl.local/bdl/generic/tiglib"
 	"bdl.local/bdl/generic/wilk/werr"
-	"github.com/jmoiron/sqlx"
 	"strconv"
 	"time"
 )
@@ -56,10 +55,24 @@ type VentePlaq struct {
 // ************************** Manipulation Quantité *******************************
 
 // @param   qte en maps
-func (vp *VentePlaq) ModifierQte(db *sqlx.DB, qte float64) {
+func (vp *VentePlaq) ModifierQte(db DBOrTx, qte float64) {
 	vp.Qte += qte
 }
 
+// ************************** Prix *******************************
+
+// Prix HT de la livraison facturée au client (0 si la livraison n'est pas facturée)
+// Par map (sur Qte) ou par km (sur FactureLivraisonNbKm), selon FactureLivraisonUnite
+func (vp *VentePlaq) CoutLivraisonHT() float64 {
+	if !vp.FactureLivraison {
+		return 0
+	}
+	if vp.FactureLivraisonUnite == "km" {
+		return vp.FactureLivraisonPUHT * vp.FactureLivraisonNbKm
+	}
+	return vp.FactureLivraisonPUHT * vp.Qte
+}
+
 // ************************** Nom *******************************
 
 func (vp *VentePlaq) String() string {
@@ -82,7 +95,7 @@ func (vp *VentePlaq) StringSansDate() string {
 
 // ************************** Get one *******************************
 
-func GetVentePlaq(db *sqlx.DB, id int) (*VentePlaq, error) {
+func GetVentePlaq(db DBOrTx, id int) (*VentePlaq, error) {
 	vp := &VentePlaq{}
 	query := "select * from venteplaq where id=$1"
 	row := db.QueryRowx(query, id)
@@ -93,7 +106,7 @@ func GetVentePlaq(db *sqlx.DB, id int) (*VentePlaq, error) {
 	return vp, nil
 }
 
-func GetVentePlaqFull(db *sqlx.DB, id int) (*VentePlaq, error) {
+func GetVentePlaqFull(db DBOrTx, id int) (*VentePlaq, error) {
 	vp, err := GetVentePlaq(db, id)
 	if err != nil {
 		return vp, werr.Wrapf(err, "Erreur appel GetVentePlaq()")
@@ -126,7 +139,7 @@ func GetVentePlaqFull(db *sqlx.DB, id int) (*VentePlaq, error) {
 // Renvoie la liste des années ayant des ventes de plaquettes,
 // @param   exclude   Année à exclure du résultat
 // @return  Liste de string au format YYYY
-func GetVentePlaqDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
+func GetVentePlaqDifferentYears(db DBOrTx, exclude string) ([]string, error) {
 	res := []string{}
 	list := []time.Time{}
 	query := "select datevente from venteplaq order by datevente"
@@ -146,7 +159,7 @@ func GetVentePlaqDifferentYears(db *sqlx.DB, exclude string) ([]string, error) {
 // Renvoie la liste des ventes de plaquettes pour une année donnée,
 // triés par ordre chronologique inverse.
 // Chaque vente contient les mêmes champs que ceux renvoyés par GetVentePlaqFull()
-func GetVentePlaqsOfYear(db *sqlx.DB, annee string) ([]*VentePlaq, error) {
+func GetVentePlaqsOfYear(db DBOrTx, annee string) ([]*VentePlaq, error) {
 	res := []*VentePlaq{}
 	type ligne struct {
 		Id        int
@@ -172,7 +185,7 @@ func GetVentePlaqsOfYear(db *sqlx.DB, annee string) ([]*VentePlaq, error) {
 // Renvoie la liste des ventes de plaquettes de date 1 à date 2,
 // triés par ordre chronologique.
 // Chaque vente contient les mêmes champs que ceux renvoyés par GetVentePlaqFull()
-func GetVentePlaqsOfPeriod(db *sqlx.DB, date1, date2 time.Time) ([]*VentePlaq, error) {
+func GetVentePlaqsOfPeriod(db DBOrTx, date1, date2 time.Time) ([]*VentePlaq, error) {
 	res := []*VentePlaq{}
 	query := "select * from venteplaq where datevente>=$1 and datevente<=$2 order by datevente"
 	err := db.Select(&res, query, date1, date2)
@@ -191,7 +204,7 @@ func GetVentePlaqsOfPeriod(db *sqlx.DB, date1, date2 time.Time) ([]*VentePlaq, e
 
 // Renvoie la liste des ventes de plaquettes pour un client donné, situé entre 2 dates,
 // Chaque chantier contient les mêmes champs que ceux renvoyés par GetVentePlaqFull()
-func GetVentePlaqsOfClient(db *sqlx.DB, idClient int, dateDebut, dateFin time.Time) ([]*VentePlaq, error) {
+func GetVentePlaqsOfClient(db DBOrTx, idClient int, dateDebut, dateFin time.Time) ([]*VentePlaq, error) {
 	res := []*VentePlaq{}
 	query := "select * from venteplaq where id_client=$1 and datevente>=$2 and datevente<=$3 order by datevente"
 	err := db.Select(&res, query, idClient, dateDebut, dateFin)
@@ -213,7 +226,7 @@ func GetVentePlaqsOfClient(db *sqlx.DB, idClient int, dateDebut, dateFin time.Ti
 
 // ************************** Compute *******************************
 
-func (vp *VentePlaq) ComputeQte(db *sqlx.DB) error {
+func (vp *VentePlaq) ComputeQte(db DBOrTx) error {
 	var qtes []float64
 	query := `select qte from ventecharge where id_livraison in(
                 select id from ventelivre where id_vente=$1
@@ -229,7 +242,7 @@ func (vp *VentePlaq) ComputeQte(db *sqlx.DB) error {
 	return nil
 }
 
-func (vp *VentePlaq) ComputeClient(db *sqlx.DB) error {
+func (vp *VentePlaq) ComputeClient(db DBOrTx) error {
 	var err error
 	vp.Client, err = GetActeur(db, vp.IdClient)
 	if err != nil {
@@ -238,7 +251,7 @@ func (vp *VentePlaq) ComputeClient(db *sqlx.DB) error {
 	return nil
 }
 
-func (vp *VentePlaq) ComputeFournisseur(db *sqlx.DB) error {
+func (vp *VentePlaq) ComputeFournisseur(db DBOrTx) error {
 	var err error
 	vp.Fournisseur, err = GetActeur(db, vp.IdFournisseur)
 	if err != nil {
@@ -247,7 +260,7 @@ func (vp *VentePlaq) ComputeFournisseur(db *sqlx.DB) error {
 	return nil
 }
 
-func (vp *VentePlaq) ComputeLivraisons(db *sqlx.DB) error {
+func (vp *VentePlaq) ComputeLivraisons(db DBOrTx) error {
 	query := "select id from ventelivre where id_vente=$1 order by datelivre"
 	idsLivraison := []int{}
 	err := db.Select(&idsLivraison, query, &vp.Id)
@@ -264,7 +277,7 @@ func (vp *VentePlaq) ComputeLivraisons(db *sqlx.DB) error {
 	return nil
 }
 
-func (vp *VentePlaq) ComputeChantiers(db *sqlx.DB) error {
+func (vp *VentePlaq) ComputeChantiers(db DBOrTx) error {
 	ids := []int{}
 	query := `select distinct id_chantier from tas where id in (
                   select id_tas from ventecharge where id_livraison in(
@@ -293,61 +306,9 @@ func (vp *VentePlaq) ComputeChantiers(db *sqlx.DB) error {
 	return nil
 }
 
-// ************************** Totaux *******************************
-
-// Pour une période donnée, calcule la quantité de plaquettes (en maps) vendues
-// en répartissant par propriétaire des parcelles où ont eu lieu les chantiers
-// La répartition utilise la surface des parcelles
-// @return 
-//      key = id proprio
-//      value = quantité vendue sur les parcelles de ce proprio, pour toutes les ventes de la période
-func ComputeQuantiteVenteParProprio(db *sqlx.DB, date1, date2 time.Time) (res map[int]float64, err error){
-    res = map[int]float64{}
-    ventes, err := GetVentePlaqsOfPeriod(db, date1, date2)
-    if err != nil {
-        return res, werr.Wrapf(err, "Erreur appel GetVentePlaqsOfPeriod()")
-    }
-    for _, vente := range(ventes){
-        err = vente.ComputeQte(db)
-        if err != nil {
-            return res, werr.Wrapf(err, "Erreur appel VentePlaq.ComputeQte()")
-        }
-        err = vente.ComputeChantiers(db)
-        if err != nil {
-            return res, werr.Wrapf(err, "Erreur appel VentePlaq.ComputeChantiers()")
-        }
-        for _, chantier := range(vente.Chantiers){ 
-            liensParcelles, err := computeLiensParcellesOfChantier(db, "plaq", chantier.Id)
-            if err != nil {
-                return res, werr.Wrapf(err, "Erreur appel computeLiensParcellesOfChantier()")
-            }
-            for _, lienParcelle := range(liensParcelles){
-                parcelle, err := GetParcelle(db, lienParcelle.IdParcelle)
-                surfaceParcelle := parcelle.Surface
-                if err != nil {
-                    return res, werr.Wrapf(err, "Erreur appel GetParcelle()")
-                }
-                idProprio := parcelle.IdProprietaire
-                if _, ok := res[idProprio]; !ok {
-                    res[idProprio] = 0
-                }
-                surface := float64(0)
-                if lienParcelle.Entiere {
-                    surface = surfaceParcelle
-                } else {
-                    surface = lienParcelle.Surface
-                }
-                // ICI règle de 3
-                res[idProprio] += vente.Qte * surface / surfaceParcelle
-            }
-        }
-    }
-    return res, nil
-}
-
 // ************************** CRUD *******************************
 
-func InsertVentePlaq(db *sqlx.DB, vp *VentePlaq) (int, error) {
+func InsertVentePlaq(db DBOrTx, vp *VentePlaq) (int, error) {
 	query := `insert into venteplaq(
         id_client,
         id_fournisseur,
@@ -386,10 +347,18 @@ func InsertVentePlaq(db *sqlx.DB, vp *VentePlaq) (int, error) {
 	if err != nil {
 		return id, werr.Wrapf(err, "Erreur query "+query)
 	}
+	err = insertAudit(db, "venteplaq", id, AUDIT_INSERT, "")
+	if err != nil {
+		return id, werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return id, nil
 }
 
-func UpdateVentePlaq(db *sqlx.DB, vp *VentePlaq) error {
+func UpdateVentePlaq(db DBOrTx, vp *VentePlaq) error {
+	avant, err := auditEtat(db, "venteplaq", vp.Id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	query := `update venteplaq set(
         id_client,
         id_fournisseur,
@@ -407,7 +376,7 @@ func UpdateVentePlaq(db *sqlx.DB, vp *VentePlaq) error {
         facturenotes,
         notes
         ) = ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15) where id=$16`
-	_, err := db.Exec(
+	_, err = db.Exec(
 		query,
 		vp.IdClient,
 		vp.IdFournisseur,
@@ -428,14 +397,22 @@ func UpdateVentePlaq(db *sqlx.DB, vp *VentePlaq) error {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "venteplaq", vp.Id, AUDIT_UPDATE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
 
-func DeleteVentePlaq(db *sqlx.DB, id int) error {
+func DeleteVentePlaq(db DBOrTx, id int) error {
+	avant, err := auditEtat(db, "venteplaq", id)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel auditEtat()")
+	}
 	// delete les livraisons dépendant de cette vente
 	idsLivraison := []int{}
 	query := "select id from ventelivre where id_vente=$1"
-	err := db.Select(&idsLivraison, query, id)
+	err = db.Select(&idsLivraison, query, id)
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
@@ -451,5 +428,9 @@ func DeleteVentePlaq(db *sqlx.DB, id int) error {
 	if err != nil {
 		return werr.Wrapf(err, "Erreur query : "+query)
 	}
+	err = insertAudit(db, "venteplaq", id, AUDIT_DELETE, avant)
+	if err != nil {
+		return werr.Wrapf(err, "Erreur appel insertAudit()")
+	}
 	return nil
 }
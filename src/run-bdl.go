@@ -12,15 +12,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"mime"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"bdl.local/bdl/control"
 	"bdl.local/bdl/control/ajax"
+	"bdl.local/bdl/control/api"
 	"bdl.local/bdl/ctxt"
 	"bdl.local/bdl/generic/wilk/werr"
 	"bdl.local/bdl/model"
@@ -42,125 +46,266 @@ func main() {
 	model.MustLoadEnv()
 	ctxt.MustLoadConfig()
 	ctxt.MustInitDB()
+	ctxt.MustApplyMigrations()
 	ctxt.MustInitTemplates()
+	ctxt.LanceSauvegardesAutomatiques()
 
 	r := mux.NewRouter()
 
-	r.HandleFunc("/ajax/get/lieudits-from-ids-ugs/{ids:[0-9,]+}", Hajax(ajax.GetLieuditsFromIdsUGs))
-	r.HandleFunc("/ajax/get/fermiers-from-ids-ugs/{ids:[0-9,]+}", Hajax(ajax.GetFermiersFromIdsUGs))
-	r.HandleFunc("/ajax/get/parcelles-from-ids-ugs/{ids:[0-9,]+}", Hajax(ajax.GetParcellesFromIdsUGs))
-	r.HandleFunc("/ajax/get/parcelle-from-code-et-commune/{code-parcelle:[A-Z0-9]{6}}/{id-commune:[0-9]+}", Hajax(ajax.GetParcelleFromCodeAndCommuneId))
-	r.HandleFunc("/ajax/get/ugs-from-fermier/{id:[0-9]+}", Hajax(ajax.GetUGsFromFermier))
-	r.HandleFunc("/ajax/get/ug-from-code/{code}", Hajax(ajax.GetUGFromCode))
-	r.HandleFunc("/ajax/get/bloc-notes", Hajax(ajax.GetBlocnotes))
-
-	r.HandleFunc("/", H(control.Accueil))
-	r.HandleFunc("/doc", H(control.ShowDoc))
-	r.HandleFunc("/backup", H(control.BackupDB))
-	r.HandleFunc("/maj-qgis", H(control.MajQGis))
-	r.HandleFunc("/bloc-notes/update", H(control.UpdateBlocnotes))
-	r.HandleFunc("/bloc-notes/update/{ok}", H(control.UpdateBlocnotes))
-
-	r.HandleFunc("/activite/recherche", H(control.SearchActivite))
-	r.HandleFunc("/activite/recherche/{tab}", H(control.SearchActivite))
-
-	r.HandleFunc("/facture/vente-plaquette/{id:[0-9]+}", HPDF(control.ShowFactureVentePlaq))
-	r.HandleFunc("/facture/autre/{id:[0-9]+}", HPDF(control.ShowFactureChautre))
-
-	r.HandleFunc("/affacture/form/{id:[0-9]+}", H(control.FormAffacture))
-	r.HandleFunc("/affacture/show", HPDF(control.ShowAffacture))
-
-	r.HandleFunc("/acteur/liste", H(control.ListActeur))
-	r.HandleFunc("/acteur/new", H(control.NewActeur))
-	r.HandleFunc("/acteur/update/{id:[0-9]+}", H(control.UpdateActeur))
-	r.HandleFunc("/acteur/delete/{id:[0-9]+}", H(control.DeleteActeur))
-	r.HandleFunc("/acteur/{id:[0-9]+}", H(control.ShowActeur))
-
-	r.HandleFunc("/fermier/liste", H(control.ListFermier))
-	r.HandleFunc("/fermier/{id:[0-9]+}", H(control.ShowFermier))
-
-	r.HandleFunc("/chantier/autre/liste", H(control.ListChautre))
-	r.HandleFunc("/chantier/autre/liste/{annee:[0-9]+}", H(control.ListChautre))
-	r.HandleFunc("/chantier/autre/new", H(control.NewChautre))
-	r.HandleFunc("/chantier/autre/{id:[0-9]+}", H(control.ShowChautre))
-	r.HandleFunc("/chantier/autre/update/{id:[0-9]+}", H(control.UpdateChautre))
-	r.HandleFunc("/chantier/autre/delete/{id:[0-9]+}", H(control.DeleteChautre))
-
-	r.HandleFunc("/chantier/chauffage-fermier/liste/{annee:[0-9]+}", H(control.ListChaufer))
-	r.HandleFunc("/chantier/chauffage-fermier/liste", H(control.ListChaufer))
-	r.HandleFunc("/chantier/chauffage-fermier/new", H(control.NewChaufer))
-	r.HandleFunc("/chantier/chauffage-fermier/{id:[0-9]+}", H(control.ShowChaufer))
-	r.HandleFunc("/chantier/chauffage-fermier/update/{id:[0-9]+}", H(control.UpdateChaufer))
-	r.HandleFunc("/chantier/chauffage-fermier/delete/{id:[0-9]+}", H(control.DeleteChaufer))
-
-	r.HandleFunc("/chantier/plaquette/liste", H(control.ListPlaq))
-	r.HandleFunc("/chantier/plaquette/liste/{annee:[0-9]+}", H(control.ListPlaq))
-	r.HandleFunc("/chantier/plaquette/new", H(control.NewPlaq))
-	r.HandleFunc("/chantier/plaquette/{id:[0-9]+}", H(control.ShowPlaq))
-	r.HandleFunc("/chantier/plaquette/update/{id:[0-9]+}", H(control.UpdatePlaq))
-	r.HandleFunc("/chantier/plaquette/{id:[0-9]+}/{tab}", H(control.ShowPlaq))
-	r.HandleFunc("/chantier/plaquette/delete/{id:[0-9]+}", H(control.DeletePlaq))
-
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/new", H(control.NewPlaqOp))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/update/{id-op:[0-9]+}", H(control.UpdatePlaqOp))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/delete/{id-op:[0-9]+}", H(control.DeletePlaqOp))
-
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/new", H(control.NewPlaqTrans))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/update/{id-pt:[0-9]+}", H(control.UpdatePlaqTrans))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/delete/{id-pt:[0-9]+}", H(control.DeletePlaqTrans))
-
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/new", H(control.NewPlaqRange))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/update/{id-pr:[0-9]+}", H(control.UpdatePlaqRange))
-	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/delete/{id-pr:[0-9]+}", H(control.DeletePlaqRange))
-
-	r.HandleFunc("/vente/recherche", H(control.SearchVente))
-	r.HandleFunc("/vente/liste", H(control.ListVentePlaq))
-	r.HandleFunc("/vente/liste/{annee:[0-9]+}", H(control.ListVentePlaq))
-	r.HandleFunc("/vente/{id-vente:[0-9]+}", H(control.ShowVentePlaq))
-	r.HandleFunc("/vente/new", H(control.NewVentePlaq))
-	r.HandleFunc("/vente/update/{id-vente:[0-9]+}", H(control.UpdateVentePlaq))
-	r.HandleFunc("/vente/delete/{id-vente:[0-9]+}", H(control.DeleteVentePlaq))
-
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/new", H(control.NewVenteLivre))
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/update/{id-livraison:[0-9]+}", H(control.UpdateVenteLivre))
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/delete/{id-livraison:[0-9]+}", H(control.DeleteVenteLivre))
-
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/new", H(control.NewVenteCharge))
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/update/{id-chargement:[0-9]+}", H(control.UpdateVenteCharge))
-	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/delete/{id-chargement:[0-9]+}", H(control.DeleteVenteCharge))
-
-	r.HandleFunc("/stockage/liste", H(control.ListStockages))
-	r.HandleFunc("/stockage/new", H(control.NewStockage))
-	r.HandleFunc("/stockage/update/{id:[0-9]+}", H(control.UpdateStockage))
-	r.HandleFunc("/stockage/delete/{id:[0-9]+}", H(control.DeleteOrArchiveStockage))
-
-	r.HandleFunc("/tas-vides", H(control.ShowTasVides))
-	r.HandleFunc("/tas/vider/{id:[0-9]+}/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", H(control.SignalerTasVide))
-
-	r.HandleFunc("/frais-stockage/new/{id-stockage:[0-9]+}", H(control.NewStockFrais))
-	r.HandleFunc("/frais-stockage/update/{id:[0-9]+}", H(control.UpdateStockFrais))
-	r.HandleFunc("/frais-stockage/delete/{id:[0-9]+}", H(control.DeleteStockFrais))
-
-	r.HandleFunc("/humidite/liste", H(control.ListHumid))
-	r.HandleFunc("/humidite/liste/{annee:[0-9]+}", H(control.ListHumid))
-	r.HandleFunc("/humidite/new", H(control.NewHumid))
-	r.HandleFunc("/humidite/new/tas/{id-tas:[0-9]+}", H(control.NewHumid))
-	r.HandleFunc("/humidite/update/{id:[0-9]+}", H(control.UpdateHumid))
-	r.HandleFunc("/humidite/delete/{id:[0-9]+}", H(control.DeleteHumid))
-
-	r.HandleFunc("/sylviculture/recherche", H(control.SearchSylvi))
-	r.HandleFunc("/sylviculture/recherche/{tab}", H(control.SearchSylvi)) ////// supprimer si finalement pas de tab
-
-	r.HandleFunc("/ug/liste", H(control.ListUGs))
-	r.HandleFunc("/ug/{id:[0-9]+}", H(control.ShowUG))
-	r.HandleFunc("/ug/{id:[0-9]+}/{tab}", H(control.ShowUG))
-	r.HandleFunc("/commune/liste", H(control.ListCommunes))
-	r.HandleFunc("/lieudit/{id:[0-9]+}", H(control.ShowLieudit))
-	r.HandleFunc("/parcelle/{id:[0-9]+}", H(control.ShowParcelle))
-
-	r.PathPrefix("/doc/").Handler(http.StripPrefix("/doc/", http.FileServer(http.Dir(filepath.Join("..", "doc")))))
+	r.HandleFunc("/ajax/get/lieudits-from-ids-ugs/{ids:[0-9,]+}", Lecteur(Hajax(ajax.GetLieuditsFromIdsUGs)))
+	r.HandleFunc("/ajax/get/fermiers-from-ids-ugs/{ids:[0-9,]+}", Lecteur(Hajax(ajax.GetFermiersFromIdsUGs)))
+	r.HandleFunc("/ajax/get/parcelles-from-ids-ugs/{ids:[0-9,]+}", Lecteur(Hajax(ajax.GetParcellesFromIdsUGs)))
+	r.HandleFunc("/ajax/get/parcelle-from-code-et-commune/{code-parcelle:[A-Z0-9]{6}}/{id-commune:[0-9]+}", Lecteur(Hajax(ajax.GetParcelleFromCodeAndCommuneId)))
+	r.HandleFunc("/ajax/get/ugs-from-fermier/{id:[0-9]+}", Lecteur(Hajax(ajax.GetUGsFromFermier)))
+	r.HandleFunc("/ajax/get/ug-from-code/{code}", Lecteur(Hajax(ajax.GetUGFromCode)))
+	r.HandleFunc("/ajax/get/bloc-notes", Lecteur(Hajax(ajax.GetBlocnotes)))
+
+	//
+	// API JSON - voir control/api/api.go
+	//
+	r.HandleFunc("/api/v1/login", Hapi(api.Login)).Methods("POST")
+	r.HandleFunc("/api/v1/logout", Lecteur(Hapi(api.Logout))).Methods("POST")
+
+	r.HandleFunc("/api/v1/chantiers/plaquettes", Lecteur(Hapi(api.ListPlaqs))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/plaquettes", Editeur(Hapi(api.NewPlaq))).Methods("POST")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}", Lecteur(Hapi(api.GetPlaq))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}", Editeur(Hapi(api.UpdatePlaq))).Methods("PUT")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}", Editeur(Hapi(api.DeletePlaq))).Methods("DELETE")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}/operations", Editeur(Hapi(api.NewPlaqOp))).Methods("POST")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}/transports", Editeur(Hapi(api.NewPlaqTrans))).Methods("POST")
+	r.HandleFunc("/api/v1/chantiers/plaquettes/{id:[0-9]+}/rangements", Editeur(Hapi(api.NewPlaqRange))).Methods("POST")
+
+	r.HandleFunc("/api/v1/operations/{id:[0-9]+}", Lecteur(Hapi(api.GetPlaqOp))).Methods("GET")
+	r.HandleFunc("/api/v1/operations/{id:[0-9]+}", Editeur(Hapi(api.UpdatePlaqOp))).Methods("PUT")
+	r.HandleFunc("/api/v1/operations/{id:[0-9]+}", Editeur(Hapi(api.DeletePlaqOp))).Methods("DELETE")
+	r.HandleFunc("/api/v1/transports/{id:[0-9]+}", Lecteur(Hapi(api.GetPlaqTrans))).Methods("GET")
+	r.HandleFunc("/api/v1/transports/{id:[0-9]+}", Editeur(Hapi(api.UpdatePlaqTrans))).Methods("PUT")
+	r.HandleFunc("/api/v1/transports/{id:[0-9]+}", Editeur(Hapi(api.DeletePlaqTrans))).Methods("DELETE")
+	r.HandleFunc("/api/v1/rangements/{id:[0-9]+}", Lecteur(Hapi(api.GetPlaqRange))).Methods("GET")
+	r.HandleFunc("/api/v1/rangements/{id:[0-9]+}", Editeur(Hapi(api.UpdatePlaqRange))).Methods("PUT")
+	r.HandleFunc("/api/v1/rangements/{id:[0-9]+}", Editeur(Hapi(api.DeletePlaqRange))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/chantiers/autres", Lecteur(Hapi(api.ListChautres))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/autres", Editeur(Hapi(api.NewChautre))).Methods("POST")
+	r.HandleFunc("/api/v1/chantiers/autres/{id:[0-9]+}", Lecteur(Hapi(api.GetChautre))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/autres/{id:[0-9]+}", Editeur(Hapi(api.UpdateChautre))).Methods("PUT")
+	r.HandleFunc("/api/v1/chantiers/autres/{id:[0-9]+}", Editeur(Hapi(api.DeleteChautre))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/chantiers/chauffage-fermier", Lecteur(Hapi(api.ListChaufers))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/chauffage-fermier", Editeur(Hapi(api.NewChaufer))).Methods("POST")
+	r.HandleFunc("/api/v1/chantiers/chauffage-fermier/{id:[0-9]+}", Lecteur(Hapi(api.GetChaufer))).Methods("GET")
+	r.HandleFunc("/api/v1/chantiers/chauffage-fermier/{id:[0-9]+}", Editeur(Hapi(api.UpdateChaufer))).Methods("PUT")
+	r.HandleFunc("/api/v1/chantiers/chauffage-fermier/{id:[0-9]+}", Editeur(Hapi(api.DeleteChaufer))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/ventes", Lecteur(Hapi(api.ListVentePlaqs))).Methods("GET")
+	r.HandleFunc("/api/v1/ventes", Editeur(Hapi(api.NewVentePlaq))).Methods("POST")
+	r.HandleFunc("/api/v1/ventes/{id:[0-9]+}", Lecteur(Hapi(api.GetVentePlaq))).Methods("GET")
+	r.HandleFunc("/api/v1/ventes/{id:[0-9]+}", Editeur(Hapi(api.UpdateVentePlaq))).Methods("PUT")
+	r.HandleFunc("/api/v1/ventes/{id:[0-9]+}", Editeur(Hapi(api.DeleteVentePlaq))).Methods("DELETE")
+	r.HandleFunc("/api/v1/ventes/{id:[0-9]+}/livraisons", Editeur(Hapi(api.NewVenteLivre))).Methods("POST")
+	r.HandleFunc("/api/v1/livraisons/{id:[0-9]+}", Lecteur(Hapi(api.GetVenteLivre))).Methods("GET")
+	r.HandleFunc("/api/v1/livraisons/{id:[0-9]+}", Editeur(Hapi(api.UpdateVenteLivre))).Methods("PUT")
+	r.HandleFunc("/api/v1/livraisons/{id:[0-9]+}", Editeur(Hapi(api.DeleteVenteLivre))).Methods("DELETE")
+	r.HandleFunc("/api/v1/livraisons/{id:[0-9]+}/chargements", Editeur(Hapi(api.NewVenteCharge))).Methods("POST")
+	r.HandleFunc("/api/v1/chargements/{id:[0-9]+}", Lecteur(Hapi(api.GetVenteCharge))).Methods("GET")
+	r.HandleFunc("/api/v1/chargements/{id:[0-9]+}", Editeur(Hapi(api.UpdateVenteCharge))).Methods("PUT")
+	r.HandleFunc("/api/v1/chargements/{id:[0-9]+}", Editeur(Hapi(api.DeleteVenteCharge))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/stockages", Lecteur(Hapi(api.ListStockages))).Methods("GET")
+	r.HandleFunc("/api/v1/stockages", Editeur(Hapi(api.NewStockage))).Methods("POST")
+	r.HandleFunc("/api/v1/stockages/{id:[0-9]+}", Lecteur(Hapi(api.GetStockage))).Methods("GET")
+	r.HandleFunc("/api/v1/stockages/{id:[0-9]+}", Editeur(Hapi(api.UpdateStockage))).Methods("PUT")
+	r.HandleFunc("/api/v1/stockages/{id:[0-9]+}", Editeur(Hapi(api.DeleteStockage))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/tas", Lecteur(Hapi(api.ListTas))).Methods("GET")
+	r.HandleFunc("/api/v1/tas/{id:[0-9]+}", Lecteur(Hapi(api.GetTas))).Methods("GET")
+	r.HandleFunc("/api/v1/tas/{id:[0-9]+}/vider", Editeur(Hapi(api.ViderTas))).Methods("POST")
+	r.HandleFunc("/api/v1/tas/{id:[0-9]+}/rouvrir", Editeur(Hapi(api.RouvrirTas))).Methods("POST")
+
+	r.HandleFunc("/api/v1/humidites", Lecteur(Hapi(api.ListHumids))).Methods("GET")
+	r.HandleFunc("/api/v1/humidites", Editeur(Hapi(api.NewHumid))).Methods("POST")
+	r.HandleFunc("/api/v1/humidites/{id:[0-9]+}", Lecteur(Hapi(api.GetHumid))).Methods("GET")
+	r.HandleFunc("/api/v1/humidites/{id:[0-9]+}", Editeur(Hapi(api.UpdateHumid))).Methods("PUT")
+	r.HandleFunc("/api/v1/humidites/{id:[0-9]+}", Editeur(Hapi(api.DeleteHumid))).Methods("DELETE")
+
+	r.HandleFunc("/api/v1/acteurs", Lecteur(Hapi(api.ListActeurs))).Methods("GET")
+	r.HandleFunc("/api/v1/acteurs", Editeur(Hapi(api.NewActeur))).Methods("POST")
+	r.HandleFunc("/api/v1/acteurs/{id:[0-9]+}", Lecteur(Hapi(api.GetActeur))).Methods("GET")
+	r.HandleFunc("/api/v1/acteurs/{id:[0-9]+}", Editeur(Hapi(api.UpdateActeur))).Methods("PUT")
+	r.HandleFunc("/api/v1/acteurs/{id:[0-9]+}", Editeur(Hapi(api.DeleteActeur))).Methods("DELETE")
+
+	r.HandleFunc("/login", H(control.Login))
+	r.HandleFunc("/logout", H(control.Logout))
+
+	r.HandleFunc("/utilisateur/liste", Admin(H(control.ListUtilisateurs)))
+	r.HandleFunc("/utilisateur/new", Admin(H(control.NewUtilisateur)))
+	r.HandleFunc("/utilisateur/update/{id:[0-9]+}", Admin(H(control.UpdateUtilisateur)))
+	r.HandleFunc("/utilisateur/delete/{id:[0-9]+}", Admin(H(control.DeleteUtilisateur)))
+
+	r.HandleFunc("/", Lecteur(H(control.Accueil)))
+	r.HandleFunc("/doc", Lecteur(H(control.ShowDoc)))
+	r.HandleFunc("/backup", Admin(H(control.BackupDB)))
+	r.HandleFunc("/sauvegardes", Admin(H(control.ListSauvegardes)))
+	r.HandleFunc("/coherence", Admin(H(control.ShowCoherence)))
+	r.HandleFunc("/maj-qgis", Editeur(H(control.MajQGis)))
+	r.HandleFunc("/bloc-notes/update", Editeur(H(control.UpdateBlocnotes)))
+	r.HandleFunc("/bloc-notes/update/{ok}", Editeur(H(control.UpdateBlocnotes)))
+
+	r.HandleFunc("/activite/recherche", Lecteur(H(control.SearchActivite)))
+	r.HandleFunc("/activite/recherche/export/{format:csv|xlsx}", Lecteur(HPDF(control.ExportSearchActivite))).Methods("POST")
+	r.HandleFunc("/activite/recherche/bilan-pdf", Lecteur(HPDF(control.PDFBilanActivites))).Methods("POST")
+	r.HandleFunc("/activite/recherche/{tab}", Lecteur(H(control.SearchActivite)))
+
+	r.HandleFunc("/carte", Lecteur(H(control.ShowCarte)))
+	r.HandleFunc("/carte/recherche", Lecteur(H(control.SearchCarte)))
+	r.HandleFunc("/carte/export/{couche:parcelles|ugs|chantiers}", Lecteur(HPDF(control.ExportCoucheCarte)))
+	r.HandleFunc("/carte/import", Admin(H(control.ImportCadastre)))
+
+	r.HandleFunc("/facture/vente-plaquette/{id:[0-9]+}", Lecteur(HPDF(control.ShowFactureVentePlaq)))
+	r.HandleFunc("/facture/autre/{id:[0-9]+}", Lecteur(HPDF(control.ShowFactureChautre)))
+	r.HandleFunc("/facture/liste", Lecteur(H(control.ListFactures)))
+	r.HandleFunc("/facture/liste/{annee:[0-9]+}", Lecteur(H(control.ListFactures)))
+	r.HandleFunc("/facture/{id:[0-9]+}", Lecteur(H(control.ShowFacture)))
+	r.HandleFunc("/facture/{id:[0-9]+}/pdf", Lecteur(HPDF(control.ShowFacturePDF)))
+	r.HandleFunc("/facture/emettre/vente-plaquette/{id:[0-9]+}", Editeur(H(control.EmettreFactureVentePlaq)))
+	r.HandleFunc("/facture/emettre/autre/{id:[0-9]+}", Editeur(H(control.EmettreFactureChautre)))
+	r.HandleFunc("/facture/{id:[0-9]+}/avoir", Editeur(H(control.NewAvoir))).Methods("POST")
+	r.HandleFunc("/facture/{id:[0-9]+}/paiement/new", Editeur(H(control.NewFacturePaiement))).Methods("POST")
+	r.HandleFunc("/facture/{id:[0-9]+}/paiement/delete/{id-paiement:[0-9]+}", Editeur(H(control.DeleteFacturePaiement)))
+
+	r.HandleFunc("/compta/export", Lecteur(H(control.ShowExportCompta)))
+	r.HandleFunc("/compta/export/fichier", Lecteur(HPDF(control.ExportComptaFichier)))
+
+	r.HandleFunc("/affacture/form/{id:[0-9]+}", Lecteur(H(control.FormAffacture)))
+	r.HandleFunc("/affacture/show", Lecteur(HPDF(control.ShowAffacture)))
+	r.HandleFunc("/affacture/new", Editeur(H(control.NewAffacture))).Methods("POST")
+	r.HandleFunc("/affacture/liste", Lecteur(H(control.ListAffactures)))
+	r.HandleFunc("/affacture/liste/{annee:[0-9]+}", Lecteur(H(control.ListAffactures)))
+	r.HandleFunc("/affacture/en-attente", Lecteur(H(control.ListAffacturesEnAttente)))
+	r.HandleFunc("/affacture/{id:[0-9]+}", Lecteur(H(control.ShowAffactureEnregistree)))
+	r.HandleFunc("/affacture/{id:[0-9]+}/pdf", Lecteur(HPDF(control.ShowAffacturePDF)))
+	r.HandleFunc("/affacture/delete/{id:[0-9]+}", Editeur(H(control.DeleteAffacture)))
+
+	r.HandleFunc("/acteur/liste", Lecteur(H(control.ListActeur)))
+	r.HandleFunc("/acteur/new", Editeur(H(control.NewActeur)))
+	r.HandleFunc("/acteur/update/{id:[0-9]+}", Editeur(H(control.UpdateActeur)))
+	r.HandleFunc("/acteur/delete/{id:[0-9]+}", Editeur(H(control.DeleteActeur)))
+	r.HandleFunc("/acteur/{id:[0-9]+}", Lecteur(H(control.ShowActeur)))
+	r.HandleFunc("/acteur/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriqueActeur)))
+
+	r.HandleFunc("/fermier/liste", Lecteur(H(control.ListFermier)))
+	r.HandleFunc("/fermier/{id:[0-9]+}", Lecteur(H(control.ShowFermier)))
+	r.HandleFunc("/sctl/import", Admin(H(control.FormImportSCTL)))
+	r.HandleFunc("/sctl/import/appliquer", Admin(H(control.ApplyImportSCTL)))
+
+	r.HandleFunc("/chantier/autre/liste", Lecteur(H(control.ListChautre)))
+	r.HandleFunc("/chantier/autre/liste/{annee:[0-9]+}", Lecteur(H(control.ListChautre)))
+	r.HandleFunc("/chantier/autre/new", Editeur(H(control.NewChautre)))
+	r.HandleFunc("/chantier/autre/{id:[0-9]+}", Lecteur(H(control.ShowChautre)))
+	r.HandleFunc("/chantier/autre/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriqueChautre)))
+	r.HandleFunc("/chantier/autre/update/{id:[0-9]+}", Editeur(H(control.UpdateChautre)))
+	r.HandleFunc("/chantier/autre/delete/{id:[0-9]+}", Editeur(H(control.DeleteChautre)))
+
+	r.HandleFunc("/chantier/chauffage-fermier/liste/{annee:[0-9]+}", Lecteur(H(control.ListChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/liste", Lecteur(H(control.ListChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/new", Editeur(H(control.NewChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/{id:[0-9]+}", Lecteur(H(control.ShowChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriqueChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/update/{id:[0-9]+}", Editeur(H(control.UpdateChaufer)))
+	r.HandleFunc("/chantier/chauffage-fermier/delete/{id:[0-9]+}", Editeur(H(control.DeleteChaufer)))
+
+	r.HandleFunc("/chantier/plaquette/liste", Lecteur(H(control.ListPlaq)))
+	r.HandleFunc("/chantier/plaquette/liste/{annee:[0-9]+}", Lecteur(H(control.ListPlaq)))
+	r.HandleFunc("/chantier/plaquette/liste/{annee:[0-9]+}/{format:csv|xlsx}", Lecteur(HPDF(control.ExportPlaqs)))
+	r.HandleFunc("/chantier/plaquette/new", Editeur(H(control.NewPlaq)))
+	r.HandleFunc("/chantier/plaquette/{id:[0-9]+}", Lecteur(H(control.ShowPlaq)))
+	r.HandleFunc("/chantier/plaquette/update/{id:[0-9]+}", Editeur(H(control.UpdatePlaq)))
+	r.HandleFunc("/chantier/plaquette/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriquePlaq)))
+	r.HandleFunc("/chantier/plaquette/{id:[0-9]+}/{tab}", Lecteur(H(control.ShowPlaq)))
+	r.HandleFunc("/chantier/plaquette/delete/{id:[0-9]+}", Editeur(H(control.DeletePlaq)))
+
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/new", Editeur(H(control.NewPlaqOp)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/update/{id-op:[0-9]+}", Editeur(H(control.UpdatePlaqOp)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/op/delete/{id-op:[0-9]+}", Editeur(H(control.DeletePlaqOp)))
+
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/new", Editeur(H(control.NewPlaqTrans)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/update/{id-pt:[0-9]+}", Editeur(H(control.UpdatePlaqTrans)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transport/delete/{id-pt:[0-9]+}", Editeur(H(control.DeletePlaqTrans)))
+
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/new", Editeur(H(control.NewPlaqRange)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/update/{id-pr:[0-9]+}", Editeur(H(control.UpdatePlaqRange)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/range/delete/{id-pr:[0-9]+}", Editeur(H(control.DeletePlaqRange)))
+
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transfert/new", Editeur(H(control.NewPlaqTransfert)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transfert/update/{id-pt:[0-9]+}", Editeur(H(control.UpdatePlaqTransfert)))
+	r.HandleFunc("/chantier/plaquette/{id-chantier:[0-9]+}/transfert/delete/{id-pt:[0-9]+}", Editeur(H(control.DeletePlaqTransfert)))
+
+	r.HandleFunc("/vente/recherche", Lecteur(H(control.SearchVente)))
+	r.HandleFunc("/vente/recherche/export/{format:csv|xlsx}", Lecteur(HPDF(control.ExportSearchVente))).Methods("POST")
+	r.HandleFunc("/vente/recherche/bilan-pdf", Lecteur(HPDF(control.PDFBilanVentes))).Methods("POST")
+	r.HandleFunc("/vente/liste", Lecteur(H(control.ListVentePlaq)))
+	r.HandleFunc("/vente/liste/{annee:[0-9]+}", Lecteur(H(control.ListVentePlaq)))
+	r.HandleFunc("/vente/liste/{annee:[0-9]+}/{format:csv|xlsx}", Lecteur(HPDF(control.ExportVentePlaqs)))
+	r.HandleFunc("/vente/tracabilite", Lecteur(H(control.TracabiliteVentePlaq)))
+	r.HandleFunc("/vente/tracabilite/{annee:[0-9]+}", Lecteur(H(control.TracabiliteVentePlaq)))
+	r.HandleFunc("/vente/{id-vente:[0-9]+}", Lecteur(H(control.ShowVentePlaq)))
+	r.HandleFunc("/vente/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriqueVentePlaq)))
+	r.HandleFunc("/vente/new", Editeur(H(control.NewVentePlaq)))
+	r.HandleFunc("/vente/update/{id-vente:[0-9]+}", Editeur(H(control.UpdateVentePlaq)))
+	r.HandleFunc("/vente/delete/{id-vente:[0-9]+}", Editeur(H(control.DeleteVentePlaq)))
+
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/new", Editeur(H(control.NewVenteLivre)))
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/update/{id-livraison:[0-9]+}", Editeur(H(control.UpdateVenteLivre)))
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/delete/{id-livraison:[0-9]+}", Editeur(H(control.DeleteVenteLivre)))
+
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/new", Editeur(H(control.NewVenteCharge)))
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/update/{id-chargement:[0-9]+}", Editeur(H(control.UpdateVenteCharge)))
+	r.HandleFunc("/vente/{id-vente:[0-9]+}/livraison/{id-livraison:[0-9]+}/chargement/delete/{id-chargement:[0-9]+}", Editeur(H(control.DeleteVenteCharge)))
+
+	r.HandleFunc("/stockage/liste", Lecteur(H(control.ListStockages)))
+	r.HandleFunc("/stockage/previsions", Lecteur(H(control.ShowPrevisionsStockages)))
+	r.HandleFunc("/stockage/new", Editeur(H(control.NewStockage)))
+	r.HandleFunc("/stockage/update/{id:[0-9]+}", Editeur(H(control.UpdateStockage)))
+	r.HandleFunc("/stockage/delete/{id:[0-9]+}", Editeur(H(control.DeleteOrArchiveStockage)))
+	r.HandleFunc("/stockage/{id:[0-9]+}/historique", Lecteur(H(control.ShowHistoriqueStockage)))
+	r.HandleFunc("/stockage/inventaires", Lecteur(H(control.ListInventaires)))
+	r.HandleFunc("/stockage/{id:[0-9]+}/inventaire/new", Editeur(H(control.NewInventaire)))
+	r.HandleFunc("/stockage/inventaire/delete/{id:[0-9]+}", Editeur(H(control.DeleteInventaire)))
+	r.HandleFunc("/stockage/valorisation", Lecteur(H(control.ShowValorisationStock)))
+	r.HandleFunc("/stockage/valorisation/{format:pdf|csv}", Lecteur(HPDF(control.ExportValorisationStock)))
+
+	r.HandleFunc("/tas-vides", Lecteur(H(control.ShowTasVides)))
+	r.HandleFunc("/tas/vider/{id:[0-9]+}/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}/{motif:[A-Z]{2}}", Editeur(H(control.SignalerTasVide)))
+	r.HandleFunc("/tas/rouvrir/{id:[0-9]+}", Editeur(H(control.RouvrirTas)))
+	r.HandleFunc("/tas/pertes", Lecteur(H(control.ShowPertesVidage)))
+
+	r.HandleFunc("/frais-stockage/new/{id-stockage:[0-9]+}", Editeur(H(control.NewStockFrais)))
+	r.HandleFunc("/frais-stockage/update/{id:[0-9]+}", Editeur(H(control.UpdateStockFrais)))
+	r.HandleFunc("/frais-stockage/delete/{id:[0-9]+}", Editeur(H(control.DeleteStockFrais)))
+
+	r.HandleFunc("/humidite/liste", Lecteur(H(control.ListHumid)))
+	r.HandleFunc("/humidite/sechage", Lecteur(H(control.ShowSechage)))
+	r.HandleFunc("/humidite/liste/{annee:[0-9]+}", Lecteur(H(control.ListHumid)))
+	r.HandleFunc("/humidite/liste/{annee:[0-9]+}/{format:csv|xlsx}", Lecteur(HPDF(control.ExportHumids)))
+	r.HandleFunc("/humidite/new", Editeur(H(control.NewHumid)))
+	r.HandleFunc("/humidite/new/tas/{id-tas:[0-9]+}", Editeur(H(control.NewHumid)))
+	r.HandleFunc("/humidite/update/{id:[0-9]+}", Editeur(H(control.UpdateHumid)))
+	r.HandleFunc("/humidite/delete/{id:[0-9]+}", Editeur(H(control.DeleteHumid)))
+
+	r.HandleFunc("/sylviculture/recherche", Lecteur(H(control.SearchSylvi)))
+	r.HandleFunc("/sylviculture/recherche/export/{format:csv|xlsx}", Lecteur(HPDF(control.ExportSearchSylvi))).Methods("POST")
+	r.HandleFunc("/sylviculture/recherche/{tab}", Lecteur(H(control.SearchSylvi))) ////// supprimer si finalement pas de tab
+
+	r.HandleFunc("/ug/liste", Lecteur(H(control.ListUGs)))
+	r.HandleFunc("/ug/{id:[0-9]+}", Lecteur(H(control.ShowUG)))
+	r.HandleFunc("/ug/{id:[0-9]+}/{tab}", Lecteur(H(control.ShowUG)))
+	r.HandleFunc("/commune/liste", Lecteur(H(control.ListCommunes)))
+	r.HandleFunc("/lieudit/{id:[0-9]+}", Lecteur(H(control.ShowLieudit)))
+	r.HandleFunc("/parcelle/{id:[0-9]+}", Lecteur(H(control.ShowParcelle)))
+
+	r.PathPrefix("/doc/").Handler(Lecteur(http.StripPrefix("/doc/", http.FileServer(http.Dir(filepath.Join("..", "doc")))).ServeHTTP))
 	r.HandleFunc("/dbdump/", notFound) // pour empêcher de lister le rep contenant les db dumps
-	r.PathPrefix("/dbdump/").Handler(http.StripPrefix("/dbdump/", http.FileServer(http.Dir(model.SERVER_ENV.BACKUP_DIR))))
+	r.PathPrefix("/dbdump/").Handler(Admin(http.StripPrefix("/dbdump/", http.FileServer(http.Dir(model.SERVER_ENV.BACKUP_DIR))).ServeHTTP))
 
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(static.StaticFiles))))
 	r.PathPrefix("/view/").Handler(http.StripPrefix("/view/", http.FileServer(http.FS(view.ViewFiles))))
@@ -190,12 +335,14 @@ func H(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func(htt
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
 		ctx := ctxt.NewContext()
+		ctx.Utilisateur = utilisateurFromRequest(r)
 		//
 		err = h(ctx, w, r) // Call controller h ; fills ctx.TemplateName
 		//
 		if ctx.Page != nil {
 			// ctx.Page == nil if contentTypeMiddleware was called
 			ctx.Page.RunMode = model.SERVER_ENV.RUN_MODE // "dev" or "prod", available in all pages
+			ctx.Page.Utilisateur = ctx.Utilisateur
 		}
 		//
 		if err != nil {
@@ -241,6 +388,7 @@ func Hajax(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
 		ctx := ctxt.NewContext()
+		ctx.Utilisateur = utilisateurFromRequest(r)
 		err = h(ctx, w, r) // Calls controller h
 		if err != nil {
 			ctxt.LogError(err)
@@ -248,6 +396,22 @@ func Hajax(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func
 	}
 }
 
+// *********************************************************
+// Hapi = Handler API
+// Same as Hajax, but errors are sent to the client as JSON (see api.EcrireErreur())
+// @param  h Controller function
+func Hapi(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx := ctxt.NewContext()
+		ctx.Utilisateur = utilisateurFromRequest(r)
+		err = h(ctx, w, r) // Calls controller h
+		if err != nil {
+			api.EcrireErreur(w, err)
+		}
+	}
+}
+
 // *********************************************************
 // HPDF = Handler PDF
 // Same as H, but for pdf (does not execute templates)
@@ -256,6 +420,7 @@ func HPDF(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func(
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
 		ctx := ctxt.NewContext()
+		ctx.Utilisateur = utilisateurFromRequest(r)
 		err = h(ctx, w, r) // Calls controller h
 		if err != nil {
 			ctxt.LogError(err)
@@ -263,6 +428,73 @@ func HPDF(h func(*ctxt.Context, http.ResponseWriter, *http.Request) error) func(
 	}
 }
 
+// *********************** Authentification **********************************
+
+// Clé utilisée pour transmettre l'utilisateur connecté dans le context de la requête
+type utilisateurKey struct{}
+
+// Lecteur, Editeur, Admin : restreignent l'accès d'une route aux utilisateurs ayant au moins le rôle correspondant
+// (voir model.UtilisateurRoleMap)
+func Lecteur(h http.HandlerFunc) http.HandlerFunc { return Auth("lecteur", h) }
+func Editeur(h http.HandlerFunc) http.HandlerFunc { return Auth("editeur", h) }
+func Admin(h http.HandlerFunc) http.HandlerFunc   { return Auth("admin", h) }
+
+// *********************************************************
+// Auth = vérifie que la requête provient d'un utilisateur connecté ayant au moins le rôle demandé.
+// Si pas connecté, redirige vers la page de connexion.
+// Si rôle insuffisant, affiche une page d'erreur.
+// Pour l'API (/api/), renvoie une erreur JSON (401 ou 403).
+// L'utilisateur est transmis à H, Hajax, HPDF via le context de la requête.
+func Auth(role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := ctxt.NewContext()
+		estAPI := strings.HasPrefix(r.URL.Path, "/api/")
+		u, err := control.GetUtilisateurFromRequest(ctx, r)
+		if err != nil {
+			if estAPI {
+				api.EcrireErreur(w, err)
+				return
+			}
+			showErrorPage(err, ctx, w, r)
+			return
+		}
+		if u == nil {
+			if estAPI {
+				api.EcrireErreur(w, &api.Erreur{Status: http.StatusUnauthorized, Message: "Non connecté"})
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, "/ajax/") {
+				http.Error(w, "Non connecté", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login?url="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		if !u.APermission(role) {
+			if estAPI {
+				api.EcrireErreur(w, &api.Erreur{
+					Status:  http.StatusForbidden,
+					Message: "Accès refusé : droits insuffisants (" + model.UtilisateurRoleMap[role] + ")",
+				})
+				return
+			}
+			ctx.Utilisateur = u
+			w.WriteHeader(http.StatusForbidden)
+			err = fmt.Errorf("Accès refusé : l'utilisateur <b>%s</b> n'a pas les droits nécessaires (%s)",
+				u.Login, model.UtilisateurRoleMap[role])
+			showErrorPage(err, ctx, w, r)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), utilisateurKey{}, u)))
+	}
+}
+
+// Renvoie l'utilisateur stocké dans le context de la requête par Auth(), ou nil
+func utilisateurFromRequest(r *http.Request) *model.Utilisateur {
+	u, _ := r.Context().Value(utilisateurKey{}).(*model.Utilisateur)
+	return u
+}
+
 // *********************** Gestion d'erreur **********************************
 // A mettre ailleurs, mais où ?
 
@@ -270,6 +502,7 @@ func notFound(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("NOT FOUND")
 	fmt.Printf("Request r = %+v\n", r)
 	ctx := ctxt.NewContext()
+	ctx.Utilisateur, _ = control.GetUtilisateurFromRequest(ctx, r)
 	err := fmt.Errorf("Page inexistante :<br><code><b>%s</b></code>", r.URL)
 	showErrorPage(err, ctx, w, r)
 }
@@ -290,7 +523,8 @@ func showErrorPage(theErr error, ctx *ctxt.Context, w http.ResponseWriter, r *ht
 			URL:     r.URL.String(),
 			Details: werr.SprintHTML(theErr),
 		},
-		RunMode: model.SERVER_ENV.RUN_MODE,
+		RunMode:     model.SERVER_ENV.RUN_MODE,
+		Utilisateur: ctx.Utilisateur,
 	}
 	tmpl := ctx.Template
 	err = tmpl.ExecuteTemplate(w, "header.html", ctx.Page)
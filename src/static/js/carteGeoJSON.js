@@ -0,0 +1,110 @@
+/******************************************************************************
+    Affiche une couche GeoJSON (polygones, coordonnées longitude / latitude) dans un élément svg.
+    Pas de fond de carte : seules les entités de la couche sont dessinées.
+    Zoom avec la molette, déplacement en faisant glisser la carte.
+    Ex :
+        afficherCarteGeoJSON(document.getElementById('carte'), geojson, {
+            classe: (feature) => 'parcelle',
+            titre: (feature) => feature.properties.code,
+            onclick: (feature) => {},
+        });
+    @param  svg     Elément svg dans lequel dessiner la carte.
+    @param  geojson FeatureCollection contenant des Polygon ou MultiPolygon.
+    @param  options Fonctions appelées pour chaque entité (toutes facultatives) :
+                    classe : classe css du path ; titre : infobulle ; onclick : clic sur l'entité.
+
+    @copyright  BDL, Bois du Larzac.
+    @licence    GPL, conformémént au fichier LICENCE situé à la racine du projet.
+    @history    2026-10-18 : Creation
+********************************************************************************/
+function afficherCarteGeoJSON(svg, geojson, options={}){
+    if(geojson.features.length == 0){
+        return;
+    }
+    const NS = 'http://www.w3.org/2000/svg';
+    // bbox en longitude / latitude
+    let lonMin = Infinity, lonMax = -Infinity, latMin = Infinity, latMax = -Infinity;
+    const polygonesDe = (geometry) => geometry.type == 'Polygon' ? [geometry.coordinates] : geometry.coordinates;
+    for(const feature of geojson.features){
+        for(const polygone of polygonesDe(feature.geometry)){
+            for(const anneau of polygone){
+                for(const [lon, lat] of anneau){
+                    lonMin = Math.min(lonMin, lon); lonMax = Math.max(lonMax, lon);
+                    latMin = Math.min(latMin, lat); latMax = Math.max(latMax, lat);
+                }
+            }
+        }
+    }
+    // projection équirectangulaire, suffisante à l'échelle de quelques communes
+    const cosLat = Math.cos((latMin + latMax) / 2 * Math.PI / 180);
+    const largeur = 1000;
+    const echelle = largeur / Math.max((lonMax - lonMin) * cosLat, 1e-9);
+    const hauteur = Math.max((latMax - latMin) * echelle, 1);
+    const x = (lon) => ((lon - lonMin) * cosLat * echelle).toFixed(2);
+    const y = (lat) => ((latMax - lat) * echelle).toFixed(2);
+    //
+    svg.innerHTML = '';
+    const groupe = document.createElementNS(NS, 'g');
+    svg.appendChild(groupe);
+    for(const feature of geojson.features){
+        let d = '';
+        for(const polygone of polygonesDe(feature.geometry)){
+            for(const anneau of polygone){
+                d += 'M' + anneau.map(([lon, lat]) => x(lon) + ' ' + y(lat)).join('L') + 'Z';
+            }
+        }
+        const path = document.createElementNS(NS, 'path');
+        path.setAttribute('d', d);
+        path.setAttribute('fill-rule', 'evenodd');
+        path.setAttribute('vector-effect', 'non-scaling-stroke');
+        if(options.classe){
+            path.setAttribute('class', options.classe(feature));
+        }
+        if(options.titre){
+            const title = document.createElementNS(NS, 'title');
+            title.textContent = options.titre(feature);
+            path.appendChild(title);
+        }
+        if(options.onclick){
+            path.addEventListener('click', () => options.onclick(feature));
+        }
+        groupe.appendChild(path);
+    }
+    //
+    // zoom et déplacement, en modifiant le viewBox
+    //
+    let vb = {x: 0, y: 0, w: largeur, h: hauteur};
+    const majViewBox = () => svg.setAttribute('viewBox', `${vb.x} ${vb.y} ${vb.w} ${vb.h}`);
+    majViewBox();
+    // coordonnées svg d'un événement souris
+    const pointSVG = (e) => {
+        const pt = svg.createSVGPoint();
+        pt.x = e.clientX;
+        pt.y = e.clientY;
+        return pt.matrixTransform(svg.getScreenCTM().inverse());
+    };
+    svg.addEventListener('wheel', (e) => {
+        e.preventDefault();
+        const p = pointSVG(e);
+        const facteur = e.deltaY < 0 ? 0.8 : 1.25;
+        vb = {
+            x: p.x - (p.x - vb.x) * facteur,
+            y: p.y - (p.y - vb.y) * facteur,
+            w: vb.w * facteur,
+            h: vb.h * facteur,
+        };
+        majViewBox();
+    });
+    let depart = null;
+    svg.addEventListener('mousedown', (e) => { depart = pointSVG(e); });
+    svg.addEventListener('mousemove', (e) => {
+        if(depart == null){
+            return;
+        }
+        const p = pointSVG(e);
+        vb.x -= p.x - depart.x;
+        vb.y -= p.y - depart.y;
+        majViewBox();
+    });
+    window.addEventListener('mouseup', () => { depart = null; });
+}